@@ -0,0 +1,29 @@
+package database
+
+import (
+	"github.com/nargesbyt/todo.go/entity"
+	"gorm.io/gorm"
+)
+
+// Migrate creates the tables of all entities and adds missing columns.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&entity.User{},
+		&entity.Task{},
+		&entity.Token{},
+		&entity.Webhook{},
+		&entity.WebhookDelivery{},
+		&entity.WebhookAttempt{},
+		&entity.Feed{},
+		&entity.CalendarObject{},
+		&entity.CalendarChange{},
+		&entity.ImportedTask{},
+		&entity.Digest{},
+		&entity.Role{},
+		&entity.Identity{},
+		&entity.SigningKey{},
+		&entity.RefreshToken{},
+		&entity.Client{},
+		&entity.Share{},
+	)
+}
@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// CalendarObject records the resource name and UID a CalDAV client chose
+// for a task it created, so the task is served back under them.
+type CalendarObject struct {
+	ID     int64  `gorm:"column:id;primaryKey"`
+	UserID int64  `gorm:"column:user_id;uniqueIndex:idx_calendar_objects_name"`
+	Name   string `gorm:"uniqueIndex:idx_calendar_objects_name"`
+	TaskID int64  `gorm:"column:task_id;uniqueIndex"`
+	UID    string
+}
+
+// CalendarChange records that a task was created, updated or deleted, for
+// incremental CalDAV sync. Name is the resource name of a deleted task,
+// which can no longer be looked up.
+type CalendarChange struct {
+	ID        int64 `gorm:"column:id;primaryKey"`
+	UserID    int64 `gorm:"column:user_id;index"`
+	TaskID    int64 `gorm:"column:task_id"`
+	Name      string
+	Deleted   int
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
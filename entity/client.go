@@ -0,0 +1,62 @@
+package entity
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Client is a third-party app registered to ask users for access through
+// the authorization code flow. Public clients, such as mobile apps, can not
+// keep a secret and have none; every client must use PKCE.
+type Client struct {
+	ID       int64  `gorm:"column:id;primaryKey"`
+	UserID   int64  `gorm:"column:user_id;index"`
+	ClientID string `gorm:"uniqueIndex"`
+	// SecretHash is the SHA-256 of the secret of confidential clients.
+	SecretHash string
+	Name       string
+	// RedirectURIs and Scopes are comma separated.
+	RedirectURIs string
+	Scopes       string
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	Version      int64     `gorm:"not null;default:1"`
+}
+
+// Confidential reports whether the client authenticates with a secret.
+func (c Client) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// HashSecret stores the hash of a client secret. Secrets are random and
+// long, so a plain hash is enough.
+func (c *Client) HashSecret(secret string) {
+	sum := sha256.Sum256([]byte(secret))
+	c.SecretHash = hex.EncodeToString(sum[:])
+}
+
+// VerifySecret reports whether secret is the secret of the client.
+func (c Client) VerifySecret(secret string) bool {
+	sum := sha256.Sum256([]byte(secret))
+	return c.Confidential() && subtle.ConstantTimeCompare([]byte(c.SecretHash), []byte(hex.EncodeToString(sum[:]))) == 1
+}
+
+// RedirectURIList returns the URIs the client may be redirected to.
+func (c Client) RedirectURIList() []string {
+	if c.RedirectURIs == "" {
+		return nil
+	}
+
+	return strings.Split(c.RedirectURIs, ",")
+}
+
+// ScopeList returns the scopes the client may ask for.
+func (c Client) ScopeList() []string {
+	if c.Scopes == "" {
+		return nil
+	}
+
+	return strings.Split(c.Scopes, ",")
+}
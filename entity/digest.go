@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// Digest holds the daily digest email settings of a user. SendAt is the
+// local time of day, HH:MM in TimeZone, and LastSentOn the local date of
+// the last digest sent. Digests are only sent to ConfirmedEmail, and only
+// while it is still the email of the user; PendingEmail is the address a
+// confirmation link with ConfirmToken was sent to.
+type Digest struct {
+	ID               int64 `gorm:"column:id;primaryKey"`
+	UserID           int64 `gorm:"column:user_id;uniqueIndex"`
+	Enabled          int
+	SendAt           string
+	TimeZone         string
+	UnsubscribeToken string `gorm:"uniqueIndex"`
+	ConfirmedEmail   string
+	PendingEmail     string
+	ConfirmToken     string `gorm:"index"`
+	LastSentOn       string
+	CreatedAt        time.Time `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time
+	Version          int64 `gorm:"not null;default:1"`
+}
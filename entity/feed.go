@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Feed is the secret calendar feed of a user. Only a hash of the secret in
+// the feed URL is stored.
+type Feed struct {
+	ID         int64     `gorm:"column:id;primaryKey"`
+	UserID     int64     `gorm:"column:user_id;uniqueIndex"`
+	SecretHash string    `gorm:"uniqueIndex"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	RotatedAt  time.Time
+}
+
+func HashFeedSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// Identity links the subject of an OIDC issuer to a local user.
+type Identity struct {
+	ID          int64  `gorm:"column:id;primaryKey"`
+	UserID      int64  `gorm:"column:user_id;index"`
+	Issuer      string `gorm:"uniqueIndex:idx_identities_issuer_subject"`
+	Subject     string `gorm:"uniqueIndex:idx_identities_issuer_subject"`
+	Email       string
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	LastLoginAt time.Time
+}
@@ -0,0 +1,10 @@
+package entity
+
+// ImportedTask links a task to the ID it had in the system it was imported
+// from, so importing the same record again does not duplicate it.
+type ImportedTask struct {
+	ID         int64  `gorm:"column:id;primaryKey"`
+	UserID     int64  `gorm:"column:user_id;uniqueIndex:idx_imported_tasks_external_id"`
+	ExternalID string `gorm:"uniqueIndex:idx_imported_tasks_external_id"`
+	TaskID     int64  `gorm:"column:task_id;index"`
+}
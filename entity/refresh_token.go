@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+const RefreshTokenPrefix = "todo_rt_"
+
+// RefreshToken can be used once to get a new access token and the next
+// refresh token of its family. Using it a second time means it leaked, and
+// revokes the whole family.
+type RefreshToken struct {
+	ID     int64 `gorm:"column:id;primaryKey"`
+	UserID int64 `gorm:"column:user_id;index"`
+	// ClientID is the client id of the third-party app the token was
+	// issued to, empty for our own clients.
+	ClientID  string `gorm:"index"`
+	FamilyID  string `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	// Scopes lists the permissions the tokens are limited to, like the
+	// scopes of a personal access token.
+	Scopes    string
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	RevokedAt sql.NullTime
+}
+
+// HashRefreshToken hashes a raw refresh token for storage. The tokens are
+// random and long, so a plain hash is enough.
+func HashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// ScopeList returns the scopes of the token, or nil if it is not limited.
+func (t RefreshToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+
+	return strings.Split(t.Scopes, ",")
+}
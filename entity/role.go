@@ -0,0 +1,94 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	PermissionTasksRead      = "tasks:read"
+	PermissionTasksWrite     = "tasks:write"
+	PermissionTokensManage   = "tokens:manage"
+	PermissionWebhooksManage = "webhooks:manage"
+	PermissionUsersAdmin     = "users:admin"
+	// PermissionProfile covers the account of the user. Every role grants
+	// it, so it only limits what a token can do.
+	PermissionProfile = "profile"
+)
+
+// Permissions lists every permission, in the order they are shown.
+var Permissions = []string{
+	PermissionTasksRead,
+	PermissionTasksWrite,
+	PermissionTokensManage,
+	PermissionWebhooksManage,
+	PermissionUsersAdmin,
+	PermissionProfile,
+}
+
+// Role is a named set of permissions. Users are assigned a role by name.
+type Role struct {
+	ID          int64  `gorm:"column:id;primaryKey"`
+	Name        string `gorm:"uniqueIndex"`
+	Description string
+	Permissions string
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+// PermissionList returns the permissions the role grants.
+func (r Role) PermissionList() []string {
+	if r.Permissions == "" {
+		return nil
+	}
+
+	return strings.Split(r.Permissions, ",")
+}
+
+// Granted returns the permissions the role grants, with "*" expanded.
+func (r Role) Granted() []string {
+	granted := []string{}
+	for _, p := range Permissions {
+		if r.Grants(p) {
+			granted = append(granted, p)
+		}
+	}
+
+	return granted
+}
+
+// Grants reports whether the role has a permission. A "*" permission
+// grants every permission.
+func (r Role) Grants(permission string) bool {
+	if permission == PermissionProfile {
+		return true
+	}
+	for _, p := range r.PermissionList() {
+		if p == "*" || p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DefaultRoles are created when missing at startup. Existing roles are
+// left as they are, so they can be changed in the database.
+func DefaultRoles() []Role {
+	return []Role{
+		{
+			Name:        RoleAdmin,
+			Description: "Everything, including managing users",
+			Permissions: "*",
+		},
+		{
+			Name:        RoleUser,
+			Description: "Manage own tasks, tokens and webhooks",
+			Permissions: strings.Join([]string{PermissionTasksRead, PermissionTasksWrite, PermissionTokensManage, PermissionWebhooksManage}, ","),
+		},
+		{
+			Name:        RoleViewer,
+			Description: "Read own tasks",
+			Permissions: PermissionTasksRead,
+		},
+	}
+}
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+// Share lets a user follow the board of a project of another user: its
+// tasks, their changes and who is viewing or editing them. Projects are
+// the +project tags of tasks and are stored in lower case.
+type Share struct {
+	ID        int64  `gorm:"column:id;primaryKey"`
+	OwnerID   int64  `gorm:"column:owner_id;uniqueIndex:idx_shares_project"`
+	Owner     User   `gorm:"foreignKey:OwnerID"`
+	Project   string `gorm:"uniqueIndex:idx_shares_project"`
+	UserID    int64  `gorm:"column:user_id;uniqueIndex:idx_shares_project;index"`
+	User      User
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
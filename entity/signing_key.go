@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// SigningKey is a key the access tokens we issue are signed with. The
+// newest key signs, older ones are kept to verify the tokens they signed
+// until those expire.
+type SigningKey struct {
+	ID        int64  `gorm:"column:id;primaryKey"`
+	KeyID     string `gorm:"uniqueIndex"`
+	Algorithm string
+	// PrivateKey is the PKCS #8 key, PEM encoded.
+	PrivateKey string
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/google/jsonapi"
+	"strings"
 	"time"
 )
 
@@ -21,12 +22,36 @@ func (t Task) JSONAPIRelationshipLinks(relation string) *jsonapi.Links {
 	return nil
 }
 
+// Task is a to-do of a user. Due is the date it is due, YYYY-MM-DD, and
+// Labels are +project and @context tags written like in todo.txt; both are
+// also read from the title, where users tend to type them. ParentID is
+// the task a checklist item belongs to.
 type Task struct {
 	ID         int64 `gorm:"column:id;primaryKey"`
 	Title      string
 	Status     string
 	CreatedAt  time.Time `gorm:"autoCreateTime"`
 	FinishedAt sql.NullTime
-	UserID     int64 `gorm:"column:user_id;foreignKey"`
-	User       User 
+	Due        string        `gorm:"not null;default:''"`
+	Priority   string        `gorm:"not null;default:''"`
+	Labels     string        `gorm:"not null;default:''"`
+	ParentID   sql.NullInt64 `gorm:"index"`
+	UserID     int64         `gorm:"column:user_id;foreignKey"`
+	User       User
+	Version    int64 `gorm:"not null;default:1"`
+}
+
+// FinishedStatuses are the statuses that mark a task as done.
+var FinishedStatuses = []string{"done", "completed", "finished"}
+
+// Finished reports whether status marks a task as done.
+func Finished(status string) bool {
+	status = strings.ToLower(strings.TrimSpace(status))
+	for _, s := range FinishedStatuses {
+		if status == s {
+			return true
+		}
+	}
+
+	return false
 }
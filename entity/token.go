@@ -1,25 +1,70 @@
 package entity
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"time"
 )
 
-const DefaultTokenCost = 14
+const (
+	DefaultTokenCost = 14
+	TokenPrefix      = "todo_pat_"
+)
 
 type Token struct {
-	ID        int64 `gorm:"column:id;primaryKey"`
-	UserID    int64 `gorm:"column:user_id;foreignKey"`
-	Title     string
-	Token     string
-	IssuedAt  time.Time `gorm:"autoCreateTime"`
+	ID     int64 `gorm:"column:id;primaryKey"`
+	UserID int64 `gorm:"column:user_id;foreignKey"`
+	Title  string
+	Token  string
+	// LookupID is the public part of tokens of the todo_pat_<id>_<secret>
+	// format, which identifies the token without hashing. Legacy tokens
+	// have none.
+	LookupID  sql.NullString `gorm:"uniqueIndex"`
+	IssuedAt  time.Time      `gorm:"autoCreateTime"`
 	Active    int
 	LastUsed  sql.NullTime
 	ExpiredAt sql.NullTime
-	User      User
+	// Scopes lists the permissions the token is limited to. Tokens made
+	// before scopes existed have none and are not limited.
+	Scopes  string
+	User    User
+	Version int64 `gorm:"not null;default:1"`
+}
+
+// ParseToken splits a token of the todo_pat_<id>_<secret> format. It
+// returns false for legacy tokens, which have no lookup id.
+func ParseToken(raw string) (lookupID string, secret string, ok bool) {
+	if !strings.HasPrefix(raw, TokenPrefix) {
+		return "", "", false
+	}
+
+	return strings.Cut(strings.TrimPrefix(raw, TokenPrefix), "_")
+}
+
+// HashSecret stores the keyed hash of the secret of a token. Unlike the
+// bcrypt hash of legacy tokens it is fast to verify; the secret is random
+// enough that a slow hash adds nothing.
+func (t *Token) HashSecret(key []byte, secret string) {
+	t.Token = hashSecret(key, secret)
+}
+
+// VerifySecret compares a secret with the keyed hash in constant time.
+func (t *Token) VerifySecret(key []byte, secret string) bool {
+	return hmac.Equal([]byte(t.Token), []byte(hashSecret(key, secret)))
 }
 
+func hashSecret(key []byte, secret string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(secret))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HashToken stores the bcrypt hash of a legacy token.
 func (t *Token) HashToken() error {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(t.Token), DefaultTokenCost)
 	if err != nil {
@@ -39,3 +84,17 @@ func (t *Token) VerifyToken(rawToken string) error {
 
 	return nil
 }
+
+// ScopeList returns the scopes of the token, or nil when it is not limited.
+func (t Token) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+
+	return strings.Split(t.Scopes, ",")
+}
+
+// Usable reports whether the token is active and not expired.
+func (t Token) Usable(now time.Time) bool {
+	return t.Active != 0 && !(t.ExpiredAt.Valid && t.ExpiredAt.Time.Before(now))
+}
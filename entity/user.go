@@ -5,6 +5,12 @@ import (
 	"time"
 )
 
+const (
+	RoleUser   = "user"
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+)
+
 type User struct {
 	ID        int64  `gorm:"column:id;primaryKey"`
 	Email     string ` gorm:"unique"`
@@ -13,6 +19,8 @@ type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Tasks     []Task
+	Role      string `gorm:"not null;default:user"`
+	Version   int64  `gorm:"not null;default:1"`
 }
 
 func (user *User) HashPassword() error {
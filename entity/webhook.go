@@ -0,0 +1,74 @@
+package entity
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook posts events to a URL. A global webhook is set up by an admin for
+// the whole organization and receives the events of every user.
+type Webhook struct {
+	ID        int64 `gorm:"column:id;primaryKey"`
+	UserID    int64 `gorm:"column:user_id;foreignKey"`
+	URL       string
+	Events    string
+	Secret    string
+	Active    int
+	Global    int       `gorm:"not null;default:0"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	Version   int64     `gorm:"not null;default:1"`
+}
+
+// EventTypes returns the event types the webhook is subscribed to.
+func (w Webhook) EventTypes() []string {
+	if w.Events == "" {
+		return nil
+	}
+
+	return strings.Split(w.Events, ",")
+}
+
+// Subscribed reports whether events of eventType are delivered to the
+// webhook. A "*" subscription matches every event type.
+func (w Webhook) Subscribed(eventType string) bool {
+	for _, t := range w.EventTypes() {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+type WebhookDelivery struct {
+	ID            int64 `gorm:"column:id;primaryKey"`
+	WebhookID     int64 `gorm:"column:webhook_id;index"`
+	Event         string
+	Payload       []byte
+	Status        string `gorm:"index"`
+	Attempts      int
+	ResponseCode  int
+	LastError     string
+	NextAttemptAt time.Time `gorm:"index"`
+	DeliveredAt   sql.NullTime
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	Webhook       Webhook
+	AttemptLog    []WebhookAttempt `gorm:"foreignKey:DeliveryID"`
+}
+
+type WebhookAttempt struct {
+	ID           int64 `gorm:"column:id;primaryKey"`
+	DeliveryID   int64 `gorm:"column:delivery_id;index"`
+	Number       int
+	ResponseCode int
+	Error        string
+	Duration     time.Duration
+	AttemptedAt  time.Time
+}
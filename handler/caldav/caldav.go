@@ -0,0 +1,763 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/ical"
+	"github.com/nargesbyt/todo.go/internal/transfer"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	Prefix = "/dav"
+
+	nsDAV            = "DAV:"
+	nsCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarServer = "http://calendarserver.org/ns/"
+
+	principalPath = Prefix + "/principals/me/"
+	homePath      = Prefix + "/calendars/"
+	inboxName     = "tasks"
+	syncTokenBase = "http://todo.go/ns/sync/"
+
+	objectContentType = "text/calendar; charset=utf-8; component=vtodo"
+	maxObjectSize     = 1 << 20
+)
+
+var prefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCalendarServer: "cs"}
+
+// CalDAV exposes the projects of each user as VTODO calendar collections:
+// the tasks tagged +home are served at /dav/calendars/+home/, and the tasks
+// without a project at /dav/calendars/tasks/. Tasks created through the
+// API are served as task-<id>.ics; tasks created by a CalDAV client keep
+// the name and UID the client chose. Sync tokens point into the changes
+// SyncLog records.
+type CalDAV struct {
+	TasksRepository   repository.Tasks
+	ObjectsRepository repository.CalendarObjects
+	ChangesRepository repository.CalendarChanges
+}
+
+// object is a task as a resource of the collection.
+type object struct {
+	name string
+	uid  string
+	task entity.Task
+}
+
+func (o object) href(coll collection) string {
+	return coll.path() + o.name
+}
+
+// collection is a calendar of the tasks of a project, or of the tasks
+// without one when project is empty.
+type collection struct {
+	name    string
+	project string
+}
+
+func (coll collection) path() string {
+	return homePath + coll.name + "/"
+}
+
+func (coll collection) displayName() string {
+	if coll.project == "" {
+		return "Tasks"
+	}
+
+	return coll.name
+}
+
+// contains reports whether a task belongs to the collection.
+func (coll collection) contains(task entity.Task) bool {
+	keys := projectKeys(task)
+	if coll.project == "" {
+		return len(keys) == 0
+	}
+	for _, key := range keys {
+		if key == coll.project {
+			return true
+		}
+	}
+
+	return false
+}
+
+// projectKeys returns the keys of the projects of a task. Projects whose
+// key holds a slash cannot be named in a path, so such tasks are served as
+// tasks without a project.
+func projectKeys(task entity.Task) []string {
+	var keys []string
+	for _, project := range transfer.TaskTags(task).Projects {
+		if key := transfer.ProjectKey(project); key != "" && !strings.Contains(key, "/") {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// collectionNamed returns the collection a path segment names: tasks, or
+// a project key after a plus sign.
+func collectionNamed(segment string) (collection, bool) {
+	if segment == inboxName {
+		return collection{name: inboxName}, true
+	}
+	if len(segment) > 1 && segment[0] == '+' && transfer.ProjectKey(segment) == segment[1:] {
+		return collection{name: segment, project: segment[1:]}, true
+	}
+
+	return collection{}, false
+}
+
+// collections returns the collection of the tasks without a project
+// followed by one per project, by key.
+func collections(objects []object) []collection {
+	seen := map[string]bool{}
+	var keys []string
+	for _, o := range objects {
+		for _, key := range projectKeys(o.task) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	colls := []collection{{name: inboxName}}
+	for _, key := range keys {
+		colls = append(colls, collection{name: "+" + key, project: key})
+	}
+
+	return colls
+}
+
+// splitPath splits a path below /calendars/ into a collection and the name
+// of an object in it, which is empty for the collection itself.
+func splitPath(path string) (collection, string, bool) {
+	rest := strings.TrimPrefix(path, "/calendars/")
+	if rest == path {
+		return collection{}, "", false
+	}
+	segment, name, _ := strings.Cut(rest, "/")
+	coll, ok := collectionNamed(segment)
+
+	return coll, name, ok
+}
+
+// members returns the objects that belong to a collection.
+func members(objects []object, coll collection) []object {
+	var in []object
+	for _, o := range objects {
+		if coll.contains(o.task) {
+			in = append(in, o)
+		}
+	}
+
+	return in
+}
+
+// WellKnown redirects service discovery to the DAV root.
+func (d CalDAV) WellKnown(c *gin.Context) {
+	c.Redirect(http.StatusMovedPermanently, Prefix+"/")
+}
+
+// Serve dispatches a request below /dav by method.
+func (d CalDAV) Serve(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodOptions:
+		c.Header("DAV", "1, 3, calendar-access")
+		c.Header("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		c.Status(http.StatusOK)
+	case "PROPFIND":
+		d.propfind(c)
+	case "REPORT":
+		d.report(c)
+	case http.MethodGet, http.MethodHead:
+		d.get(c)
+	case http.MethodPut:
+		d.put(c)
+	case http.MethodDelete:
+		d.delete(c)
+	default:
+		c.AbortWithStatus(http.StatusMethodNotAllowed)
+	}
+}
+
+func (d CalDAV) propfind(c *gin.Context) {
+	var req struct {
+		AllProp *struct{} `xml:"DAV: allprop"`
+		Prop    propNames `xml:"DAV: prop"`
+	}
+	if !decodeXML(c, &req) {
+		return
+	}
+	names := req.Prop.Names
+	if req.AllProp != nil {
+		names = nil
+	}
+
+	userId, _ := c.Get("userId")
+	depth := c.GetHeader("Depth")
+	ms := &multistatus{}
+	path := strings.TrimSuffix(c.Param("path"), "/")
+	coll, name, isCalendar := splitPath(path)
+	switch {
+	case path == "":
+		ms.add(Prefix+"/", rootProps(), names)
+	case path == "/principals/me":
+		ms.add(principalPath, principalProps(), names)
+	case path == "/calendars":
+		ms.add(homePath, homeProps(), names)
+		if depth != "0" {
+			token, ok := d.syncToken(c, userId.(int64))
+			if !ok {
+				return
+			}
+			objects, ok := d.objects(c, userId.(int64))
+			if !ok {
+				return
+			}
+			for _, coll := range collections(objects) {
+				ms.add(coll.path(), collectionProps(coll, token), names)
+			}
+		}
+	case isCalendar && name == "":
+		token, ok := d.syncToken(c, userId.(int64))
+		if !ok {
+			return
+		}
+		objects, ok := d.objects(c, userId.(int64))
+		if !ok {
+			return
+		}
+		ms.add(coll.path(), collectionProps(coll, token), names)
+		if depth != "0" {
+			for _, o := range members(objects, coll) {
+				ms.add(o.href(coll), objectProps(o, false), names)
+			}
+		}
+	default:
+		coll, o, ok := d.resolve(c, userId.(int64))
+		if !ok {
+			return
+		}
+		ms.add(o.href(coll), objectProps(o, false), names)
+	}
+
+	ms.write(c)
+}
+
+func (d CalDAV) report(c *gin.Context) {
+	coll, name, ok := splitPath(strings.TrimSuffix(c.Param("path"), "/"))
+	if !ok || name != "" {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		XMLName   xml.Name
+		Prop      propNames `xml:"DAV: prop"`
+		Hrefs     []string  `xml:"DAV: href"`
+		SyncToken *string   `xml:"DAV: sync-token"`
+		Filter    struct {
+			Comps []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+		} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	}
+	if !decodeXML(c, &req) {
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	if req.XMLName == (xml.Name{Space: nsDAV, Local: "sync-collection"}) {
+		d.syncCollection(c, userId.(int64), coll, req.SyncToken, req.Prop.Names)
+		return
+	}
+	objects, ok := d.objects(c, userId.(int64))
+	if !ok {
+		return
+	}
+	objects = members(objects, coll)
+
+	ms := &multistatus{}
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		if matchesTodos(req.Filter.Comps) {
+			for _, o := range objects {
+				ms.add(o.href(coll), objectProps(o, true), req.Prop.Names)
+			}
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		byHref := map[string]object{}
+		for _, o := range objects {
+			byHref[o.href(coll)] = o
+		}
+		for _, href := range req.Hrefs {
+			if o, ok := byHref[href]; ok {
+				ms.add(href, objectProps(o, true), req.Prop.Names)
+			} else {
+				ms.notFound(href)
+			}
+		}
+	default:
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	ms.write(c)
+}
+
+// syncCollection answers a sync-collection report, see RFC 6578. Without a
+// token it lists every object of the collection; with one, the objects
+// changed since and the names of those deleted or moved to another
+// collection since.
+func (d CalDAV) syncCollection(c *gin.Context, userId int64, coll collection, token *string, names []xml.Name) {
+	// The token is read first, so a change made meanwhile is sent again
+	// next time rather than missed.
+	latest, ok := d.syncToken(c, userId)
+	if !ok {
+		return
+	}
+	objects, ok := d.objects(c, userId)
+	if !ok {
+		return
+	}
+
+	ms := &multistatus{syncToken: formatSyncToken(latest)}
+	if token == nil || *token == "" {
+		for _, o := range members(objects, coll) {
+			ms.add(o.href(coll), objectProps(o, false), names)
+		}
+		ms.write(c)
+		return
+	}
+
+	since, ok := parseSyncToken(*token)
+	if !ok || since > latest {
+		abortInvalidSyncToken(c)
+		return
+	}
+	changes, err := d.ChangesRepository.Since(userId, since)
+	if err == repository.ErrSyncTokenExpired {
+		abortInvalidSyncToken(c)
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch calendar changes from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	byTask := map[int64]object{}
+	for _, o := range objects {
+		byTask[o.task.ID] = o
+	}
+	// The last change of a task decides how it is reported.
+	last := map[int64]*entity.CalendarChange{}
+	var order []int64
+	for _, change := range changes {
+		if change.ID > latest {
+			continue
+		}
+		if _, seen := last[change.TaskID]; !seen {
+			order = append(order, change.TaskID)
+		}
+		last[change.TaskID] = change
+	}
+	for _, taskId := range order {
+		o, ok := byTask[taskId]
+		if ok && coll.contains(o.task) {
+			ms.add(o.href(coll), objectProps(o, false), names)
+			continue
+		}
+		name := last[taskId].Name
+		if ok {
+			name = o.name
+		} else if name == "" {
+			name = defaultName(taskId)
+		}
+		ms.notFound(coll.path() + name)
+	}
+
+	ms.write(c)
+}
+
+func abortInvalidSyncToken(c *gin.Context) {
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+	c.String(http.StatusForbidden, xml.Header+`<d:error xmlns:d="DAV:"><d:valid-sync-token/></d:error>`)
+	c.Abort()
+}
+
+func (d CalDAV) get(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	_, o, ok := d.resolve(c, userId.(int64))
+	if !ok {
+		return
+	}
+
+	c.Header("ETag", handler.ETag(o.task.Version))
+	if handler.NotModified(c, o.task.Version) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, objectContentType, calendarData(o))
+}
+
+func (d CalDAV) put(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	coll, name, ok := splitPath(c.Param("path"))
+	if !ok || name == "" || strings.Contains(name, "/") || !strings.HasSuffix(name, ".ics") {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	todo, err := ical.ParseTodo(io.LimitReader(c.Request.Body, maxObjectSize))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	// The object may be in another collection, when a client moves it
+	// here. It is then updated as if it were created.
+	o, err := d.lookup(userId.(int64), name)
+	if err != nil && err != repository.ErrTaskNotFound {
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+	exists := err == nil && coll.contains(o.task)
+
+	if !exists {
+		if c.GetHeader("If-Match") != "" {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
+	} else if c.GetHeader("If-None-Match") == "*" {
+		handler.AbortWithPreconditionFailed(c)
+		return
+	}
+
+	if err == repository.ErrTaskNotFound {
+		if isDefaultName(name) {
+			c.AbortWithStatusJSON(http.StatusForbidden, handler.NewProblem(http.StatusForbidden, "names like task-<id>.ics are reserved"))
+			return
+		}
+		if todo.Summary == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "SUMMARY is required"))
+			return
+		}
+		task := entity.Task{
+			Title:    todo.Summary,
+			Status:   ical.TaskStatus(todo.Status, ""),
+			Due:      todo.Due,
+			Priority: ical.TaskPriority(todo.Priority, ""),
+			UserID:   userId.(int64),
+		}
+		task.Labels = coll.labels(todo, task, false)
+		task, err = d.TasksRepository.CreateFromCalendar(task, name, todo.UID)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg("unable to create task from calendar object")
+			c.AbortWithStatus(http.StatusInternalServerError)
+
+			return
+		}
+		c.Header("ETag", handler.ETag(task.Version))
+		c.Status(http.StatusCreated)
+
+		return
+	}
+
+	var version int64
+	if exists {
+		if version, ok = handler.IfMatch(c, o.task.Version); !ok {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
+	}
+	task := o.task
+	if todo.Summary != "" {
+		task.Title = todo.Summary
+	}
+	task.Status = ical.TaskStatus(todo.Status, o.task.Status)
+	task.Due = todo.Due
+	task.Priority = ical.TaskPriority(todo.Priority, transfer.TaskTags(o.task).Priority)
+	task.Labels = coll.labels(todo, task, !exists)
+	task, err = d.TasksRepository.UpdateFields(task, version)
+	if err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+	c.Header("ETag", handler.ETag(task.Version))
+	if exists {
+		c.Status(http.StatusNoContent)
+	} else {
+		c.Status(http.StatusCreated)
+	}
+}
+
+// labels returns the labels of a task written to the collection: the
+// categories the client sent, or the labels the task has when it sent
+// none. A task moved here from another collection leaves its projects
+// behind. The project of the collection is added when the task is not
+// tagged with it, so the task stays where the client put it.
+func (coll collection) labels(todo ical.Todo, task entity.Task, moved bool) string {
+	var labels []string
+	if todo.Categories == nil {
+		labels = strings.Fields(task.Labels)
+	}
+	for _, category := range todo.Categories {
+		label := strings.Join(strings.Fields(category), "_")
+		if len(label) < 2 || (label[0] != '+' && label[0] != '@') {
+			label = "@" + label
+		}
+		labels = append(labels, label)
+	}
+	if moved || coll.project == "" {
+		kept := labels[:0]
+		for _, label := range labels {
+			if !strings.HasPrefix(label, "+") {
+				kept = append(kept, label)
+			}
+		}
+		labels = kept
+	}
+
+	task.Labels = strings.Join(labels, " ")
+	if coll.project != "" && !coll.contains(task) {
+		labels = append(labels, "+"+coll.project)
+	}
+
+	return strings.Join(labels, " ")
+}
+
+func (d CalDAV) delete(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	_, o, ok := d.resolve(c, userId.(int64))
+	if !ok {
+		return
+	}
+
+	version, ok := handler.IfMatch(c, o.task.Version)
+	if !ok {
+		handler.AbortWithPreconditionFailed(c)
+		return
+	}
+	if err := d.TasksRepository.Delete(o.task.ID, version); err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+	if err := d.ObjectsRepository.DeleteByTask(o.task.ID); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to delete calendar object")
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// syncToken returns the id of the last change of the tasks of the user,
+// aborting the request on error.
+func (d CalDAV) syncToken(c *gin.Context, userId int64) (int64, bool) {
+	latest, err := d.ChangesRepository.Latest(userId)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch calendar changes from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return 0, false
+	}
+
+	return latest, true
+}
+
+// objects returns every task of the user as a calendar object, whatever
+// its collection, aborting the request on error.
+func (d CalDAV) objects(c *gin.Context, userId int64) ([]object, bool) {
+	tasks, err := repository.FindAll(d.TasksRepository, "", "", userId)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch tasks from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return nil, false
+	}
+	mapped, err := d.ObjectsRepository.List(userId)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch calendar objects from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return nil, false
+	}
+
+	byTask := map[int64]*entity.CalendarObject{}
+	for _, m := range mapped {
+		byTask[m.TaskID] = m
+	}
+	objects := make([]object, 0, len(tasks))
+	for _, task := range tasks {
+		objects = append(objects, objectOf(*task, byTask[task.ID]))
+	}
+
+	return objects, true
+}
+
+// resolve finds the object named by the path, aborting the request with
+// 404 when the collection holds no such object of the user.
+func (d CalDAV) resolve(c *gin.Context, userId int64) (collection, object, bool) {
+	coll, name, ok := splitPath(c.Param("path"))
+	if !ok || name == "" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return coll, object{}, false
+	}
+
+	o, err := d.lookup(userId, name)
+	if err == nil && !coll.contains(o.task) {
+		err = repository.ErrTaskNotFound
+	}
+	if err != nil {
+		if err == repository.ErrTaskNotFound {
+			c.AbortWithStatus(http.StatusNotFound)
+			return coll, o, false
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return coll, o, false
+	}
+
+	return coll, o, true
+}
+
+func (d CalDAV) lookup(userId int64, name string) (object, error) {
+	var mapping *entity.CalendarObject
+	m, err := d.ObjectsRepository.GetByName(userId, name)
+	switch err {
+	case nil:
+		mapping = &m
+	case repository.ErrCalendarObjectNotFound:
+	default:
+		return object{}, err
+	}
+
+	var id int64
+	if mapping != nil {
+		id = mapping.TaskID
+	} else if id = defaultID(name); id == 0 {
+		return object{}, repository.ErrTaskNotFound
+	}
+
+	task, err := d.TasksRepository.Get(id)
+	if err != nil {
+		return object{}, err
+	}
+	if task.UserID != userId {
+		return object{}, repository.ErrTaskNotFound
+	}
+
+	return objectOf(task, mapping), nil
+}
+
+func objectOf(task entity.Task, mapping *entity.CalendarObject) object {
+	if mapping != nil && mapping.UID != "" {
+		return object{name: mapping.Name, uid: mapping.UID, task: task}
+	}
+	if mapping != nil {
+		return object{name: mapping.Name, uid: ical.UID(task), task: task}
+	}
+
+	return object{name: defaultName(task.ID), uid: ical.UID(task), task: task}
+}
+
+func calendarData(o object) []byte {
+	var buf bytes.Buffer
+	w := ical.NewWriter(&buf)
+	// Due dates and priorities may also be tagged in titles.
+	task := o.task
+	tags := transfer.TaskTags(task)
+	task.Due, task.Priority = tags.Due, tags.Priority
+	w.Begin("Tasks")
+	w.Todo(task, o.uid, time.Now())
+	if err := w.End(); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to encode calendar object")
+	}
+
+	return buf.Bytes()
+}
+
+type compFilter struct {
+	Name  string       `xml:"name,attr"`
+	Comps []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// matchesTodos reports whether a calendar-query filter can match VTODO
+// components, the only kind the collection holds.
+func matchesTodos(filters []compFilter) bool {
+	for _, calendar := range filters {
+		for _, comp := range calendar.Comps {
+			if !strings.EqualFold(comp.Name, "VTODO") {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+type propNames struct {
+	Names []xml.Name
+}
+
+func (p *propNames) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			p.Names = append(p.Names, t.Name)
+			if err := dec.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// decodeXML decodes a request body, treating an empty one as a request for
+// all properties. It aborts the request on malformed XML.
+func decodeXML(c *gin.Context, v interface{}) bool {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxObjectSize))
+	if err == nil && len(bytes.TrimSpace(body)) == 0 {
+		return true
+	}
+	if err == nil {
+		err = xml.Unmarshal(body, v)
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "malformed XML request body"))
+		return false
+	}
+
+	return true
+}
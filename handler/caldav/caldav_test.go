@@ -0,0 +1,462 @@
+package caldav
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTasks keeps tasks in memory, and calendar objects created with them
+// in objects.
+type fakeTasks struct {
+	tasks   map[int64]*entity.Task
+	nextID  int64
+	objects *fakeObjects
+}
+
+func (f *fakeTasks) Create(title string, userId int64) (entity.Task, error) {
+	f.nextID++
+	task := entity.Task{ID: f.nextID, Title: title, Status: "pending", UserID: userId, CreatedAt: time.Now(), Version: 1}
+	f.tasks[task.ID] = &task
+
+	return task, nil
+}
+
+func (f *fakeTasks) CreateImported(task entity.Task, externalId string) (entity.Task, error) {
+	f.nextID++
+	task.ID, task.CreatedAt, task.Version = f.nextID, time.Now(), 1
+	f.tasks[task.ID] = &task
+
+	return task, nil
+}
+
+func (f *fakeTasks) CreateFromCalendar(task entity.Task, name string, uid string) (entity.Task, error) {
+	task, _ = f.CreateImported(task, "")
+	_, err := f.objects.Create(task.UserID, name, task.ID, uid)
+
+	return task, err
+}
+
+func (f *fakeTasks) Get(id int64) (entity.Task, error) {
+	task, ok := f.tasks[id]
+	if !ok {
+		return entity.Task{}, repository.ErrTaskNotFound
+	}
+
+	return *task, nil
+}
+
+func (f *fakeTasks) Find(title string, status string, userId int64, page repository.Page) ([]*entity.Task, repository.PageInfo, error) {
+	var found []*entity.Task
+	for _, task := range f.tasks {
+		if task.UserID == userId {
+			t := *task
+			found = append(found, &t)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+
+	return found, repository.PageInfo{Total: int64(len(found))}, nil
+}
+
+func (f *fakeTasks) Update(id int64, title string, status string, version int64) (entity.Task, error) {
+	task, ok := f.tasks[id]
+	if !ok {
+		return entity.Task{}, repository.ErrTaskNotFound
+	}
+	if version != 0 && version != task.Version {
+		return *task, repository.ErrVersionConflict
+	}
+	task.Title, task.Status = title, status
+	task.Version++
+
+	return *task, nil
+}
+
+func (f *fakeTasks) UpdateFields(task entity.Task, version int64) (entity.Task, error) {
+	stored, ok := f.tasks[task.ID]
+	if !ok {
+		return entity.Task{}, repository.ErrTaskNotFound
+	}
+	if version != 0 && version != stored.Version {
+		return *stored, repository.ErrVersionConflict
+	}
+	task.Version = stored.Version + 1
+	*stored = task
+
+	return task, nil
+}
+
+func (f *fakeTasks) Delete(id int64, version int64) error {
+	task, ok := f.tasks[id]
+	if !ok {
+		return repository.ErrTaskNotFound
+	}
+	if version != 0 && version != task.Version {
+		return repository.ErrVersionConflict
+	}
+	delete(f.tasks, id)
+
+	return nil
+}
+
+func (f *fakeTasks) Stats(userId int64, since time.Time, now time.Time) (repository.TaskStats, error) {
+	return repository.TaskStats{}, nil
+}
+
+// fakeObjects keeps calendar objects in memory and, like the repository,
+// replaces the mapping of a name or a task on create.
+type fakeObjects struct {
+	objects []entity.CalendarObject
+}
+
+func (f *fakeObjects) Create(userId int64, name string, taskId int64, uid string) (entity.CalendarObject, error) {
+	kept := f.objects[:0]
+	for _, o := range f.objects {
+		if !(o.UserID == userId && o.Name == name) && o.TaskID != taskId {
+			kept = append(kept, o)
+		}
+	}
+	object := entity.CalendarObject{ID: int64(len(kept) + 1), UserID: userId, Name: name, TaskID: taskId, UID: uid}
+	f.objects = append(kept, object)
+
+	return object, nil
+}
+
+func (f *fakeObjects) GetByName(userId int64, name string) (entity.CalendarObject, error) {
+	for _, o := range f.objects {
+		if o.UserID == userId && o.Name == name {
+			return o, nil
+		}
+	}
+
+	return entity.CalendarObject{}, repository.ErrCalendarObjectNotFound
+}
+
+func (f *fakeObjects) GetByTask(taskId int64) (entity.CalendarObject, error) {
+	for _, o := range f.objects {
+		if o.TaskID == taskId {
+			return o, nil
+		}
+	}
+
+	return entity.CalendarObject{}, repository.ErrCalendarObjectNotFound
+}
+
+func (f *fakeObjects) List(userId int64) ([]*entity.CalendarObject, error) {
+	var list []*entity.CalendarObject
+	for i := range f.objects {
+		if f.objects[i].UserID == userId {
+			list = append(list, &f.objects[i])
+		}
+	}
+
+	return list, nil
+}
+
+func (f *fakeObjects) DeleteByTask(taskId int64) error {
+	kept := f.objects[:0]
+	for _, o := range f.objects {
+		if o.TaskID != taskId {
+			kept = append(kept, o)
+		}
+	}
+	f.objects = kept
+
+	return nil
+}
+
+// fakeChanges keeps the change log in memory.
+type fakeChanges struct {
+	changes []entity.CalendarChange
+}
+
+func (f *fakeChanges) Record(change entity.CalendarChange) (entity.CalendarChange, error) {
+	change.ID = int64(len(f.changes) + 1)
+	f.changes = append(f.changes, change)
+
+	return change, nil
+}
+
+func (f *fakeChanges) Since(userId int64, since int64) ([]*entity.CalendarChange, error) {
+	var changes []*entity.CalendarChange
+	for i := range f.changes {
+		if f.changes[i].UserID == userId && f.changes[i].ID > since {
+			changes = append(changes, &f.changes[i])
+		}
+	}
+
+	return changes, nil
+}
+
+func (f *fakeChanges) Latest(userId int64) (int64, error) {
+	var latest int64
+	for _, change := range f.changes {
+		if change.UserID == userId {
+			latest = change.ID
+		}
+	}
+
+	return latest, nil
+}
+
+func (f *fakeChanges) Prune(before time.Time) error {
+	return nil
+}
+
+type fixture struct {
+	tasks   *fakeTasks
+	objects *fakeObjects
+	changes *fakeChanges
+	// repo publishes writes to the sync log, like the server does.
+	repo   repository.Tasks
+	router *gin.Engine
+}
+
+func setup() *fixture {
+	gin.SetMode(gin.TestMode)
+	f := &fixture{
+		objects: &fakeObjects{},
+		changes: &fakeChanges{},
+	}
+	f.tasks = &fakeTasks{tasks: map[int64]*entity.Task{}, objects: f.objects}
+	f.repo = repository.NewPublishingTasks(f.tasks, SyncLog{ObjectsRepository: f.objects, ChangesRepository: f.changes})
+	d := CalDAV{TasksRepository: f.repo, ObjectsRepository: f.objects, ChangesRepository: f.changes}
+
+	f.router = gin.New()
+	f.router.Any(Prefix+"/*path", func(c *gin.Context) { c.Set("userId", int64(1)) }, d.Serve)
+	for _, method := range []string{"PROPFIND", "REPORT"} {
+		f.router.Handle(method, Prefix+"/*path", func(c *gin.Context) { c.Set("userId", int64(1)) }, d.Serve)
+	}
+
+	return f
+}
+
+func (f *fixture) do(method string, path string, body string, header map[string]string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(method, Prefix+path, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	f.router.ServeHTTP(resp, req)
+
+	return resp
+}
+
+const todo = "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:abc\r\nSUMMARY:Call mom\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+
+func syncReport(token string) string {
+	return `<?xml version="1.0"?><d:sync-collection xmlns:d="DAV:"><d:sync-token>` + token +
+		`</d:sync-token><d:prop><d:getetag/></d:prop></d:sync-collection>`
+}
+
+func TestPutCreatesTask(t *testing.T) {
+	f := setup()
+
+	resp := f.do(http.MethodPut, "/calendars/tasks/abc.ics", todo, map[string]string{"If-None-Match": "*"})
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	task, err := f.tasks.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, "Call mom", task.Title)
+	mapping, err := f.objects.GetByName(1, "abc.ics")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", mapping.UID)
+
+	resp = f.do(http.MethodGet, "/calendars/tasks/abc.ics", "", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "UID:abc\r\n")
+}
+
+func TestPutUpdatesTask(t *testing.T) {
+	f := setup()
+	task, err := f.repo.Create("Call mom", 1)
+	require.NoError(t, err)
+
+	body := strings.Replace(todo, "SUMMARY:Call mom", "SUMMARY:Call dad\r\nSTATUS:COMPLETED", 1)
+	resp := f.do(http.MethodPut, "/calendars/tasks/task-1.ics", body, map[string]string{"If-Match": `"1"`})
+	require.Equal(t, http.StatusNoContent, resp.Code)
+
+	task, err = f.tasks.Get(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Call dad", task.Title)
+	assert.Equal(t, "done", task.Status)
+
+	resp = f.do(http.MethodPut, "/calendars/tasks/task-1.ics", body, map[string]string{"If-Match": `"1"`})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+}
+
+func TestPutReusesNameOfTaskDeletedElsewhere(t *testing.T) {
+	f := setup()
+	require.Equal(t, http.StatusCreated, f.do(http.MethodPut, "/calendars/tasks/abc.ics", todo, nil).Code)
+
+	// Deleted through the REST API rather than CalDAV.
+	require.NoError(t, f.repo.Delete(1, 0))
+	_, err := f.objects.GetByName(1, "abc.ics")
+	assert.Equal(t, repository.ErrCalendarObjectNotFound, err)
+
+	resp := f.do(http.MethodPut, "/calendars/tasks/abc.ics", todo, map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusCreated, resp.Code)
+}
+
+func TestDelete(t *testing.T) {
+	f := setup()
+	require.Equal(t, http.StatusCreated, f.do(http.MethodPut, "/calendars/tasks/abc.ics", todo, nil).Code)
+
+	resp := f.do(http.MethodDelete, "/calendars/tasks/abc.ics", "", map[string]string{"If-Match": `"2"`})
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+
+	resp = f.do(http.MethodDelete, "/calendars/tasks/abc.ics", "", map[string]string{"If-Match": `"1"`})
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Empty(t, f.tasks.tasks)
+	assert.Equal(t, http.StatusNotFound, f.do(http.MethodGet, "/calendars/tasks/abc.ics", "", nil).Code)
+}
+
+func TestSyncCollection(t *testing.T) {
+	f := setup()
+	first, _ := f.repo.Create("First", 1)
+	second, _ := f.repo.Create("Second", 1)
+	_, _ = f.repo.Create("Other user", 2)
+
+	resp := f.do("REPORT", "/calendars/tasks/", syncReport(""), nil)
+	require.Equal(t, http.StatusMultiStatus, resp.Code)
+	assert.Contains(t, resp.Body.String(), "task-1.ics")
+	assert.Contains(t, resp.Body.String(), "task-2.ics")
+	assert.NotContains(t, resp.Body.String(), "task-3.ics")
+	assert.Contains(t, resp.Body.String(), "<d:sync-token>"+formatSyncToken(2)+"</d:sync-token>")
+
+	t.Run("NoChanges", func(t *testing.T) {
+		resp := f.do("REPORT", "/calendars/tasks/", syncReport(formatSyncToken(2)), nil)
+		require.Equal(t, http.StatusMultiStatus, resp.Code)
+		assert.NotContains(t, resp.Body.String(), "<d:response>")
+	})
+
+	_, err := f.repo.Update(first.ID, "First, updated", "pending", 0)
+	require.NoError(t, err)
+	require.NoError(t, f.repo.Delete(second.ID, 0))
+
+	t.Run("Changes", func(t *testing.T) {
+		resp := f.do("REPORT", "/calendars/tasks/", syncReport(formatSyncToken(2)), nil)
+		require.Equal(t, http.StatusMultiStatus, resp.Code)
+		body := resp.Body.String()
+		assert.Contains(t, body, `<d:response><d:href>/dav/calendars/tasks/task-1.ics</d:href><d:propstat><d:prop><d:getetag>&#34;2&#34;</d:getetag>`)
+		assert.Contains(t, body, `<d:response><d:href>/dav/calendars/tasks/task-2.ics</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>`)
+		assert.Contains(t, body, "<d:sync-token>"+formatSyncToken(5)+"</d:sync-token>")
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		resp := f.do("REPORT", "/calendars/tasks/", syncReport("http://todo.go/ns/sync/99"), nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		assert.Contains(t, resp.Body.String(), "valid-sync-token")
+	})
+}
+
+func TestPropfindCollection(t *testing.T) {
+	f := setup()
+	_, _ = f.repo.Create("First", 1)
+
+	resp := f.do("PROPFIND", "/calendars/tasks/", `<?xml version="1.0"?><d:propfind xmlns:d="DAV:"><d:prop><d:sync-token/><d:getetag/></d:prop></d:propfind>`, map[string]string{"Depth": "1"})
+	require.Equal(t, http.StatusMultiStatus, resp.Code)
+	assert.Contains(t, resp.Body.String(), "<d:sync-token>"+formatSyncToken(1)+"</d:sync-token>")
+	assert.Contains(t, resp.Body.String(), "/dav/calendars/tasks/task-1.ics")
+}
+
+func TestPutStoresDuePriorityAndCategories(t *testing.T) {
+	f := setup()
+	task, err := f.repo.Create("Call mom due:2023-05-01", 1)
+	require.NoError(t, err)
+
+	resp := f.do(http.MethodGet, "/calendars/tasks/task-1.ics", "", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "DUE;VALUE=DATE:20230501\r\n")
+
+	body := strings.Replace(todo, "SUMMARY:Call mom", "SUMMARY:Call mom\r\nDUE;TZID=Europe/Berlin:20230601T090000\r\nPRIORITY:1\r\nCATEGORIES:@phone,Family", 1)
+	resp = f.do(http.MethodPut, "/calendars/tasks/task-1.ics", body, map[string]string{"If-Match": `"1"`})
+	require.Equal(t, http.StatusNoContent, resp.Code)
+
+	task, err = f.tasks.Get(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "2023-06-01", task.Due)
+	assert.Equal(t, "A", task.Priority)
+	assert.Equal(t, "@phone @Family", task.Labels)
+
+	resp = f.do(http.MethodGet, "/calendars/tasks/task-1.ics", "", nil)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "DUE;VALUE=DATE:20230601\r\n")
+	assert.Contains(t, resp.Body.String(), "PRIORITY:1\r\n")
+	assert.Contains(t, resp.Body.String(), "CATEGORIES:@phone,@Family\r\n")
+
+	// A client that knows no categories keeps the labels.
+	resp = f.do(http.MethodPut, "/calendars/tasks/task-1.ics", todo, nil)
+	require.Equal(t, http.StatusNoContent, resp.Code)
+	task, err = f.tasks.Get(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "", task.Due)
+	assert.Equal(t, "", task.Priority)
+	assert.Equal(t, "@phone @Family", task.Labels)
+}
+
+func TestProjectCollections(t *testing.T) {
+	f := setup()
+	_, _ = f.repo.Create("Paint the fence +Home", 1)
+	_, _ = f.repo.Create("Call mom", 1)
+	_, _ = f.repo.CreateImported(entity.Task{Title: "Write report", Labels: "+work @office", UserID: 1}, "")
+
+	propfind := `<?xml version="1.0"?><d:propfind xmlns:d="DAV:"><d:prop><d:displayname/></d:prop></d:propfind>`
+	resp := f.do("PROPFIND", "/calendars/", propfind, map[string]string{"Depth": "1"})
+	require.Equal(t, http.StatusMultiStatus, resp.Code)
+	body := resp.Body.String()
+	assert.Contains(t, body, "<d:href>/dav/calendars/tasks/</d:href><d:propstat><d:prop><d:displayname>Tasks</d:displayname>")
+	assert.Contains(t, body, "<d:href>/dav/calendars/+home/</d:href><d:propstat><d:prop><d:displayname>+home</d:displayname>")
+	assert.Contains(t, body, "<d:href>/dav/calendars/+work/</d:href>")
+
+	resp = f.do("REPORT", "/calendars/+home/", syncReport(""), nil)
+	require.Equal(t, http.StatusMultiStatus, resp.Code)
+	assert.Contains(t, resp.Body.String(), "/dav/calendars/+home/task-1.ics")
+	assert.NotContains(t, resp.Body.String(), "task-2.ics")
+	assert.NotContains(t, resp.Body.String(), "task-3.ics")
+
+	resp = f.do("REPORT", "/calendars/tasks/", syncReport(""), nil)
+	require.Equal(t, http.StatusMultiStatus, resp.Code)
+	assert.Contains(t, resp.Body.String(), "/dav/calendars/tasks/task-2.ics")
+	assert.NotContains(t, resp.Body.String(), "task-1.ics")
+
+	assert.Equal(t, http.StatusNotFound, f.do(http.MethodGet, "/calendars/+work/task-1.ics", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, f.do("PROPFIND", "/calendars/+Home/", "", nil).Code)
+
+	t.Run("Create", func(t *testing.T) {
+		resp := f.do(http.MethodPut, "/calendars/+work/abc.ics", todo, map[string]string{"If-None-Match": "*"})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		task, err := f.tasks.Get(4)
+		require.NoError(t, err)
+		assert.Equal(t, "+work", task.Labels)
+	})
+
+	t.Run("Move", func(t *testing.T) {
+		// Clients move an object by creating it in the other collection.
+		body := strings.Replace(todo, "SUMMARY:Call mom", "SUMMARY:Write report\r\nCATEGORIES:+work,@office", 1)
+		resp := f.do(http.MethodPut, "/calendars/+home/task-3.ics", body, map[string]string{"If-None-Match": "*"})
+		require.Equal(t, http.StatusCreated, resp.Code)
+		task, err := f.tasks.Get(3)
+		require.NoError(t, err)
+		assert.Equal(t, "@office +home", task.Labels)
+		assert.Equal(t, http.StatusNotFound, f.do(http.MethodDelete, "/calendars/+work/task-3.ics", "", nil).Code)
+	})
+}
+
+func TestPutRejectsReservedNames(t *testing.T) {
+	f := setup()
+
+	resp := f.do(http.MethodPut, "/calendars/tasks/task-7.ics", todo, map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Empty(t, f.tasks.tasks)
+}
@@ -0,0 +1,191 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/handler"
+)
+
+// props maps property names to their XML content.
+type props map[xml.Name]string
+
+func dav(local string) xml.Name       { return xml.Name{Space: nsDAV, Local: local} }
+func caldav(local string) xml.Name    { return xml.Name{Space: nsCalDAV, Local: local} }
+func calserver(local string) xml.Name { return xml.Name{Space: nsCalendarServer, Local: local} }
+
+func href(path string) string {
+	return "<d:href>" + escape(path) + "</d:href>"
+}
+
+func rootProps() props {
+	return props{
+		dav("resourcetype"):           "<d:collection/>",
+		dav("current-user-principal"): href(principalPath),
+	}
+}
+
+func principalProps() props {
+	return props{
+		dav("resourcetype"):                 "<d:principal/>",
+		dav("displayname"):                  "me",
+		dav("current-user-principal"):       href(principalPath),
+		dav("principal-URL"):                href(principalPath),
+		caldav("calendar-home-set"):         href(homePath),
+		caldav("calendar-user-address-set"): "",
+	}
+}
+
+func homeProps() props {
+	return props{
+		dav("resourcetype"):           "<d:collection/>",
+		dav("current-user-principal"): href(principalPath),
+	}
+}
+
+func collectionProps(coll collection, latest int64) props {
+	token := formatSyncToken(latest)
+
+	return props{
+		dav("resourcetype"):                        "<d:collection/><c:calendar/>",
+		dav("displayname"):                         escape(coll.displayName()),
+		dav("current-user-principal"):              href(principalPath),
+		dav("owner"):                               href(principalPath),
+		dav("sync-token"):                          escape(token),
+		calserver("getctag"):                       escape(token),
+		caldav("supported-calendar-component-set"): `<c:comp name="VTODO"/>`,
+		dav("current-user-privilege-set"): "<d:privilege><d:read/></d:privilege>" +
+			"<d:privilege><d:write/></d:privilege>" +
+			"<d:privilege><d:write-content/></d:privilege>" +
+			"<d:privilege><d:bind/></d:privilege>" +
+			"<d:privilege><d:unbind/></d:privilege>",
+		dav("supported-report-set"): "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><d:sync-collection/></d:report></d:supported-report>",
+	}
+}
+
+// objectProps returns the properties of a calendar object. calendar-data
+// is only returned by reports, never by PROPFIND.
+func objectProps(o object, withData bool) props {
+	p := props{
+		dav("resourcetype"):   "",
+		dav("getetag"):        escape(handler.ETag(o.task.Version)),
+		dav("getcontenttype"): escape(objectContentType),
+	}
+	if withData {
+		p[caldav("calendar-data")] = escape(string(calendarData(o)))
+	}
+
+	return p
+}
+
+type response struct {
+	href    string
+	found   []string
+	missing []string
+	status  int
+}
+
+type multistatus struct {
+	responses []response
+	syncToken string
+}
+
+// add adds a response for a resource with the requested properties, or
+// all but calendar-data when names is empty.
+func (m *multistatus) add(path string, p props, names []xml.Name) {
+	r := response{href: path}
+	if len(names) == 0 {
+		for name := range p {
+			if name == caldav("calendar-data") {
+				continue
+			}
+			names = append(names, name)
+		}
+		sortNames(names)
+	}
+	for _, name := range names {
+		if value, ok := p[name]; ok {
+			r.found = append(r.found, element(name, value))
+		} else {
+			r.missing = append(r.missing, element(name, ""))
+		}
+	}
+	m.responses = append(m.responses, r)
+}
+
+func (m *multistatus) notFound(path string) {
+	m.responses = append(m.responses, response{href: path, status: http.StatusNotFound})
+}
+
+func (m *multistatus) write(c *gin.Context) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+	for _, r := range m.responses {
+		b.WriteString("<d:response>" + href(r.href))
+		if r.status != 0 {
+			b.WriteString(status(r.status))
+		}
+		if len(r.found) > 0 {
+			b.WriteString("<d:propstat><d:prop>" + strings.Join(r.found, "") + "</d:prop>" + status(http.StatusOK) + "</d:propstat>")
+		}
+		if len(r.missing) > 0 {
+			b.WriteString("<d:propstat><d:prop>" + strings.Join(r.missing, "") + "</d:prop>" + status(http.StatusNotFound) + "</d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	if m.syncToken != "" {
+		b.WriteString("<d:sync-token>" + escape(m.syncToken) + "</d:sync-token>")
+	}
+	b.WriteString("</d:multistatus>")
+
+	c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", b.Bytes())
+}
+
+func status(code int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", code, http.StatusText(code))
+}
+
+// element renders a property, declaring its namespace inline when it has
+// no prefix on the multistatus element.
+func element(name xml.Name, value string) string {
+	prefix, ok := prefixes[name.Space]
+	open := prefix + ":" + name.Local
+	decl := ""
+	if name.Space == "" {
+		open = name.Local
+	} else if !ok {
+		open = "x:" + name.Local
+		decl = ` xmlns:x="` + escape(name.Space) + `"`
+	}
+	if value == "" {
+		return "<" + open + decl + "/>"
+	}
+
+	return "<" + open + decl + ">" + value + "</" + open + ">"
+}
+
+func escape(s string) string {
+	var b bytes.Buffer
+	if err := xml.EscapeText(&b, []byte(s)); err != nil {
+		return ""
+	}
+
+	return b.String()
+}
+
+func sortNames(names []xml.Name) {
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Space != names[j].Space {
+			return names[i].Space < names[j].Space
+		}
+		return names[i].Local < names[j].Local
+	})
+}
@@ -0,0 +1,99 @@
+package caldav
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/event"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+// SyncLog is notified of every task write, wherever it came from. It
+// records the change for sync-collection reports and drops the resource
+// name of a deleted task, so a client can reuse it.
+type SyncLog struct {
+	ObjectsRepository repository.CalendarObjects
+	ChangesRepository repository.CalendarChanges
+	// Retention is how long changes are kept. A client that has not synced
+	// for longer syncs from scratch.
+	Retention time.Duration
+}
+
+func (s SyncLog) Publish(e event.Event) error {
+	change := entity.CalendarChange{UserID: e.UserID, TaskID: e.TaskID}
+	if e.Type == event.TaskDeleted {
+		change.Deleted = 1
+		change.Name = defaultName(e.TaskID)
+		mapping, err := s.ObjectsRepository.GetByTask(e.TaskID)
+		switch err {
+		case nil:
+			change.Name = mapping.Name
+		case repository.ErrCalendarObjectNotFound:
+		default:
+			return err
+		}
+		if err := s.ObjectsRepository.DeleteByTask(e.TaskID); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.ChangesRepository.Record(change)
+
+	return err
+}
+
+// Run prunes changes older than Retention every interval until ctx is
+// done.
+func (s SyncLog) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.ChangesRepository.Prune(time.Now().Add(-s.Retention)); err != nil {
+				log.Error().Stack().Err(err).Msg("unable to prune calendar changes")
+			}
+		}
+	}
+}
+
+func defaultName(taskId int64) string {
+	return fmt.Sprintf("task-%d.ics", taskId)
+}
+
+// defaultID returns the id of the task a default name stands for, or 0.
+func defaultID(name string) int64 {
+	var id int64
+	if _, err := fmt.Sscanf(name, "task-%d.ics", &id); err != nil || id <= 0 || defaultName(id) != name {
+		return 0
+	}
+
+	return id
+}
+
+// isDefaultName reports whether name is reserved for tasks created
+// through the API.
+func isDefaultName(name string) bool {
+	return defaultID(name) != 0
+}
+
+func formatSyncToken(id int64) string {
+	return syncTokenBase + strconv.FormatInt(id, 10)
+}
+
+func parseSyncToken(token string) (int64, bool) {
+	if !strings.HasPrefix(token, syncTokenBase) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(token, syncTokenBase), 10, 64)
+
+	return id, err == nil && id >= 0
+}
@@ -0,0 +1,516 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/event"
+	"github.com/nargesbyt/todo.go/internal/random"
+	"github.com/nargesbyt/todo.go/internal/transfer"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	presenceChannel   = "collab:presence"
+	presenceKeyPrefix = "collab:presence:"
+
+	PresenceViewing = "viewing"
+	PresenceEditing = "editing"
+	PresenceLeft    = "left"
+
+	pingInterval = 30 * time.Second
+	writeTimeout = 10 * time.Second
+	sendBuffer   = 64
+)
+
+var errNotShared = errors.New("the board is not shared with you")
+
+// Message is exchanged in both directions over the WebSocket connection.
+type Message struct {
+	Type     string            `json:"type"`
+	View     *View             `json:"view,omitempty"`
+	Board    string            `json:"board,omitempty"`
+	TaskID   int64             `json:"task_id,omitempty"`
+	State    string            `json:"state,omitempty"`
+	ClientID string            `json:"client_id,omitempty"`
+	UserID   int64             `json:"user_id,omitempty"`
+	Changes  map[string]Change `json:"changes,omitempty"`
+	Task     *TaskSnapshot     `json:"task,omitempty"`
+	Tasks    []*TaskSnapshot   `json:"tasks,omitempty"`
+	Presence []Message         `json:"presence,omitempty"`
+	Detail   string            `json:"detail,omitempty"`
+	At       time.Time         `json:"at,omitempty"`
+}
+
+// View selects the tasks of a board a client is looking at: the tasks of
+// OwnerID tagged +Project, or all of them without a project. Users see the
+// boards of their own projects and of those shared with them; OwnerID
+// defaults to the authenticated user.
+type View struct {
+	OwnerID int64  `json:"owner_id,omitempty"`
+	Project string `json:"project,omitempty"`
+	Status  string `json:"status,omitempty"`
+}
+
+// board identifies the board of a view, which its clients share presence
+// on regardless of their status filter.
+func (v View) board() string {
+	return fmt.Sprintf("%d:%s", v.OwnerID, v.Project)
+}
+
+// Change is the old and new value of a task field.
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type TaskSnapshot struct {
+	ID         int64      `json:"id"`
+	Title      string     `json:"title"`
+	Status     string     `json:"status"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Version    int64      `json:"version"`
+}
+
+type client struct {
+	id     string
+	userID int64
+	conn   *websocket.Conn
+	send   chan []byte
+	// unfollow stops the events of the board being followed. It is only
+	// used by the reading goroutine.
+	unfollow func()
+
+	mu   sync.Mutex
+	view *View
+}
+
+// Collab serves a WebSocket channel where clients subscribe to a view of
+// a board, receive live diffs of its tasks and share presence with the
+// other users on the board.
+type Collab struct {
+	Broker           *event.Broker
+	RedisClient      *redis.Client
+	TasksRepository  repository.Tasks
+	SharesRepository repository.Shares
+
+	upgrader websocket.Upgrader
+	mu       sync.Mutex
+	clients  map[*client]bool
+}
+
+func NewCollab(broker *event.Broker, redisClient *redis.Client, tasks repository.Tasks, shares repository.Shares) *Collab {
+	return &Collab{
+		Broker:           broker,
+		RedisClient:      redisClient,
+		TasksRepository:  tasks,
+		SharesRepository: shares,
+		clients:          map[*client]bool{},
+	}
+}
+
+// Run relays presence messages published by any instance to local clients
+// until ctx is done.
+func (h *Collab) Run(ctx context.Context) {
+	pubsub := h.RedisClient.Subscribe(ctx, presenceChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var m Message
+		if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+			log.Error().Stack().Err(err).Msg("unable to decode presence message")
+			continue
+		}
+
+		h.mu.Lock()
+		for cl := range h.clients {
+			if cl.id != m.ClientID && cl.board() == m.Board {
+				cl.deliver([]byte(msg.Payload))
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Connect upgrades an authenticated request to a WebSocket connection.
+func (h *Collab) Connect(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to upgrade to websocket")
+		return
+	}
+
+	cl := &client{
+		id:     random.Token(16),
+		userID: userId.(int64),
+		conn:   conn,
+		send:   make(chan []byte, sendBuffer),
+	}
+	h.mu.Lock()
+	h.clients[cl] = true
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go h.write(cl, done)
+	h.read(cl)
+
+	close(done)
+	h.unsubscribe(cl)
+	h.mu.Lock()
+	delete(h.clients, cl)
+	h.mu.Unlock()
+	conn.Close()
+}
+
+func (h *Collab) read(cl *client) {
+	cl.conn.SetReadLimit(4096)
+	cl.conn.SetReadDeadline(time.Now().Add(2 * pingInterval))
+	cl.conn.SetPongHandler(func(string) error {
+		return cl.conn.SetReadDeadline(time.Now().Add(2 * pingInterval))
+	})
+
+	for {
+		var m Message
+		if err := cl.conn.ReadJSON(&m); err != nil {
+			return
+		}
+
+		switch m.Type {
+		case "subscribe":
+			view := View{}
+			if m.View != nil {
+				view = *m.View
+			}
+			h.subscribe(cl, view)
+		case "unsubscribe":
+			h.unsubscribe(cl)
+		case "presence":
+			if m.State != PresenceViewing && m.State != PresenceEditing && m.State != PresenceLeft {
+				h.sendJSON(cl, Message{Type: "error", Detail: "unknown presence state"})
+				continue
+			}
+			if cl.board() == "" {
+				h.sendJSON(cl, Message{Type: "error", Detail: "subscribe to a board first"})
+				continue
+			}
+			h.announce(cl, m.TaskID, m.State)
+		default:
+			h.sendJSON(cl, Message{Type: "error", Detail: "unknown message type"})
+		}
+	}
+}
+
+// subscribe switches a client to a view after checking that the board is
+// the user's own or shared with them, and answers with the tasks and
+// presence on the board.
+func (h *Collab) subscribe(cl *client, view View) {
+	if view.OwnerID == 0 {
+		view.OwnerID = cl.userID
+	}
+	view.Project = transfer.ProjectKey(view.Project)
+	if view.OwnerID != cl.userID {
+		if view.Project == "" {
+			h.sendJSON(cl, Message{Type: "error", Detail: errNotShared.Error()})
+			return
+		}
+		_, err := h.SharesRepository.Get(view.OwnerID, view.Project, cl.userID)
+		if err == repository.ErrShareNotFound {
+			h.sendJSON(cl, Message{Type: "error", Detail: errNotShared.Error()})
+			return
+		}
+		if err != nil {
+			log.Error().Stack().Err(err).Msg("unable to load share")
+			h.sendJSON(cl, Message{Type: "error", Detail: "unable to subscribe"})
+			return
+		}
+	}
+
+	tasks, err := repository.FindAll(h.TasksRepository, "", view.Status, view.OwnerID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to load board")
+		h.sendJSON(cl, Message{Type: "error", Detail: "unable to subscribe"})
+		return
+	}
+	if view.Project != "" {
+		tasks = transfer.WithProject(tasks, view.Project)
+	}
+	snapshots := []*TaskSnapshot{}
+	for _, task := range tasks {
+		snapshots = append(snapshots, snapshotOf(task))
+	}
+
+	if cl.board() != view.board() {
+		h.unsubscribe(cl)
+	} else if cl.unfollow != nil {
+		cl.unfollow()
+	}
+	cl.mu.Lock()
+	cl.view = &view
+	cl.mu.Unlock()
+	h.follow(cl, view.OwnerID)
+
+	h.sendJSON(cl, Message{Type: "subscribed", ClientID: cl.id, View: &view, Board: view.board(), Tasks: snapshots, Presence: h.snapshot(cl)})
+}
+
+// unsubscribe stops the events of the board of a client and removes its
+// presence.
+func (h *Collab) unsubscribe(cl *client) {
+	if cl.unfollow != nil {
+		cl.unfollow()
+		cl.unfollow = nil
+	}
+	if cl.board() != "" {
+		h.leave(cl)
+	}
+	cl.mu.Lock()
+	cl.view = nil
+	cl.mu.Unlock()
+}
+
+// follow sends a client the diffs of the tasks of ownerID in its view.
+func (h *Collab) follow(cl *client, ownerID int64) {
+	events, unsubscribe := h.Broker.Subscribe(ownerID)
+	stop := make(chan struct{})
+	cl.unfollow = func() {
+		close(stop)
+		unsubscribe()
+	}
+
+	go func() {
+		for {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					select {
+					case <-stop:
+					default:
+						// The broker dropped a client that could not keep
+						// up; it has to reconnect.
+						cl.conn.Close()
+					}
+					return
+				}
+				if m, ok := diff(cl.currentView(), ev); ok {
+					h.sendJSON(cl, m)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (h *Collab) write(cl *client, done <-chan struct{}) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case payload := <-cl.send:
+			cl.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := cl.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				cl.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			cl.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := cl.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				cl.conn.Close()
+				return
+			}
+			h.refresh(cl)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (h *Collab) sendJSON(cl *client, m Message) {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to encode message")
+		return
+	}
+	cl.deliver(payload)
+}
+
+func (cl *client) deliver(payload []byte) {
+	select {
+	case cl.send <- payload:
+	default:
+		// A client that can not keep up is disconnected and has to
+		// resubscribe.
+		cl.conn.Close()
+	}
+}
+
+// currentView returns a copy of the view of a client, or nil.
+func (cl *client) currentView() *View {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.view == nil {
+		return nil
+	}
+	view := *cl.view
+
+	return &view
+}
+
+// board returns the board of a client, or an empty string when it is not
+// subscribed.
+func (cl *client) board() string {
+	if view := cl.currentView(); view != nil {
+		return view.board()
+	}
+
+	return ""
+}
+
+// sees reports whether task is part of view.
+func sees(view *View, task *entity.Task) bool {
+	if view == nil || task == nil {
+		return false
+	}
+	if view.Status != "" && view.Status != task.Status {
+		return false
+	}
+
+	return view.Project == "" || len(transfer.WithProject([]*entity.Task{task}, view.Project)) > 0
+}
+
+// announce stores the presence of a client and publishes it to the other
+// clients of the same board on every instance.
+func (h *Collab) announce(cl *client, taskID int64, state string) {
+	board := cl.board()
+	m := Message{Type: "presence", Board: board, ClientID: cl.id, UserID: cl.userID, TaskID: taskID, State: state, At: time.Now()}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	key := presenceKeyPrefix + board
+	if state == PresenceLeft {
+		err = h.RedisClient.HDel(ctx, key, cl.id).Err()
+	} else {
+		err = h.RedisClient.HSet(ctx, key, cl.id, payload).Err()
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to store presence")
+	}
+	if err := h.RedisClient.Publish(ctx, presenceChannel, payload).Err(); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to publish presence")
+	}
+}
+
+func (h *Collab) leave(cl *client) {
+	h.announce(cl, 0, PresenceLeft)
+}
+
+// refresh keeps the presence of a live client from being considered stale.
+func (h *Collab) refresh(cl *client) {
+	board := cl.board()
+	if board == "" {
+		return
+	}
+	key := presenceKeyPrefix + board
+	value, err := h.RedisClient.HGet(context.Background(), key, cl.id).Bytes()
+	if err != nil {
+		return
+	}
+	var m Message
+	if err := json.Unmarshal(value, &m); err != nil {
+		return
+	}
+	m.At = time.Now()
+	if payload, err := json.Marshal(m); err == nil {
+		h.RedisClient.HSet(context.Background(), key, cl.id, payload)
+	}
+}
+
+// snapshot returns the presence of the other clients on the board, leaving
+// out entries of connections that stopped refreshing them.
+func (h *Collab) snapshot(cl *client) []Message {
+	key := presenceKeyPrefix + cl.board()
+	entries, err := h.RedisClient.HGetAll(context.Background(), key).Result()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to read presence")
+		return nil
+	}
+
+	var presence []Message
+	for id, value := range entries {
+		var m Message
+		if err := json.Unmarshal([]byte(value), &m); err != nil {
+			continue
+		}
+		if time.Since(m.At) > 2*pingInterval {
+			h.RedisClient.HDel(context.Background(), key, id)
+			continue
+		}
+		if id != cl.id {
+			presence = append(presence, m)
+		}
+	}
+
+	return presence
+}
+
+// diff turns a task event into the message a client with view sees, if
+// the task is or was part of the view.
+func diff(view *View, ev event.Event) (Message, bool) {
+	if view == nil || ev.UserID != view.OwnerID || (!sees(view, ev.Task) && !sees(view, ev.Previous)) {
+		return Message{}, false
+	}
+
+	m := Message{Type: ev.Type, TaskID: ev.TaskID, At: ev.OccurredAt}
+	if ev.Type == event.TaskDeleted {
+		return m, true
+	}
+
+	m.Task = snapshotOf(ev.Task)
+	if ev.Previous != nil {
+		before := snapshotOf(ev.Previous)
+		m.Changes = map[string]Change{}
+		if before.Title != m.Task.Title {
+			m.Changes["title"] = Change{From: before.Title, To: m.Task.Title}
+		}
+		if before.Status != m.Task.Status {
+			m.Changes["status"] = Change{From: before.Status, To: m.Task.Status}
+		}
+		if !sameTime(before.FinishedAt, m.Task.FinishedAt) {
+			m.Changes["finished_at"] = Change{From: before.FinishedAt, To: m.Task.FinishedAt}
+		}
+	}
+
+	return m, true
+}
+
+func snapshotOf(task *entity.Task) *TaskSnapshot {
+	s := &TaskSnapshot{ID: task.ID, Title: task.Title, Status: task.Status, Version: task.Version}
+	if task.FinishedAt.Valid {
+		finishedAt := task.FinishedAt.Time
+		s.FinishedAt = &finishedAt
+	}
+
+	return s
+}
+
+func sameTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
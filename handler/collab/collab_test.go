@@ -0,0 +1,187 @@
+package collab
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/event"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	finishedAt := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	open := &entity.Task{ID: 1, Title: "Paint +home", Status: "pending", UserID: 1, Version: 1}
+	done := &entity.Task{ID: 1, Title: "Paint the fence +home", Status: "done", UserID: 1, FinishedAt: sql.NullTime{Time: finishedAt, Valid: true}, Version: 2}
+	updated := event.Event{Type: event.TaskUpdated, UserID: 1, TaskID: 1, Task: done, Previous: open}
+
+	tests := []struct {
+		name string
+		view *View
+		ev   event.Event
+		want *Message
+	}{
+		{
+			name: "Updated",
+			view: &View{OwnerID: 1},
+			ev:   updated,
+			want: &Message{Type: event.TaskUpdated, TaskID: 1, Task: snapshotOf(done), Changes: map[string]Change{
+				"title":       {From: "Paint +home", To: "Paint the fence +home"},
+				"status":      {From: "pending", To: "done"},
+				"finished_at": {From: (*time.Time)(nil), To: &finishedAt},
+			}},
+		},
+		{
+			name: "LeavesStatusView",
+			view: &View{OwnerID: 1, Status: "pending"},
+			ev:   updated,
+			want: &Message{Type: event.TaskUpdated, TaskID: 1, Task: snapshotOf(done), Changes: map[string]Change{
+				"title":       {From: "Paint +home", To: "Paint the fence +home"},
+				"status":      {From: "pending", To: "done"},
+				"finished_at": {From: (*time.Time)(nil), To: &finishedAt},
+			}},
+		},
+		{
+			name: "Created",
+			view: &View{OwnerID: 1, Project: "home"},
+			ev:   event.Event{Type: event.TaskCreated, UserID: 1, TaskID: 1, Task: open},
+			want: &Message{Type: event.TaskCreated, TaskID: 1, Task: snapshotOf(open)},
+		},
+		{
+			name: "Deleted",
+			view: &View{OwnerID: 1, Project: "home"},
+			ev:   event.Event{Type: event.TaskDeleted, UserID: 1, TaskID: 1, Task: open},
+			want: &Message{Type: event.TaskDeleted, TaskID: 1},
+		},
+		{
+			name: "OtherProject",
+			view: &View{OwnerID: 1, Project: "work"},
+			ev:   updated,
+		},
+		{
+			name: "OtherStatus",
+			view: &View{OwnerID: 1, Status: "doing"},
+			ev:   updated,
+		},
+		{
+			name: "OtherOwner",
+			view: &View{OwnerID: 2},
+			ev:   updated,
+		},
+		{
+			name: "Unsubscribed",
+			ev:   updated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ok := diff(tt.view, tt.ev)
+			if tt.want == nil {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, *tt.want, m)
+		})
+	}
+}
+
+func TestConnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := event.NewBroker(redisClient, 100)
+	go broker.Run(ctx)
+
+	paint := &entity.Task{ID: 1, Title: "Paint", Labels: "+home", Status: "pending", UserID: 1, Version: 1}
+	tasks := new(repository.MockTaskRepository)
+	tasks.On("Find", "", "", int64(1), mock.Anything).Return([]*entity.Task{paint, {ID: 2, Title: "Report +work", UserID: 1}}, repository.PageInfo{}, nil)
+	tasks.On("Find", "", "pending", int64(1), mock.Anything).Return([]*entity.Task{paint}, repository.PageInfo{}, nil)
+	shares := new(repository.MockShareRepository)
+	shares.On("Get", int64(1), "home", int64(2)).Return(entity.Share{ID: 1}, nil)
+	shares.On("Get", int64(1), "home", int64(3)).Return(entity.Share{}, repository.ErrShareNotFound)
+
+	h := NewCollab(broker, redisClient, tasks, shares)
+	go h.Run(ctx)
+	require.Eventually(t, func() bool {
+		subscribers := server.PubSubNumSub(presenceChannel, "events:live")
+		return subscribers[presenceChannel] == 1 && subscribers["events:live"] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	r := gin.New()
+	r.GET("/collab", func(c *gin.Context) {
+		userId, _ := strconv.ParseInt(c.Query("user"), 10, 64)
+		c.Set("userId", userId)
+	}, h.Connect)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	dial := func(user string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/collab?user="+user, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	owner := dial("1")
+	collaborator := dial("2")
+	stranger := dial("3")
+
+	require.NoError(t, collaborator.WriteJSON(Message{Type: "subscribe", View: &View{OwnerID: 1, Project: "+Home"}}))
+	subscribed := receive(t, collaborator, "subscribed")
+	assert.Equal(t, &View{OwnerID: 1, Project: "home"}, subscribed.View)
+	assert.Equal(t, []*TaskSnapshot{snapshotOf(paint)}, subscribed.Tasks)
+
+	require.NoError(t, stranger.WriteJSON(Message{Type: "subscribe", View: &View{OwnerID: 1, Project: "home"}}))
+	assert.Equal(t, errNotShared.Error(), receive(t, stranger, "error").Detail)
+	require.NoError(t, stranger.WriteJSON(Message{Type: "presence", TaskID: 1, State: PresenceEditing}))
+	assert.Equal(t, "subscribe to a board first", receive(t, stranger, "error").Detail)
+
+	require.NoError(t, owner.WriteJSON(Message{Type: "subscribe", View: &View{Project: "home", Status: "pending"}}))
+	receive(t, owner, "subscribed")
+	require.NoError(t, owner.WriteJSON(Message{Type: "presence", TaskID: 1, State: PresenceEditing}))
+	presence := receive(t, collaborator, "presence")
+	assert.Equal(t, int64(1), presence.UserID)
+	assert.Equal(t, int64(1), presence.TaskID)
+	assert.Equal(t, PresenceEditing, presence.State)
+
+	require.NoError(t, collaborator.WriteJSON(Message{Type: "presence", TaskID: 1, State: PresenceViewing}))
+	assert.Equal(t, int64(2), receive(t, owner, "presence").UserID)
+
+	done := *paint
+	done.Status = "done"
+	require.NoError(t, broker.Publish(event.Event{Type: event.TaskUpdated, UserID: 1, TaskID: 1, Task: &done, Previous: paint}))
+	updated := receive(t, collaborator, event.TaskUpdated)
+	assert.Equal(t, Change{From: "pending", To: "done"}, updated.Changes["status"])
+	receive(t, owner, event.TaskUpdated)
+
+	tasks.AssertExpectations(t)
+	shares.AssertExpectations(t)
+}
+
+// receive reads messages from conn until one of the given type arrives.
+func receive(t *testing.T, conn *websocket.Conn, messageType string) Message {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	for {
+		var m Message
+		require.NoError(t, conn.ReadJSON(&m))
+		if m.Type == messageType {
+			return m
+		}
+	}
+}
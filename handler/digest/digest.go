@@ -0,0 +1,280 @@
+package digest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/digest"
+	"github.com/nargesbyt/todo.go/internal/dto"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultSendAt   = "08:00"
+	defaultTimeZone = "UTC"
+)
+
+type Digest struct {
+	DigestsRepository repository.Digests
+	UsersRepository   repository.Users
+	Sender            *digest.Sender
+}
+
+// Get returns the digest settings of the authenticated user, which are
+// disabled until first saved.
+func (d Digest) Get(c *gin.Context) {
+	settings, ok := d.load(c)
+	if !ok {
+		return
+	}
+
+	resp := dto.Digest{}
+	resp.FromEntity(settings)
+	if settings.ID != 0 {
+		c.Header("ETag", handler.ETag(settings.Version))
+	}
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// Update enables or disables the digest and sets when it is sent. When it
+// is enabled for an email that is not confirmed yet, a confirmation link
+// is sent there first.
+func (d Digest) Update(c *gin.Context) {
+	settings, ok := d.load(c)
+	if !ok {
+		return
+	}
+	user, err := d.UsersRepository.GetUserByID(settings.UserID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+	version := int64(0)
+	if settings.ID != 0 {
+		if version, ok = handler.IfMatch(c, settings.Version); !ok {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
+	}
+
+	req := dto.UpdateDigestRequest{Enabled: settings.Enabled, SendAt: settings.SendAt, TimeZone: settings.TimeZone}
+	if _, err := handler.BindRequest(c, "digests", "", &req); err != nil {
+		log.Error().Stack().Err(err).Msg("unprocessable entity")
+		handler.AbortWithBindError(c, err)
+
+		return
+	}
+	if detail := validate(req); detail != "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, detail))
+		return
+	}
+	if req.Enabled == 1 && user.Email == "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, "add an email to your account to enable the digest"))
+		return
+	}
+	if req.Enabled == 1 && d.Sender.BaseURL == "" {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, handler.NewProblem(http.StatusServiceUnavailable, "digests are not configured on this server"))
+		return
+	}
+
+	wasEnabled := settings.Enabled
+	settings, err = d.DigestsRepository.Save(user.ID, req.Enabled, req.SendAt, req.TimeZone, version)
+	if err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+	// Enabling the digest again resends the link, in case it got lost.
+	if settings.Enabled == 1 && settings.ConfirmedEmail != user.Email && (wasEnabled == 0 || settings.PendingEmail != user.Email) {
+		if err := d.Sender.SendConfirmation(settings, user); err != nil {
+			log.Error().Stack().Err(err).Int64("digest", settings.ID).Msg("unable to send digest confirmation")
+		}
+	}
+
+	resp := dto.Digest{}
+	resp.FromEntity(settings)
+	c.Header("ETag", handler.ETag(settings.Version))
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// Preview renders the digest the authenticated user would get now, as
+// HTML or, with format=text, as plain text.
+func (d Digest) Preview(c *gin.Context) {
+	settings, ok := d.load(c)
+	if !ok {
+		return
+	}
+	user, err := d.UsersRepository.GetUserByID(settings.UserID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	msg, err := d.Sender.Compose(settings, user, time.Now())
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to compose digest")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	if c.Query("format") == "text" {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(msg.Text))
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(msg.HTML))
+}
+
+// UnsubscribeForm answers the unsubscribe link in a digest with a form
+// that asks to confirm. Link scanners and prefetchers follow links, so a
+// GET must not unsubscribe.
+func (d Digest) UnsubscribeForm(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	page(c, digest.Page{
+		Title:  "Unsubscribe from the daily digest",
+		Text:   "You will no longer receive the daily summary of your tasks.",
+		Action: "unsubscribe",
+		Token:  token,
+		Button: "Unsubscribe",
+	})
+}
+
+// Unsubscribe disables the digest of the token. It answers both the form
+// of UnsubscribeForm and one-click unsubscribe POSTs from mail clients,
+// which send the token in the link.
+func (d Digest) Unsubscribe(c *gin.Context) {
+	token := formToken(c)
+	if token == "" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err := d.DigestsRepository.Unsubscribe(token); err != nil {
+		if err == repository.ErrDigestNotFound {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	page(c, digest.Page{
+		Title: "Unsubscribed",
+		Text:  "You will no longer receive the daily digest.",
+	})
+}
+
+// ConfirmForm answers the link in the confirmation email with a form, for
+// the same reason as UnsubscribeForm.
+func (d Digest) ConfirmForm(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	page(c, digest.Page{
+		Title:  "Confirm the daily digest",
+		Text:   "Send the daily summary of your tasks to this address.",
+		Action: "confirm",
+		Token:  token,
+		Button: "Confirm",
+	})
+}
+
+// Confirm makes the address the confirmation email was sent to the one
+// digests go to.
+func (d Digest) Confirm(c *gin.Context) {
+	if err := d.DigestsRepository.Confirm(formToken(c)); err != nil {
+		if err == repository.ErrDigestNotFound {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	page(c, digest.Page{
+		Title: "Confirmed",
+		Text:  "You will receive the daily digest at this address.",
+	})
+}
+
+// load returns the digest settings of the authenticated user, or the
+// defaults when there are none yet.
+func (d Digest) load(c *gin.Context) (entity.Digest, bool) {
+	userId, _ := c.Get("userId")
+	settings, err := d.DigestsRepository.Get(userId.(int64))
+	if err == repository.ErrDigestNotFound {
+		return entity.Digest{UserID: userId.(int64), SendAt: defaultSendAt, TimeZone: defaultTimeZone}, true
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return settings, false
+	}
+
+	return settings, true
+}
+
+func validate(req dto.UpdateDigestRequest) string {
+	if req.Enabled != 0 && req.Enabled != 1 {
+		return "enabled must be 0 or 1"
+	}
+	if !digest.ValidTime(req.SendAt) {
+		return "send_at must be a time of day like 08:00"
+	}
+	if _, err := time.LoadLocation(req.TimeZone); err != nil || req.TimeZone == "" {
+		return "time_zone must be an IANA time zone like Europe/Berlin"
+	}
+
+	return ""
+}
+
+// formToken returns the token of a POST, either in the link of one-click
+// unsubscribe or in the form of a page.
+func formToken(c *gin.Context) string {
+	if token := c.Query("token"); token != "" {
+		return token
+	}
+
+	return c.PostForm("token")
+}
+
+func page(c *gin.Context, p digest.Page) {
+	body, err := digest.RenderPage(p)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to render page")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", body)
+}
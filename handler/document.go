@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+)
+
+const QueryParamInclude = "include"
+
+var ErrInvalidInclude = errors.New("invalid include parameter")
+
+// Document holds the include and fields[type] parameters that shape a
+// JSON:API response document.
+type Document struct {
+	Include [][]string
+	Fields  map[string]map[string]bool
+}
+
+// ParseDocument reads include and fields[type] from the query string.
+// Every include path must be one of allowed, e.g. "user" or "user.tasks".
+func ParseDocument(c *gin.Context, allowed ...string) (Document, error) {
+	d := Document{Fields: map[string]map[string]bool{}}
+
+	if include := c.Query(QueryParamInclude); include != "" {
+		for _, path := range strings.Split(include, ",") {
+			if !contains(allowed, path) {
+				return d, ErrInvalidInclude
+			}
+			d.Include = append(d.Include, strings.Split(path, "."))
+		}
+	}
+
+	for key, values := range c.Request.URL.Query() {
+		if !strings.HasPrefix(key, "fields[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		resourceType := key[len("fields[") : len(key)-1]
+		fields := map[string]bool{}
+		for _, v := range values {
+			for _, f := range strings.Split(v, ",") {
+				if f != "" {
+					fields[f] = true
+				}
+			}
+		}
+		d.Fields[resourceType] = fields
+	}
+
+	return d, nil
+}
+
+// Apply keeps only the included resources reachable through the requested
+// include paths and trims every resource to its requested fieldset.
+func (d Document) Apply(payload jsonapi.Payloader) {
+	var primary, included []*jsonapi.Node
+	switch p := payload.(type) {
+	case *jsonapi.OnePayload:
+		if p.Data != nil {
+			primary = []*jsonapi.Node{p.Data}
+		}
+		included = p.Included
+	case *jsonapi.ManyPayload:
+		primary = p.Data
+		included = p.Included
+	}
+
+	index := map[string]*jsonapi.Node{}
+	for _, n := range included {
+		index[nodeKey(n)] = n
+	}
+	seen := map[string]bool{}
+	for _, n := range primary {
+		seen[nodeKey(n)] = true
+	}
+
+	var kept []*jsonapi.Node
+	for _, path := range d.Include {
+		frontier := primary
+		for _, relation := range path {
+			var next []*jsonapi.Node
+			for _, n := range frontier {
+				for _, ref := range related(n, relation) {
+					full, ok := index[nodeKey(ref)]
+					if !ok {
+						continue
+					}
+					next = append(next, full)
+					if !seen[nodeKey(full)] {
+						seen[nodeKey(full)] = true
+						kept = append(kept, full)
+					}
+				}
+			}
+			frontier = next
+		}
+	}
+
+	for _, n := range primary {
+		d.trim(n)
+	}
+	for _, n := range kept {
+		d.trim(n)
+	}
+
+	switch p := payload.(type) {
+	case *jsonapi.OnePayload:
+		p.Included = kept
+	case *jsonapi.ManyPayload:
+		p.Included = kept
+	}
+}
+
+func (d Document) trim(n *jsonapi.Node) {
+	fields, ok := d.Fields[n.Type]
+	if !ok {
+		return
+	}
+	for name := range n.Attributes {
+		if !fields[name] {
+			delete(n.Attributes, name)
+		}
+	}
+	for name := range n.Relationships {
+		if !fields[name] {
+			delete(n.Relationships, name)
+		}
+	}
+}
+
+// MarshalDocument writes model as a JSON:API document shaped by d.
+func MarshalDocument(c *gin.Context, model interface{}, d Document) error {
+	payload, err := jsonapi.Marshal(model)
+	if err != nil {
+		return err
+	}
+	d.Apply(payload)
+
+	c.Header("Content-Type", jsonapi.MediaType)
+
+	return json.NewEncoder(c.Writer).Encode(payload)
+}
+
+func related(n *jsonapi.Node, relation string) []*jsonapi.Node {
+	switch r := n.Relationships[relation].(type) {
+	case *jsonapi.RelationshipOneNode:
+		if r.Data != nil {
+			return []*jsonapi.Node{r.Data}
+		}
+	case *jsonapi.RelationshipManyNode:
+		return r.Data
+	}
+
+	return nil
+}
+
+func nodeKey(n *jsonapi.Node) string {
+	return n.Type + "," + n.ID
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
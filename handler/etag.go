@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag returns the entity tag of a resource at the given version.
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// IfMatch checks the If-Match header against the current version of a
+// resource. It returns the version a conditional write must be applied to,
+// which is 0 when the request carries no precondition, and false when the
+// precondition fails.
+func IfMatch(c *gin.Context, version int64) (int64, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return 0, true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == ETag(version) {
+			return version, true
+		}
+	}
+
+	return 0, false
+}
+
+// NotModified reports whether the If-None-Match header of a GET request
+// matches the current version of a resource, in which case the client's
+// copy is still fresh.
+func NotModified(c *gin.Context, version int64) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == ETag(version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AbortWithPreconditionFailed aborts a conditional request whose resource
+// has changed since the client last read it.
+func AbortWithPreconditionFailed(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, NewProblem(http.StatusPreconditionFailed, "resource has been modified"))
+}
@@ -0,0 +1,124 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/dto"
+	"github.com/nargesbyt/todo.go/internal/event"
+	"github.com/rs/zerolog/log"
+)
+
+type Events struct {
+	Broker    *event.Broker
+	Heartbeat time.Duration
+}
+
+// Stream pushes the task events of the authenticated user as Server-Sent
+// Events. A Last-Event-ID header replays the logged events after that id
+// before switching to live ones.
+func (e Events) Stream(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	live, unsubscribe := e.Broker.Subscribe(userId.(int64))
+	defer unsubscribe()
+
+	lastID := c.GetHeader("Last-Event-ID")
+	var backlog []event.Event
+	if lastID != "" {
+		var err error
+		backlog, err = e.Broker.Since(c.Request.Context(), lastID, userId.(int64))
+		if err != nil {
+			log.Error().Stack().Err(err).Msg("unable to read the event log")
+			c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "invalid Last-Event-ID"))
+			return
+		}
+	}
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for _, ev := range backlog {
+		if err := render(c.Writer, ev); err != nil {
+			log.Error().Stack().Err(err).Msg("can not respond")
+			return
+		}
+		lastID = ev.ID
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(e.Heartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-live:
+			if !ok {
+				return false
+			}
+			if lastID != "" && !after(ev.ID, lastID) {
+				return true
+			}
+			if err := render(w, ev); err != nil {
+				log.Error().Stack().Err(err).Msg("can not respond")
+				return false
+			}
+			lastID = ev.ID
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func render(w io.Writer, ev event.Event) error {
+	data := fmt.Sprintf(`{"data":{"type":"tasks","id":"%d"}}`, ev.TaskID)
+	if ev.Type != event.TaskDeleted && ev.Task != nil {
+		resp := dto.Task{}
+		resp.FromEntity(*ev.Task)
+		buf := bytes.NewBuffer(nil)
+		if err := jsonapi.MarshalPayloadWithoutIncluded(buf, &resp); err != nil {
+			return err
+		}
+		data = strings.TrimSpace(buf.String())
+	}
+
+	return sse.Encode(w, sse.Event{
+		Id:    ev.ID,
+		Event: ev.Type,
+		Data:  data,
+	})
+}
+
+// after reports whether the Redis stream id a comes after b.
+func after(a string, b string) bool {
+	am, as := splitID(a)
+	bm, bs := splitID(b)
+	if am != bm {
+		return am > bm
+	}
+
+	return as > bs
+}
+
+func splitID(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	m, _ := strconv.ParseUint(ms, 10, 64)
+	s, _ := strconv.ParseUint(seq, 10, 64)
+
+	return m, s
+}
@@ -0,0 +1,113 @@
+package feed
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/dto"
+	"github.com/nargesbyt/todo.go/internal/ical"
+	"github.com/nargesbyt/todo.go/internal/transfer"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+type Feed struct {
+	FeedsRepository repository.Feeds
+	TasksRepository repository.Tasks
+	// BaseURL is prepended to the feed path to build subscription URLs.
+	BaseURL string
+}
+
+func (f Feed) Get(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	feed, err := f.FeedsRepository.Get(userId.(int64))
+	if err != nil {
+		if err == repository.ErrFeedNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "Feed not found"))
+			return
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	resp := dto.Feed{}
+	resp.FromEntity(feed)
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// Rotate issues a new secret URL for the feed of the authenticated user.
+func (f Feed) Rotate(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	feed, secret, err := f.FeedsRepository.Rotate(userId.(int64))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to rotate feed secret")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	resp := dto.Feed{}
+	resp.FromEntity(feed)
+	resp.URL = strings.TrimSuffix(f.BaseURL, "/") + fmt.Sprintf("/feeds/%s/tasks.ics", secret)
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// Tasks serves the tasks of the feed owner as an iCalendar stream. The
+// status and title query parameters filter the tasks like on /tasks, the
+// project and label query parameters keep the tasks tagged +project and
+// @label. Tasks with a due date are also written as all-day events.
+func (f Feed) Tasks(c *gin.Context) {
+	feed, err := f.FeedsRepository.GetBySecret(c.Param("secret"))
+	if err != nil {
+		if err == repository.ErrFeedNotFound {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	tasks, err := repository.FindAll(f.TasksRepository, c.Query("title"), c.Query("status"), feed.UserID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch tasks from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+	if project := strings.TrimPrefix(c.Query("project"), "+"); project != "" {
+		tasks = transfer.WithProject(tasks, project)
+	}
+	if label := strings.TrimPrefix(c.Query("label"), "@"); label != "" {
+		tasks = transfer.WithContext(tasks, label)
+	}
+
+	c.Header("Content-Type", ical.ContentType)
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Status(http.StatusOK)
+
+	now := time.Now()
+	w := ical.NewWriter(c.Writer)
+	w.Begin("Tasks")
+	for _, task := range tasks {
+		// Due dates may also be tagged in titles.
+		dated := *task
+		dated.Due = transfer.TaskTags(dated).Due
+		w.Todo(dated, ical.UID(dated), now)
+		w.Event(dated, ical.EventUID(dated), now)
+	}
+	if err := w.End(); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
@@ -0,0 +1,229 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+	keyPrefix      = "idempotency:"
+	maxKeyLength   = 255
+	defaultLockTTL = time.Minute
+)
+
+// replayedHeaders are the response headers stored along with the body.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// secretHeaders are the response headers stored for responses holding a
+// secret, whose body is not stored.
+var secretHeaders = []string{"Location", "ETag"}
+
+type record struct {
+	Fingerprint string            `json:"fingerprint"`
+	Status      int               `json:"status"`
+	Header      map[string]string `json:"header"`
+	Body        []byte            `json:"body"`
+	// Secret is set when the body was left out because it held a secret.
+	Secret bool `json:"secret,omitempty"`
+}
+
+// Idempotency replays the stored response of a create request when a
+// client retries it with the same Idempotency-Key header. Responses are
+// kept for TTL. A key is locked for LockTTL, one minute by default, while
+// its request is handled, so a request that never finishes does not block
+// retries for long.
+type Idempotency struct {
+	RedisClient *redis.Client
+	TTL         time.Duration
+	LockTTL     time.Duration
+}
+
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// Handle must run after authentication so keys are scoped per user.
+// Unauthenticated requests are scoped per client IP.
+func (i *Idempotency) Handle(c *gin.Context) {
+	i.handle(c, false)
+}
+
+// HandleSecret is Handle for create requests whose response holds a secret,
+// such as a token, which must neither sit in Redis nor be handed out
+// twice. Only the status, Location and ETag are stored, and a retry is
+// answered with 409 Conflict pointing at the created resource.
+func (i *Idempotency) HandleSecret(c *gin.Context) {
+	i.handle(c, true)
+}
+
+func (i *Idempotency) handle(c *gin.Context, secret bool) {
+	key := c.GetHeader(HeaderKey)
+	if key == "" {
+		c.Next()
+		return
+	}
+	if len(key) > maxKeyLength {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "idempotency key is too long"))
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "can not read request body"))
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	scope := "anonymous:" + c.ClientIP()
+	if userId, ok := c.Get("userId"); ok {
+		scope = fmt.Sprint(userId)
+	}
+	redisKey := keyPrefix + scope + ":" + key
+	fingerprint := requestFingerprint(c.Request.Method, c.Request.URL.Path, body)
+
+	pending, err := json.Marshal(record{Fingerprint: fingerprint})
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	lockTTL := i.LockTTL
+	if lockTTL == 0 {
+		lockTTL = defaultLockTTL
+	}
+	acquired, err := i.RedisClient.SetNX(context.Background(), redisKey, pending, lockTTL).Result()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to store idempotency key")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !acquired {
+		i.replay(c, redisKey, fingerprint)
+		return
+	}
+
+	// A panic is recovered by an outer handler, which answers 500; the
+	// key is released for a retry like after any server error.
+	defer func() {
+		if r := recover(); r != nil {
+			i.release(redisKey)
+			panic(r)
+		}
+	}()
+
+	w := &recorder{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+
+	if w.Status() >= http.StatusInternalServerError {
+		i.release(redisKey)
+		return
+	}
+
+	// Only a successful response holds the secret.
+	redact := secret && w.Status() < http.StatusMultipleChoices
+	stored := record{
+		Fingerprint: fingerprint,
+		Status:      w.Status(),
+		Header:      map[string]string{},
+		Secret:      redact,
+	}
+	headers := secretHeaders
+	if !redact {
+		stored.Body = w.body.Bytes()
+		headers = replayedHeaders
+	}
+	for _, h := range headers {
+		if v := w.Header().Get(h); v != "" {
+			stored.Header[h] = v
+		}
+	}
+	value, err := json.Marshal(stored)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to encode idempotent response")
+		return
+	}
+	if err := i.RedisClient.Set(context.Background(), redisKey, value, i.TTL).Err(); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to store idempotent response")
+	}
+}
+
+func (i *Idempotency) release(redisKey string) {
+	if err := i.RedisClient.Del(context.Background(), redisKey).Err(); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to release idempotency key")
+	}
+}
+
+func (i *Idempotency) replay(c *gin.Context, redisKey string, fingerprint string) {
+	value, err := i.RedisClient.Get(context.Background(), redisKey).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			c.AbortWithStatusJSON(http.StatusConflict, handler.NewProblem(http.StatusConflict, "a request with this idempotency key is in progress"))
+			return
+		}
+		log.Error().Stack().Err(err).Msg("unable to read idempotency key")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var stored record
+	if err := json.Unmarshal(value, &stored); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to decode idempotent response")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if stored.Fingerprint != fingerprint {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, "idempotency key was already used for a different request"))
+		return
+	}
+	if stored.Status == 0 {
+		c.AbortWithStatusJSON(http.StatusConflict, handler.NewProblem(http.StatusConflict, "a request with this idempotency key is in progress"))
+		return
+	}
+
+	for h, v := range stored.Header {
+		c.Header(h, v)
+	}
+	c.Header(HeaderReplayed, "true")
+	if stored.Secret {
+		c.AbortWithStatusJSON(http.StatusConflict, handler.NewProblem(http.StatusConflict, "a request with this idempotency key was already processed; its response held a secret that is only shown once"))
+		return
+	}
+	c.Status(stored.Status)
+	if _, err := c.Writer.Write(stored.Body); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+	c.Abort()
+}
+
+func requestFingerprint(method string, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
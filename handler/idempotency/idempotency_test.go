@@ -0,0 +1,157 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T) (*Idempotency, *miniredis.Miniredis) {
+	gin.SetMode(gin.TestMode)
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	return &Idempotency{RedisClient: client, TTL: time.Hour}, server
+}
+
+func send(r *gin.Engine, body string, key string, remoteAddr string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(body))
+	req.Header.Set(HeaderKey, key)
+	req.RemoteAddr = remoteAddr
+	r.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func TestHandle(t *testing.T) {
+	t.Run("Replay", func(t *testing.T) {
+		ih, _ := setup(t)
+		calls := 0
+		r := gin.New()
+		r.POST("/things", func(c *gin.Context) { c.Set("userId", int64(1)) }, ih.Handle, func(c *gin.Context) {
+			calls++
+			c.Header("Location", "/things/1")
+			c.String(http.StatusCreated, "created")
+		})
+
+		first := send(r, "a", "key", "192.0.2.1:1234")
+		second := send(r, "a", "key", "192.0.2.1:1234")
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "/things/1", second.Header().Get("Location"))
+		assert.Equal(t, "true", second.Header().Get(HeaderReplayed))
+	})
+
+	t.Run("DifferentRequest", func(t *testing.T) {
+		ih, _ := setup(t)
+		r := gin.New()
+		r.POST("/things", func(c *gin.Context) { c.Set("userId", int64(1)) }, ih.Handle, func(c *gin.Context) {
+			c.String(http.StatusCreated, "created")
+		})
+
+		send(r, "a", "key", "192.0.2.1:1234")
+		resp := send(r, "b", "key", "192.0.2.1:1234")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	})
+
+	t.Run("AnonymousClientsDoNotShareKeys", func(t *testing.T) {
+		ih, _ := setup(t)
+		calls := 0
+		r := gin.New()
+		r.POST("/things", ih.Handle, func(c *gin.Context) {
+			calls++
+			c.String(http.StatusCreated, "created")
+		})
+
+		send(r, "a", "key", "192.0.2.1:1234")
+		resp := send(r, "a", "key", "192.0.2.2:1234")
+
+		assert.Equal(t, 2, calls)
+		assert.Empty(t, resp.Header().Get(HeaderReplayed))
+	})
+
+	t.Run("ServerErrorReleasesKey", func(t *testing.T) {
+		ih, _ := setup(t)
+		calls := 0
+		r := gin.New()
+		r.POST("/things", ih.Handle, func(c *gin.Context) {
+			calls++
+			c.AbortWithStatus(http.StatusInternalServerError)
+		})
+
+		send(r, "a", "key", "192.0.2.1:1234")
+		send(r, "a", "key", "192.0.2.1:1234")
+
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("PanicReleasesKey", func(t *testing.T) {
+		ih, _ := setup(t)
+		calls := 0
+		r := gin.New()
+		r.Use(gin.CustomRecovery(func(c *gin.Context, err any) { c.AbortWithStatus(http.StatusInternalServerError) }))
+		r.POST("/things", ih.Handle, func(c *gin.Context) {
+			calls++
+			panic("boom")
+		})
+
+		assert.Equal(t, http.StatusInternalServerError, send(r, "a", "key", "192.0.2.1:1234").Code)
+		send(r, "a", "key", "192.0.2.1:1234")
+
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("LockExpires", func(t *testing.T) {
+		ih, server := setup(t)
+		ih.LockTTL = time.Second
+		r := gin.New()
+		r.POST("/things", func(c *gin.Context) { c.Set("userId", int64(1)) }, ih.Handle, func(c *gin.Context) {
+			require.Equal(t, time.Second, server.TTL(server.Keys()[0]))
+			c.String(http.StatusCreated, "created")
+		})
+
+		require.Equal(t, http.StatusCreated, send(r, "a", "key", "192.0.2.1:1234").Code)
+		assert.Equal(t, time.Hour, server.TTL(server.Keys()[0]))
+	})
+}
+
+func TestHandleSecret(t *testing.T) {
+	ih, server := setup(t)
+	calls := 0
+	r := gin.New()
+	r.POST("/things", func(c *gin.Context) { c.Set("userId", int64(1)) }, ih.HandleSecret, func(c *gin.Context) {
+		calls++
+		c.Header("Location", "/things/1")
+		c.Header("ETag", `"1"`)
+		c.String(http.StatusCreated, "todo_pat_secret")
+	})
+
+	first := send(r, "a", "key", "192.0.2.1:1234")
+	require.Equal(t, "todo_pat_secret", first.Body.String())
+
+	keys := server.Keys()
+	require.Len(t, keys, 1)
+	stored, err := ih.RedisClient.Get(context.Background(), keys[0]).Result()
+	require.NoError(t, err)
+	assert.NotContains(t, stored, "todo_pat_secret")
+
+	second := send(r, "a", "key", "192.0.2.1:1234")
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusConflict, second.Code)
+	assert.NotContains(t, second.Body.String(), "todo_pat_secret")
+	assert.Equal(t, "/things/1", second.Header().Get("Location"))
+	assert.Equal(t, `"1"`, second.Header().Get("ETag"))
+}
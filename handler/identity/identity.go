@@ -0,0 +1,104 @@
+package identity
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/dto"
+	"github.com/nargesbyt/todo.go/internal/sso"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+// Identity manages the OIDC identities linked to the authenticated user.
+type Identity struct {
+	IdentitiesRepository repository.Identities
+	Providers            *sso.Providers
+	Provisioner          sso.Provisioner
+}
+
+// Link links the identity of an ID token to the authenticated user, which
+// lets users who signed up with a password sign in through a provider.
+func (i Identity) Link(c *gin.Context) {
+	req := dto.LinkIdentityRequest{}
+	if _, err := handler.BindRequest(c, "identities", "", &req); err != nil {
+		handler.AbortWithBindError(c, err)
+		return
+	}
+
+	provider, idToken, err := i.Providers.Verify(c, req.IDToken)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, "invalid ID token"))
+		return
+	}
+	identity, err := provider.Identity(idToken)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, err.Error()))
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	linked, err := i.Provisioner.Link(userId.(int64), identity)
+	if err == repository.ErrIdentityExists {
+		c.AbortWithStatusJSON(http.StatusConflict, handler.NewProblem(http.StatusConflict, err.Error()))
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("internal server error while linking an identity")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.Identity{}
+	resp.FromEntity(linked)
+	c.Header("Location", fmt.Sprintf("/me/identities/%d", linked.ID))
+	c.Status(http.StatusCreated)
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+func (i Identity) List(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	identities, err := i.IdentitiesRepository.List(userId.(int64))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch identities from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]*dto.Identity, 0, len(identities))
+	for _, identity := range identities {
+		r := dto.Identity{}
+		r.FromEntity(identity)
+		resp = append(resp, &r)
+	}
+	if err := handler.MarshalDocument(c, resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+func (i Identity) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "invalid identity id"))
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	err = i.IdentitiesRepository.Delete(id, userId.(int64))
+	if err == repository.ErrIdentityNotFound {
+		c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "Identity not found"))
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("internal server error while deleting an identity")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const redacted = "REDACTED"
+
+var (
+	// feedSecret matches the secret of a feed URL, which grants access to
+	// the feed by itself.
+	feedSecret = regexp.MustCompile(`^/feeds/[^/?]+`)
+	// secretParam matches the query parameters carrying one-time tokens
+	// and authorization codes.
+	secretParam = regexp.MustCompile(`([?&](?:token|code|state)=)[^&]*`)
+)
+
+// Logger writes an access log line per request like gin's default logger,
+// with the secrets in request paths redacted.
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(logFormatter)
+}
+
+func logFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		RedactPath(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// RedactPath replaces the secrets in a request path and query with
+// REDACTED.
+func RedactPath(path string) string {
+	path = feedSecret.ReplaceAllString(path, "/feeds/"+redacted)
+
+	return secretParam.ReplaceAllString(path, "${1}"+redacted)
+}
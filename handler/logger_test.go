@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/feeds/s3cr3t/tasks.ics?status=done", "/feeds/REDACTED/tasks.ics?status=done"},
+		{"/feed/rotate", "/feed/rotate"},
+		{"/digest/unsubscribe?token=abc&x=1", "/digest/unsubscribe?token=REDACTED&x=1"},
+		{"/oauth/google/callback?state=abc&code=xyz", "/oauth/google/callback?state=REDACTED&code=REDACTED"},
+		{"/tasks?title=code=1", "/tasks?title=code=1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, RedactPath(tt.path))
+	}
+}
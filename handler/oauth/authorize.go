@@ -0,0 +1,226 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/dto"
+	"github.com/nargesbyt/todo.go/internal/random"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	requestKeyPrefix = "oauth:request:"
+	codeKeyPrefix    = "oauth:code:"
+
+	// codeTTL is how long an authorization code can be redeemed, see RFC
+	// 6749 section 4.1.2.
+	codeTTL = time.Minute
+)
+
+// authorization is an authorization request waiting for consent, and
+// once approved the grant its code stands for.
+type authorization struct {
+	ClientID    string `json:"client_id"`
+	UserID      int64  `json:"user_id"`
+	RedirectURI string `json:"redirect_uri"`
+	// RedirectURISent tells whether the client sent the redirect_uri, in
+	// which case it must send it again to redeem the code.
+	RedirectURISent bool      `json:"redirect_uri_sent"`
+	Scopes          []string  `json:"scopes"`
+	State           string    `json:"state"`
+	CodeChallenge   string    `json:"code_challenge"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+// Authorization runs the authorization code flow with PKCE for
+// third-party apps. The endpoints return data for our client to show a
+// consent screen; the user is signed in to us, usually by session cookie.
+type Authorization struct {
+	ClientsRepository repository.Clients
+	RedisClient       *redis.Client
+	// RequestTTL is how long the user has to decide on a request.
+	RequestTTL time.Duration
+}
+
+// Authorize checks an authorization request and keeps it until the user
+// decides on it. Errors are returned to the consent screen rather than
+// the client, since the redirect URI may not be trusted yet.
+func (a Authorization) Authorize(c *gin.Context) {
+	client, err := a.ClientsRepository.Get(c.Query("client_id"))
+	if err == repository.ErrClientNotFound {
+		AbortWithOAuthError(c, http.StatusBadRequest, "invalid_client", "unknown client_id")
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to load the client")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	redirectURI := c.Query("redirect_uri")
+	registered := client.RedirectURIList()
+	if redirectURI == "" && len(registered) == 1 {
+		redirectURI = registered[0]
+	}
+	if !contains(registered, redirectURI) {
+		AbortWithOAuthError(c, http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for the client")
+		return
+	}
+	if c.Query("response_type") != "code" {
+		AbortWithOAuthError(c, http.StatusBadRequest, "unsupported_response_type", "response_type must be code")
+		return
+	}
+	if c.Query("code_challenge") == "" || c.Query("code_challenge_method") != "S256" {
+		AbortWithOAuthError(c, http.StatusBadRequest, "invalid_request", "a S256 code_challenge is required")
+		return
+	}
+
+	scopes := client.ScopeList()
+	if requested := c.Query("scope"); requested != "" {
+		var ok bool
+		if scopes, ok = narrowScopes(scopes, requested); !ok {
+			AbortWithOAuthError(c, http.StatusBadRequest, "invalid_scope", "the scope is unknown or not allowed for the client")
+			return
+		}
+	}
+
+	userId, _ := c.Get("userId")
+	request := authorization{
+		ClientID:        client.ClientID,
+		UserID:          userId.(int64),
+		RedirectURI:     redirectURI,
+		RedirectURISent: c.Query("redirect_uri") != "",
+		Scopes:          scopes,
+		State:           c.Query("state"),
+		CodeChallenge:   c.Query("code_challenge"),
+		ExpiresAt:       time.Now().Add(a.RequestTTL),
+	}
+	id := random.Token(24)
+	if err := a.save(requestKeyPrefix+id, request, a.RequestTTL); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to store the authorization request")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.AuthorizationRequest{
+		ID:          id,
+		ClientID:    client.ClientID,
+		ClientName:  client.Name,
+		Scopes:      scopes,
+		RedirectURI: redirectURI,
+		ExpiresAt:   request.ExpiresAt,
+	}
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// Consent records the decision of the user on an authorization request and
+// tells where to send the browser: back to the client with a code, or with
+// an access_denied error. Only a signed in browser may decide, so an app
+// holding a token can not approve its own requests.
+func (a Authorization) Consent(c *gin.Context) {
+	if c.GetString("sessionId") == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, handler.NewProblem(http.StatusForbidden, "consent requires a session login"))
+		return
+	}
+
+	req := dto.ConsentRequest{}
+	if _, err := handler.BindRequest(c, "consents", "", &req); err != nil {
+		handler.AbortWithBindError(c, err)
+		return
+	}
+
+	request, err := a.take(requestKeyPrefix + c.Param("id"))
+	userId, _ := c.Get("userId")
+	if err == redis.Nil || (err == nil && request.UserID != userId.(int64)) {
+		c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "Authorization request not found"))
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to load the authorization request")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	query := url.Values{}
+	if req.Approve {
+		code := random.Token(32)
+		request.ExpiresAt = time.Now().Add(codeTTL)
+		if err := a.save(codeKeyPrefix+code, request, codeTTL); err != nil {
+			log.Error().Stack().Err(err).Msg("unable to store the authorization code")
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		query.Set("code", code)
+	} else {
+		query.Set("error", "access_denied")
+	}
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+
+	resp := dto.Consent{ID: c.Param("id"), RedirectTo: withQuery(request.RedirectURI, query)}
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+func (a Authorization) save(key string, value authorization, ttl time.Duration) error {
+	return saveAuthorization(a.RedisClient, key, value, ttl)
+}
+
+func (a Authorization) take(key string) (authorization, error) {
+	return takeAuthorization(a.RedisClient, key)
+}
+
+func saveAuthorization(client *redis.Client, key string, value authorization, ttl time.Duration) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return client.Set(context.Background(), key, encoded, ttl).Err()
+}
+
+// takeAuthorization loads and removes an authorization, so a request is
+// decided and a code redeemed only once.
+func takeAuthorization(client *redis.Client, key string) (authorization, error) {
+	var value authorization
+
+	encoded, err := client.GetDel(context.Background(), key).Bytes()
+	if err != nil {
+		return value, err
+	}
+	err = json.Unmarshal(encoded, &value)
+
+	return value, err
+}
+
+// verifyPKCE checks a code_verifier against the S256 code_challenge of RFC
+// 7636.
+func verifyPKCE(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(pkceChallenge(verifier)), []byte(challenge)) == 1
+}
+
+func withQuery(rawURL string, query url.Values) string {
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+
+	return rawURL + separator + query.Encode()
+}
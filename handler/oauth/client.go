@@ -0,0 +1,156 @@
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/dto"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+// Client registers the third-party apps of the authenticated user.
+type Client struct {
+	ClientsRepository       repository.Clients
+	RefreshTokensRepository repository.RefreshTokens
+}
+
+func (cl Client) Create(c *gin.Context) {
+	req := dto.CreateClientRequest{}
+	if _, err := handler.BindRequest(c, "clients", "", &req); err != nil {
+		handler.AbortWithBindError(c, err)
+		return
+	}
+	if detail := validateClient(req); detail != "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, detail))
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	client, secret, err := cl.ClientsRepository.Add(userId.(int64), req.Name, req.RedirectURIs, req.Scopes, req.Confidential)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("internal server error while registering a client")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.Client{}
+	resp.FromEntity(client)
+	resp.ClientSecret = secret
+
+	c.Header("Location", fmt.Sprintf("/oauth2/clients/%d", client.ID))
+	c.Header("ETag", handler.ETag(client.Version))
+	c.Status(http.StatusCreated)
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+func (cl Client) List(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	clients, err := cl.ClientsRepository.List(userId.(int64))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch clients from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]*dto.Client, 0, len(clients))
+	for _, client := range clients {
+		r := dto.Client{}
+		r.FromEntity(client)
+		resp = append(resp, &r)
+	}
+	if err := handler.MarshalDocument(c, resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// Delete removes a client and revokes the refresh tokens issued to it.
+func (cl Client) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "invalid client id"))
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	client, err := cl.ClientsRepository.Delete(id, userId.(int64))
+	if err == repository.ErrClientNotFound {
+		c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "Client not found"))
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("internal server error while deleting a client")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := cl.RefreshTokensRepository.RevokeClient(client.ClientID); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to revoke the refresh tokens of a deleted client")
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// validateClient returns a problem detail for an invalid registration.
+// Redirect URIs must be absolute without a fragment; plain http is only
+// allowed for loopback addresses, custom schemes serve native apps.
+func validateClient(req dto.CreateClientRequest) string {
+	if req.Name == "" {
+		return "name is required"
+	}
+	if len(req.RedirectURIs) == 0 {
+		return "at least one redirect URI is required"
+	}
+	for _, raw := range req.RedirectURIs {
+		u, err := url.Parse(raw)
+		if err != nil || !u.IsAbs() || u.Fragment != "" || strings.Contains(raw, ",") {
+			return fmt.Sprintf("invalid redirect URI %q", raw)
+		}
+		if detail := checkRedirectScheme(u); detail != "" {
+			return fmt.Sprintf("redirect URI %q %s", raw, detail)
+		}
+	}
+	if len(req.Scopes) == 0 {
+		return "at least one scope is required"
+	}
+	for _, scope := range req.Scopes {
+		if !contains(entity.Permissions, scope) {
+			return fmt.Sprintf("unknown scope %q", scope)
+		}
+	}
+
+	return ""
+}
+
+// forbiddenSchemes run code or read files wherever the consent screen
+// navigates to them.
+var forbiddenSchemes = []string{"javascript", "data", "vbscript", "file", "blob", "about"}
+
+// checkRedirectScheme allows https, http for loopback addresses and, for
+// native apps, private-use schemes in reverse domain name notation such as
+// com.example.app, see RFC 8252 section 7.1.
+func checkRedirectScheme(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	switch {
+	case scheme == "https":
+		return ""
+	case scheme == "http":
+		if u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1" {
+			return ""
+		}
+		return "must use https"
+	case contains(forbiddenSchemes, scheme):
+		return "uses a forbidden scheme"
+	case strings.Contains(scheme, "."):
+		return ""
+	default:
+		return "must use https or a reverse domain name scheme"
+	}
+}
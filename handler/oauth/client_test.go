@@ -0,0 +1,33 @@
+package oauth
+
+import (
+	"testing"
+
+	"github.com/nargesbyt/todo.go/internal/dto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateClientRedirectURIs(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{"https://app.example.com/callback", true},
+		{"http://127.0.0.1:8123/callback", true},
+		{"http://localhost/callback", true},
+		{"com.example.app:/callback", true},
+		{"http://app.example.com/callback", false},
+		{"javascript:alert(1)", false},
+		{"JavaScript://example.com/%0aalert(1)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"vbscript:msgbox(1)", false},
+		{"file:///etc/passwd", false},
+		{"myapp:/callback", false},
+		{"https://app.example.com/callback#fragment", false},
+		{"/callback", false},
+	}
+	for _, tt := range tests {
+		req := dto.CreateClientRequest{Name: "app", RedirectURIs: []string{tt.uri}, Scopes: []string{"tasks:read"}}
+		assert.Equal(t, tt.valid, validateClient(req) == "", tt.uri)
+	}
+}
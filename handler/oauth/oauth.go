@@ -2,9 +2,17 @@ package oauth
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/handler"
 	"github.com/nargesbyt/todo.go/internal/random"
+	"github.com/nargesbyt/todo.go/internal/sso"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 	"golang.org/x/oauth2"
 	"net/http"
 	"time"
@@ -12,57 +20,143 @@ import (
 
 const stateKeyPrefix = "oidc:state:"
 
-type OAuth struct {
-	OAuth2Config oauth2.Config
-	RedisClient  *redis.Client
+// login is what a login started with Get needs to be finished by
+// Callback: the provider, the nonce the ID token must carry and the PKCE
+// code verifier.
+type login struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
 }
 
-func (a *OAuth) setState(state string) error {
+type OAuth struct {
+	Providers   *sso.Providers
+	Provisioner sso.Provisioner
+	RedisClient *redis.Client
+}
 
-	err := a.RedisClient.Set(context.Background(), stateKeyPrefix+state, true, time.Minute*5).Err()
+// setState remembers the login a state was issued for.
+func (a *OAuth) setState(state string, l login) error {
+	value, err := json.Marshal(l)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return a.RedisClient.Set(context.Background(), stateKeyPrefix+state, value, time.Minute*5).Err()
 }
-func (a *OAuth) isValidState(state string) (bool, error) {
 
-	exist, err := a.RedisClient.Exists(context.Background(), stateKeyPrefix+state).Result()
+// takeState consumes state and returns its login, and false when it was
+// not issued for a login with provider.
+func (a *OAuth) takeState(state string, provider string) (login, bool, error) {
+	var l login
+
+	value, err := a.RedisClient.GetDel(context.Background(), stateKeyPrefix+state).Bytes()
+	if err == redis.Nil {
+		return l, false, nil
+	}
 	if err != nil {
-		return false, err
+		return l, false, err
+	}
+	if err := json.Unmarshal(value, &l); err != nil {
+		return l, false, err
 	}
-	if exist == 1 {
-		return true, nil
+
+	return l, l.Provider == provider, nil
+}
+
+// pkceChallenge returns the S256 code_challenge of RFC 7636 for verifier.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (a *OAuth) provider(c *gin.Context) (*sso.Provider, bool) {
+	provider, err := a.Providers.Get(c.Param("provider"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "OIDC provider not found"))
+		return nil, false
 	}
-	return false, nil
+	return provider, true
 }
 
 func (a *OAuth) Get(c *gin.Context) {
+	provider, ok := a.provider(c)
+	if !ok {
+		return
+	}
+
 	state := random.Token(20)
-	err := a.setState(state)
+	l := login{Provider: provider.Name, Nonce: random.Token(20), Verifier: random.Token(64)}
+	err := a.setState(state, l)
 	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to store the OIDC state")
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	c.Redirect(http.StatusFound, a.OAuth2Config.AuthCodeURL(state))
+	c.Redirect(http.StatusFound, provider.OAuth2.AuthCodeURL(state,
+		oidc.Nonce(l.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", pkceChallenge(l.Verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	))
 }
 
 func (a *OAuth) Callback(c *gin.Context) {
-	state, err := a.isValidState(c.Query("state"))
+	provider, ok := a.provider(c)
+	if !ok {
+		return
+	}
+
+	l, ok, err := a.takeState(c.Query("state"), provider.Name)
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 
-	if !state {
+	if !ok {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	oauth2Token, err := a.OAuth2Config.Exchange(c, c.Query("code"))
+	oauth2Token, err := provider.OAuth2.Exchange(c, c.Query("code"), oauth2.SetAuthURLParam("code_verifier", l.Verifier))
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, oauth2Token.Extra("id_token").(string))
+	idToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadGateway, handler.NewProblem(http.StatusBadGateway, "the provider returned no ID token"))
+		return
+	}
+	verified, err := provider.Verifier.Verify(c, idToken)
+	if err != nil || subtle.ConstantTimeCompare([]byte(verified.Nonce), []byte(l.Nonce)) != 1 {
+		c.AbortWithStatusJSON(http.StatusBadGateway, handler.NewProblem(http.StatusBadGateway, "the provider returned an invalid ID token"))
+		return
+	}
+	identity, err := provider.Identity(verified)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadGateway, handler.NewProblem(http.StatusBadGateway, err.Error()))
+		return
+	}
+
+	// The first login creates the user, so the ID token can be used right
+	// away.
+	if _, err := a.Provisioner.User(provider, identity); err != nil {
+		AbortWithProvisionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, idToken)
+}
+
+// AbortWithProvisionError rejects an OIDC identity that has no user and can
+// not get one.
+func AbortWithProvisionError(c *gin.Context, err error) {
+	switch err {
+	case sso.ErrEmailNotVerified, sso.ErrDomainNotAllowed, sso.ErrAccountExists:
+		c.AbortWithStatusJSON(http.StatusForbidden, handler.NewProblem(http.StatusForbidden, err.Error()))
+	default:
+		log.Error().Stack().Err(err).Msg("unable to provision the user of an OIDC identity")
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
 }
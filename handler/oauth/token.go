@@ -0,0 +1,494 @@
+package oauth
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/jwt"
+	"github.com/nargesbyt/todo.go/internal/sso"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantPassword          = "password"
+	GrantRefreshToken      = "refresh_token"
+	GrantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+// tokenResponse is the successful response of RFC 6749 section 5.1.
+type tokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// AbortWithOAuthError responds with an error of RFC 6749 section 5.2.
+func AbortWithOAuthError(c *gin.Context, status int, code string, description string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": code, "error_description": description})
+}
+
+// introspection is the response of RFC 7662 section 2.2.
+type introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ID        string `json:"jti,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// Token issues our own short-lived access tokens, which are checked
+// without a database query, and refresh tokens to renew them. Third-party
+// clients get them through the authorization code flow.
+type Token struct {
+	UsersRepository         repository.Users
+	TokensRepository        repository.Tokens
+	RefreshTokensRepository repository.RefreshTokens
+	ClientsRepository       repository.Clients
+	RedisClient             *redis.Client
+	Providers               *sso.Providers
+	Provisioner             sso.Provisioner
+	Issuer                  *jwt.Issuer
+	RefreshTTL              time.Duration
+}
+
+// grant is what a grant type yields: a user, the scopes the tokens are
+// limited to and the client they are issued to. A non-empty problem
+// rejects the grant.
+type grant struct {
+	user     entity.User
+	scopes   []string
+	clientID string
+	familyID string
+	problem  string
+}
+
+// Create is the token endpoint. It redeems an authorization code or a
+// refresh token, and for our own clients also takes a password or
+// exchanges a personal access token or OIDC ID token.
+func (t Token) Create(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	client, ok := t.client(c)
+	if !ok {
+		return
+	}
+
+	var (
+		g          grant
+		issuedType string
+		err        error
+	)
+	grantType := c.PostForm("grant_type")
+	switch grantType {
+	case GrantAuthorizationCode:
+		if client.ClientID == "" {
+			AbortWithOAuthError(c, http.StatusUnauthorized, "invalid_client", "client authentication is required")
+			return
+		}
+		g, err = t.authorizationCode(client, c.PostForm("code"), c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+	case GrantPassword, GrantTokenExchange:
+		if client.ClientID != "" {
+			AbortWithOAuthError(c, http.StatusBadRequest, "unauthorized_client", "third-party clients must use the authorization code flow")
+			return
+		}
+		if grantType == GrantPassword {
+			g, err = t.password(c.PostForm("username"), c.PostForm("password"))
+			break
+		}
+		issuedType = TokenTypeAccessToken
+		g, err = t.exchange(c, c.PostForm("subject_token"), c.PostForm("subject_token_type"))
+	case GrantRefreshToken:
+		g, err = t.refresh(client.ClientID, c.PostForm("refresh_token"))
+	default:
+		AbortWithOAuthError(c, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code, password, refresh_token or token exchange")
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to check the grant")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if g.problem != "" {
+		AbortWithOAuthError(c, http.StatusBadRequest, "invalid_grant", g.problem)
+		return
+	}
+
+	scopes, ok := narrowScopes(g.scopes, c.PostForm("scope"))
+	if !ok {
+		AbortWithOAuthError(c, http.StatusBadRequest, "invalid_scope", "the scope is unknown or exceeds the granted scopes")
+		return
+	}
+
+	resp, err := t.issue(g.user, scopes, g.clientID, g.familyID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to issue tokens")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	resp.IssuedTokenType = issuedType
+	c.JSON(http.StatusOK, resp)
+}
+
+// JWKS publishes the keys that verify our access tokens.
+func (t Token) JWKS(c *gin.Context) {
+	set, err := t.Issuer.JWKS()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to load the signing keys")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
+
+func (t Token) issue(user entity.User, scopes []string, clientID string, familyID string) (tokenResponse, error) {
+	access, expiresAt, err := t.Issuer.Issue(user.ID, user.Role, scopes, clientID)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	_, refresh, err := t.RefreshTokensRepository.Add(user.ID, clientID, familyID, scopes, time.Now().Add(t.RefreshTTL))
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	return tokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
+		RefreshToken: refresh,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+func (t Token) password(username string, password string) (grant, error) {
+	user, err := t.UsersRepository.GetUserByUsername(username)
+	if err == repository.ErrUserNotFound {
+		return grant{problem: "invalid username or password"}, nil
+	}
+	if err != nil {
+		return grant{}, err
+	}
+	if user.CheckPassword(password) != nil {
+		return grant{problem: "invalid username or password"}, nil
+	}
+
+	return grant{user: user}, nil
+}
+
+// exchange trades a personal access token, keeping its scopes, or an OIDC
+// ID token, provisioning its user like a login does.
+func (t Token) exchange(c *gin.Context, subject string, subjectType string) (grant, error) {
+	switch subjectType {
+	case TokenTypeAccessToken:
+		token, err := t.TokensRepository.Lookup(subject)
+		if err == repository.ErrInvalidToken || (err == nil && !token.Usable(time.Now())) {
+			return grant{problem: "invalid personal access token"}, nil
+		}
+		if err != nil {
+			return grant{}, err
+		}
+		user, err := t.UsersRepository.GetUserByID(token.UserID)
+		if err != nil {
+			return grant{}, err
+		}
+
+		return grant{user: user, scopes: token.ScopeList()}, nil
+	case TokenTypeIDToken:
+		provider, idToken, err := t.Providers.Verify(c, subject)
+		if err != nil {
+			return grant{problem: "invalid ID token"}, nil
+		}
+		identity, err := provider.Identity(idToken)
+		if err != nil {
+			return grant{problem: "invalid ID token"}, nil
+		}
+		user, err := t.Provisioner.User(provider, identity)
+		switch err {
+		case nil:
+			return grant{user: user}, nil
+		case sso.ErrEmailNotVerified, sso.ErrDomainNotAllowed, sso.ErrAccountExists:
+			return grant{problem: err.Error()}, nil
+		default:
+			return grant{}, err
+		}
+	default:
+		return grant{problem: "subject_token_type must be an access token or an ID token"}, nil
+	}
+}
+
+// authorizationCode redeems a code of the authorization code flow. The
+// code_verifier proves the client redeeming it is the one that asked for
+// it. A redirect_uri sent with the authorization request must be sent
+// again, see RFC 6749 section 4.1.3.
+func (t Token) authorizationCode(client entity.Client, code string, redirectURI string, verifier string) (grant, error) {
+	request, err := takeAuthorization(t.RedisClient, codeKeyPrefix+code)
+	if err == redis.Nil {
+		return grant{problem: "invalid authorization code"}, nil
+	}
+	if err != nil {
+		return grant{}, err
+	}
+	if request.RedirectURISent && redirectURI == "" {
+		return grant{problem: "redirect_uri is required"}, nil
+	}
+	if request.ClientID != client.ClientID || (redirectURI != "" && redirectURI != request.RedirectURI) {
+		return grant{problem: "invalid authorization code"}, nil
+	}
+	if !verifyPKCE(request.CodeChallenge, verifier) {
+		return grant{problem: "invalid code_verifier"}, nil
+	}
+
+	user, err := t.UsersRepository.GetUserByID(request.UserID)
+	if err == repository.ErrUserNotFound {
+		return grant{problem: "invalid authorization code"}, nil
+	}
+	if err != nil {
+		return grant{}, err
+	}
+
+	return grant{user: user, scopes: request.Scopes, clientID: client.ClientID}, nil
+}
+
+// refresh redeems a refresh token. The new tokens keep its scopes, client
+// and family, so a reuse of any of them revokes the lot. A token shown by
+// another client than its own has leaked too.
+func (t Token) refresh(clientID string, raw string) (grant, error) {
+	token, err := t.RefreshTokensRepository.Use(raw)
+	if err == repository.ErrInvalidRefreshToken || err == repository.ErrRefreshTokenReused {
+		return grant{problem: err.Error()}, nil
+	}
+	if err != nil {
+		return grant{}, err
+	}
+	if token.ClientID != clientID {
+		if err := t.RefreshTokensRepository.RevokeFamily(token.FamilyID); err != nil {
+			return grant{}, err
+		}
+
+		return grant{problem: repository.ErrInvalidRefreshToken.Error()}, nil
+	}
+	user, err := t.UsersRepository.GetUserByID(token.UserID)
+	if err == repository.ErrUserNotFound {
+		return grant{problem: repository.ErrInvalidRefreshToken.Error()}, nil
+	}
+	if err != nil {
+		return grant{}, err
+	}
+
+	return grant{user: user, scopes: token.ScopeList(), clientID: token.ClientID, familyID: token.FamilyID}, nil
+}
+
+// Revoke revokes a refresh token of the requesting client, see RFC 7009.
+// Its whole family is revoked. Access tokens are not stored, so they can
+// not be revoked and expire on their own shortly.
+func (t Token) Revoke(c *gin.Context) {
+	client, ok := t.requireClient(c, false)
+	if !ok {
+		return
+	}
+
+	raw := c.PostForm("token")
+	if !strings.HasPrefix(raw, entity.RefreshTokenPrefix) {
+		if _, err := t.Issuer.Verify(raw); err == nil {
+			AbortWithOAuthError(c, http.StatusBadRequest, "unsupported_token_type", "access tokens can not be revoked, they expire shortly")
+			return
+		}
+		// Unknown tokens count as revoked.
+		c.Status(http.StatusOK)
+		return
+	}
+
+	token, err := t.RefreshTokensRepository.Find(raw)
+	if err == repository.ErrInvalidRefreshToken {
+		c.Status(http.StatusOK)
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to load the refresh token")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if token.ClientID != client.ClientID {
+		AbortWithOAuthError(c, http.StatusBadRequest, "unauthorized_client", "the token was not issued to the client")
+		return
+	}
+	if err := t.RefreshTokensRepository.RevokeFamily(token.FamilyID); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to revoke the refresh token")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// Introspect tells a confidential client whether one of its tokens is
+// active, see RFC 7662. Tokens of other clients are reported inactive.
+func (t Token) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	client, ok := t.requireClient(c, true)
+	if !ok {
+		return
+	}
+
+	raw := c.PostForm("token")
+	resp := introspection{}
+	if strings.HasPrefix(raw, entity.RefreshTokenPrefix) {
+		token, err := t.RefreshTokensRepository.Find(raw)
+		if err != nil && err != repository.ErrInvalidRefreshToken {
+			log.Error().Stack().Err(err).Msg("unable to load the refresh token")
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if err == nil && token.ClientID == client.ClientID {
+			resp = introspection{
+				Active:    true,
+				Scope:     strings.Join(token.ScopeList(), " "),
+				ClientID:  token.ClientID,
+				TokenType: "refresh_token",
+				Subject:   strconv.FormatInt(token.UserID, 10),
+				Issuer:    t.Issuer.URL,
+				ExpiresAt: token.ExpiresAt.Unix(),
+				IssuedAt:  token.CreatedAt.Unix(),
+			}
+		}
+	} else if claims, err := t.Issuer.Verify(raw); err == nil && claims.ClientID == client.ClientID {
+		resp = introspection{
+			Active:    true,
+			Scope:     strings.Join(claims.Scopes, " "),
+			ClientID:  claims.ClientID,
+			TokenType: "Bearer",
+			Subject:   strconv.FormatInt(claims.UserID, 10),
+			Issuer:    t.Issuer.URL,
+			ID:        claims.ID,
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Metadata describes the authorization server, see RFC 8414.
+func (t Token) Metadata(c *gin.Context) {
+	base := strings.TrimSuffix(t.Issuer.URL, "/")
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                t.Issuer.URL,
+		"authorization_endpoint":                base + "/oauth2/authorize",
+		"token_endpoint":                        base + "/auth/token",
+		"jwks_uri":                              base + "/.well-known/jwks.json",
+		"revocation_endpoint":                   base + "/oauth2/revoke",
+		"introspection_endpoint":                base + "/oauth2/introspect",
+		"scopes_supported":                      entity.Permissions,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{GrantAuthorizationCode, GrantRefreshToken, GrantPassword, GrantTokenExchange},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+// client authenticates the client of a request by HTTP Basic auth or the
+// client_id and client_secret form fields, see RFC 6749 section 2.3.1.
+// Public clients only send their client_id. A request naming no client
+// returns a zero client; it returns false once the request is aborted.
+func (t Token) client(c *gin.Context) (entity.Client, bool) {
+	id, secret, basic := c.Request.BasicAuth()
+	if basic {
+		var err error
+		if id, err = url.QueryUnescape(id); err == nil {
+			secret, err = url.QueryUnescape(secret)
+		}
+		if err != nil {
+			abortInvalidClient(c, basic)
+			return entity.Client{}, false
+		}
+	} else {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	if id == "" {
+		return entity.Client{}, true
+	}
+
+	client, err := t.ClientsRepository.Get(id)
+	if err != nil && err != repository.ErrClientNotFound {
+		log.Error().Stack().Err(err).Msg("unable to load the client")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return entity.Client{}, false
+	}
+	if err != nil || (client.Confidential() && !client.VerifySecret(secret)) || (!client.Confidential() && secret != "") {
+		abortInvalidClient(c, basic)
+		return entity.Client{}, false
+	}
+
+	return client, true
+}
+
+// requireClient is client for the endpoints only clients may use.
+func (t Token) requireClient(c *gin.Context, confidential bool) (entity.Client, bool) {
+	client, ok := t.client(c)
+	if !ok {
+		return client, false
+	}
+	if client.ClientID == "" || (confidential && !client.Confidential()) {
+		abortInvalidClient(c, false)
+		return client, false
+	}
+
+	return client, true
+}
+
+func abortInvalidClient(c *gin.Context, basic bool) {
+	if basic {
+		c.Header("WWW-Authenticate", `Basic realm="todo"`)
+	}
+	AbortWithOAuthError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+}
+
+// narrowScopes limits granted to the space separated requested scopes.
+// Without a request the granted scopes are kept; nil grants are not
+// limited. It returns false for unknown scopes or ones beyond the grant.
+func narrowScopes(granted []string, requested string) ([]string, bool) {
+	fields := strings.Fields(requested)
+	if len(fields) == 0 {
+		return granted, true
+	}
+
+	var scopes []string
+	for _, scope := range fields {
+		if !contains(entity.Permissions, scope) || (granted != nil && !contains(granted, scope)) {
+			return nil, false
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return scopes, true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"github.com/nargesbyt/todo.go/repository"
+)
+
+const (
+	QueryParamPageAfter  = "page[after]"
+	QueryParamPageBefore = "page[before]"
+)
+
+var ErrInvalidPageParam = errors.New("invalid pagination parameter")
+
+// ParsePage reads page[after], page[before] and page[limit] from the query
+// string. A missing limit falls back to the default and a too large one is
+// capped to the maximum page size.
+func ParsePage(c *gin.Context) (repository.Page, error) {
+	page := repository.Page{Limit: repository.DefaultPageLimit}
+
+	if limit := c.Query(jsonapi.QueryParamPageLimit); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 {
+			return page, ErrInvalidPageParam
+		}
+		if l > repository.MaxPageLimit {
+			l = repository.MaxPageLimit
+		}
+		page.Limit = l
+	}
+
+	var err error
+	if after := c.Query(QueryParamPageAfter); after != "" {
+		page.After, err = strconv.ParseInt(after, 10, 64)
+		if err != nil || page.After < 1 {
+			return page, ErrInvalidPageParam
+		}
+	}
+	if before := c.Query(QueryParamPageBefore); before != "" {
+		page.Before, err = strconv.ParseInt(before, 10, 64)
+		if err != nil || page.Before < 1 {
+			return page, ErrInvalidPageParam
+		}
+	}
+	if page.After > 0 && page.Before > 0 {
+		return page, ErrInvalidPageParam
+	}
+
+	return page, nil
+}
+
+// PageLinks builds the self, first, prev, next and last links of a page,
+// keeping every other query parameter of the request.
+func PageLinks(u *url.URL, page repository.Page, info repository.PageInfo) *jsonapi.Links {
+	link := func(cursor string, id int64) string {
+		l := *u
+		q := l.Query()
+		q.Del(QueryParamPageAfter)
+		q.Del(QueryParamPageBefore)
+		q.Set(jsonapi.QueryParamPageLimit, strconv.Itoa(page.Limit))
+		if cursor != "" {
+			q.Set(cursor, strconv.FormatInt(id, 10))
+		}
+		l.RawQuery = q.Encode()
+
+		return l.RequestURI()
+	}
+
+	links := jsonapi.Links{
+		"self":  u.RequestURI(),
+		"first": link("", 0),
+		"last":  link("", 0),
+		"prev":  nil,
+		"next":  nil,
+	}
+	if info.Total > int64(page.Limit) {
+		links["last"] = link(QueryParamPageBefore, info.MaxID+1)
+	}
+	if info.HasPrev && info.StartID > 0 {
+		links["prev"] = link(QueryParamPageBefore, info.StartID)
+	}
+	if info.HasNext && info.EndID > 0 {
+		links["next"] = link(QueryParamPageAfter, info.EndID)
+	}
+
+	return &links
+}
+
+// MarshalPage writes models as a JSON:API collection shaped by d, carrying
+// pagination links and the total number of matching resources in meta.
+func MarshalPage(c *gin.Context, models interface{}, d Document, page repository.Page, info repository.PageInfo) error {
+	payload, err := jsonapi.Marshal(models)
+	if err != nil {
+		return err
+	}
+	d.Apply(payload)
+
+	if many, ok := payload.(*jsonapi.ManyPayload); ok {
+		many.Links = PageLinks(c.Request.URL, page, info)
+		many.Meta = &jsonapi.Meta{
+			"total": info.Total,
+			"limit": page.Limit,
+		}
+	}
+
+	c.Header("Content-Type", jsonapi.MediaType)
+
+	return json.NewEncoder(c.Writer).Encode(payload)
+}
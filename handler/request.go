@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+)
+
+var (
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrInvalidDocument      = errors.New("invalid JSON:API document")
+	ErrResourceConflict     = errors.New("resource type or id does not match the endpoint")
+)
+
+// ResourceIdentifier identifies a related resource in a request document.
+type ResourceIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type relationship struct {
+	Data *ResourceIdentifier `json:"data"`
+}
+
+type requestDocument struct {
+	Data *struct {
+		Type          string                  `json:"type"`
+		ID            string                  `json:"id"`
+		Attributes    json.RawMessage         `json:"attributes"`
+		Relationships map[string]relationship `json:"relationships"`
+	} `json:"data"`
+}
+
+// Relationships maps relationship names of a request document to the
+// resource they point at.
+type Relationships map[string]*ResourceIdentifier
+
+// BindRequest decodes the body of a write request into req. A JSON:API
+// document must have the given resource type and, when id is not empty,
+// the same id; its attributes are decoded into req using its json tags.
+// Any other content type is bound as plain JSON.
+func BindRequest(c *gin.Context, resourceType string, id string, req interface{}) (Relationships, error) {
+	contentType := c.GetHeader("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if contentType == "" || err != nil || mediaType != jsonapi.MediaType {
+		return nil, c.ShouldBindJSON(req)
+	}
+	if len(params) > 0 {
+		return nil, ErrUnsupportedMediaType
+	}
+
+	var doc requestDocument
+	decoder := json.NewDecoder(c.Request.Body)
+	if err := decoder.Decode(&doc); err != nil || doc.Data == nil {
+		return nil, ErrInvalidDocument
+	}
+	if doc.Data.Type != resourceType || (id != "" && doc.Data.ID != id) {
+		return nil, ErrResourceConflict
+	}
+
+	if len(doc.Data.Attributes) > 0 {
+		if err := json.NewDecoder(bytes.NewReader(doc.Data.Attributes)).Decode(req); err != nil {
+			return nil, ErrInvalidDocument
+		}
+	}
+
+	relationships := Relationships{}
+	for name, rel := range doc.Data.Relationships {
+		relationships[name] = rel.Data
+	}
+
+	return relationships, nil
+}
+
+// AbortWithBindError aborts the request with the status matching an error
+// returned by BindRequest.
+func AbortWithBindError(c *gin.Context, err error) {
+	switch err {
+	case ErrUnsupportedMediaType:
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, NewProblem(http.StatusUnsupportedMediaType, err.Error()))
+	case ErrResourceConflict:
+		c.AbortWithStatusJSON(http.StatusConflict, NewProblem(http.StatusConflict, err.Error()))
+	default:
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, NewProblem(http.StatusUnprocessableEntity, err.Error()))
+	}
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+type cachedRole struct {
+	role    entity.Role
+	expires time.Time
+}
+
+// Authorizer checks the permissions of the role of the authenticated user.
+// Roles are cached for TTL, so changes to them apply after at most TTL.
+type Authorizer struct {
+	Roles repository.Roles
+	TTL   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedRole
+}
+
+func NewAuthorizer(roles repository.Roles, ttl time.Duration) *Authorizer {
+	return &Authorizer{Roles: roles, TTL: ttl, cache: map[string]cachedRole{}}
+}
+
+// Role returns the role with the given name. An unknown role grants
+// nothing.
+func (a *Authorizer) Role(name string) (entity.Role, error) {
+	a.mu.Lock()
+	cached, ok := a.cache[name]
+	a.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.role, nil
+	}
+
+	role, err := a.Roles.Get(name)
+	if err == repository.ErrRoleNotFound {
+		role, err = entity.Role{Name: name}, nil
+	}
+	if err != nil {
+		return role, err
+	}
+
+	a.mu.Lock()
+	a.cache[name] = cachedRole{role: role, expires: time.Now().Add(a.TTL)}
+	a.mu.Unlock()
+
+	return role, nil
+}
+
+// Granted returns the permissions of the authenticated user, limited to
+// the scopes of the token the request was authenticated with.
+func (a *Authorizer) Granted(c *gin.Context) ([]string, error) {
+	role, err := a.Role(c.GetString("role"))
+	if err != nil {
+		return nil, err
+	}
+
+	granted := []string{}
+	for _, p := range role.Granted() {
+		if inScope(c, p) {
+			granted = append(granted, p)
+		}
+	}
+
+	return granted, nil
+}
+
+// Require lets a request through only when the authenticated user has all
+// the permissions and, for tokens, all of them are in scope. It must run
+// after the authentication middleware.
+func (a *Authorizer) Require(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requireScopes(c, permissions) {
+			return
+		}
+		granted, ok := a.grants(c, permissions)
+		if !ok {
+			return
+		}
+		if !granted {
+			AbortWithForbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSelf lets a request through when the route parameter param is the
+// id of the authenticated user, or when the user has all the permissions.
+// Tokens need the profile scope for the user's own account and the
+// permissions in scope for others, so a token limited to tasks can not
+// change the account.
+func (a *Authorizer) RequireSelf(param string, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, ok := c.Get("userId")
+		id, err := strconv.ParseInt(c.Param(param), 10, 64)
+		if ok && err == nil && userId.(int64) == id {
+			if requireScopes(c, []string{entity.PermissionProfile}) {
+				c.Next()
+			}
+			return
+		}
+
+		if !requireScopes(c, permissions) {
+			return
+		}
+		granted, ok := a.grants(c, permissions)
+		if !ok {
+			return
+		}
+		if !granted {
+			AbortWithForbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// grants reports whether the role of the authenticated user has all the
+// permissions. It aborts the request and returns false for ok when the
+// role can not be loaded.
+func (a *Authorizer) grants(c *gin.Context, permissions []string) (granted bool, ok bool) {
+	role, err := a.Role(c.GetString("role"))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to load role")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return false, false
+	}
+	for _, p := range permissions {
+		if !role.Grants(p) {
+			return false, true
+		}
+	}
+
+	return true, true
+}
+
+// requireScopes aborts the request when it was authenticated with a token
+// that lacks one of the permissions in its scopes.
+func requireScopes(c *gin.Context, permissions []string) bool {
+	for _, p := range permissions {
+		if !inScope(c, p) {
+			c.AbortWithStatusJSON(http.StatusForbidden, NewProblem(http.StatusForbidden, fmt.Sprintf("token is missing the %s scope", p)))
+			return false
+		}
+	}
+
+	return true
+}
+
+// inScope reports whether the token of the request allows a permission.
+// Requests not authenticated with a scoped token are not limited.
+func inScope(c *gin.Context, permission string) bool {
+	scopes, ok := c.Get("scopes")
+	if !ok {
+		return true
+	}
+	for _, s := range scopes.([]string) {
+		if s == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+func AbortWithForbidden(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, NewProblem(http.StatusForbidden, "permission is denied"))
+}
+
+// RequireUnscoped lets a request through only when it was not
+// authenticated with a scoped token. It guards the routes that can take
+// over the account, which no scope covers, so a token limited to tasks can
+// not link a sign-in identity for example.
+func RequireUnscoped(c *gin.Context) {
+	if _, ok := c.Get("scopes"); ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, NewProblem(http.StatusForbidden, "this requires a session, a password or an unscoped token"))
+		return
+	}
+	c.Next()
+}
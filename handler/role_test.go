@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRoles serves the default roles.
+type fakeRoles struct{}
+
+func (fakeRoles) Get(name string) (entity.Role, error) {
+	for _, role := range entity.DefaultRoles() {
+		if role.Name == name {
+			return role, nil
+		}
+	}
+
+	return entity.Role{}, repository.ErrRoleNotFound
+}
+
+func (fakeRoles) List() ([]entity.Role, error) {
+	return entity.DefaultRoles(), nil
+}
+
+func (fakeRoles) Seed([]entity.Role) error {
+	return nil
+}
+
+func TestRequireSelf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authz := NewAuthorizer(fakeRoles{}, time.Minute)
+
+	tests := []struct {
+		name   string
+		id     string
+		role   string
+		scopes []string
+		status int
+	}{
+		{name: "Self", id: "1", role: entity.RoleViewer, status: http.StatusOK},
+		{name: "SelfWithProfileScope", id: "1", role: entity.RoleUser, scopes: []string{entity.PermissionProfile}, status: http.StatusOK},
+		{name: "SelfWithTasksScope", id: "1", role: entity.RoleAdmin, scopes: []string{entity.PermissionTasksWrite}, status: http.StatusForbidden},
+		{name: "Other", id: "2", role: entity.RoleUser, status: http.StatusForbidden},
+		{name: "OtherAsAdmin", id: "2", role: entity.RoleAdmin, status: http.StatusOK},
+		{name: "OtherAsAdminWithProfileScope", id: "2", role: entity.RoleAdmin, scopes: []string{entity.PermissionProfile}, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/users/:id", func(c *gin.Context) {
+				c.Set("userId", int64(1))
+				c.Set("role", tt.role)
+				if tt.scopes != nil {
+					c.Set("scopes", tt.scopes)
+				}
+			}, authz.RequireSelf("id", entity.PermissionUsersAdmin), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/users/"+tt.id, nil))
+			assert.Equal(t, tt.status, resp.Code)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/dto"
+	"github.com/nargesbyt/todo.go/internal/session"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+// Session signs browsers in with a session cookie instead of sending the
+// password on every request.
+type Session struct {
+	UsersRepository repository.Users
+	Store           *session.Store
+	// Secure limits the cookies to HTTPS; only turn it off for local
+	// development.
+	Secure bool
+}
+
+func (s Session) Login(c *gin.Context) {
+	req := dto.LoginRequest{}
+	if _, err := handler.BindRequest(c, "sessions", "", &req); err != nil {
+		handler.AbortWithBindError(c, err)
+		return
+	}
+
+	user, err := s.UsersRepository.GetUserByUsername(req.Username)
+	if err != nil && err != repository.ErrUserNotFound {
+		log.Error().Stack().Err(err).Msg("unable to load the user")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err != nil || user.CheckPassword(req.Password) != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, handler.NewProblem(http.StatusUnauthorized, "invalid username or password"))
+		return
+	}
+
+	sess, cookie, err := s.Store.Create(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to create a session")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	maxAge := int(s.Store.AbsoluteTimeout.Seconds())
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(session.CookieName, cookie, maxAge, "/", "", s.Secure, true)
+	// Scripts read the CSRF token from its own cookie to send it back in
+	// the X-CSRF-Token header.
+	c.SetCookie(session.CSRFCookieName, sess.CSRFToken, maxAge, "/", "", s.Secure, false)
+
+	resp := dto.Session{}
+	resp.FromEntity(sess)
+	resp.Current = true
+	resp.CSRFToken = sess.CSRFToken
+	c.Status(http.StatusCreated)
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// Logout ends the session the request was made with.
+func (s Session) Logout(c *gin.Context) {
+	if id := c.GetString("sessionId"); id != "" {
+		userId, _ := c.Get("userId")
+		if err := s.Store.Delete(userId.(int64), id); err != nil && err != session.ErrSessionNotFound {
+			log.Error().Stack().Err(err).Msg("unable to delete the session")
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(session.CookieName, "", -1, "/", "", s.Secure, true)
+	c.SetCookie(session.CSRFCookieName, "", -1, "/", "", s.Secure, false)
+	c.Status(http.StatusNoContent)
+}
+
+// List lists the sessions of the authenticated user.
+func (s Session) List(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	sessions, err := s.Store.List(userId.(int64))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to list sessions")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]*dto.Session, 0, len(sessions))
+	for _, sess := range sessions {
+		r := dto.Session{}
+		r.FromEntity(sess)
+		r.Current = sess.ID == c.GetString("sessionId")
+		resp = append(resp, &r)
+	}
+	if err := handler.MarshalDocument(c, resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// Delete revokes a session of the authenticated user, e.g. on a lost
+// device.
+func (s Session) Delete(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	err := s.Store.Delete(userId.(int64), c.Param("id"))
+	if err == session.ErrSessionNotFound {
+		c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "Session not found"))
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to delete the session")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package share
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/dto"
+	"github.com/nargesbyt/todo.go/internal/transfer"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+// Share lets users share the boards of their projects with other users,
+// who can then follow them on the collaboration channel.
+type Share struct {
+	SharesRepository repository.Shares
+	UsersRepository  repository.Users
+}
+
+// Create shares the project in the path with the user named in the body.
+func (s Share) Create(c *gin.Context) {
+	project, ok := projectKey(c)
+	if !ok {
+		return
+	}
+
+	req := dto.CreateShareRequest{}
+	if _, err := handler.BindRequest(c, "shares", "", &req); err != nil {
+		log.Error().Stack().Err(err).Msg("unprocessable entity")
+		handler.AbortWithBindError(c, err)
+
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	user, err := s.UsersRepository.GetUserByUsername(req.Username)
+	if err == repository.ErrUserNotFound {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, "user not found"))
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to find user")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if user.ID == userId.(int64) {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, "projects can not be shared with their owner"))
+		return
+	}
+
+	share, err := s.SharesRepository.Create(userId.(int64), project, user.ID)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to share project")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.Share{}
+	resp.FromEntity(share)
+	c.Header("Location", fmt.Sprintf("/projects/%s/shares/%s", project, user.Username))
+	c.Status(http.StatusCreated)
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// List returns the users the project in the path is shared with.
+func (s Share) List(c *gin.Context) {
+	project, ok := projectKey(c)
+	if !ok {
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	shares, err := s.SharesRepository.List(userId.(int64), project)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch shares from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	respond(c, shares)
+}
+
+// SharedWith returns the projects of other users shared with the
+// authenticated user.
+func (s Share) SharedWith(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	shares, err := s.SharesRepository.SharedWith(userId.(int64))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch shares from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	respond(c, shares)
+}
+
+// Delete stops sharing the project in the path with a user.
+func (s Share) Delete(c *gin.Context) {
+	project, ok := projectKey(c)
+	if !ok {
+		return
+	}
+
+	user, err := s.UsersRepository.GetUserByUsername(c.Param("username"))
+	if err == repository.ErrUserNotFound {
+		c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, repository.ErrShareNotFound.Error()))
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to find user")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	err = s.SharesRepository.Delete(userId.(int64), project, user.ID)
+	if err == repository.ErrShareNotFound {
+		c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, err.Error()))
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to delete share")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// projectKey returns the key of the project in the path, aborting the
+// request with 422 when the name has none, like a lone "+".
+func projectKey(c *gin.Context) (string, bool) {
+	project := transfer.ProjectKey(c.Param("project"))
+	if project == "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, "project name is required"))
+		return "", false
+	}
+
+	return project, true
+}
+
+func respond(c *gin.Context, shares []*entity.Share) {
+	resp := []*dto.Share{}
+	for _, share := range shares {
+		s := dto.Share{}
+		s.FromEntity(*share)
+		resp = append(resp, &s)
+	}
+	if err := handler.MarshalDocument(c, resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
@@ -0,0 +1,36 @@
+package share
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmptyProject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	shares := new(repository.MockShareRepository)
+	s := Share{SharesRepository: shares}
+
+	r := gin.New()
+	auth := func(c *gin.Context) { c.Set("userId", int64(1)) }
+	r.POST("/projects/:project/shares", auth, s.Create)
+	r.GET("/projects/:project/shares", auth, s.List)
+	r.DELETE("/projects/:project/shares/:username", auth, s.Delete)
+
+	body := `{"data":{"type":"shares","attributes":{"username":"sara"}}}`
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/projects/+/shares", strings.NewReader(body)),
+		httptest.NewRequest(http.MethodGet, "/projects/%20/shares", nil),
+		httptest.NewRequest(http.MethodDelete, "/projects/+/shares/sara", nil),
+	} {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, req.Method)
+	}
+	shares.AssertExpectations(t)
+}
@@ -0,0 +1,76 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/stats"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultDays = 30
+	maxDays     = 366
+	keyPrefix   = "stats:"
+)
+
+type Stats struct {
+	TasksRepository repository.Tasks
+	RedisClient     *redis.Client
+	// TTL is how long a report is cached; zero disables the cache.
+	TTL time.Duration
+}
+
+// Get reports the task statistics of the authenticated user. The days
+// query parameter sets how many days the per day counts cover.
+func (s Stats) Get(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultDays)))
+	if err != nil || days < 1 || days > maxDays {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, fmt.Sprintf("days must be between 1 and %d", maxDays)))
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	key := fmt.Sprintf("%s%d:%d", keyPrefix, userId.(int64), days)
+	if s.TTL > 0 {
+		cached, err := s.RedisClient.Get(context.Background(), key).Bytes()
+		if err == nil {
+			c.Data(http.StatusOK, "application/json; charset=utf-8", cached)
+			return
+		}
+		if err != redis.Nil {
+			log.Error().Stack().Err(err).Msg("unable to read cached stats")
+		}
+	}
+
+	now := time.Now().UTC()
+	since := now.Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	taskStats, err := s.TasksRepository.Stats(userId.(int64), since, now)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to compute stats")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, handler.NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+
+	body, err := json.Marshal(stats.NewReport(taskStats, since, now))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if s.TTL > 0 {
+		if err := s.RedisClient.Set(context.Background(), key, body, s.TTL).Err(); err != nil {
+			log.Error().Stack().Err(err).Msg("unable to cache stats")
+		}
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
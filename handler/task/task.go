@@ -3,7 +3,6 @@ package task
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/google/jsonapi"
 	"github.com/nargesbyt/todo.go/handler"
 	"github.com/nargesbyt/todo.go/internal/dto"
 	"github.com/nargesbyt/todo.go/repository"
@@ -17,12 +16,18 @@ type Task struct {
 }
 
 func (t Task) List(c *gin.Context) {
-
-	pageNumber, _ := strconv.Atoi(c.Query(jsonapi.QueryParamPageNumber))
-	limit, _ := strconv.Atoi(c.Query(jsonapi.QueryParamPageLimit))
+	doc, err := handler.ParseDocument(c, "user")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+	page, err := handler.ParsePage(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
 	userId, _ := c.Get("userId")
-	tasks, err := t.TasksRepository.Find(c.Query("title"), c.Query("status"), userId.(int64), pageNumber, limit)
-	fmt.Println("tasks are: ", tasks)
+	tasks, pageInfo, err := t.TasksRepository.Find(c.Query("title"), c.Query("status"), userId.(int64), page)
 	if err != nil {
 		log.Error().Stack().Err(err).Msg("internal server error")
 
@@ -39,13 +44,17 @@ func (t Task) List(c *gin.Context) {
 		dtoTasks = append(dtoTasks, &resp)
 
 	}
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, dtoTasks); err != nil {
+	if err := handler.MarshalPage(c, dtoTasks, doc, page, pageInfo); err != nil {
 		log.Fatal().Err(err).Msg("can not respond")
 	}
 
 }
 func (t Task) Get(c *gin.Context) {
+	doc, err := handler.ParseDocument(c, "user")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "invalid task id"))
@@ -74,23 +83,35 @@ func (t Task) Get(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", handler.ETag(task.Version))
+	if handler.NotModified(c, task.Version) {
+		c.AbortWithStatus(http.StatusNotModified)
+
+		return
+	}
+
 	resp := dto.Task{}
 	resp.FromEntity(task)
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, &resp); err != nil {
+	if err := handler.MarshalDocument(c, &resp, doc); err != nil {
 		log.Fatal().Err(err).Msg("can not respond")
 	}
 }
 
 func (t Task) Create(c *gin.Context) {
 	cRequest := dto.TaskCreateRequest{}
-	if err := c.BindJSON(&cRequest); err != nil {
+	relationships, err := handler.BindRequest(c, "tasks", "", &cRequest)
+	if err != nil {
 		log.Error().Stack().Err(err).Msg("unprocessable entity")
-		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		handler.AbortWithBindError(c, err)
 
 		return
 	}
 	userId, _ := c.Get("userId")
+	if user := relationships["user"]; user != nil && (user.Type != "users" || user.ID != strconv.FormatInt(userId.(int64), 10)) {
+		c.AbortWithStatusJSON(http.StatusForbidden, handler.NewProblem(http.StatusForbidden, "tasks can only be created for the authenticated user"))
+
+		return
+	}
 	task, err := t.TasksRepository.Create(cRequest.Title, userId.(int64))
 	if err != nil {
 		log.Error().Stack().Err(err).Msg("internal server error")
@@ -100,8 +121,10 @@ func (t Task) Create(c *gin.Context) {
 	}
 	resp := dto.Task{}
 	resp.FromEntity(task)
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, &resp); err != nil {
+	c.Header("Location", fmt.Sprintf("/tasks/%d", task.ID))
+	c.Header("ETag", handler.ETag(task.Version))
+	c.Status(http.StatusCreated)
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
 		log.Fatal().Err(err).Msg("can not respond")
 	}
 }
@@ -135,8 +158,19 @@ func (t Task) Delete(c *gin.Context) {
 
 		return
 	}
-	err = t.TasksRepository.Delete(id)
+	version, ok := handler.IfMatch(c, task.Version)
+	if !ok {
+		handler.AbortWithPreconditionFailed(c)
+
+		return
+	}
+	err = t.TasksRepository.Delete(id, version)
 	if err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+
+			return
+		}
 		/*if err == repository.ErrTaskNotFound {
 			log.Error().Stack().Err(err).Msg("task not found")
 			c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "Task not found"))
@@ -179,17 +213,29 @@ func (t Task) Update(c *gin.Context) {
 		return
 	}
 
+	version, ok := handler.IfMatch(c, task.Version)
+	if !ok {
+		handler.AbortWithPreconditionFailed(c)
+
+		return
+	}
+
 	uRequest := dto.TaskUpdateRequest{}
-	if err := c.BindJSON(&uRequest); err != nil {
+	if _, err := handler.BindRequest(c, "tasks", c.Param("id"), &uRequest); err != nil {
 		log.Error().Stack().Err(err).Msg("unprocessable entity")
-		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		handler.AbortWithBindError(c, err)
 
 		return
 	}
 
 	resp := dto.Task{}
-	updateResult, err := t.TasksRepository.Update(id, uRequest.Title, uRequest.Status)
+	updateResult, err := t.TasksRepository.Update(id, uRequest.Title, uRequest.Status, version)
 	if err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+
+			return
+		}
 		if err == repository.ErrUnauthorized {
 			log.Error().Stack().Err(err).Msg("unauthorized")
 			c.AbortWithStatus(http.StatusUnauthorized)
@@ -203,8 +249,8 @@ func (t Task) Update(c *gin.Context) {
 		return
 	}
 	resp.FromEntity(updateResult)
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, &resp); err != nil {
+	c.Header("ETag", handler.ETag(updateResult.Version))
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
 		log.Fatal().Err(err).Msg("can not respond")
 	}
 }
@@ -53,7 +53,7 @@ func TestGet(t *testing.T) {
 		r.ServeHTTP(resp, c.Request)
 
 		buf := bytes.NewBuffer(nil)
-		err = jsonapi.MarshalPayload(buf, &response)
+		err = jsonapi.MarshalPayloadWithoutIncluded(buf, &response)
 		assert.NoError(t, err)
 
 		assert.Equal(t, http.StatusOK, resp.Code)
@@ -61,6 +61,85 @@ func TestGet(t *testing.T) {
 		assert.True(t, mockTaskRepository.AssertExpectations(t))
 	})
 
+	t.Run("IncludeAndFields", func(t *testing.T) {
+		var id int64 = 5
+		mockTaskResp := entity.Task{
+			ID:        id,
+			Title:     "New task",
+			Status:    "pending",
+			CreatedAt: time.Now(),
+			UserID:    1,
+			User:      entity.User{ID: 1, Username: "ali", Email: "ali@yahoo.com"},
+		}
+		mockTaskRepository := new(repository.MockTaskRepository)
+		mockTaskRepository.On("Get", id).Return(mockTaskResp, nil)
+		taskHandler := Task{mockTaskRepository}
+
+		rr := httptest.NewRecorder()
+		c, r := gin.CreateTestContext(rr)
+		r.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
+		r.GET("/tasks/:id", taskHandler.Get)
+
+		var err error
+		c.Request, err = http.NewRequest(http.MethodGet, "/tasks/5?include=user&fields[tasks]=title,user&fields[users]=username", nil)
+		require.NoError(t, err)
+		r.ServeHTTP(rr, c.Request)
+
+		var body struct {
+			Data     jsonapi.Node   `json:"data"`
+			Included []jsonapi.Node `json:"included"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, map[string]interface{}{"title": "New task"}, body.Data.Attributes)
+		assert.Contains(t, body.Data.Relationships, "user")
+		require.Len(t, body.Included, 1)
+		assert.Equal(t, "users", body.Included[0].Type)
+		assert.Equal(t, map[string]interface{}{"username": "ali"}, body.Included[0].Attributes)
+		assert.Empty(t, body.Included[0].Relationships)
+	})
+
+	t.Run("NotModified", func(t *testing.T) {
+		var id int64 = 5
+		mockTaskRepository := new(repository.MockTaskRepository)
+		mockTaskRepository.On("Get", id).Return(entity.Task{ID: id, UserID: 1, Version: 2}, nil)
+		taskHandler := Task{mockTaskRepository}
+
+		rr := httptest.NewRecorder()
+		c, r := gin.CreateTestContext(rr)
+		r.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
+		r.GET("/tasks/:id", taskHandler.Get)
+
+		c.Request, _ = http.NewRequest(http.MethodGet, "/tasks/5", nil)
+		c.Request.Header.Set("If-None-Match", `W/"2"`)
+		r.ServeHTTP(rr, c.Request)
+
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+		assert.Empty(t, rr.Body.Bytes())
+	})
+
+	t.Run("InvalidInclude", func(t *testing.T) {
+		mockTaskRepository := new(repository.MockTaskRepository)
+		taskHandler := Task{mockTaskRepository}
+
+		rr := httptest.NewRecorder()
+		c, r := gin.CreateTestContext(rr)
+		r.GET("/tasks/:id", taskHandler.Get)
+
+		var err error
+		c.Request, err = http.NewRequest(http.MethodGet, "/tasks/5?include=owner", nil)
+		require.NoError(t, err)
+		r.ServeHTTP(rr, c.Request)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockTaskRepository.AssertNotCalled(t, "Get", mock.Anything)
+	})
+
 	t.Run("BadRequest", func(t *testing.T) {
 		var id string = "abc"
 		mockTaskRepository := new(repository.MockTaskRepository)
@@ -87,7 +166,7 @@ func TestGet(t *testing.T) {
 	t.Run("NotFound", func(t *testing.T) {
 		var id int64 = 5
 		mockTaskRepository := new(repository.MockTaskRepository)
-		mockTaskRepository.On("DisplayTask", id).Return(entity.Task{}, repository.ErrTaskNotFound)
+		mockTaskRepository.On("Get", id).Return(entity.Task{}, repository.ErrTaskNotFound)
 		rr := httptest.NewRecorder()
 
 		c, router := gin.CreateTestContext(rr)
@@ -137,7 +216,6 @@ func TestGet(t *testing.T) {
 func TestAddTask(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	t.Run("Success", func(t *testing.T) {
-		//request := TaskCreateRequest{}
 		var title string = "task jadid"
 		response := dto.Task{}
 		mockTaskResponse := entity.Task{
@@ -145,49 +223,109 @@ func TestAddTask(t *testing.T) {
 			Title:     title,
 			Status:    "pending",
 			CreatedAt: time.Now(),
-			//FinishedAt: nil,
-
+			UserID:    1,
 		}
 		response.FromEntity(mockTaskResponse)
 		mockTaskRepository := new(repository.MockTaskRepository)
-		mockTaskRepository.On("Create", title).Return(mockTaskResponse, nil)
+		mockTaskRepository.On("Create", title, int64(1)).Return(mockTaskResponse, nil)
 		taskRepository := Task{mockTaskRepository}
 		rr := httptest.NewRecorder()
 		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
 		router.POST("/tasks", taskRepository.Create)
 
-		taskreq := entity.Task{Title: title}
-		jsonValue, _ := json.Marshal(taskreq)
+		jsonValue, _ := json.Marshal(dto.TaskCreateRequest{Title: title})
 		var err error
 		c.Request, err = http.NewRequest("POST", "/tasks", bytes.NewBuffer(jsonValue))
-
 		assert.NoError(t, err)
+		c.Request.Header.Set("Content-Type", "application/json")
 
 		router.ServeHTTP(rr, c.Request)
-		respBody, err := json.Marshal(response)
+
+		buf := bytes.NewBuffer(nil)
+		err = jsonapi.MarshalPayloadWithoutIncluded(buf, &response)
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusCreated, rr.Code)
-		assert.Equal(t, respBody, rr.Body.Bytes())
+		assert.Equal(t, "/tasks/2", rr.Header().Get("Location"))
+		assert.Equal(t, buf.Bytes(), rr.Body.Bytes())
+		mockTaskRepository.AssertExpectations(t)
+
+	})
+	t.Run("JSONAPIDocument", func(t *testing.T) {
+		var title string = "task jadid"
+		mockTaskRepository := new(repository.MockTaskRepository)
+		mockTaskRepository.On("Create", title, int64(1)).Return(entity.Task{ID: 3, Title: title, UserID: 1}, nil)
+		taskRepository := Task{mockTaskRepository}
+		rr := httptest.NewRecorder()
+		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
+		router.POST("/tasks", taskRepository.Create)
+
+		body := `{"data":{"type":"tasks","attributes":{"title":"task jadid"},"relationships":{"user":{"data":{"type":"users","id":"1"}}}}}`
+		var err error
+		c.Request, err = http.NewRequest("POST", "/tasks", bytes.NewBufferString(body))
+		assert.NoError(t, err)
+		c.Request.Header.Set("Content-Type", jsonapi.MediaType)
+
+		router.ServeHTTP(rr, c.Request)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "/tasks/3", rr.Header().Get("Location"))
 		mockTaskRepository.AssertExpectations(t)
+	})
+	t.Run("TypeConflict", func(t *testing.T) {
+		mockTaskRepository := new(repository.MockTaskRepository)
+		taskRepository := Task{mockTaskRepository}
+		rr := httptest.NewRecorder()
+		c, router := gin.CreateTestContext(rr)
+		router.POST("/tasks", taskRepository.Create)
+
+		body := `{"data":{"type":"tokens","attributes":{"title":"task jadid"}}}`
+		c.Request, _ = http.NewRequest("POST", "/tasks", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", jsonapi.MediaType)
+
+		router.ServeHTTP(rr, c.Request)
 
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		mockTaskRepository.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+	t.Run("UnsupportedMediaType", func(t *testing.T) {
+		mockTaskRepository := new(repository.MockTaskRepository)
+		taskRepository := Task{mockTaskRepository}
+		rr := httptest.NewRecorder()
+		c, router := gin.CreateTestContext(rr)
+		router.POST("/tasks", taskRepository.Create)
+
+		body := `{"data":{"type":"tasks","attributes":{"title":"task jadid"}}}`
+		c.Request, _ = http.NewRequest("POST", "/tasks", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", jsonapi.MediaType+"; version=1")
+
+		router.ServeHTTP(rr, c.Request)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
 	})
 	t.Run("ServerError", func(t *testing.T) {
 		mockTaskRepository := new(repository.MockTaskRepository)
 
-		mockTaskRepository.On("Create", mock.Anything).Return(entity.Task{}, errors.New("Internal Server Error"))
+		mockTaskRepository.On("Create", mock.Anything, mock.Anything).Return(entity.Task{}, errors.New("Internal Server Error"))
 
 		taskRepository := Task{mockTaskRepository}
 
 		rr := httptest.NewRecorder()
 		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
 
 		var title string = "New task"
-		taskreq := entity.Task{Title: title}
+		taskreq := dto.TaskCreateRequest{Title: title}
 
 		jsonValue, _ := json.Marshal(taskreq)
-		//var err error
 		c.Request, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer(jsonValue))
-		//assert.NoError(t, err)
 		router.POST("/tasks", taskRepository.Create)
 		router.ServeHTTP(rr, c.Request)
 
@@ -209,6 +347,7 @@ func TestUpdate(t *testing.T) {
 			Title:     title,
 			Status:    status,
 			CreatedAt: time.Now(),
+			UserID:    1,
 		}
 		updateRequest := dto.TaskUpdateRequest{
 			Title:  title,
@@ -218,15 +357,18 @@ func TestUpdate(t *testing.T) {
 		updateResponse.FromEntity(mockTaskResponse)
 
 		mockTaskRepository := new(repository.MockTaskRepository)
-		mockTaskRepository.On("Update", id, title, status).Return(mockTaskResponse, nil)
+		mockTaskRepository.On("Get", id).Return(entity.Task{ID: id, UserID: 1}, nil)
+		mockTaskRepository.On("Update", id, title, status, int64(0)).Return(mockTaskResponse, nil)
 		taskRepository := Task{mockTaskRepository}
 
 		rr := httptest.NewRecorder()
 		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
 
 		router.PATCH("/tasks/:id", taskRepository.Update)
 
-		//updateRequest := mockTask
 		jsonValue, _ := json.Marshal(updateRequest)
 		var err error
 		c.Request, err = http.NewRequest("PATCH", "/tasks/5", bytes.NewBuffer(jsonValue))
@@ -235,18 +377,103 @@ func TestUpdate(t *testing.T) {
 
 		router.ServeHTTP(rr, c.Request)
 
-		respBody, err := json.Marshal(updateResponse)
+		buf := bytes.NewBuffer(nil)
+		err = jsonapi.MarshalPayloadWithoutIncluded(buf, &updateResponse)
 		assert.NoError(t, err)
 
 		assert.Equal(t, http.StatusOK, rr.Code)
-		assert.Equal(t, respBody, rr.Body.Bytes())
+		assert.Equal(t, buf.Bytes(), rr.Body.Bytes())
+		mockTaskRepository.AssertExpectations(t)
+
+	})
+	t.Run("IDConflict", func(t *testing.T) {
+		var id int64 = 5
+		mockTaskRepository := new(repository.MockTaskRepository)
+		mockTaskRepository.On("Get", id).Return(entity.Task{ID: id, UserID: 1}, nil)
+		taskRepository := Task{mockTaskRepository}
+
+		rr := httptest.NewRecorder()
+		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
+		router.PATCH("/tasks/:id", taskRepository.Update)
+
+		body := `{"data":{"type":"tasks","id":"6","attributes":{"status":"finished"}}}`
+		c.Request, _ = http.NewRequest("PATCH", "/tasks/5", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", jsonapi.MediaType)
+
+		router.ServeHTTP(rr, c.Request)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		mockTaskRepository.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("IfMatch", func(t *testing.T) {
+		var id int64 = 5
+		mockTaskRepository := new(repository.MockTaskRepository)
+		mockTaskRepository.On("Get", id).Return(entity.Task{ID: id, UserID: 1, Version: 3}, nil)
+		mockTaskRepository.On("Update", id, "", "finished", int64(3)).Return(entity.Task{ID: id, UserID: 1, Status: "finished", Version: 4}, nil)
+		taskRepository := Task{mockTaskRepository}
+
+		rr := httptest.NewRecorder()
+		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
+		router.PATCH("/tasks/:id", taskRepository.Update)
 
-		//mockTaskRepository.AssertCalled(t, "Update", id, title, status)
+		c.Request, _ = http.NewRequest("PATCH", "/tasks/5", bytes.NewBufferString(`{"status":"finished"}`))
+		c.Request.Header.Set("If-Match", `"3"`)
 
+		router.ServeHTTP(rr, c.Request)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+		mockTaskRepository.AssertExpectations(t)
+	})
+	t.Run("PreconditionFailed", func(t *testing.T) {
+		var id int64 = 5
+		mockTaskRepository := new(repository.MockTaskRepository)
+		mockTaskRepository.On("Get", id).Return(entity.Task{ID: id, UserID: 1, Version: 4}, nil)
+		taskRepository := Task{mockTaskRepository}
+
+		rr := httptest.NewRecorder()
+		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
+		router.PATCH("/tasks/:id", taskRepository.Update)
+
+		c.Request, _ = http.NewRequest("PATCH", "/tasks/5", bytes.NewBufferString(`{"status":"finished"}`))
+		c.Request.Header.Set("If-Match", `"3"`)
+
+		router.ServeHTTP(rr, c.Request)
+
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+		mockTaskRepository.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("ConcurrentWrite", func(t *testing.T) {
+		var id int64 = 5
+		mockTaskRepository := new(repository.MockTaskRepository)
+		mockTaskRepository.On("Get", id).Return(entity.Task{ID: id, UserID: 1, Version: 3}, nil)
+		mockTaskRepository.On("Update", id, "", "finished", int64(3)).Return(entity.Task{}, repository.ErrVersionConflict)
+		taskRepository := Task{mockTaskRepository}
+
+		rr := httptest.NewRecorder()
+		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
+		router.PATCH("/tasks/:id", taskRepository.Update)
+
+		c.Request, _ = http.NewRequest("PATCH", "/tasks/5", bytes.NewBufferString(`{"status":"finished"}`))
+		c.Request.Header.Set("If-Match", `"3"`)
+
+		router.ServeHTTP(rr, c.Request)
+
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+		mockTaskRepository.AssertExpectations(t)
 	})
-	//t.Run("Error", func(t *testing.T) {
-	//
-	//})
 
 }
 func TestDelete(t *testing.T) {
@@ -255,11 +482,15 @@ func TestDelete(t *testing.T) {
 		var id int64
 		id = 7
 		mockTaskRepository := new(repository.MockTaskRepository)
-		mockTaskRepository.On("Delete", id).Return(nil)
+		mockTaskRepository.On("Get", id).Return(entity.Task{ID: id, UserID: 1, Version: 1}, nil)
+		mockTaskRepository.On("Delete", id, int64(0)).Return(nil)
 		taskRepository := Task{mockTaskRepository}
 
 		rr := httptest.NewRecorder()
 		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
 
 		router.DELETE("/tasks/:id", taskRepository.Delete)
 		var err error
@@ -268,55 +499,105 @@ func TestDelete(t *testing.T) {
 
 		router.ServeHTTP(rr, c.Request)
 		assert.Equal(t, http.StatusAccepted, rr.Code)
+		mockTaskRepository.AssertExpectations(t)
 
 	})
+	t.Run("PreconditionFailed", func(t *testing.T) {
+		var id int64 = 7
+		mockTaskRepository := new(repository.MockTaskRepository)
+		mockTaskRepository.On("Get", id).Return(entity.Task{ID: id, UserID: 1, Version: 2}, nil)
+		taskRepository := Task{mockTaskRepository}
+
+		rr := httptest.NewRecorder()
+		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
+		router.DELETE("/tasks/:id", taskRepository.Delete)
+
+		c.Request, _ = http.NewRequest(http.MethodDelete, "/tasks/7", nil)
+		c.Request.Header.Set("If-Match", `"1"`)
+
+		router.ServeHTTP(rr, c.Request)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+		mockTaskRepository.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
 }
 func TestFind(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	t.Run("Success", func(t *testing.T) {
 		var title1 string = "task1"
-		//var title2 string = "task two"
 		var status string = "pending"
 		var userId int64 = 1
-		var page int = 1
-		var limit int = 1
-		mockTaskResponse := []entity.Task{
+		page := repository.Page{After: 3, Limit: 1}
+		mockTaskResponse := []*entity.Task{
 			{
+				ID:     4,
 				Title:  title1,
 				Status: status,
+				UserID: userId,
 			},
 		}
+		pageInfo := repository.PageInfo{Total: 3, MaxID: 6, StartID: 4, EndID: 4, HasPrev: true, HasNext: true}
 		mockTaskRepository := new(repository.MockTaskRepository)
-		mockTaskRepository.On("Find", title1, status, userId, page, limit).Return(mockTaskResponse, nil)
+		mockTaskRepository.On("Find", title1, status, userId, page).Return(mockTaskResponse, pageInfo, nil)
 
 		task := Task{mockTaskRepository}
 		rr := httptest.NewRecorder()
 
 		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", userId)
+		})
 		router.GET("/tasks", task.List)
 		var err error
-		c.Request, err = http.NewRequest(http.MethodGet, "/tasks?title=task1&status=pending", nil)
+		c.Request, err = http.NewRequest(http.MethodGet, "/tasks?title=task1&status=pending&page[after]=3&page[limit]=1", nil)
 		assert.NoError(t, err)
 
 		router.ServeHTTP(rr, c.Request)
-		respBody, err := json.Marshal(mockTaskResponse)
-		assert.NoError(t, err)
 
-		assert.Equal(t, respBody, rr.Body.Bytes())
+		var body struct {
+			Data  []map[string]interface{} `json:"data"`
+			Links map[string]*string       `json:"links"`
+			Meta  map[string]interface{}   `json:"meta"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
 		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Len(t, body.Data, 1)
+		assert.Equal(t, float64(3), body.Meta["total"])
+		assert.Equal(t, "/tasks?page%5Blimit%5D=1&status=pending&title=task1", *body.Links["first"])
+		assert.Equal(t, "/tasks?page%5Bbefore%5D=4&page%5Blimit%5D=1&status=pending&title=task1", *body.Links["prev"])
+		assert.Equal(t, "/tasks?page%5Bafter%5D=4&page%5Blimit%5D=1&status=pending&title=task1", *body.Links["next"])
+		assert.Equal(t, "/tasks?page%5Bbefore%5D=7&page%5Blimit%5D=1&status=pending&title=task1", *body.Links["last"])
 		mockTaskRepository.AssertExpectations(t)
 
 	})
-	t.Run("Error", func(t *testing.T) {
-		//var title string = "taskOne"
-		//var status string = "pending"
+	t.Run("BadRequest", func(t *testing.T) {
+		mockTaskRepository := new(repository.MockTaskRepository)
+		task := Task{mockTaskRepository}
+		rr := httptest.NewRecorder()
 
+		c, router := gin.CreateTestContext(rr)
+		router.GET("/tasks", task.List)
+		var err error
+		c.Request, err = http.NewRequest(http.MethodGet, "/tasks?page[after]=1&page[before]=5", nil)
+		assert.NoError(t, err)
+
+		router.ServeHTTP(rr, c.Request)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockTaskRepository.AssertNotCalled(t, "Find", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("Error", func(t *testing.T) {
 		mockTaskRepository := new(repository.MockTaskRepository)
-		mockTaskRepository.On("Find", mock.Anything, mock.Anything).Return([]entity.Task{}, errors.New("db connection error"))
+		mockTaskRepository.On("Find", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return([]*entity.Task{}, repository.PageInfo{}, errors.New("db connection error"))
 		task := Task{mockTaskRepository}
 		rr := httptest.NewRecorder()
 
 		c, router := gin.CreateTestContext(rr)
+		router.Use(func(c *gin.Context) {
+			c.Set("userId", int64(1))
+		})
 		router.GET("/tasks", task.List)
 		var err error
 		c.Request, err = http.NewRequest(http.MethodGet, "/tasks?title=task1&status=pending", nil)
@@ -324,7 +605,6 @@ func TestFind(t *testing.T) {
 
 		router.ServeHTTP(rr, c.Request)
 		respBody, err := json.Marshal(handler.NewProblem(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)))
-		//respBody, err := json.Marshal(http.StatusInternalServerError)
 		assert.NoError(t, err)
 
 		assert.Equal(t, respBody, rr.Body.Bytes())
@@ -2,8 +2,9 @@ package token
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/google/jsonapi"
+	"github.com/nargesbyt/todo.go/entity"
 	"github.com/nargesbyt/todo.go/handler"
 	"github.com/nargesbyt/todo.go/internal/dto"
 	"github.com/nargesbyt/todo.go/repository"
@@ -15,14 +16,28 @@ import (
 
 type Token struct {
 	TokenRepository repository.Tokens
+	Authorizer      *handler.Authorizer
 }
 
 func (t Token) Create(c *gin.Context) {
 	createTokenRequest := dto.CreateTokenRequest{}
-	err := c.BindJSON(&createTokenRequest)
+	_, err := handler.BindRequest(c, "tokens", "", &createTokenRequest)
 	if err != nil {
 		log.Error().Stack().Err(err).Msg("unprocessable entity")
-		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		handler.AbortWithBindError(c, err)
+
+		return
+	}
+
+	granted, err := t.Authorizer.Granted(c)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to load permissions")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+	if detail := validateScopes(createTokenRequest.Scopes, granted); detail != "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, detail))
 
 		return
 	}
@@ -36,7 +51,7 @@ func (t Token) Create(c *gin.Context) {
 		return
 	}*/
 
-	token, err := t.TokenRepository.Add(createTokenRequest.Title, createTokenRequest.ExpiredAt, userId.(int64))
+	token, err := t.TokenRepository.Add(createTokenRequest.Title, createTokenRequest.ExpiredAt, createTokenRequest.Scopes, userId.(int64))
 	if err != nil {
 		log.Error().Stack().Err(err).Msg("internal server error while inserting a record in tokens table")
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -47,15 +62,21 @@ func (t Token) Create(c *gin.Context) {
 	resp := dto.Tokens{}
 	resp.FromEntity(token)
 
-	c.Header("Content-Type", jsonapi.MediaType)
+	c.Header("Location", fmt.Sprintf("/tokens/%d", token.ID))
+	c.Header("ETag", handler.ETag(token.Version))
 	c.Status(http.StatusCreated)
 
-	if err := jsonapi.MarshalPayload(c.Writer, &resp); err != nil {
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
 		log.Fatal().Err(err).Msg("can not respond")
 	}
 	//c.JSON(http.StatusCreated, &resp)
 }
 func (t Token) Get(c *gin.Context) {
+	doc, err := handler.ParseDocument(c, "user")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -85,26 +106,36 @@ func (t Token) Get(c *gin.Context) {
 
 		return
 	}
+	c.Header("ETag", handler.ETag(token.Version))
+	if handler.NotModified(c, token.Version) {
+		c.AbortWithStatus(http.StatusNotModified)
+
+		return
+	}
+
 	resp := dto.Tokens{}
 	resp.FromEntity(token)
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, &resp); err != nil {
+	if err := handler.MarshalDocument(c, &resp, doc); err != nil {
 		log.Fatal().Err(err).Msg("can not respond")
 	}
 	//c.JSON(http.StatusOK, &token)
 }
 
 func (t Token) List(c *gin.Context) {
+	doc, err := handler.ParseDocument(c, "user")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+	page, err := handler.ParsePage(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
 	userId, _ := c.Get("userId")
-	tokens, err := t.TokenRepository.List(c.Query("title"), userId.(int64))
+	tokens, pageInfo, err := t.TokenRepository.List(c.Query("title"), userId.(int64), page)
 	if err != nil {
-		if err == repository.ErrTokenNotFound {
-			c.AbortWithStatus(http.StatusNotFound)
-			log.Error().Stack().Err(err).Msg("token not found")
-
-			return
-		}
-		c.AbortWithStatus(http.StatusBadRequest)
+		c.AbortWithStatus(http.StatusInternalServerError)
 		log.Error().Stack().Err(err).Msg("can not fetch record from database")
 
 		return
@@ -116,8 +147,7 @@ func (t Token) List(c *gin.Context) {
 		dtoTokens = append(dtoTokens, &resp)
 
 	}
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, dtoTokens); err != nil {
+	if err := handler.MarshalPage(c, dtoTokens, doc, page, pageInfo); err != nil {
 		log.Fatal().Err(err).Msg("can not respond")
 	}
 
@@ -146,17 +176,29 @@ func (t Token) Update(c *gin.Context) {
 		return
 	}
 
+	version, ok := handler.IfMatch(c, token.Version)
+	if !ok {
+		handler.AbortWithPreconditionFailed(c)
+
+		return
+	}
+
 	uRequest := dto.UpdateRequest{}
-	if err := c.BindJSON(&uRequest); err != nil {
+	if _, err := handler.BindRequest(c, "tokens", c.Param("id"), &uRequest); err != nil {
 		log.Error().Stack().Err(err).Msg("unprocessable entity")
-		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		handler.AbortWithBindError(c, err)
 
 		return
 	}
 
 	resp := dto.Tokens{}
-	updateResult, err := t.TokenRepository.Update(id, uRequest.Title, uRequest.ExpiredAt, time.Now(), uRequest.Active)
+	updateResult, err := t.TokenRepository.Update(id, uRequest.Title, uRequest.ExpiredAt, time.Now(), uRequest.Active, version)
 	if err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+
+			return
+		}
 		if err == repository.ErrUnauthorized {
 			log.Error().Stack().Err(err).Msg("unauthorized")
 			c.AbortWithStatus(http.StatusUnauthorized)
@@ -170,8 +212,8 @@ func (t Token) Update(c *gin.Context) {
 		return
 	}
 	resp.FromEntity(updateResult)
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, &resp); err != nil {
+	c.Header("ETag", handler.ETag(updateResult.Version))
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
 		log.Fatal().Err(err).Msg("unsuccessful token update")
 	}
 }
@@ -204,8 +246,19 @@ func (t Token) Delete(c *gin.Context) {
 
 		return
 	}
-	err = t.TokenRepository.Delete(id)
+	version, ok := handler.IfMatch(c, token.Version)
+	if !ok {
+		handler.AbortWithPreconditionFailed(c)
+
+		return
+	}
+	err = t.TokenRepository.Delete(id, version)
 	if err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+
+			return
+		}
 		c.AbortWithStatus(http.StatusInternalServerError)
 		log.Error().Stack().Err(err).Msg("internal server error")
 
@@ -214,3 +267,30 @@ func (t Token) Delete(c *gin.Context) {
 	c.Status(http.StatusAccepted)
 
 }
+
+// validateScopes checks that a new token has scopes and that the creator
+// holds all of them, so tokens never grant more than their creator has.
+func validateScopes(scopes []string, granted []string) string {
+	if len(scopes) == 0 {
+		return "scopes must list at least one permission"
+	}
+
+	known := map[string]bool{}
+	for _, p := range entity.Permissions {
+		known[p] = true
+	}
+	held := map[string]bool{}
+	for _, p := range granted {
+		held[p] = true
+	}
+	for _, scope := range scopes {
+		if !known[scope] {
+			return fmt.Sprintf("%s is not a known scope", scope)
+		}
+		if !held[scope] {
+			return fmt.Sprintf("the %s scope is not granted to you", scope)
+		}
+	}
+
+	return ""
+}
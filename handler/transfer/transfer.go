@@ -0,0 +1,263 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/transfer"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+const maxImportSize = 32 << 20
+
+type Transfer struct {
+	TasksRepository   repository.Tasks
+	ImportsRepository repository.Imports
+	Jobs              *transfer.Jobs
+}
+
+// Export streams every task of the authenticated user in the format given
+// by the format query parameter, csv by default.
+func (t Transfer) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", transfer.CSV)
+	enc, err := transfer.NewEncoder(format, c.Writer)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	c.Header("Content-Type", transfer.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="tasks.%s"`, format))
+	c.Status(http.StatusOK)
+
+	userId, _ := c.Get("userId")
+	// Once streaming started the status can not change, so a failure can
+	// only cut the response short.
+	if err := transfer.Export(t.TasksRepository, t.ImportsRepository, userId.(int64), enc, c.Writer.Flush); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to export tasks")
+	}
+}
+
+// Import creates tasks from an uploaded export. The format comes from the
+// format query parameter or else the Content-Type; dry_run=true validates
+// the input without writing anything.
+func (t Transfer) Import(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = formatOf(c.GetHeader("Content-Type"))
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "dry_run must be a boolean"))
+		return
+	}
+
+	dec, err := transfer.NewDecoder(format, http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == transfer.ErrUnknownFormat {
+			status = http.StatusUnsupportedMediaType
+		}
+		abortWithInputError(c, status, err)
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	importer := transfer.Importer{Tasks: t.TasksRepository, Imports: t.ImportsRepository}
+	result, err := importer.Import(userId.(int64), dec, dryRun)
+	var inputErr *transfer.InputError
+	if errors.As(err, &inputErr) {
+		if tooLarge(err) {
+			abortWithInputError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"code":   http.StatusBadRequest,
+			"detail": fmt.Sprintf("import stopped after row %d: %s", result.Rows, err.Error()),
+			"result": result,
+		})
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to import tasks")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, handler.NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ExportMarkdown returns the tasks of the authenticated user matching the
+// title and status query parameters as a Markdown checklist. The project
+// query parameter keeps the tasks tagged +project.
+func (t Transfer) ExportMarkdown(c *gin.Context) {
+	userId, _ := c.Get("userId")
+	tasks, err := repository.FindAll(t.TasksRepository, c.Query("title"), c.Query("status"), userId.(int64))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to find tasks")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, handler.NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+	if project := strings.TrimPrefix(c.Query("project"), "+"); project != "" {
+		tasks = transfer.WithProject(tasks, project)
+	}
+
+	var b bytes.Buffer
+	if err := transfer.WriteChecklist(&b, tasks); err != nil {
+		log.Error().Stack().Err(err).Msg("unable to write checklist")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, handler.NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="tasks.md"`)
+	c.Data(http.StatusOK, transfer.MarkdownContentType, b.Bytes())
+}
+
+// ImportMarkdown creates or updates tasks from the checklist items of a
+// Markdown document, matching them to the tasks below the same parent by
+// title. dry_run=true reports the changes without writing them.
+func (t Transfer) ImportMarkdown(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "dry_run must be a boolean"))
+		return
+	}
+
+	items, err := transfer.ParseChecklist(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		abortWithInputError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	importer := transfer.Importer{Tasks: t.TasksRepository, Imports: t.ImportsRepository}
+	result, err := importer.ImportChecklist(userId.(int64), items, dryRun)
+	if err != nil {
+		log.Error().Stack().Err(err).Int("items", result.Rows).Msg("unable to import checklist")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, handler.NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// StartJob imports the export of another app in the background. The
+// source query parameter names the app: todotxt, todoist or trello.
+// Todoist backups may be json or csv, given by format or the Content-Type.
+func (t Transfer) StartJob(c *gin.Context) {
+	source := c.Query("source")
+	format := c.Query("format")
+	if format == "" {
+		format = formatOf(c.GetHeader("Content-Type"))
+	}
+
+	var open func(io.Reader) (transfer.Decoder, error)
+	switch source {
+	case transfer.TodoTxt:
+		open = func(r io.Reader) (transfer.Decoder, error) { return transfer.NewTodoTxtDecoder(r), nil }
+	case transfer.Todoist:
+		if format == "" {
+			format = transfer.JSON
+		}
+		if format != transfer.JSON && format != transfer.CSV {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, handler.NewProblem(http.StatusUnsupportedMediaType, transfer.ErrUnknownFormat.Error()))
+			return
+		}
+		open = func(r io.Reader) (transfer.Decoder, error) { return transfer.NewTodoistDecoder(format, r) }
+	case transfer.Trello:
+		open = transfer.NewTrelloDecoder
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "source must be one of todotxt, todoist or trello"))
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "dry_run must be a boolean"))
+		return
+	}
+
+	// The upload is kept in a file so the job can outlive the request.
+	f, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to create import file")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, handler.NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+	_, err = io.Copy(f, http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		abortWithInputError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	job, err := t.Jobs.Start(userId.(int64), source, dryRun, f.Name(), open)
+	if err != nil {
+		os.Remove(f.Name())
+		log.Error().Stack().Err(err).Msg("unable to start import job")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, handler.NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+
+	c.Header("Location", "/import/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// Job reports the status and progress of an import job.
+func (t Transfer) Job(c *gin.Context) {
+	job, err := t.Jobs.Get(c.Param("id"))
+	userId, _ := c.Get("userId")
+	if err == transfer.ErrJobNotFound || (err == nil && job.UserID != userId.(int64)) {
+		c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, transfer.ErrJobNotFound.Error()))
+		return
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to get import job")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, handler.NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// abortWithInputError answers an upload that can not be read with status,
+// or 413 when it is larger than allowed.
+func abortWithInputError(c *gin.Context, status int, err error) {
+	if tooLarge(err) {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, handler.NewProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("uploads must not be larger than %d bytes", maxImportSize)))
+		return
+	}
+
+	c.AbortWithStatusJSON(status, handler.NewProblem(status, err.Error()))
+}
+
+func tooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+
+	return errors.As(err, &maxBytesErr)
+}
+
+func formatOf(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return transfer.CSV
+	case "application/json":
+		return transfer.JSON
+	case "application/x-ndjson", "application/ndjson":
+		return transfer.NDJSON
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,91 @@
+package transfer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestImport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		setup       func(tasks *repository.MockTaskRepository)
+		notInBody   string
+	}{
+		{
+			name:        "Success",
+			contentType: "application/x-ndjson",
+			body:        `{"title":"Open"}`,
+			status:      http.StatusOK,
+			setup: func(tasks *repository.MockTaskRepository) {
+				tasks.On("CreateImported", mock.Anything, "").Return(entity.Task{ID: 1}, nil)
+			},
+		},
+		{
+			name:        "UnknownFormat",
+			contentType: "application/xml",
+			body:        "<tasks/>",
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "UnreadableInput",
+			contentType: "application/json",
+			body:        `[{"title":"Open"}, {"title":`,
+			status:      http.StatusBadRequest,
+			setup: func(tasks *repository.MockTaskRepository) {
+				tasks.On("CreateImported", mock.Anything, "").Return(entity.Task{ID: 1}, nil)
+			},
+		},
+		{
+			name:        "TooLarge",
+			contentType: "application/json",
+			body:        `["` + strings.Repeat("a", maxImportSize),
+			status:      http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "StoreError",
+			contentType: "application/x-ndjson",
+			body:        `{"title":"Open"}`,
+			status:      http.StatusInternalServerError,
+			setup: func(tasks *repository.MockTaskRepository) {
+				tasks.On("CreateImported", mock.Anything, "").Return(entity.Task{}, errors.New("pq: connection refused"))
+			},
+			notInBody: "connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks := new(repository.MockTaskRepository)
+			if tt.setup != nil {
+				tt.setup(tasks)
+			}
+			th := Transfer{TasksRepository: tasks, ImportsRepository: new(repository.MockImportRepository)}
+
+			r := gin.New()
+			r.POST("/import", func(c *gin.Context) { c.Set("userId", int64(1)) }, th.Import)
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/import", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			r.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.status, resp.Code)
+			if tt.notInBody != "" {
+				assert.NotContains(t, resp.Body.String(), tt.notInBody)
+			}
+			tasks.AssertExpectations(t)
+		})
+	}
+}
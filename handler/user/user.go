@@ -1,8 +1,8 @@
 package user
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/google/jsonapi"
 	"github.com/nargesbyt/todo.go/entity"
 	"github.com/nargesbyt/todo.go/handler"
 	"github.com/nargesbyt/todo.go/internal/dto"
@@ -18,24 +18,23 @@ import (
 
 type User struct {
 	UsersRepository repository.Users
+	Authorizer      *handler.Authorizer
 }
 
 func (u User) Create(c *gin.Context) {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	user := entity.User{}
-	err := c.BindJSON(&user)
+	cRequest := dto.UserCreateRequest{}
+	_, err := handler.BindRequest(c, "users", "", &cRequest)
 	if err != nil {
 		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 		logger := zerolog.New(os.Stdout).With().Timestamp().Caller().Logger()
 		logger.Error().Stack().Err(err).Msg("can not read body request")
-		//log.Error().Err(err).Msg("can not read body request")
-		//log.Println(err)
-		c.AbortWithStatus(http.StatusInternalServerError)
+		handler.AbortWithBindError(c, err)
 		return
 
 	}
 	createResponse := dto.User{}
-	user, err = u.UsersRepository.Create(user.Email, user.Password, user.Username)
+	user, err := u.UsersRepository.Create(cRequest.Email, cRequest.Password, cRequest.Username)
 	createResponse.FromEntity(user)
 	if err != nil {
 		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
@@ -46,8 +45,10 @@ func (u User) Create(c *gin.Context) {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, &createResponse); err != nil {
+	c.Header("Location", fmt.Sprintf("/users/%d", user.ID))
+	c.Header("ETag", handler.ETag(user.Version))
+	c.Status(http.StatusCreated)
+	if err := handler.MarshalDocument(c, &createResponse, handler.Document{}); err != nil {
 		log.Fatal().Err(err).Msg("cannot write response")
 		//log.Fatal(err)
 	}
@@ -55,17 +56,18 @@ func (u User) Create(c *gin.Context) {
 
 }
 func (u User) List(c *gin.Context) {
-	users, err := u.UsersRepository.GetUsers(c.Query("email"), c.Query("username"))
+	doc, err := handler.ParseDocument(c, "tasks")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+	page, err := handler.ParsePage(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+	users, pageInfo, err := u.UsersRepository.GetUsers(c.Query("email"), c.Query("username"), page)
 	if err != nil {
-		if err == repository.ErrUserNotFound {
-			zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
-			logger := zerolog.New(os.Stdout).With().Timestamp().Caller().Logger()
-			logger.Error().Stack().Err(err).Msg("user not found")
-			//log.Error().Err(err).Msg("user not found")
-			//log.Println(err)
-			c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "User not found"))
-			return
-		}
 		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 		logger := zerolog.New(os.Stdout).With().Timestamp().Caller().Logger()
 		logger.Error().Stack().Err(err).Msg("internal server error")
@@ -82,8 +84,7 @@ func (u User) List(c *gin.Context) {
 		dtoUsers = append(dtoUsers, &resp)
 	}
 
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, dtoUsers); err != nil {
+	if err := handler.MarshalPage(c, dtoUsers, doc, page, pageInfo); err != nil {
 		log.Fatal().Err(err).Msg("cannot write response")
 	}
 	//c.JSON(http.StatusOK, user)
@@ -100,28 +101,40 @@ func (u User) Update(c *gin.Context) {
 		return
 	}
 	uRequest := dto.UserUpdateRequest{}
-	if err := c.BindJSON(&uRequest); err != nil {
+	if _, err := handler.BindRequest(c, "users", c.Param("id"), &uRequest); err != nil {
 		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 		logger := zerolog.New(os.Stdout).With().Timestamp().Caller().Logger()
 		logger.Error().Stack().Err(err).Msg("can not read request body")
-		//log.Error().Err(err).Msg("can not read request body")
-		//log.Println(err)
-		c.AbortWithStatus(http.StatusUnprocessableEntity)
+		handler.AbortWithBindError(c, err)
+		return
+	}
+	version, ok := u.precondition(c, id)
+	if !ok {
+		handler.AbortWithPreconditionFailed(c)
 		return
 	}
 	resp := dto.User{}
-	updateResult, err := u.UsersRepository.UpdateUsers(id, uRequest.Username, uRequest.Email, uRequest.Password)
+	updateResult, err := u.UsersRepository.UpdateUsers(id, uRequest.Username, uRequest.Email, uRequest.Password, version)
 	if err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
+		if err == repository.ErrUserNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "User not found"))
+			return
+		}
 		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 		logger := zerolog.New(os.Stdout).With().Timestamp().Caller().Logger()
 		logger.Error().Stack().Err(err).Msg("can not save changes to repository")
 		//log.Error().Err(err).Msg("can not save changes in repositort")
 		//log.Println(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
 	resp.FromEntity(updateResult)
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, &resp); err != nil {
+	c.Header("ETag", handler.ETag(updateResult.Version))
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
 		log.Fatal().Err(err).Msg("can not write response")
 	}
 	//c.JSON(http.StatusOK, resp)
@@ -132,8 +145,17 @@ func (u User) Delete(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	err = u.UsersRepository.DeleteUsers(id)
+	version, ok := u.precondition(c, id)
+	if !ok {
+		handler.AbortWithPreconditionFailed(c)
+		return
+	}
+	err = u.UsersRepository.DeleteUsers(id, version)
 	if err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
 		if err == repository.ErrTaskNotFound {
 			zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 			logger := zerolog.New(os.Stdout).With().Timestamp().Caller().Logger()
@@ -150,6 +172,11 @@ func (u User) Delete(c *gin.Context) {
 
 }
 func (u User) Get(c *gin.Context) {
+	doc, err := handler.ParseDocument(c, "tasks")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "invalid user id"))
@@ -173,11 +200,126 @@ func (u User) Get(c *gin.Context) {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	c.Header("ETag", handler.ETag(user.Version))
+	if handler.NotModified(c, user.Version) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
 	resp := dto.User{}
 	resp.FromEntity(user)
-	c.Header("Content-Type", jsonapi.MediaType)
-	if err := jsonapi.MarshalPayload(c.Writer, &resp); err != nil {
+	if err := handler.MarshalDocument(c, &resp, doc); err != nil {
 		log.Fatal().Err(err).Msg("can not response")
 	}
 
 }
+
+// precondition resolves the If-Match header of a write to the version of
+// the user it must be applied to.
+func (u User) precondition(c *gin.Context, id int64) (int64, bool) {
+	if c.GetHeader("If-Match") == "" {
+		return 0, true
+	}
+
+	user, err := u.UsersRepository.GetUserByID(id)
+	if err != nil {
+		return 0, false
+	}
+
+	return handler.IfMatch(c, user.Version)
+}
+
+// SetRole assigns a role to a user. Admins can not take the users:admin
+// permission away from themselves, so there is always an admin left.
+func (u User) SetRole(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "invalid user id"))
+		return
+	}
+	req := dto.UserRoleRequest{}
+	if _, err := handler.BindRequest(c, "users", c.Param("id"), &req); err != nil {
+		log.Error().Stack().Err(err).Msg("can not read request body")
+		handler.AbortWithBindError(c, err)
+		return
+	}
+	role, err := u.Authorizer.Roles.Get(req.Role)
+	if err != nil {
+		if err == repository.ErrRoleNotFound {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, "role does not exist"))
+			return
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	userId, _ := c.Get("userId")
+	if id == userId.(int64) && !role.Grants(entity.PermissionUsersAdmin) {
+		c.AbortWithStatusJSON(http.StatusConflict, handler.NewProblem(http.StatusConflict, "admins can not remove their own admin role"))
+		return
+	}
+	version, ok := u.precondition(c, id)
+	if !ok {
+		handler.AbortWithPreconditionFailed(c)
+		return
+	}
+
+	user, err := u.UsersRepository.SetRole(id, req.Role, version)
+	if err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
+		if err == repository.ErrUserNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "User not found"))
+			return
+		}
+		log.Error().Stack().Err(err).Msg("can not save changes to repository")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.User{}
+	resp.FromEntity(user)
+	c.Header("ETag", handler.ETag(user.Version))
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not write response")
+	}
+}
+
+// Permissions returns the role and permissions of the authenticated user.
+// For requests made with a scoped token only the permissions in scope are
+// listed.
+func (u User) Permissions(c *gin.Context) {
+	granted, err := u.Authorizer.Granted(c)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to load role")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	resp := dto.Permissions{ID: strconv.FormatInt(userId.(int64), 10), Role: c.GetString("role"), Permissions: granted}
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not write response")
+	}
+}
+
+// Roles lists the roles users can be assigned.
+func (u User) Roles(c *gin.Context) {
+	roles, err := u.Authorizer.Roles.List()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]*dto.Role, 0, len(roles))
+	for _, role := range roles {
+		r := dto.Role{}
+		r.FromEntity(role)
+		resp = append(resp, &r)
+	}
+	if err := handler.MarshalDocument(c, resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not write response")
+	}
+}
@@ -0,0 +1,380 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/internal/dto"
+	"github.com/nargesbyt/todo.go/internal/random"
+	hooks "github.com/nargesbyt/todo.go/internal/webhook"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+type Webhook struct {
+	WebhooksRepository repository.Webhooks
+	Dispatcher         *hooks.Dispatcher
+	// Authorizer decides who may set up global webhooks, which receive
+	// the events of every user.
+	Authorizer *handler.Authorizer
+}
+
+func (w Webhook) Create(c *gin.Context) {
+	req := dto.CreateWebhookRequest{}
+	if _, err := handler.BindRequest(c, "webhooks", "", &req); err != nil {
+		log.Error().Stack().Err(err).Msg("unprocessable entity")
+		handler.AbortWithBindError(c, err)
+
+		return
+	}
+	if detail := validate(req.URL, req.Events); detail != "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, detail))
+		return
+	}
+	if req.Secret == "" {
+		req.Secret = random.Token(32)
+	}
+	global := 0
+	if req.Global {
+		granted, err := w.Authorizer.Granted(c)
+		if err != nil {
+			log.Error().Stack().Err(err).Msg("unable to load role")
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !contains(granted, entity.PermissionUsersAdmin) {
+			c.AbortWithStatusJSON(http.StatusForbidden, handler.NewProblem(http.StatusForbidden, "global webhooks require the users:admin permission"))
+			return
+		}
+		global = 1
+	}
+
+	userId, _ := c.Get("userId")
+	webhook, err := w.WebhooksRepository.Create(userId.(int64), req.URL, req.Events, req.Secret, global)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("internal server error while inserting a webhook")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	resp := dto.Webhook{}
+	resp.FromEntity(webhook)
+	resp.Secret = webhook.Secret
+
+	c.Header("Location", fmt.Sprintf("/webhooks/%d", webhook.ID))
+	c.Header("ETag", handler.ETag(webhook.Version))
+	c.Status(http.StatusCreated)
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+func (w Webhook) List(c *gin.Context) {
+	doc, err := handler.ParseDocument(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+	page, err := handler.ParsePage(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	userId, _ := c.Get("userId")
+	webhooks, pageInfo, err := w.WebhooksRepository.List(userId.(int64), page)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch webhooks from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	var dtoWebhooks []*dto.Webhook
+	for _, webhook := range webhooks {
+		resp := dto.Webhook{}
+		resp.FromEntity(*webhook)
+		dtoWebhooks = append(dtoWebhooks, &resp)
+	}
+	if err := handler.MarshalPage(c, dtoWebhooks, doc, page, pageInfo); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+func (w Webhook) Get(c *gin.Context) {
+	doc, err := handler.ParseDocument(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+	webhook, ok := w.load(c)
+	if !ok {
+		return
+	}
+
+	c.Header("ETag", handler.ETag(webhook.Version))
+	if handler.NotModified(c, webhook.Version) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+
+	resp := dto.Webhook{}
+	resp.FromEntity(webhook)
+	if err := handler.MarshalDocument(c, &resp, doc); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+func (w Webhook) Update(c *gin.Context) {
+	webhook, ok := w.load(c)
+	if !ok {
+		return
+	}
+	version, ok := handler.IfMatch(c, webhook.Version)
+	if !ok {
+		handler.AbortWithPreconditionFailed(c)
+		return
+	}
+
+	req := dto.UpdateWebhookRequest{URL: webhook.URL, Events: webhook.EventTypes(), Active: webhook.Active}
+	if _, err := handler.BindRequest(c, "webhooks", c.Param("id"), &req); err != nil {
+		log.Error().Stack().Err(err).Msg("unprocessable entity")
+		handler.AbortWithBindError(c, err)
+
+		return
+	}
+	if detail := validate(req.URL, req.Events); detail != "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, handler.NewProblem(http.StatusUnprocessableEntity, detail))
+		return
+	}
+
+	webhook, err := w.WebhooksRepository.Update(webhook.ID, req.URL, req.Events, req.Active, version)
+	if err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	resp := dto.Webhook{}
+	resp.FromEntity(webhook)
+	c.Header("ETag", handler.ETag(webhook.Version))
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+func (w Webhook) Delete(c *gin.Context) {
+	webhook, ok := w.load(c)
+	if !ok {
+		return
+	}
+	version, ok := handler.IfMatch(c, webhook.Version)
+	if !ok {
+		handler.AbortWithPreconditionFailed(c)
+		return
+	}
+
+	if err := w.WebhooksRepository.Delete(webhook.ID, version); err != nil {
+		if err == repository.ErrVersionConflict {
+			handler.AbortWithPreconditionFailed(c)
+			return
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Ping queues a test delivery to the webhook.
+func (w Webhook) Ping(c *gin.Context) {
+	webhook, ok := w.load(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := w.Dispatcher.Ping(webhook)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to queue ping delivery")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+	w.accepted(c, delivery)
+}
+
+func (w Webhook) Deliveries(c *gin.Context) {
+	page, err := handler.ParsePage(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+	webhook, ok := w.load(c)
+	if !ok {
+		return
+	}
+
+	deliveries, pageInfo, err := w.WebhooksRepository.Deliveries(webhook.ID, page)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("can not fetch webhook deliveries from database")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+
+	var dtoDeliveries []*dto.WebhookDelivery
+	for _, delivery := range deliveries {
+		resp := dto.WebhookDelivery{}
+		resp.FromEntity(*delivery)
+		dtoDeliveries = append(dtoDeliveries, &resp)
+	}
+	if err := handler.MarshalPage(c, dtoDeliveries, handler.Document{}, page, pageInfo); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+func (w Webhook) Delivery(c *gin.Context) {
+	doc, err := handler.ParseDocument(c, "attempts")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, err.Error()))
+		return
+	}
+	delivery, ok := w.loadDelivery(c)
+	if !ok {
+		return
+	}
+
+	resp := dto.WebhookDelivery{}
+	resp.FromEntity(delivery)
+	if err := handler.MarshalDocument(c, &resp, doc); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// Redeliver queues a new delivery with the payload of an earlier one.
+func (w Webhook) Redeliver(c *gin.Context) {
+	delivery, ok := w.loadDelivery(c)
+	if !ok {
+		return
+	}
+
+	redelivery, err := w.Dispatcher.Redeliver(delivery)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to queue redelivery")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return
+	}
+	w.accepted(c, redelivery)
+}
+
+func (w Webhook) accepted(c *gin.Context, delivery entity.WebhookDelivery) {
+	resp := dto.WebhookDelivery{}
+	resp.FromEntity(delivery)
+
+	c.Header("Location", fmt.Sprintf("/webhooks/%d/deliveries/%d", delivery.WebhookID, delivery.ID))
+	c.Status(http.StatusAccepted)
+	if err := handler.MarshalDocument(c, &resp, handler.Document{}); err != nil {
+		log.Error().Stack().Err(err).Msg("can not respond")
+	}
+}
+
+// load fetches the webhook of the id param and checks that it belongs to
+// the authenticated user, aborting the request otherwise.
+func (w Webhook) load(c *gin.Context) (entity.Webhook, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "invalid webhook id"))
+		return entity.Webhook{}, false
+	}
+
+	webhook, err := w.WebhooksRepository.Get(id)
+	if err != nil {
+		if err == repository.ErrWebhookNotFound {
+			c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "Webhook not found"))
+			return webhook, false
+		}
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return webhook, false
+	}
+
+	userId, _ := c.Get("userId")
+	if webhook.UserID != userId {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return webhook, false
+	}
+
+	return webhook, true
+}
+
+func (w Webhook) loadDelivery(c *gin.Context) (entity.WebhookDelivery, bool) {
+	webhook, ok := w.load(c)
+	if !ok {
+		return entity.WebhookDelivery{}, false
+	}
+	id, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, handler.NewProblem(http.StatusBadRequest, "invalid delivery id"))
+		return entity.WebhookDelivery{}, false
+	}
+
+	delivery, err := w.WebhooksRepository.GetDelivery(id)
+	if err == repository.ErrDeliveryNotFound || (err == nil && delivery.WebhookID != webhook.ID) {
+		c.AbortWithStatusJSON(http.StatusNotFound, handler.NewProblem(http.StatusNotFound, "Delivery not found"))
+		return delivery, false
+	}
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("internal server error")
+		c.AbortWithStatus(http.StatusInternalServerError)
+
+		return delivery, false
+	}
+
+	return delivery, true
+}
+
+// validate returns why a webhook configuration is invalid, or an empty
+// string.
+func validate(rawURL string, events []string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "url must be an absolute http or https URL"
+	}
+	if len(events) == 0 {
+		return "at least one event type is required"
+	}
+	for _, e := range events {
+		if e == "*" {
+			continue
+		}
+		if !contains(hooks.EventTypes, e) {
+			return fmt.Sprintf("unknown event type %q", e)
+		}
+	}
+
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
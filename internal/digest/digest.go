@@ -0,0 +1,181 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/transfer"
+
+	// Time zones are loaded from the binary so they work on hosts without
+	// a zoneinfo database.
+	_ "time/tzdata"
+)
+
+const (
+	dayLayout  = "2006-01-02"
+	timeLayout = "15:04"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	textTemplate        = texttemplate.Must(texttemplate.ParseFS(templates, "templates/digest.txt.tmpl"))
+	htmlTemplate        = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/digest.html.tmpl"))
+	confirmTextTemplate = texttemplate.Must(texttemplate.ParseFS(templates, "templates/confirm.txt.tmpl"))
+	confirmHTMLTemplate = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/confirm.html.tmpl"))
+	pageTemplate        = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/page.html.tmpl"))
+)
+
+// Item is a task listed in a digest.
+type Item struct {
+	Title string
+}
+
+// Content is what a digest tells a user about their tasks.
+type Content struct {
+	Username       string
+	Date           string
+	DueToday       []Item
+	Overdue        []Item
+	Completed      []Item
+	UnsubscribeURL string
+}
+
+// Confirmation is what the email confirming the address of a digest tells
+// a user.
+type Confirmation struct {
+	Username   string
+	ConfirmURL string
+}
+
+// Page is a web page answering a link in an email. With a Button, it is a
+// form that posts Token to Action, so following the link alone changes
+// nothing.
+type Page struct {
+	Title  string
+	Text   string
+	Action string
+	Token  string
+	Button string
+}
+
+// Message is a rendered digest email.
+type Message struct {
+	Subject        string
+	Text           string
+	HTML           string
+	UnsubscribeURL string
+}
+
+// NewContent sorts tasks into the digest of the local day of now.
+func NewContent(user entity.User, tasks []*entity.Task, now time.Time) Content {
+	content := Content{Username: user.Username, Date: now.Format("Monday, January 2, 2006")}
+	today := now.Format(dayLayout)
+	yesterday := now.Add(-24 * time.Hour)
+
+	for _, task := range tasks {
+		if entity.Finished(task.Status) {
+			if task.FinishedAt.Valid && task.FinishedAt.Time.After(yesterday) {
+				content.Completed = append(content.Completed, Item{Title: task.Title})
+			}
+			continue
+		}
+
+		due := transfer.TaskTags(*task).Due
+		switch {
+		case due == "":
+		case due == today:
+			content.DueToday = append(content.DueToday, Item{Title: task.Title})
+		case due < today:
+			content.Overdue = append(content.Overdue, Item{Title: task.Title})
+		}
+	}
+
+	return content
+}
+
+// Render renders the plain text and HTML parts of a digest.
+func Render(content Content) (Message, error) {
+	msg := Message{
+		Subject:        "Your tasks for " + content.Date,
+		UnsubscribeURL: content.UnsubscribeURL,
+	}
+
+	var b bytes.Buffer
+	if err := textTemplate.Execute(&b, content); err != nil {
+		return msg, err
+	}
+	msg.Text = b.String()
+
+	b.Reset()
+	if err := htmlTemplate.Execute(&b, content); err != nil {
+		return msg, err
+	}
+	msg.HTML = b.String()
+
+	return msg, nil
+}
+
+// RenderConfirmation renders the email confirming the address of a digest.
+func RenderConfirmation(confirmation Confirmation) (Message, error) {
+	msg := Message{Subject: "Confirm your daily digest"}
+
+	var b bytes.Buffer
+	if err := confirmTextTemplate.Execute(&b, confirmation); err != nil {
+		return msg, err
+	}
+	msg.Text = b.String()
+
+	b.Reset()
+	if err := confirmHTMLTemplate.Execute(&b, confirmation); err != nil {
+		return msg, err
+	}
+	msg.HTML = b.String()
+
+	return msg, nil
+}
+
+// RenderPage renders a web page answering a link in an email.
+func RenderPage(page Page) ([]byte, error) {
+	var b bytes.Buffer
+	err := pageTemplate.Execute(&b, page)
+
+	return b.Bytes(), err
+}
+
+// UnsubscribeURL returns the link that turns off the digest.
+func UnsubscribeURL(baseURL string, digest entity.Digest) string {
+	return strings.TrimSuffix(baseURL, "/") + "/digest/unsubscribe?token=" + url.QueryEscape(digest.UnsubscribeToken)
+}
+
+// ConfirmURL returns the link that confirms the address of a digest.
+func ConfirmURL(baseURL string, token string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/digest/confirm?token=" + url.QueryEscape(token)
+}
+
+// ValidTime reports whether sendAt is a time of day like 07:30.
+func ValidTime(sendAt string) bool {
+	_, err := time.Parse(timeLayout, sendAt)
+
+	return err == nil
+}
+
+// Due returns the local day of now in the time zone of the digest and
+// whether the digest of that day should be sent.
+func Due(digest entity.Digest, now time.Time) (string, bool) {
+	loc, err := time.LoadLocation(digest.TimeZone)
+	if err != nil {
+		return "", false
+	}
+	local := now.In(loc)
+	day := local.Format(dayLayout)
+
+	return day, digest.LastSentOn != day && local.Format(timeLayout) >= digest.SendAt
+}
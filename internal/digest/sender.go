@@ -0,0 +1,122 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrNoBaseURL is returned when a link has to be sent without knowing
+// where the server is reachable.
+var ErrNoBaseURL = errors.New("digest base url is not configured")
+
+// Sender sends the digests that are due.
+type Sender struct {
+	Digests repository.Digests
+	Users   repository.Users
+	Tasks   repository.Tasks
+	Mailer  Mailer
+	// BaseURL is prepended to the unsubscribe and confirmation paths of
+	// the links in emails.
+	BaseURL string
+}
+
+// Compose renders the digest of a user for the local day of now.
+func (s *Sender) Compose(digest entity.Digest, user entity.User, now time.Time) (Message, error) {
+	loc, err := time.LoadLocation(digest.TimeZone)
+	if err != nil {
+		return Message{}, err
+	}
+	tasks, err := repository.FindAll(s.Tasks, "", "", user.ID)
+	if err != nil {
+		return Message{}, err
+	}
+
+	content := NewContent(user, tasks, now.In(loc))
+	content.UnsubscribeURL = UnsubscribeURL(s.BaseURL, digest)
+
+	return Render(content)
+}
+
+// SendConfirmation asks the user to confirm their email as the address of
+// the digest.
+func (s *Sender) SendConfirmation(digest entity.Digest, user entity.User) error {
+	if s.BaseURL == "" {
+		return ErrNoBaseURL
+	}
+	token, err := s.Digests.RequestConfirmation(digest.ID, user.Email)
+	if err != nil {
+		return err
+	}
+	msg, err := RenderConfirmation(Confirmation{Username: user.Username, ConfirmURL: ConfirmURL(s.BaseURL, token)})
+	if err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(user.Email, msg)
+}
+
+// Run checks for due digests every interval until ctx is done.
+func (s *Sender) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sendDue(time.Now())
+		}
+	}
+}
+
+func (s *Sender) sendDue(now time.Time) {
+	digests, err := s.Digests.Enabled()
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to list digests")
+		return
+	}
+
+	for _, digest := range digests {
+		day, due := Due(digest, now)
+		if !due {
+			continue
+		}
+		// Claiming before sending means a failed digest is skipped for the
+		// day rather than sent twice.
+		claimed, err := s.Digests.Claim(digest.ID, day)
+		if err != nil {
+			log.Error().Stack().Err(err).Int64("digest", digest.ID).Msg("unable to claim digest")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.send(digest, now); err != nil {
+			log.Error().Stack().Err(err).Int64("digest", digest.ID).Msg("unable to send digest")
+		}
+	}
+}
+
+func (s *Sender) send(digest entity.Digest, now time.Time) error {
+	user, err := s.Users.GetUserByID(digest.UserID)
+	if err != nil {
+		return err
+	}
+	// The user changed their email since confirming it.
+	if user.Email != digest.ConfirmedEmail {
+		log.Debug().Int64("digest", digest.ID).Msg("skipping digest to unconfirmed email")
+		return nil
+	}
+	msg, err := s.Compose(digest, user, now)
+	if err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(user.Email, msg)
+}
@@ -0,0 +1,57 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+)
+
+type Client struct {
+	ID           int64     `jsonapi:"primary,clients"`
+	ClientID     string    `jsonapi:"attr,client_id"`
+	ClientSecret string    `jsonapi:"attr,client_secret,omitempty"`
+	Name         string    `jsonapi:"attr,name"`
+	RedirectURIs []string  `jsonapi:"attr,redirect_uris"`
+	Scopes       []string  `jsonapi:"attr,scopes"`
+	Confidential bool      `jsonapi:"attr,confidential"`
+	CreatedAt    time.Time `jsonapi:"attr,created_at"`
+}
+
+type CreateClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+// AuthorizationRequest is what the consent screen shows: which app asks
+// for which scopes.
+type AuthorizationRequest struct {
+	ID          string    `jsonapi:"primary,authorization-requests"`
+	ClientID    string    `jsonapi:"attr,client_id"`
+	ClientName  string    `jsonapi:"attr,client_name"`
+	Scopes      []string  `jsonapi:"attr,scopes"`
+	RedirectURI string    `jsonapi:"attr,redirect_uri"`
+	ExpiresAt   time.Time `jsonapi:"attr,expires_at"`
+}
+
+// ConsentRequest approves or denies an authorization request.
+type ConsentRequest struct {
+	Approve bool `json:"approve"`
+}
+
+// Consent tells where to send the browser after a consent decision.
+type Consent struct {
+	ID         string `jsonapi:"primary,consents"`
+	RedirectTo string `jsonapi:"attr,redirect_to"`
+}
+
+func (c *Client) FromEntity(client entity.Client) {
+	c.ID = client.ID
+	c.ClientID = client.ClientID
+	c.Name = client.Name
+	c.RedirectURIs = client.RedirectURIList()
+	c.Scopes = client.ScopeList()
+	c.Confidential = client.Confidential()
+	c.CreatedAt = client.CreatedAt
+}
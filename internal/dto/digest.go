@@ -0,0 +1,32 @@
+package dto
+
+import (
+	"github.com/nargesbyt/todo.go/entity"
+	"time"
+)
+
+type UpdateDigestRequest struct {
+	Enabled  int    `json:"enabled"`
+	SendAt   string `json:"send_at"`
+	TimeZone string `json:"time_zone"`
+}
+
+type Digest struct {
+	ID             int64     `jsonapi:"primary,digests"`
+	Enabled        int       `jsonapi:"attr,enabled"`
+	SendAt         string    `jsonapi:"attr,send_at"`
+	TimeZone       string    `jsonapi:"attr,time_zone"`
+	LastSentOn     string    `jsonapi:"attr,last_sent_on,omitempty"`
+	ConfirmedEmail string    `jsonapi:"attr,confirmed_email,omitempty"`
+	UpdatedAt      time.Time `jsonapi:"attr,updated_at"`
+}
+
+func (r *Digest) FromEntity(digest entity.Digest) {
+	r.ID = digest.ID
+	r.Enabled = digest.Enabled
+	r.SendAt = digest.SendAt
+	r.TimeZone = digest.TimeZone
+	r.LastSentOn = digest.LastSentOn
+	r.ConfirmedEmail = digest.ConfirmedEmail
+	r.UpdatedAt = digest.UpdatedAt
+}
@@ -0,0 +1,21 @@
+package dto
+
+import (
+	"github.com/nargesbyt/todo.go/entity"
+	"time"
+)
+
+type Feed struct {
+	ID        int64     `jsonapi:"primary,feeds"`
+	URL       string    `jsonapi:"attr,url,omitempty"`
+	CreatedAt time.Time `jsonapi:"attr,created_at"`
+	RotatedAt time.Time `jsonapi:"attr,rotated_at"`
+}
+
+// FromEntity leaves out the URL, which is only shown when the secret is
+// rotated.
+func (r *Feed) FromEntity(feed entity.Feed) {
+	r.ID = feed.ID
+	r.CreatedAt = feed.CreatedAt
+	r.RotatedAt = feed.RotatedAt
+}
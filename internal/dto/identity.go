@@ -0,0 +1,30 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+)
+
+type Identity struct {
+	ID          int64     `jsonapi:"primary,identities"`
+	Issuer      string    `jsonapi:"attr,issuer"`
+	Subject     string    `jsonapi:"attr,subject"`
+	Email       string    `jsonapi:"attr,email"`
+	CreatedAt   time.Time `jsonapi:"attr,created_at"`
+	LastLoginAt time.Time `jsonapi:"attr,last_login_at"`
+}
+
+// LinkIdentityRequest carries an ID token of the identity to link.
+type LinkIdentityRequest struct {
+	IDToken string `json:"id_token"`
+}
+
+func (i *Identity) FromEntity(identity entity.Identity) {
+	i.ID = identity.ID
+	i.Issuer = identity.Issuer
+	i.Subject = identity.Subject
+	i.Email = identity.Email
+	i.CreatedAt = identity.CreatedAt
+	i.LastLoginAt = identity.LastLoginAt
+}
@@ -0,0 +1,32 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/nargesbyt/todo.go/internal/session"
+)
+
+type Session struct {
+	ID         string    `jsonapi:"primary,sessions"`
+	UserAgent  string    `jsonapi:"attr,user_agent"`
+	IP         string    `jsonapi:"attr,ip"`
+	Current    bool      `jsonapi:"attr,current"`
+	CSRFToken  string    `jsonapi:"attr,csrf_token,omitempty"`
+	CreatedAt  time.Time `jsonapi:"attr,created_at"`
+	LastSeenAt time.Time `jsonapi:"attr,last_seen_at"`
+	ExpiresAt  time.Time `jsonapi:"attr,expires_at"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (s *Session) FromEntity(sess session.Session) {
+	s.ID = sess.ID
+	s.UserAgent = sess.UserAgent
+	s.IP = sess.IP
+	s.CreatedAt = sess.CreatedAt
+	s.LastSeenAt = sess.LastSeenAt
+	s.ExpiresAt = sess.ExpiresAt
+}
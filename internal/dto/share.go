@@ -0,0 +1,28 @@
+package dto
+
+import (
+	"github.com/nargesbyt/todo.go/entity"
+	"time"
+)
+
+type CreateShareRequest struct {
+	Username string `json:"username"`
+}
+
+type Share struct {
+	ID        int64     `jsonapi:"primary,shares"`
+	Project   string    `jsonapi:"attr,project"`
+	OwnerID   int64     `jsonapi:"attr,owner_id"`
+	Owner     string    `jsonapi:"attr,owner"`
+	Username  string    `jsonapi:"attr,username"`
+	CreatedAt time.Time `jsonapi:"attr,created_at"`
+}
+
+func (r *Share) FromEntity(share entity.Share) {
+	r.ID = share.ID
+	r.Project = share.Project
+	r.OwnerID = share.OwnerID
+	r.Owner = share.Owner.Username
+	r.Username = share.User.Username
+	r.CreatedAt = share.CreatedAt
+}
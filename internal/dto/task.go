@@ -18,6 +18,10 @@ type Task struct {
 	Status     string    `jsonapi:"attr,status"`
 	CreatedAt  time.Time `jsonapi:"attr,created_at"`
 	FinishedAt time.Time `jsonapi:"attr,finished_at"`
+	Due        string    `jsonapi:"attr,due,omitempty"`
+	Priority   string    `jsonapi:"attr,priority,omitempty"`
+	Labels     string    `jsonapi:"attr,labels,omitempty"`
+	ParentID   int64     `jsonapi:"attr,parent_id,omitempty"`
 	User       *User     `jsonapi:"relation,user"`
 }
 
@@ -27,7 +31,12 @@ func (r *Task) FromEntity(task entity.Task) {
 	r.Status = task.Status
 	r.CreatedAt = task.CreatedAt
 	r.FinishedAt = task.FinishedAt.Time
-	user := User{}
-	user.FromEntity(task.User)
-	r.User = &user
+	r.Due = task.Due
+	r.Priority = task.Priority
+	r.Labels = task.Labels
+	r.ParentID = task.ParentID.Int64
+	r.User = &User{ID: task.UserID}
+	if task.User.ID != 0 {
+		r.User.FromEntity(task.User)
+	}
 }
@@ -8,6 +8,7 @@ import (
 type CreateTokenRequest struct {
 	Title     string    `json:"title"`
 	ExpiredAt time.Time `json:"expired_at"`
+	Scopes    []string  `json:"scopes"`
 }
 
 type UpdateRequest struct {
@@ -24,6 +25,7 @@ type Tokens struct {
 	Token     string    `jsonapi:"attr,token"`
 	LastUsed  time.Time `jsonapi:"attr,last_used"`
 	Active    int       `jsonapi:"attr,active"`
+	Scopes    []string  `jsonapi:"attr,scopes"`
 	User      *User     `jsonapi:"relation,user"`
 }
 
@@ -33,6 +35,7 @@ func (r *Tokens) FromEntity(token entity.Token) {
 	r.IssuedAt = token.IssuedAt
 	r.Token = token.Token
 	r.Active = token.Active
+	r.Scopes = token.ScopeList()
 
 	if token.ExpiredAt.Valid {
 		r.ExpiredAt = token.ExpiredAt.Time
@@ -42,7 +45,8 @@ func (r *Tokens) FromEntity(token entity.Token) {
 		r.LastUsed = token.LastUsed.Time
 	}
 
-	user := User{}
-	user.FromEntity(token.User)
-	r.User = &user
+	r.User = &User{ID: token.UserID}
+	if token.User.ID != 0 {
+		r.User.FromEntity(token.User)
+	}
 }
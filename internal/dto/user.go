@@ -9,9 +9,16 @@ type User struct {
 	ID        int64     `jsonapi:"primary,users"`
 	Username  string    `jsonapi:"attr,username"`
 	Email     string    `jsonapi:"attr,email"`
+	Role      string    `jsonapi:"attr,role"`
 	CreatedAt time.Time `jsonapi:"attr,created_at"`
 	UpdatedAt time.Time `jsonapi:"attr,updated_at"`
-	Tasks     []*Task   `jsonapi:"relation,tasks"`
+	Tasks     []*Task   `jsonapi:"relation,tasks,omitempty"`
+}
+
+type UserCreateRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
 }
 
 type UserUpdateRequest struct {
@@ -20,10 +27,37 @@ type UserUpdateRequest struct {
 	Password string `json:"password"`
 }
 
+type UserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// Permissions are what the authenticated user may do. The id is the id of
+// the user.
+type Permissions struct {
+	ID          string   `jsonapi:"primary,permissions"`
+	Role        string   `jsonapi:"attr,role"`
+	Permissions []string `jsonapi:"attr,permissions"`
+}
+
+type Role struct {
+	ID          int64    `jsonapi:"primary,roles"`
+	Name        string   `jsonapi:"attr,name"`
+	Description string   `jsonapi:"attr,description"`
+	Permissions []string `jsonapi:"attr,permissions"`
+}
+
+func (r *Role) FromEntity(role entity.Role) {
+	r.ID = role.ID
+	r.Name = role.Name
+	r.Description = role.Description
+	r.Permissions = role.Granted()
+}
+
 func (r *User) FromEntity(user entity.User) {
 	r.ID = user.ID
 	r.Username = user.Username
 	r.Email = user.Email
+	r.Role = user.Role
 	r.CreatedAt = user.CreatedAt
 	r.UpdatedAt = user.UpdatedAt
 	tasks := []*Task{}
@@ -0,0 +1,97 @@
+package dto
+
+import (
+	"github.com/nargesbyt/todo.go/entity"
+	"time"
+)
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+	Global bool     `json:"global"`
+}
+
+type UpdateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active int      `json:"active"`
+}
+
+type Webhook struct {
+	ID        int64     `jsonapi:"primary,webhooks"`
+	URL       string    `jsonapi:"attr,url"`
+	Events    []string  `jsonapi:"attr,events"`
+	Secret    string    `jsonapi:"attr,secret,omitempty"`
+	Active    int       `jsonapi:"attr,active"`
+	Global    bool      `jsonapi:"attr,global"`
+	CreatedAt time.Time `jsonapi:"attr,created_at"`
+}
+
+// FromEntity leaves out the secret, which is only shown once on creation.
+func (r *Webhook) FromEntity(webhook entity.Webhook) {
+	r.ID = webhook.ID
+	r.URL = webhook.URL
+	r.Events = webhook.EventTypes()
+	r.Active = webhook.Active
+	r.Global = webhook.Global == 1
+	r.CreatedAt = webhook.CreatedAt
+}
+
+type WebhookDelivery struct {
+	ID            int64             `jsonapi:"primary,webhook-deliveries"`
+	Event         string            `jsonapi:"attr,event"`
+	Status        string            `jsonapi:"attr,status"`
+	Attempts      int               `jsonapi:"attr,attempts"`
+	ResponseCode  int               `jsonapi:"attr,response_code"`
+	LastError     string            `jsonapi:"attr,last_error"`
+	NextAttemptAt *time.Time        `jsonapi:"attr,next_attempt_at"`
+	DeliveredAt   *time.Time        `jsonapi:"attr,delivered_at"`
+	CreatedAt     time.Time         `jsonapi:"attr,created_at"`
+	Payload       string            `jsonapi:"attr,payload"`
+	AttemptLog    []*WebhookAttempt `jsonapi:"relation,attempts,omitempty"`
+}
+
+func (r *WebhookDelivery) FromEntity(delivery entity.WebhookDelivery) {
+	r.ID = delivery.ID
+	r.Event = delivery.Event
+	r.Status = delivery.Status
+	r.Attempts = delivery.Attempts
+	r.ResponseCode = delivery.ResponseCode
+	r.LastError = delivery.LastError
+	r.CreatedAt = delivery.CreatedAt
+	r.Payload = string(delivery.Payload)
+
+	if delivery.Status == entity.DeliveryPending {
+		nextAttemptAt := delivery.NextAttemptAt
+		r.NextAttemptAt = &nextAttemptAt
+	}
+	if delivery.DeliveredAt.Valid {
+		deliveredAt := delivery.DeliveredAt.Time
+		r.DeliveredAt = &deliveredAt
+	}
+
+	for _, attempt := range delivery.AttemptLog {
+		a := WebhookAttempt{}
+		a.FromEntity(attempt)
+		r.AttemptLog = append(r.AttemptLog, &a)
+	}
+}
+
+type WebhookAttempt struct {
+	ID           int64     `jsonapi:"primary,webhook-attempts"`
+	Number       int       `jsonapi:"attr,number"`
+	ResponseCode int       `jsonapi:"attr,response_code"`
+	Error        string    `jsonapi:"attr,error"`
+	DurationMS   int64     `jsonapi:"attr,duration_ms"`
+	AttemptedAt  time.Time `jsonapi:"attr,attempted_at"`
+}
+
+func (r *WebhookAttempt) FromEntity(attempt entity.WebhookAttempt) {
+	r.ID = attempt.ID
+	r.Number = attempt.Number
+	r.ResponseCode = attempt.ResponseCode
+	r.Error = attempt.Error
+	r.DurationMS = attempt.Duration.Milliseconds()
+	r.AttemptedAt = attempt.AttemptedAt
+}
@@ -0,0 +1,185 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	TaskCreated = "task.created"
+	TaskUpdated = "task.updated"
+	TaskDeleted = "task.deleted"
+
+	streamKey     = "events:log"
+	channel       = "events:live"
+	subscriberBuf = 64
+)
+
+// Event describes a change of a task owned by UserID. Previous holds the
+// task as it was before an update.
+type Event struct {
+	ID         string       `json:"id"`
+	Type       string       `json:"type"`
+	UserID     int64        `json:"user_id"`
+	TaskID     int64        `json:"task_id"`
+	Task       *entity.Task `json:"task,omitempty"`
+	Previous   *entity.Task `json:"previous,omitempty"`
+	OccurredAt time.Time    `json:"occurred_at"`
+}
+
+// Publisher is notified after every repository write.
+type Publisher interface {
+	Publish(e Event) error
+}
+
+// Publishers notifies every publisher in turn and returns the first error.
+type Publishers []Publisher
+
+func (p Publishers) Publish(e Event) error {
+	var first error
+	for _, publisher := range p {
+		if err := publisher.Publish(e); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// Broker appends events to a bounded log in a Redis stream and fans them
+// out to the subscribers of every server instance through Redis pub/sub.
+type Broker struct {
+	redisClient *redis.Client
+	logSize     int64
+
+	mu          sync.Mutex
+	subscribers map[chan Event]int64
+}
+
+func NewBroker(redisClient *redis.Client, logSize int64) *Broker {
+	return &Broker{
+		redisClient: redisClient,
+		logSize:     logSize,
+		subscribers: map[chan Event]int64{},
+	}
+}
+
+// Publish stores e in the event log and broadcasts it to all instances.
+func (b *Broker) Publish(e Event) error {
+	ctx := context.Background()
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	id, err := b.redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		MaxLen: b.logSize,
+		Approx: true,
+		Values: map[string]interface{}{"event": payload},
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	e.ID = id
+	payload, err = json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return b.redisClient.Publish(ctx, channel, payload).Err()
+}
+
+// Run receives the events published by any instance and dispatches them to
+// local subscribers until ctx is done.
+func (b *Broker) Run(ctx context.Context) {
+	pubsub := b.redisClient.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var e Event
+		if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+			log.Error().Stack().Err(err).Msg("unable to decode event")
+			continue
+		}
+		b.dispatch(e)
+	}
+}
+
+func (b *Broker) dispatch(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch, userID := range b.subscribers {
+		if userID != e.UserID {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+			// The subscriber is too slow; closing its channel ends the
+			// stream so the client reconnects and resumes from the log.
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the live events of userID. The returned function must
+// be called to stop receiving them.
+func (b *Broker) Subscribe(userID int64) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuf)
+
+	b.mu.Lock()
+	b.subscribers[ch] = userID
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Since returns the logged events of userID that came after lastID.
+func (b *Broker) Since(ctx context.Context, lastID string, userID int64) ([]Event, error) {
+	messages, err := b.redisClient.XRange(ctx, streamKey, lastID, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, msg := range messages {
+		if msg.ID == lastID {
+			continue
+		}
+		payload, ok := msg.Values["event"].(string)
+		if !ok {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(payload), &e); err != nil {
+			return nil, err
+		}
+		if e.UserID != userID {
+			continue
+		}
+		e.ID = msg.ID
+		events = append(events, e)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,203 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+)
+
+const (
+	ContentType = "text/calendar; charset=utf-8"
+
+	prodID        = "-//todo.go//tasks//EN"
+	dateTime      = "20060102T150405Z"
+	date          = "20060102"
+	maxLineOctets = 75
+)
+
+// Writer encodes tasks as an iCalendar (RFC 5545) stream.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Begin writes the calendar header. name is shown by calendar apps as the
+// title of the subscription.
+func (w *Writer) Begin(name string) {
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:" + prodID)
+	w.line("CALSCALE:GREGORIAN")
+	w.line("X-WR-CALNAME:" + Escape(name))
+}
+
+// UID returns the default unique identifier of a task in calendars.
+func UID(task entity.Task) string {
+	return fmt.Sprintf("task-%d@todo.go", task.ID)
+}
+
+// EventUID returns the unique identifier of the event on the due date of a
+// task.
+func EventUID(task entity.Task) string {
+	return fmt.Sprintf("task-%d-due@todo.go", task.ID)
+}
+
+// Todo writes task as a VTODO component with the given UID.
+func (w *Writer) Todo(task entity.Task, uid string, stamp time.Time) {
+	w.line("BEGIN:VTODO")
+	w.line("UID:" + Escape(uid))
+	w.line("DTSTAMP:" + stamp.UTC().Format(dateTime))
+	if !task.CreatedAt.IsZero() {
+		w.line("CREATED:" + task.CreatedAt.UTC().Format(dateTime))
+	}
+	w.line("SUMMARY:" + Escape(task.Title))
+	w.line("STATUS:" + Status(task))
+	w.line(fmt.Sprintf("SEQUENCE:%d", task.Version))
+	if due, ok := dueDate(task); ok {
+		w.line("DUE;VALUE=DATE:" + due.Format(date))
+	}
+	if priority := PriorityOf(task.Priority); priority != 0 {
+		w.line(fmt.Sprintf("PRIORITY:%d", priority))
+	}
+	if labels := strings.Fields(task.Labels); len(labels) > 0 {
+		for i, label := range labels {
+			labels[i] = Escape(label)
+		}
+		w.line("CATEGORIES:" + strings.Join(labels, ","))
+	}
+	if task.FinishedAt.Valid {
+		w.line("COMPLETED:" + task.FinishedAt.Time.UTC().Format(dateTime))
+	}
+	w.line("END:VTODO")
+}
+
+// Event writes a task with a due date as an all-day VEVENT component on
+// that date, for calendar apps that do not show VTODO components. Tasks
+// without a valid due date are skipped.
+func (w *Writer) Event(task entity.Task, uid string, stamp time.Time) {
+	due, ok := dueDate(task)
+	if !ok {
+		return
+	}
+
+	w.line("BEGIN:VEVENT")
+	w.line("UID:" + Escape(uid))
+	w.line("DTSTAMP:" + stamp.UTC().Format(dateTime))
+	w.line("DTSTART;VALUE=DATE:" + due.Format(date))
+	w.line("DTEND;VALUE=DATE:" + due.AddDate(0, 0, 1).Format(date))
+	w.line("SUMMARY:" + Escape(task.Title))
+	if Status(task) == "CANCELLED" {
+		w.line("STATUS:CANCELLED")
+	}
+	w.line("TRANSP:TRANSPARENT")
+	w.line(fmt.Sprintf("SEQUENCE:%d", task.Version))
+	w.line("END:VEVENT")
+}
+
+// End writes the calendar footer and flushes the stream.
+func (w *Writer) End() error {
+	w.line("END:VCALENDAR")
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.w.Flush()
+}
+
+// line writes a content line terminated by CRLF, folding it so no line
+// exceeds 75 octets without splitting a UTF-8 sequence.
+func (w *Writer) line(s string) {
+	if w.err != nil {
+		return
+	}
+
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !startsRune(s[cut]) {
+			cut--
+		}
+		if _, w.err = w.w.WriteString(s[:cut] + "\r\n "); w.err != nil {
+			return
+		}
+		s = s[cut:]
+		// Continuation lines start with a space, which counts toward the
+		// limit.
+		limit = maxLineOctets - 1
+	}
+	_, w.err = w.w.WriteString(s + "\r\n")
+}
+
+func startsRune(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// Escape escapes a TEXT property value.
+func Escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+func dueDate(task entity.Task) (time.Time, bool) {
+	if task.Due == "" {
+		return time.Time{}, false
+	}
+	due, err := time.Parse("2006-01-02", task.Due)
+
+	return due, err == nil
+}
+
+// Status maps the free-form status of a task to a VTODO status.
+func Status(task entity.Task) string {
+	if task.FinishedAt.Valid {
+		return "COMPLETED"
+	}
+
+	return statusOf(task.Status)
+}
+
+// PriorityOf maps the free-form priority of a task to a VTODO priority,
+// 1 being the highest and 0 undefined. A, p1 and high are 1, B, p2 and
+// medium are 5, and the lower letters, p3, p4 and low are 9.
+func PriorityOf(priority string) int {
+	priority = strings.ToLower(strings.TrimSpace(priority))
+	switch {
+	case priority == "":
+		return 0
+	case priority == "a" || priority == "p1" || priority == "high":
+		return 1
+	case priority == "b" || priority == "p2" || priority == "medium":
+		return 5
+	case len(priority) == 1 && priority[0] >= 'c' && priority[0] <= 'z',
+		priority == "p3" || priority == "p4" || priority == "low":
+		return 9
+	default:
+		return 0
+	}
+}
+
+func statusOf(status string) string {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "done", "completed", "finished":
+		return "COMPLETED"
+	case "doing", "in progress", "in-progress", "in_progress", "started":
+		return "IN-PROCESS"
+	case "cancelled", "canceled":
+		return "CANCELLED"
+	default:
+		return "NEEDS-ACTION"
+	}
+}
@@ -0,0 +1,178 @@
+package ical
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterTodo(t *testing.T) {
+	stamp := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	task := entity.Task{
+		ID:         3,
+		Title:      "Buy milk, eggs; bread",
+		Status:     "done",
+		CreatedAt:  stamp.Add(-time.Hour),
+		FinishedAt: sql.NullTime{Time: stamp, Valid: true},
+		Priority:   "p2",
+		Labels:     "+home @shop,ping",
+		Version:    2,
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Begin("Tasks")
+	w.Todo(task, UID(task), stamp)
+	require.NoError(t, w.End())
+
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\n"))
+	assert.Contains(t, out, "UID:task-3@todo.go\r\n")
+	assert.Contains(t, out, `SUMMARY:Buy milk\, eggs\; bread`+"\r\n")
+	assert.Contains(t, out, "STATUS:COMPLETED\r\n")
+	assert.Contains(t, out, "COMPLETED:20230501T120000Z\r\n")
+	assert.Contains(t, out, "SEQUENCE:2\r\n")
+	assert.Contains(t, out, "PRIORITY:5\r\n")
+	assert.Contains(t, out, `CATEGORIES:+home,@shop\,ping`+"\r\n")
+	assert.True(t, strings.HasSuffix(out, "END:VCALENDAR\r\n"))
+}
+
+func TestWriterEvent(t *testing.T) {
+	stamp := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	dated := entity.Task{ID: 3, Title: "Pay rent", Status: "pending", Due: "2023-05-31", Version: 1}
+	cancelled := entity.Task{ID: 4, Title: "Trip", Status: "cancelled", Due: "2023-06-01"}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Todo(dated, UID(dated), stamp)
+	w.Event(dated, EventUID(dated), stamp)
+	w.Event(cancelled, EventUID(cancelled), stamp)
+	w.Event(entity.Task{ID: 5, Title: "Someday"}, "undated", stamp)
+	w.Event(entity.Task{ID: 6, Title: "Later", Due: "next week"}, "invalid", stamp)
+	require.NoError(t, w.End())
+
+	out := buf.String()
+	assert.Contains(t, out, "DUE;VALUE=DATE:20230531\r\n")
+	assert.Contains(t, out, "BEGIN:VEVENT\r\n"+
+		"UID:task-3-due@todo.go\r\n"+
+		"DTSTAMP:20230501T120000Z\r\n"+
+		"DTSTART;VALUE=DATE:20230531\r\n"+
+		"DTEND;VALUE=DATE:20230601\r\n"+
+		"SUMMARY:Pay rent\r\n"+
+		"TRANSP:TRANSPARENT\r\n"+
+		"SEQUENCE:1\r\n"+
+		"END:VEVENT\r\n")
+	assert.Contains(t, out, "UID:task-4-due@todo.go\r\n")
+	assert.Contains(t, out, "STATUS:CANCELLED\r\n")
+	assert.Equal(t, 2, strings.Count(out, "BEGIN:VEVENT"))
+}
+
+func TestWriterFoldsLongLines(t *testing.T) {
+	title := strings.Repeat("ä", 100)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Todo(entity.Task{ID: 1, Title: title}, "uid", time.Now())
+	require.NoError(t, w.End())
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), maxLineOctets)
+	}
+	todo, err := ParseTodo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, title, todo.Summary)
+}
+
+func TestParseTodo(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Todo
+		err  error
+	}{
+		{
+			name: "Simple",
+			in:   "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:abc\r\nSUMMARY:Call mom\r\nSTATUS:needs-action\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+			want: Todo{UID: "abc", Summary: "Call mom", Status: "NEEDS-ACTION"},
+		},
+		{
+			name: "FoldedAndEscaped",
+			in:   "BEGIN:VTODO\nSUMMARY;LANGUAGE=en:Line one\\nline\n  two\\, done\\;\nEND:VTODO\n",
+			want: Todo{Summary: "Line one\nline two, done;"},
+		},
+		{
+			name: "IgnoresOtherComponents",
+			in:   "BEGIN:VCALENDAR\r\nSUMMARY:calendar\r\nBEGIN:VTODO\r\nSUMMARY:task\r\nEND:VTODO\r\nBEGIN:VTODO\r\nSUMMARY:second\r\nEND:VTODO\r\n",
+			want: Todo{Summary: "task"},
+		},
+		{
+			name: "TaskFields",
+			in: "BEGIN:VTODO\r\nSUMMARY:Pay rent\r\nDUE;TZID=Europe/Berlin:20230531T235900\r\nPRIORITY:9\r\n" +
+				"CATEGORIES:+home,@shop\\,ping\r\nCATEGORIES:Bills\r\nEND:VTODO\r\n",
+			want: Todo{Summary: "Pay rent", Due: "2023-05-31", Priority: 9, Categories: []string{"+home", "@shop,ping", "Bills"}},
+		},
+		{
+			name: "EmptyCategories",
+			in:   "BEGIN:VTODO\r\nSUMMARY:Pay rent\r\nDUE;VALUE=DATE:bogus\r\nCATEGORIES:\r\nEND:VTODO\r\n",
+			want: Todo{Summary: "Pay rent", Categories: []string{}},
+		},
+		{
+			name: "NoTodo",
+			in:   "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:meeting\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			err:  ErrNoTodo,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todo, err := ParseTodo(strings.NewReader(tt.in))
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, todo)
+		})
+	}
+}
+
+func TestTaskStatus(t *testing.T) {
+	tests := []struct {
+		vtodo   string
+		current string
+		want    string
+	}{
+		{"COMPLETED", "pending", "done"},
+		{"COMPLETED", "finished", "finished"},
+		{"IN-PROCESS", "", "doing"},
+		{"IN-PROCESS", "in progress", "in progress"},
+		{"", "waiting", "waiting"},
+		{"", "done", "pending"},
+		{"CANCELLED", "pending", "cancelled"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, TaskStatus(tt.vtodo, tt.current), tt.vtodo+"/"+tt.current)
+	}
+}
+
+func TestTaskPriority(t *testing.T) {
+	tests := []struct {
+		vtodo   int
+		current string
+		want    string
+	}{
+		{1, "", "A"},
+		{1, "p1", "p1"},
+		{3, "B", "A"},
+		{5, "medium", "medium"},
+		{5, "", "B"},
+		{9, "D", "D"},
+		{7, "", "C"},
+		{0, "A", ""},
+		{0, "someday", "someday"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, TaskPriority(tt.vtodo, tt.current), tt.current)
+	}
+}
@@ -0,0 +1,193 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoTodo = errors.New("calendar has no VTODO component")
+
+// Todo holds the VTODO properties that map to task fields. Due is a date
+// like 2024-01-31, or empty. Categories is nil when the component has no
+// CATEGORIES property, which clients that do not know labels leave out.
+type Todo struct {
+	UID        string
+	Summary    string
+	Status     string
+	Due        string
+	Priority   int
+	Categories []string
+}
+
+// ParseTodo reads the first VTODO component of an iCalendar stream.
+func ParseTodo(r io.Reader) (Todo, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	var (
+		todo   Todo
+		inTodo bool
+		found  bool
+	)
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		// Parameters such as LANGUAGE are not needed.
+		name, _, _ = strings.Cut(name, ";")
+		name = strings.ToUpper(name)
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VTODO"):
+			inTodo, found = true, true
+		case name == "END" && strings.EqualFold(value, "VTODO"):
+			return todo, nil
+		case !inTodo:
+		case name == "UID":
+			todo.UID = Unescape(value)
+		case name == "SUMMARY":
+			todo.Summary = Unescape(value)
+		case name == "STATUS":
+			todo.Status = strings.ToUpper(value)
+		case name == "DUE":
+			todo.Due = parseDate(value)
+		case name == "PRIORITY":
+			todo.Priority, _ = strconv.Atoi(strings.TrimSpace(value))
+		case name == "CATEGORIES":
+			if todo.Categories == nil {
+				todo.Categories = []string{}
+			}
+			for _, category := range splitList(value) {
+				if category = strings.TrimSpace(Unescape(category)); category != "" {
+					todo.Categories = append(todo.Categories, category)
+				}
+			}
+		}
+	}
+
+	if !found {
+		return Todo{}, ErrNoTodo
+	}
+
+	return todo, nil
+}
+
+// unfold joins folded content lines.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseDate keeps the date of a DATE or DATE-TIME value as 2006-01-02.
+// The time and zone of a DATE-TIME are dropped, as tasks are due on days.
+func parseDate(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) < 8 {
+		return ""
+	}
+	due, err := time.Parse(date, value[:8])
+	if err != nil {
+		return ""
+	}
+
+	return due.Format("2006-01-02")
+}
+
+// splitList splits a list value on the commas that are not escaped.
+func splitList(value string) []string {
+	var (
+		items []string
+		start int
+	)
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			items = append(items, value[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(items, value[start:])
+}
+
+// Unescape reverses Escape.
+func Unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
+
+// TaskStatus maps a VTODO status back to a task status. The current
+// status is kept when it already maps to the same VTODO status, so the
+// finer grained statuses of the API survive a round trip.
+func TaskStatus(vtodo string, current string) string {
+	if vtodo == "" {
+		vtodo = "NEEDS-ACTION"
+	}
+	if current != "" && statusOf(current) == vtodo {
+		return current
+	}
+
+	switch vtodo {
+	case "COMPLETED":
+		return "done"
+	case "IN-PROCESS":
+		return "doing"
+	case "CANCELLED":
+		return "cancelled"
+	default:
+		return "pending"
+	}
+}
+
+// TaskPriority maps a VTODO priority back to a task priority: 1 to 4 to
+// A, 5 to B and 6 to 9 to C. Like TaskStatus, the current priority is kept
+// when it already maps to the same VTODO priority.
+func TaskPriority(vtodo int, current string) string {
+	if PriorityOf(current) == vtodo {
+		return current
+	}
+
+	switch {
+	case vtodo >= 1 && vtodo <= 4:
+		return "A"
+	case vtodo == 5:
+		return "B"
+	case vtodo >= 6 && vtodo <= 9:
+		return "C"
+	default:
+		return ""
+	}
+}
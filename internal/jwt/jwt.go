@@ -0,0 +1,324 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v3"
+	josejwt "github.com/go-jose/go-jose/v3/jwt"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/random"
+	"github.com/nargesbyt/todo.go/repository"
+)
+
+const (
+	// TokenType is the typ header of access tokens, see RFC 9068.
+	TokenType = "at+jwt"
+
+	algorithm = jose.ES256
+	// reloadInterval is how long keys are cached before another instance
+	// may have rotated them.
+	reloadInterval     = time.Minute
+	missReloadInterval = 5 * time.Second
+	leeway             = 30 * time.Second
+)
+
+var (
+	ErrInvalidToken = errors.New("access token is invalid")
+	// ErrForeignToken is returned for JWTs issued by someone else, such as
+	// an OIDC provider.
+	ErrForeignToken = errors.New("access token was issued by someone else")
+)
+
+// Claims are what an access token tells about its user.
+// ClientID is set for tokens issued to third-party apps.
+type Claims struct {
+	ID        string
+	UserID    int64
+	Role      string
+	Scopes    []string
+	ClientID  string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type accessClaims struct {
+	josejwt.Claims
+	Role     string `json:"role"`
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+type signingKey struct {
+	id        string
+	private   *ecdsa.PrivateKey
+	createdAt time.Time
+}
+
+// Issuer signs and verifies our own access tokens. They carry the role of
+// the user, so checking them needs no database query; a changed role
+// applies once the token expires. The newest key signs and is replaced
+// every Rotation; older keys keep verifying until their tokens expire.
+type Issuer struct {
+	Keys      repository.SigningKeys
+	URL       string
+	AccessTTL time.Duration
+	Rotation  time.Duration
+
+	mu       sync.Mutex
+	keys     []signingKey
+	loadedAt time.Time
+}
+
+// Issue returns a signed access token. clientID is the third-party app it
+// is issued to, if any.
+func (i *Issuer) Issue(userId int64, role string, scopes []string, clientID string) (string, time.Time, error) {
+	key, err := i.signingKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: algorithm, Key: jose.JSONWebKey{Key: key.private, KeyID: key.id}},
+		(&jose.SignerOptions{}).WithType(TokenType),
+	)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(i.AccessTTL)
+	claims := accessClaims{
+		Claims: josejwt.Claims{
+			Issuer:    i.URL,
+			Subject:   strconv.FormatInt(userId, 10),
+			Audience:  josejwt.Audience{i.URL},
+			IssuedAt:  josejwt.NewNumericDate(now),
+			NotBefore: josejwt.NewNumericDate(now),
+			Expiry:    josejwt.NewNumericDate(expiresAt),
+			ID:        random.Token(16),
+		},
+		Role:     role,
+		Scope:    strings.Join(scopes, " "),
+		ClientID: clientID,
+	}
+	raw, err := josejwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return raw, expiresAt, nil
+}
+
+// Verify checks an access token. It returns ErrForeignToken for JWTs that
+// were not issued by us, and ErrInvalidToken for any other bad token.
+func (i *Issuer) Verify(raw string) (Claims, error) {
+	token, err := josejwt.ParseSigned(raw)
+	if err != nil || len(token.Headers) != 1 {
+		return Claims{}, ErrInvalidToken
+	}
+	var unverified josejwt.Claims
+	if err := token.UnsafeClaimsWithoutVerification(&unverified); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	if unverified.Issuer != i.URL {
+		return Claims{}, ErrForeignToken
+	}
+	if token.Headers[0].Algorithm != string(algorithm) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	key, err := i.verificationKey(token.Headers[0].KeyID)
+	if err != nil {
+		return Claims{}, err
+	}
+	var claims accessClaims
+	if err := token.Claims(&key.private.PublicKey, &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	expected := josejwt.Expected{Issuer: i.URL, Audience: josejwt.Audience{i.URL}, Time: time.Now()}
+	if err := claims.ValidateWithLeeway(expected, leeway); err != nil || claims.Expiry == nil {
+		return Claims{}, ErrInvalidToken
+	}
+	userId, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	result := Claims{
+		ID:        claims.ID,
+		UserID:    userId,
+		Role:      claims.Role,
+		ClientID:  claims.ClientID,
+		ExpiresAt: claims.Expiry.Time(),
+	}
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Time()
+	}
+	if claims.Scope != "" {
+		result.Scopes = strings.Fields(claims.Scope)
+	}
+
+	return result, nil
+}
+
+// JWKS returns the public keys that verify our access tokens.
+func (i *Issuer) JWKS() (jose.JSONWebKeySet, error) {
+	keys, err := i.load(false)
+	if err != nil {
+		return jose.JSONWebKeySet{}, err
+	}
+
+	set := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, jose.JSONWebKey{
+			Key:       &key.private.PublicKey,
+			KeyID:     key.id,
+			Algorithm: string(algorithm),
+			Use:       "sig",
+		})
+	}
+
+	return set, nil
+}
+
+// signingKey returns the newest key, making a new one when it is due.
+func (i *Issuer) signingKey() (signingKey, error) {
+	keys, err := i.load(false)
+	if err != nil {
+		return signingKey{}, err
+	}
+	if len(keys) > 0 && time.Since(keys[0].createdAt) < i.Rotation {
+		return keys[0], nil
+	}
+
+	if err := i.rotate(keys); err != nil {
+		return signingKey{}, err
+	}
+	keys, err = i.load(true)
+	if err != nil {
+		return signingKey{}, err
+	}
+	if len(keys) == 0 {
+		return signingKey{}, errors.New("no signing key")
+	}
+
+	return keys[0], nil
+}
+
+// verificationKey returns the key with id. An unknown id may be a key
+// another instance just made, so the keys are read again, but not more
+// often than every missReloadInterval.
+func (i *Issuer) verificationKey(id string) (signingKey, error) {
+	keys, err := i.load(false)
+	if err != nil {
+		return signingKey{}, err
+	}
+	if key, ok := findKey(keys, id); ok {
+		return key, nil
+	}
+
+	i.mu.Lock()
+	stale := time.Since(i.loadedAt) > missReloadInterval
+	i.mu.Unlock()
+	if stale {
+		if keys, err = i.load(true); err != nil {
+			return signingKey{}, err
+		}
+		if key, ok := findKey(keys, id); ok {
+			return key, nil
+		}
+	}
+
+	return signingKey{}, ErrInvalidToken
+}
+
+func findKey(keys []signingKey, id string) (signingKey, bool) {
+	for _, key := range keys {
+		if key.id == id {
+			return key, true
+		}
+	}
+
+	return signingKey{}, false
+}
+
+// rotate adds a new key and removes the keys whose tokens have all
+// expired, which are the ones replaced more than AccessTTL ago.
+func (i *Issuer) rotate(keys []signingKey) error {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if _, err := i.Keys.Add(random.Token(16), string(algorithm), string(encoded)); err != nil {
+		return err
+	}
+
+	// A key replaced by a key older than AccessTTL verifies no more live
+	// tokens.
+	for _, key := range keys {
+		if time.Since(key.createdAt) > i.AccessTTL+leeway {
+			return i.Keys.DeleteBefore(key.createdAt)
+		}
+	}
+
+	return nil
+}
+
+// load returns the keys, newest first, reading them from the database when
+// the cache is stale or force is set.
+func (i *Issuer) load(force bool) ([]signingKey, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !force && i.keys != nil && time.Since(i.loadedAt) < reloadInterval {
+		return i.keys, nil
+	}
+
+	stored, err := i.Keys.List()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]signingKey, 0, len(stored))
+	for _, s := range stored {
+		key, err := parseKey(s)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	i.keys = keys
+	i.loadedAt = time.Now()
+
+	return keys, nil
+}
+
+func parseKey(stored entity.SigningKey) (signingKey, error) {
+	block, _ := pem.Decode([]byte(stored.PrivateKey))
+	if block == nil {
+		return signingKey{}, errors.New("signing key " + stored.KeyID + " is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, err
+	}
+	private, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return signingKey{}, errors.New("signing key " + stored.KeyID + " is not an ECDSA key")
+	}
+
+	return signingKey{id: stored.KeyID, private: private, createdAt: stored.CreatedAt}, nil
+}
@@ -0,0 +1,231 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"sort"
+	"testing"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v3"
+	josejwt "github.com/go-jose/go-jose/v3/jwt"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testURL = "https://todo.example.com"
+
+// fakeKeys keeps signing keys in memory, so tests can age them.
+type fakeKeys struct {
+	keys []entity.SigningKey
+}
+
+func (f *fakeKeys) List() ([]entity.SigningKey, error) {
+	keys := append([]entity.SigningKey{}, f.keys...)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+
+	return keys, nil
+}
+
+func (f *fakeKeys) Add(keyID string, algorithm string, privateKey string) (entity.SigningKey, error) {
+	key := entity.SigningKey{ID: int64(len(f.keys) + 1), KeyID: keyID, Algorithm: algorithm, PrivateKey: privateKey, CreatedAt: time.Now()}
+	f.keys = append(f.keys, key)
+
+	return key, nil
+}
+
+func (f *fakeKeys) DeleteBefore(createdAt time.Time) error {
+	var kept []entity.SigningKey
+	for _, key := range f.keys {
+		if !key.CreatedAt.Before(createdAt) {
+			kept = append(kept, key)
+		}
+	}
+	f.keys = kept
+
+	return nil
+}
+
+// age moves the creation of the key with id back by d.
+func (f *fakeKeys) age(id string, d time.Duration) {
+	for i := range f.keys {
+		if f.keys[i].KeyID == id {
+			f.keys[i].CreatedAt = f.keys[i].CreatedAt.Add(-d)
+		}
+	}
+}
+
+func (f *fakeKeys) ids() []string {
+	keys, _ := f.List()
+	ids := []string{}
+	for _, key := range keys {
+		ids = append(ids, key.KeyID)
+	}
+
+	return ids
+}
+
+func newIssuer() (*Issuer, *fakeKeys) {
+	keys := &fakeKeys{}
+
+	return &Issuer{Keys: keys, URL: testURL, AccessTTL: 15 * time.Minute, Rotation: time.Hour}, keys
+}
+
+// sign signs claims with key like Issue does, but lets the test choose
+// every part of the token.
+func sign(t *testing.T, alg jose.SignatureAlgorithm, key interface{}, kid string, claims accessClaims) string {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: alg, Key: jose.JSONWebKey{Key: key, KeyID: kid}},
+		(&jose.SignerOptions{}).WithType(TokenType),
+	)
+	require.NoError(t, err)
+	raw, err := josejwt.Signed(signer).Claims(claims).CompactSerialize()
+	require.NoError(t, err)
+
+	return raw
+}
+
+func validClaims() accessClaims {
+	now := time.Now()
+
+	return accessClaims{
+		Claims: josejwt.Claims{
+			Issuer:   testURL,
+			Subject:  "7",
+			Audience: josejwt.Audience{testURL},
+			IssuedAt: josejwt.NewNumericDate(now),
+			Expiry:   josejwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Role: "user",
+	}
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	issuer, keys := newIssuer()
+	raw, expiresAt, err := issuer.Issue(7, "admin", []string{"tasks:read", "tasks:write"}, "app")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), expiresAt, time.Second)
+	assert.Len(t, keys.keys, 1)
+
+	claims, err := issuer.Verify(raw)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), claims.UserID)
+	assert.Equal(t, "admin", claims.Role)
+	assert.Equal(t, []string{"tasks:read", "tasks:write"}, claims.Scopes)
+	assert.Equal(t, "app", claims.ClientID)
+	assert.NotEmpty(t, claims.ID)
+	assert.Equal(t, expiresAt.Unix(), claims.ExpiresAt.Unix())
+}
+
+func TestVerifyRejects(t *testing.T) {
+	issuer, _ := newIssuer()
+	_, _, err := issuer.Issue(7, "user", nil, "")
+	require.NoError(t, err)
+	key := issuer.keys[0]
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	expired := validClaims()
+	expired.IssuedAt = josejwt.NewNumericDate(time.Now().Add(-time.Hour))
+	expired.Expiry = josejwt.NewNumericDate(time.Now().Add(-time.Minute))
+	foreign := validClaims()
+	foreign.Issuer = "https://accounts.example.com"
+	otherAudience := validClaims()
+	otherAudience.Audience = josejwt.Audience{"https://other.example.com"}
+	noExpiry := validClaims()
+	noExpiry.Expiry = nil
+	badSubject := validClaims()
+	badSubject.Subject = "alice"
+
+	tests := []struct {
+		name string
+		raw  string
+		err  error
+	}{
+		{"Malformed", "not-a-jwt", ErrInvalidToken},
+		{"WrongAlgorithm", sign(t, jose.HS256, []byte("0123456789abcdef0123456789abcdef"), key.id, validClaims()), ErrInvalidToken},
+		{"UnknownKeyID", sign(t, algorithm, key.private, "unknown", validClaims()), ErrInvalidToken},
+		{"WrongKey", sign(t, algorithm, other, key.id, validClaims()), ErrInvalidToken},
+		{"Expired", sign(t, algorithm, key.private, key.id, expired), ErrInvalidToken},
+		{"ForeignIssuer", sign(t, algorithm, other, "theirs", foreign), ErrForeignToken},
+		{"OtherAudience", sign(t, algorithm, key.private, key.id, otherAudience), ErrInvalidToken},
+		{"NoExpiry", sign(t, algorithm, key.private, key.id, noExpiry), ErrInvalidToken},
+		{"BadSubject", sign(t, algorithm, key.private, key.id, badSubject), ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := issuer.Verify(tt.raw)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+
+	_, err = issuer.Verify(sign(t, algorithm, key.private, key.id, validClaims()))
+	assert.NoError(t, err)
+}
+
+func TestVerifyReloadsUnknownKeys(t *testing.T) {
+	issuer, keys := newIssuer()
+	_, _, err := issuer.Issue(7, "user", nil, "")
+	require.NoError(t, err)
+
+	// Another instance rotates the key.
+	elsewhere := &Issuer{Keys: keys, URL: testURL, AccessTTL: 15 * time.Minute, Rotation: time.Hour}
+	keys.age(keys.keys[0].KeyID, 2*time.Hour)
+	raw, _, err := elsewhere.Issue(7, "user", nil, "")
+	require.NoError(t, err)
+
+	// Keys are not read again right after they were loaded.
+	_, err = issuer.Verify(raw)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	issuer.loadedAt = time.Now().Add(-missReloadInterval - time.Second)
+	_, err = issuer.Verify(raw)
+	assert.NoError(t, err)
+}
+
+func TestRotation(t *testing.T) {
+	issuer, keys := newIssuer()
+	first, _, err := issuer.Issue(7, "user", nil, "")
+	require.NoError(t, err)
+	firstID := keys.keys[0].KeyID
+
+	// The first key is due for rotation, but its tokens may still be live.
+	keys.age(firstID, 70*time.Minute)
+	issuer.keys = nil
+	second, _, err := issuer.Issue(7, "user", nil, "")
+	require.NoError(t, err)
+	require.Len(t, keys.keys, 2)
+	secondID := keys.ids()[0]
+	assert.NotEqual(t, firstID, secondID)
+	assert.Equal(t, []string{secondID, firstID}, keys.ids())
+
+	for _, raw := range []string{first, second} {
+		_, err := issuer.Verify(raw)
+		assert.NoError(t, err)
+	}
+	set, err := issuer.JWKS()
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, secondID, set.Keys[0].KeyID)
+	assert.Equal(t, firstID, set.Keys[1].KeyID)
+	assert.True(t, set.Keys[0].IsPublic())
+
+	// Once the second key is due and the first replaced long enough ago
+	// for its tokens to have expired, the first key is removed.
+	keys.age(firstID, time.Hour)
+	keys.age(secondID, 70*time.Minute)
+	issuer.keys = nil
+	_, _, err = issuer.Issue(7, "user", nil, "")
+	require.NoError(t, err)
+	ids := keys.ids()
+	require.Len(t, ids, 2)
+	assert.Equal(t, secondID, ids[1])
+
+	issuer.keys = nil
+	_, err = issuer.Verify(first)
+	assert.Equal(t, ErrInvalidToken, err)
+	_, err = issuer.Verify(second)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,220 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nargesbyt/todo.go/internal/random"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	CookieName     = "todo_session"
+	CSRFCookieName = "todo_csrf"
+	CSRFHeader     = "X-CSRF-Token"
+
+	keyPrefix     = "session:"
+	userKeyPrefix = "session:user:"
+
+	// touchInterval limits how often a session in use is written back to
+	// extend its idle timeout.
+	touchInterval = time.Minute
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a browser login. The cookie holds the id and a secret, of
+// which only a hash is stored; the id alone is safe to show when listing
+// sessions.
+type Session struct {
+	ID         string    `json:"id"`
+	SecretHash string    `json:"secret_hash"`
+	UserID     int64     `json:"user_id"`
+	CSRFToken  string    `json:"csrf_token"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Store keeps sessions in Redis. A session ends after IdleTimeout without
+// requests and at the latest AbsoluteTimeout after login.
+type Store struct {
+	RedisClient     *redis.Client
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+}
+
+// Create starts a session for a user and returns it with the cookie value.
+func (s *Store) Create(userId int64, userAgent string, ip string) (Session, string, error) {
+	now := time.Now()
+	secret := random.Token(32)
+	session := Session{
+		ID:         random.Token(16),
+		SecretHash: hash(secret),
+		UserID:     userId,
+		CSRFToken:  random.Token(32),
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.AbsoluteTimeout),
+	}
+	if err := s.save(session); err != nil {
+		return session, "", err
+	}
+	ctx := context.Background()
+	if err := s.RedisClient.SAdd(ctx, userKeyPrefix+userKey(userId), session.ID).Err(); err != nil {
+		return session, "", err
+	}
+	// The set of ids outlives none of its sessions.
+	if err := s.RedisClient.Expire(ctx, userKeyPrefix+userKey(userId), s.AbsoluteTimeout).Err(); err != nil {
+		return session, "", err
+	}
+
+	return session, session.ID + "." + secret, nil
+}
+
+// Authenticate returns the live session of a cookie value and extends its
+// idle timeout.
+func (s *Store) Authenticate(cookie string) (Session, error) {
+	id, secret, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	session, err := s.get(id)
+	if err != nil {
+		return session, err
+	}
+	if subtle.ConstantTimeCompare([]byte(session.SecretHash), []byte(hash(secret))) != 1 {
+		return Session{}, ErrSessionNotFound
+	}
+
+	now := time.Now()
+	if now.After(session.ExpiresAt) || now.Sub(session.LastSeenAt) > s.IdleTimeout {
+		return Session{}, ErrSessionNotFound
+	}
+	if now.Sub(session.LastSeenAt) > touchInterval {
+		session.LastSeenAt = now
+		if err := s.save(session); err != nil {
+			return session, err
+		}
+	}
+
+	return session, nil
+}
+
+// List returns the live sessions of a user, oldest first.
+func (s *Store) List(userId int64) ([]Session, error) {
+	ctx := context.Background()
+	ids, err := s.RedisClient.SMembers(ctx, userKeyPrefix+userKey(userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	for _, id := range ids {
+		session, err := s.get(id)
+		if err == ErrSessionNotFound {
+			// Expired sessions are dropped from the set lazily.
+			s.RedisClient.SRem(ctx, userKeyPrefix+userKey(userId), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+// Delete ends a session of a user.
+func (s *Store) Delete(userId int64, id string) error {
+	session, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userId {
+		return ErrSessionNotFound
+	}
+
+	ctx := context.Background()
+	if err := s.RedisClient.Del(ctx, keyPrefix+id).Err(); err != nil {
+		return err
+	}
+
+	return s.RedisClient.SRem(ctx, userKeyPrefix+userKey(userId), id).Err()
+}
+
+// SafeMethod reports whether requests with method may omit the CSRF
+// token, because they must not change anything.
+func SafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidCSRF reports whether token is the CSRF token of the session.
+func (session Session) ValidCSRF(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(session.CSRFToken), []byte(token)) == 1
+}
+
+func (s *Store) get(id string) (Session, error) {
+	var session Session
+
+	value, err := s.RedisClient.Get(context.Background(), keyPrefix+id).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return session, ErrSessionNotFound
+		}
+		return session, err
+	}
+	if err := json.Unmarshal(value, &session); err != nil {
+		return session, err
+	}
+
+	return session, nil
+}
+
+// save stores a session until it would time out.
+func (s *Store) save(session Session) error {
+	value, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	ttl := s.IdleTimeout
+	if remaining := time.Until(session.ExpiresAt); remaining < ttl {
+		ttl = remaining
+	}
+	if ttl <= 0 {
+		return ErrSessionNotFound
+	}
+
+	return s.RedisClient.Set(context.Background(), keyPrefix+session.ID, value, ttl).Err()
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func userKey(userId int64) string {
+	return strconv.FormatInt(userId, 10)
+}
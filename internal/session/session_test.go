@@ -0,0 +1,162 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T) (*Store, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	return &Store{RedisClient: client, IdleTimeout: 30 * time.Minute, AbsoluteTimeout: 24 * time.Hour}, server
+}
+
+// rewrite stores a changed copy of a session, as if time had passed since
+// it was last used.
+func rewrite(t *testing.T, s *Store, id string, change func(*Session)) {
+	session, err := s.get(id)
+	require.NoError(t, err)
+	change(&session)
+	value, err := json.Marshal(session)
+	require.NoError(t, err)
+	require.NoError(t, s.RedisClient.Set(context.Background(), keyPrefix+id, value, time.Hour).Err())
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, _ := setup(t)
+	created, cookie, err := s.Create(1, "Firefox", "192.0.2.1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(cookie, created.ID+"."))
+	assert.NotContains(t, created.SecretHash, strings.TrimPrefix(cookie, created.ID+"."))
+
+	session, err := s.Authenticate(cookie)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), session.UserID)
+	assert.Equal(t, created.CSRFToken, session.CSRFToken)
+
+	for _, cookie := range []string{"", created.ID, created.ID + ".", created.ID + ".wrong", "unknown." + strings.TrimPrefix(cookie, created.ID+".")} {
+		_, err := s.Authenticate(cookie)
+		assert.Equal(t, ErrSessionNotFound, err, cookie)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	t.Run("LastSeen", func(t *testing.T) {
+		s, _ := setup(t)
+		created, cookie, err := s.Create(1, "", "")
+		require.NoError(t, err)
+		rewrite(t, s, created.ID, func(session *Session) { session.LastSeenAt = time.Now().Add(-31 * time.Minute) })
+
+		_, err = s.Authenticate(cookie)
+		assert.Equal(t, ErrSessionNotFound, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		s, server := setup(t)
+		_, cookie, err := s.Create(1, "", "")
+		require.NoError(t, err)
+		server.FastForward(31 * time.Minute)
+
+		_, err = s.Authenticate(cookie)
+		assert.Equal(t, ErrSessionNotFound, err)
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		s, server := setup(t)
+		created, cookie, err := s.Create(1, "", "")
+		require.NoError(t, err)
+		lastSeen := time.Now().Add(-20 * time.Minute)
+		rewrite(t, s, created.ID, func(session *Session) { session.LastSeenAt = lastSeen })
+
+		session, err := s.Authenticate(cookie)
+		require.NoError(t, err)
+		assert.True(t, session.LastSeenAt.After(lastSeen))
+		assert.Equal(t, 30*time.Minute, server.TTL(keyPrefix+created.ID))
+	})
+}
+
+func TestAbsoluteTimeout(t *testing.T) {
+	t.Run("Expired", func(t *testing.T) {
+		s, _ := setup(t)
+		created, cookie, err := s.Create(1, "", "")
+		require.NoError(t, err)
+		rewrite(t, s, created.ID, func(session *Session) { session.ExpiresAt = time.Now().Add(-time.Second) })
+
+		_, err = s.Authenticate(cookie)
+		assert.Equal(t, ErrSessionNotFound, err)
+	})
+
+	t.Run("NotExtended", func(t *testing.T) {
+		s, server := setup(t)
+		created, cookie, err := s.Create(1, "", "")
+		require.NoError(t, err)
+		rewrite(t, s, created.ID, func(session *Session) {
+			session.LastSeenAt = time.Now().Add(-5 * time.Minute)
+			session.ExpiresAt = time.Now().Add(10 * time.Minute)
+		})
+
+		_, err = s.Authenticate(cookie)
+		require.NoError(t, err)
+		ttl := server.TTL(keyPrefix + created.ID)
+		assert.True(t, ttl > 0 && ttl <= 10*time.Minute, ttl)
+	})
+}
+
+func TestList(t *testing.T) {
+	s, server := setup(t)
+	first, _, err := s.Create(1, "", "")
+	require.NoError(t, err)
+	second, _, err := s.Create(1, "", "")
+	require.NoError(t, err)
+	_, _, err = s.Create(2, "", "")
+	require.NoError(t, err)
+	server.Del(keyPrefix + first.ID)
+
+	sessions, err := s.List(1)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, second.ID, sessions[0].ID)
+	members, err := server.Members(userKeyPrefix + "1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{second.ID}, members)
+
+	assert.Equal(t, ErrSessionNotFound, s.Delete(2, second.ID))
+	require.NoError(t, s.Delete(1, second.ID))
+	sessions, err = s.List(1)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestCSRF(t *testing.T) {
+	session := Session{CSRFToken: "token"}
+	tests := []struct {
+		method string
+		token  string
+		allow  bool
+	}{
+		{method: http.MethodGet, allow: true},
+		{method: http.MethodHead, allow: true},
+		{method: http.MethodOptions, allow: true},
+		{method: http.MethodPost},
+		{method: http.MethodPut, token: "wrong"},
+		{method: http.MethodPatch, token: "toke"},
+		{method: http.MethodDelete, token: "token", allow: true},
+		{method: "PROPFIND"},
+	}
+	for _, tt := range tests {
+		allow := SafeMethod(tt.method) || session.ValidCSRF(tt.token)
+		assert.Equal(t, tt.allow, allow, "%s with %q", tt.method, tt.token)
+	}
+
+	assert.False(t, Session{}.ValidCSRF(""))
+}
@@ -0,0 +1,121 @@
+package sso
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/random"
+	"github.com/nargesbyt/todo.go/repository"
+)
+
+// touchInterval limits how often the last login of an identity is written,
+// since ID tokens are checked on every request they are used for.
+const touchInterval = time.Minute
+
+var (
+	ErrEmailNotVerified = errors.New("the identity has no verified email")
+	ErrDomainNotAllowed = errors.New("the email domain may not sign up")
+	ErrAccountExists    = errors.New("an account with this email exists, sign in and link the identity to it")
+)
+
+// Provisioner finds the local user of an OIDC identity and creates one on
+// first login.
+type Provisioner struct {
+	Users      repository.Users
+	Identities repository.Identities
+}
+
+// User returns the user linked to identity. An unlinked identity with a
+// verified email from an allowed domain gets a new user, unless a user
+// with the email exists already: taking over that account only works by
+// linking the identity while signed in to it.
+func (p Provisioner) User(provider *Provider, identity Identity) (entity.User, error) {
+	linked, err := p.Identities.Get(identity.Issuer, identity.Subject)
+	if err == nil {
+		if time.Since(linked.LastLoginAt) > touchInterval {
+			if err := p.Identities.Touch(linked.ID); err != nil {
+				return entity.User{}, err
+			}
+		}
+
+		return p.Users.GetUserByID(linked.UserID)
+	}
+	if err != repository.ErrIdentityNotFound {
+		return entity.User{}, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return entity.User{}, ErrEmailNotVerified
+	}
+	if !allowedDomain(provider.Domains, identity.Email) {
+		return entity.User{}, ErrDomainNotAllowed
+	}
+	if _, err := p.Users.GetUserByEmail(identity.Email); err == nil {
+		return entity.User{}, ErrAccountExists
+	} else if err != repository.ErrUserNotFound {
+		return entity.User{}, err
+	}
+
+	username, err := p.username(identity)
+	if err != nil {
+		return entity.User{}, err
+	}
+	// The password is never told to anyone, the user signs in through the
+	// provider or a token.
+	user, err := p.Users.Create(identity.Email, random.Token(32), username)
+	if err != nil {
+		return entity.User{}, err
+	}
+	if _, err := p.Identities.Add(user.ID, identity.Issuer, identity.Subject, identity.Email); err != nil {
+		return entity.User{}, err
+	}
+
+	return user, nil
+}
+
+// Link links identity to an existing user.
+func (p Provisioner) Link(userId int64, identity Identity) (entity.Identity, error) {
+	return p.Identities.Add(userId, identity.Issuer, identity.Subject, identity.Email)
+}
+
+// username picks a free username from the preferred username or the local
+// part of the email, adding a random suffix if it is taken.
+func (p Provisioner) username(identity Identity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		_, err := p.Users.GetUserByUsername(candidate)
+		if err == repository.ErrUserNotFound {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = base + "-" + strings.ToLower(random.Token(4))
+	}
+
+	return "", errors.New("unable to find a free username")
+}
+
+func allowedDomain(domains []string, email string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	for _, domain := range domains {
+		if strings.EqualFold(email[at+1:], domain) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,213 @@
+package sso
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown OIDC provider")
+	ErrMalformedToken  = errors.New("malformed ID token")
+)
+
+// Claims names the ID token claims that hold the attributes of a user.
+// Empty names fall back to the standard OIDC claims.
+type Claims struct {
+	Subject  string `mapstructure:"subject"`
+	Email    string `mapstructure:"email"`
+	Name     string `mapstructure:"name"`
+	Username string `mapstructure:"username"`
+}
+
+// Config is the configuration of one OIDC provider.
+type Config struct {
+	Name         string   `mapstructure:"name"`
+	Issuer       string   `mapstructure:"issuer"`
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	Scopes       []string `mapstructure:"scopes"`
+	RedirectURL  string   `mapstructure:"redirect_url"`
+	Claims       Claims   `mapstructure:"claims"`
+	// AllowedDomains limits which email domains may sign up on first login.
+	// Without any, every verified email may.
+	AllowedDomains []string `mapstructure:"allowed_domains"`
+}
+
+// Identity holds the user attributes read from an ID token.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+}
+
+// Provider is a discovered OIDC provider.
+type Provider struct {
+	Name     string
+	Issuer   string
+	OAuth2   oauth2.Config
+	Verifier *oidc.IDTokenVerifier
+	Claims   Claims
+	Domains  []string
+}
+
+// Identity reads the attributes of the user an ID token was issued for
+// using the claim names of the provider.
+func (p *Provider) Identity(idToken *oidc.IDToken) (Identity, error) {
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, err
+	}
+
+	identity := Identity{
+		Issuer:   idToken.Issuer,
+		Subject:  stringClaim(claims, p.Claims.Subject, "sub"),
+		Email:    stringClaim(claims, p.Claims.Email, "email"),
+		Name:     stringClaim(claims, p.Claims.Name, "name"),
+		Username: stringClaim(claims, p.Claims.Username, "preferred_username"),
+	}
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	if identity.Subject == "" {
+		return Identity{}, ErrMalformedToken
+	}
+
+	return identity, nil
+}
+
+func stringClaim(claims map[string]interface{}, name string, fallback string) string {
+	if name == "" {
+		name = fallback
+	}
+	value, _ := claims[name].(string)
+
+	return value
+}
+
+// Providers are the configured OIDC providers, looked up by name for the
+// login flow and by issuer for verifying ID tokens.
+type Providers struct {
+	byName   map[string]*Provider
+	byIssuer map[string]*Provider
+}
+
+// NewProviders discovers every configured provider.
+func NewProviders(ctx context.Context, configs []Config) (*Providers, error) {
+	p := &Providers{byName: map[string]*Provider{}, byIssuer: map[string]*Provider{}}
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" {
+			return nil, fmt.Errorf("OIDC provider %q needs a name and an issuer", config.Name)
+		}
+		if _, ok := p.byName[config.Name]; ok {
+			return nil, fmt.Errorf("OIDC provider %q is configured twice", config.Name)
+		}
+
+		provider, err := oidc.NewProvider(ctx, config.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("unable to discover OIDC provider %q: %w", config.Name, err)
+		}
+
+		scopes := config.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"profile", "email"}
+		}
+		if !contains(scopes, oidc.ScopeOpenID) {
+			scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+		}
+
+		p.add(&Provider{
+			Name:   config.Name,
+			Issuer: config.Issuer,
+			OAuth2: oauth2.Config{
+				ClientID:     config.ClientID,
+				ClientSecret: config.ClientSecret,
+				RedirectURL:  config.RedirectURL,
+				Endpoint:     provider.Endpoint(),
+				Scopes:       scopes,
+			},
+			Verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+			Claims:   config.Claims,
+			Domains:  config.AllowedDomains,
+		})
+	}
+
+	return p, nil
+}
+
+func (p *Providers) add(provider *Provider) {
+	p.byName[provider.Name] = provider
+	p.byIssuer[strings.TrimSuffix(provider.Issuer, "/")] = provider
+}
+
+// Get returns the provider called name.
+func (p *Providers) Get(name string) (*Provider, error) {
+	provider, ok := p.byName[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	return provider, nil
+}
+
+// Verify verifies a raw ID token with the provider matching its iss claim.
+func (p *Providers) Verify(ctx context.Context, raw string) (*Provider, *oidc.IDToken, error) {
+	issuer, err := unverifiedIssuer(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, ok := p.byIssuer[strings.TrimSuffix(issuer, "/")]
+	if !ok {
+		return nil, nil, ErrUnknownProvider
+	}
+
+	idToken, err := provider.Verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return provider, idToken, nil
+}
+
+// unverifiedIssuer reads the iss claim of a JWT without checking its
+// signature, which is only good for choosing the key to check it with.
+func unverifiedIssuer(raw string) (string, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return "", ErrMalformedToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformedToken
+	}
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Issuer == "" {
+		return "", ErrMalformedToken
+	}
+
+	return claims.Issuer, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+package sso
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	jose "github.com/go-jose/go-jose/v3"
+	josejwt "github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = "https://id.example.com/"
+
+func TestProvidersVerify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	keys := &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{key.Public()}}
+	providers := &Providers{byName: map[string]*Provider{}, byIssuer: map[string]*Provider{}}
+	providers.add(&Provider{
+		Name:     "example",
+		Issuer:   testIssuer,
+		Verifier: oidc.NewVerifier("https://id.example.com", keys, &oidc.Config{ClientID: "todo", SupportedSigningAlgs: []string{oidc.ES256}}),
+	})
+
+	claims := josejwt.Claims{
+		Issuer:   "https://id.example.com",
+		Subject:  "alice",
+		Audience: josejwt.Audience{"todo"},
+		Expiry:   josejwt.NewNumericDate(time.Now().Add(time.Hour)),
+		IssuedAt: josejwt.NewNumericDate(time.Now()),
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		provider, idToken, err := providers.Verify(context.Background(), sign(t, key, claims))
+		require.NoError(t, err)
+		assert.Equal(t, "example", provider.Name)
+		assert.Equal(t, "alice", idToken.Subject)
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		_, _, err := providers.Verify(context.Background(), sign(t, other, claims))
+		assert.Error(t, err)
+	})
+
+	t.Run("WrongAudience", func(t *testing.T) {
+		c := claims
+		c.Audience = josejwt.Audience{"other"}
+		_, _, err := providers.Verify(context.Background(), sign(t, key, c))
+		assert.Error(t, err)
+	})
+
+	t.Run("UnknownIssuer", func(t *testing.T) {
+		c := claims
+		c.Issuer = "https://evil.example.com"
+		_, _, err := providers.Verify(context.Background(), sign(t, key, c))
+		assert.Equal(t, ErrUnknownProvider, err)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		_, _, err := providers.Verify(context.Background(), "not-a-jwt")
+		assert.Equal(t, ErrMalformedToken, err)
+	})
+}
+
+func TestUnverifiedIssuer(t *testing.T) {
+	encode := func(payload string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2ln"
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+		want string
+		err  error
+	}{
+		{name: "Issuer", raw: encode(`{"iss":"https://id.example.com","sub":"alice"}`), want: "https://id.example.com"},
+		{name: "NoIssuer", raw: encode(`{"sub":"alice"}`), err: ErrMalformedToken},
+		{name: "NotJSON", raw: encode(`iss`), err: ErrMalformedToken},
+		{name: "NotBase64", raw: "e30.%%%.c2ln", err: ErrMalformedToken},
+		{name: "TwoParts", raw: "e30.e30", err: ErrMalformedToken},
+		{name: "Opaque", raw: "todo_pat_abc", err: ErrMalformedToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer, err := unverifiedIssuer(tt.raw)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, issuer)
+		})
+	}
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, claims josejwt.Claims) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	require.NoError(t, err)
+	raw, err := josejwt.Signed(signer).Claims(claims).CompactSerialize()
+	require.NoError(t, err)
+
+	return raw
+}
@@ -0,0 +1,122 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nargesbyt/todo.go/repository"
+)
+
+const dayLayout = "2006-01-02"
+
+// Report summarizes how a user is doing with their tasks.
+type Report struct {
+	Since          string                `json:"since"`
+	Total          int64                 `json:"total"`
+	Finished       int64                 `json:"finished"`
+	CompletionRate float64               `json:"completion_rate"`
+	Created        Series                `json:"created"`
+	Completed      Series                `json:"completed"`
+	CycleTime      float64               `json:"average_cycle_time_seconds"`
+	Overdue        int64                 `json:"overdue"`
+	Streak         int                   `json:"streak_days"`
+	Projects       map[string]Completion `json:"projects"`
+	Contexts       map[string]Completion `json:"contexts"`
+}
+
+// Series counts tasks per day and per ISO week, like 2024-W05.
+type Series struct {
+	Daily  []repository.DayCount `json:"daily"`
+	Weekly []WeekCount           `json:"weekly"`
+}
+
+type WeekCount struct {
+	Week  string `json:"week"`
+	Count int64  `json:"count"`
+}
+
+type Completion struct {
+	Total    int64   `json:"total"`
+	Finished int64   `json:"finished"`
+	Rate     float64 `json:"rate"`
+}
+
+// NewReport builds the report of the statistics computed since the given
+// time.
+func NewReport(s repository.TaskStats, since time.Time, now time.Time) Report {
+	r := Report{
+		Since:     since.UTC().Format(dayLayout),
+		Total:     s.Total,
+		Finished:  s.Finished,
+		Created:   series(s.Created),
+		Completed: series(s.Completed),
+		CycleTime: s.AverageCycleTime.Seconds(),
+		Overdue:   s.Overdue,
+		Streak:    streak(s.CompletionDays, now),
+		Projects:  completions(s.Projects),
+		Contexts:  completions(s.Contexts),
+	}
+	if s.Total > 0 {
+		r.CompletionRate = float64(s.Finished) / float64(s.Total)
+	}
+
+	return r
+}
+
+func completions(counts []repository.TagCount) map[string]Completion {
+	m := map[string]Completion{}
+	for _, count := range counts {
+		c := Completion{Total: count.Total, Finished: count.Finished}
+		if c.Total > 0 {
+			c.Rate = float64(c.Finished) / float64(c.Total)
+		}
+		m[count.Tag] = c
+	}
+
+	return m
+}
+
+func series(daily []repository.DayCount) Series {
+	s := Series{Daily: daily, Weekly: []WeekCount{}}
+	if s.Daily == nil {
+		s.Daily = []repository.DayCount{}
+	}
+
+	weeks := map[string]int64{}
+	for _, d := range daily {
+		day, err := time.Parse(dayLayout, d.Day)
+		if err != nil {
+			continue
+		}
+		year, week := day.ISOWeek()
+		weeks[fmt.Sprintf("%d-W%02d", year, week)] += d.Count
+	}
+	for week, count := range weeks {
+		s.Weekly = append(s.Weekly, WeekCount{Week: week, Count: count})
+	}
+	sort.Slice(s.Weekly, func(i, j int) bool { return s.Weekly[i].Week < s.Weekly[j].Week })
+
+	return s
+}
+
+// streak counts the consecutive days up to today on which a task was
+// finished. A streak that ended yesterday still counts, since today is not
+// over yet.
+func streak(days []string, now time.Time) int {
+	day := now.UTC().Truncate(24 * time.Hour)
+	if len(days) > 0 && days[0] != day.Format(dayLayout) {
+		day = day.AddDate(0, 0, -1)
+	}
+
+	n := 0
+	for _, d := range days {
+		if d != day.Format(dayLayout) {
+			break
+		}
+		n++
+		day = day.AddDate(0, 0, -1)
+	}
+
+	return n
+}
@@ -0,0 +1,157 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/nargesbyt/todo.go/repository"
+)
+
+// Encoder writes records in one of the export formats.
+type Encoder interface {
+	Begin() error
+	Encode(r Record) error
+	End() error
+}
+
+func NewEncoder(format string, w io.Writer) (Encoder, error) {
+	switch format {
+	case CSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	case JSON:
+		return &jsonEncoder{w: w}, nil
+	case NDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Export encodes every task of a user one page at a time, calling flush
+// after each page so the response is streamed instead of buffered.
+func Export(tasks repository.Tasks, imports repository.Imports, userId int64, enc Encoder, flush func()) error {
+	if err := enc.Begin(); err != nil {
+		return err
+	}
+
+	page := repository.Page{Limit: repository.MaxPageLimit}
+	for {
+		batch, info, err := tasks.Find("", "", userId, page)
+		if err != nil {
+			return err
+		}
+
+		// Parents may be on another page.
+		ids := make([]int64, 0, len(batch))
+		for _, task := range batch {
+			ids = append(ids, task.ID)
+			if task.ParentID.Valid {
+				ids = append(ids, task.ParentID.Int64)
+			}
+		}
+		externalIds, err := imports.ExternalIDs(ids)
+		if err != nil {
+			return err
+		}
+		for _, task := range batch {
+			if err := enc.Encode(recordOf(*task, externalIds)); err != nil {
+				return err
+			}
+		}
+		flush()
+
+		if !info.HasNext {
+			break
+		}
+		page.After = info.EndID
+	}
+
+	return enc.End()
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Begin() error {
+	return e.w.Write(columns)
+}
+
+func (e *csvEncoder) Encode(r Record) error {
+	err := e.w.Write([]string{
+		strconv.FormatInt(r.ID, 10),
+		r.ExternalID,
+		r.Title,
+		r.Status,
+		formatTime(r.CreatedAt),
+		formatTime(r.FinishedAt),
+		r.Due,
+		r.Priority,
+		r.Labels,
+		r.Parent,
+	})
+	if err != nil {
+		return err
+	}
+	e.w.Flush()
+
+	return e.w.Error()
+}
+
+func (e *csvEncoder) End() error {
+	e.w.Flush()
+
+	return e.w.Error()
+}
+
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) Begin() error {
+	_, err := io.WriteString(e.w, "[")
+
+	return err
+}
+
+func (e *jsonEncoder) Encode(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		b = append([]byte(","), b...)
+	}
+	e.count++
+	_, err = e.w.Write(b)
+
+	return err
+}
+
+func (e *jsonEncoder) End() error {
+	_, err := io.WriteString(e.w, "]\n")
+
+	return err
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Begin() error { return nil }
+
+func (e *ndjsonEncoder) Encode(r Record) error { return e.enc.Encode(r) }
+
+func (e *ndjsonEncoder) End() error { return nil }
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
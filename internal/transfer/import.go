@@ -0,0 +1,376 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+)
+
+const (
+	DefaultStatus = "pending"
+
+	maxTitleLength      = 255
+	maxLabelsLength     = 255
+	maxPriorityLength   = 16
+	maxExternalIDLength = 255
+	maxRowErrors        = 100
+	progressEvery       = 50
+)
+
+var ErrMissingTitleColumn = errors.New("csv header has no title column")
+
+// Decoder reads records one at a time. Next returns io.EOF after the last
+// record and a *RowError for a record that can not be decoded but does not
+// prevent reading the following ones.
+type Decoder interface {
+	Next() (Record, error)
+}
+
+// RowError describes why a record was not imported. Rows are numbered from
+// 1, not counting a CSV header.
+type RowError struct {
+	Row        int    `json:"row"`
+	ExternalID string `json:"external_id,omitempty"`
+	Detail     string `json:"detail"`
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Detail)
+}
+
+// InputError is returned by an import when its input can not be read any
+// further, as opposed to failing to store what was read.
+type InputError struct {
+	Err error
+}
+
+func (e *InputError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+// Result summarizes an import. With DryRun nothing was written and Created
+// and Updated count the tasks that would have been.
+type Result struct {
+	DryRun  bool        `json:"dry_run"`
+	Rows    int         `json:"rows"`
+	Created int         `json:"created"`
+	Updated int         `json:"updated"`
+	Skipped int         `json:"skipped"`
+	Failed  int         `json:"failed"`
+	Errors  []*RowError `json:"errors"`
+}
+
+func (r *Result) fail(err *RowError) {
+	r.Failed++
+	if len(r.Errors) < maxRowErrors {
+		r.Errors = append(r.Errors, err)
+	}
+}
+
+func NewDecoder(format string, r io.Reader) (Decoder, error) {
+	switch format {
+	case CSV:
+		return newCSVDecoder(r)
+	case JSON:
+		return newJSONDecoder(r)
+	case NDJSON:
+		return &ndjsonDecoder{scanner: bufio.NewScanner(r)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Importer creates tasks from records, skipping those whose external id
+// was already imported for the user. Progress, when set, is called with the
+// result so far every few rows.
+type Importer struct {
+	Tasks    repository.Tasks
+	Imports  repository.Imports
+	Progress func(Result)
+}
+
+// Import reads all records of dec. The returned error is an *InputError
+// when the input can not be read any further, and any other error when
+// tasks can not be stored; invalid records are reported in the result.
+func (i Importer) Import(userId int64, dec Decoder, dryRun bool) (Result, error) {
+	result := Result{DryRun: dryRun, Errors: []*RowError{}}
+	seen := map[string]bool{}
+
+	for {
+		record, err := dec.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+		rowErr, ok := err.(*RowError)
+		if err != nil && !ok {
+			return result, &InputError{Err: err}
+		}
+		result.Rows++
+		if i.Progress != nil && result.Rows%progressEvery == 0 {
+			i.Progress(result)
+		}
+		if ok {
+			result.fail(rowErr)
+			continue
+		}
+
+		if detail := validate(&record); detail != "" {
+			result.fail(&RowError{Row: result.Rows, ExternalID: record.ExternalID, Detail: detail})
+			continue
+		}
+
+		if record.ExternalID != "" {
+			if seen[record.ExternalID] {
+				result.Skipped++
+				continue
+			}
+			seen[record.ExternalID] = true
+
+			_, err := i.Imports.Get(userId, record.ExternalID)
+			if err == nil {
+				result.Skipped++
+				continue
+			}
+			if err != repository.ErrImportNotFound {
+				return result, err
+			}
+		}
+
+		if !dryRun {
+			if err := i.create(userId, record); err != nil {
+				return result, err
+			}
+		}
+		result.Created++
+	}
+}
+
+// create stores a record as a task, below the task its parent was
+// imported as.
+func (i Importer) create(userId int64, record Record) error {
+	task := newTask(userId, record)
+	if record.Parent != "" {
+		parent, err := i.Imports.Get(userId, record.Parent)
+		switch err {
+		case nil:
+			task.ParentID = sql.NullInt64{Int64: parent.TaskID, Valid: true}
+		case repository.ErrImportNotFound:
+		default:
+			return err
+		}
+	}
+	_, err := i.Tasks.CreateImported(task, record.ExternalID)
+
+	return err
+}
+
+// newTask returns the task a record stands for, without its parent. Its
+// creation and finish times are only known when the source has them; a
+// finished task without a finish time stays out of the completion
+// statistics rather than counting as finished now.
+func newTask(userId int64, record Record) entity.Task {
+	task := entity.Task{
+		Title:    record.Title,
+		Status:   record.Status,
+		Due:      record.Due,
+		Priority: record.Priority,
+		Labels:   record.Labels,
+		UserID:   userId,
+	}
+	if record.CreatedAt != nil {
+		task.CreatedAt = *record.CreatedAt
+	}
+	if record.FinishedAt != nil && entity.Finished(record.Status) {
+		task.FinishedAt = sql.NullTime{Time: *record.FinishedAt, Valid: true}
+		if task.CreatedAt.IsZero() || task.CreatedAt.After(*record.FinishedAt) {
+			task.CreatedAt = *record.FinishedAt
+		}
+	}
+
+	return task
+}
+
+// validate normalizes a record and returns why it is invalid, or an empty
+// string.
+func validate(record *Record) string {
+	record.Title = strings.TrimSpace(record.Title)
+	record.Status = strings.TrimSpace(record.Status)
+	record.ExternalID = strings.TrimSpace(record.ExternalID)
+	record.Due = strings.TrimSpace(record.Due)
+	record.Priority = strings.TrimSpace(record.Priority)
+	record.Labels = strings.Join(strings.Fields(record.Labels), " ")
+	record.Parent = strings.TrimSpace(record.Parent)
+	if record.Status == "" {
+		record.Status = DefaultStatus
+	}
+
+	switch {
+	case record.Title == "":
+		return "title is required"
+	case len(record.Title) > maxTitleLength:
+		return fmt.Sprintf("title is longer than %d bytes", maxTitleLength)
+	case len(record.ExternalID) > maxExternalIDLength:
+		return fmt.Sprintf("external_id is longer than %d bytes", maxExternalIDLength)
+	case record.Due != "" && !ValidDate(record.Due):
+		return "due must be a date like 2024-01-31"
+	case len(record.Priority) > maxPriorityLength:
+		return fmt.Sprintf("priority is longer than %d bytes", maxPriorityLength)
+	case len(record.Labels) > maxLabelsLength:
+		return fmt.Sprintf("labels are longer than %d bytes", maxLabelsLength)
+	}
+
+	return ""
+}
+
+type csvDecoder struct {
+	r     *csv.Reader
+	index map[string]int
+	row   int
+}
+
+func newCSVDecoder(r io.Reader) (*csvDecoder, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, ErrMissingTitleColumn
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := index["title"]; !ok {
+		return nil, ErrMissingTitleColumn
+	}
+
+	return &csvDecoder{r: reader, index: index}, nil
+}
+
+func (d *csvDecoder) Next() (Record, error) {
+	fields, err := d.r.Read()
+	if err == io.EOF {
+		return Record{}, io.EOF
+	}
+	d.row++
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); ok {
+			return Record{}, &RowError{Row: d.row, Detail: err.Error()}
+		}
+		return Record{}, err
+	}
+
+	field := func(name string) string {
+		i, ok := d.index[name]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		return fields[i]
+	}
+
+	record := Record{
+		ExternalID: field("external_id"),
+		Title:      field("title"),
+		Status:     field("status"),
+		Due:        field("due"),
+		Priority:   field("priority"),
+		Labels:     field("labels"),
+		Parent:     field("parent"),
+	}
+	for _, column := range []struct {
+		name string
+		time **time.Time
+	}{{"created_at", &record.CreatedAt}, {"finished_at", &record.FinishedAt}} {
+		value := strings.TrimSpace(field(column.name))
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return Record{}, &RowError{Row: d.row, ExternalID: record.ExternalID, Detail: column.name + " must be a time like 2024-01-31T09:00:00Z"}
+		}
+		*column.time = &t
+	}
+
+	return record, nil
+}
+
+// jsonDecoder streams the elements of a JSON array.
+type jsonDecoder struct {
+	dec *json.Decoder
+	row int
+}
+
+func newJSONDecoder(r io.Reader) (*jsonDecoder, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("json import must be an array of tasks")
+	}
+
+	return &jsonDecoder{dec: dec}, nil
+}
+
+func (d *jsonDecoder) Next() (Record, error) {
+	if !d.dec.More() {
+		return Record{}, io.EOF
+	}
+	d.row++
+
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		return Record{}, err
+	}
+	var record Record
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return Record{}, &RowError{Row: d.row, Detail: err.Error()}
+	}
+
+	return record, nil
+}
+
+type ndjsonDecoder struct {
+	scanner *bufio.Scanner
+	row     int
+}
+
+func (d *ndjsonDecoder) Next() (Record, error) {
+	for d.scanner.Scan() {
+		line := bytes.TrimSpace(d.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		d.row++
+
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return Record{}, &RowError{Row: d.row, Detail: err.Error()}
+		}
+		return record, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+
+	return Record{}, io.EOF
+}
@@ -0,0 +1,155 @@
+package transfer
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImporter(t *testing.T) {
+	dbErr := errors.New("connection refused")
+	isTask := func(title string, status string, finished bool) interface{} {
+		return mock.MatchedBy(func(task entity.Task) bool {
+			return task.Title == title && task.Status == status && task.UserID == 1 && task.FinishedAt.Valid == finished
+		})
+	}
+
+	tests := []struct {
+		name   string
+		in     string
+		dryRun bool
+		setup  func(tasks *repository.MockTaskRepository, imports *repository.MockImportRepository)
+		want   Result
+		err    error
+	}{
+		{
+			name: "Creates",
+			in:   `{"title":" Open "}` + "\n" + `{"title":"Closed","status":"done","external_id":"a-1"}`,
+			setup: func(tasks *repository.MockTaskRepository, imports *repository.MockImportRepository) {
+				imports.On("Get", int64(1), "a-1").Return(entity.ImportedTask{}, repository.ErrImportNotFound)
+				tasks.On("CreateImported", isTask("Open", "pending", false), "").Return(entity.Task{ID: 1}, nil)
+				tasks.On("CreateImported", isTask("Closed", "done", false), "a-1").Return(entity.Task{ID: 2}, nil)
+			},
+			want: Result{Rows: 2, Created: 2, Errors: []*RowError{}},
+		},
+		{
+			name: "KeepsFields",
+			in:   `{"title":"Item","status":"done","finished_at":"2024-01-02T00:00:00Z","due":"2024-01-03","priority":"p1","labels":" +work  @desk ","parent":"a-1"}`,
+			setup: func(tasks *repository.MockTaskRepository, imports *repository.MockImportRepository) {
+				imports.On("Get", int64(1), "a-1").Return(entity.ImportedTask{TaskID: 6}, nil)
+				finishedAt := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+				tasks.On("CreateImported", entity.Task{
+					Title:      "Item",
+					Status:     "done",
+					CreatedAt:  finishedAt,
+					FinishedAt: sql.NullTime{Time: finishedAt, Valid: true},
+					Due:        "2024-01-03",
+					Priority:   "p1",
+					Labels:     "+work @desk",
+					ParentID:   sql.NullInt64{Int64: 6, Valid: true},
+					UserID:     1,
+				}, "").Return(entity.Task{ID: 7}, nil)
+			},
+			want: Result{Rows: 1, Created: 1, Errors: []*RowError{}},
+		},
+		{
+			name: "SkipsImported",
+			in:   `{"title":"Old","external_id":"a-1"}` + "\n" + `{"title":"Again","external_id":"a-2"}` + "\n" + `{"title":"Twice","external_id":"a-2"}`,
+			setup: func(tasks *repository.MockTaskRepository, imports *repository.MockImportRepository) {
+				imports.On("Get", int64(1), "a-1").Return(entity.ImportedTask{TaskID: 3}, nil)
+				imports.On("Get", int64(1), "a-2").Return(entity.ImportedTask{}, repository.ErrImportNotFound)
+				tasks.On("CreateImported", isTask("Again", "pending", false), "a-2").Return(entity.Task{ID: 4}, nil)
+			},
+			want: Result{Rows: 3, Created: 1, Skipped: 2, Errors: []*RowError{}},
+		},
+		{
+			name: "ReportsInvalidRows",
+			in:   `{"title":""}` + "\n" + `{"title":"` + strings.Repeat("a", maxTitleLength+1) + `"}` + "\n" + `[]` + "\n" + `{"title":"Open","due":"tomorrow"}`,
+			want: Result{Rows: 4, Failed: 4, Errors: []*RowError{
+				{Row: 1, Detail: "title is required"},
+				{Row: 2, Detail: "title is longer than 255 bytes"},
+				{Row: 3, Detail: "json: cannot unmarshal array into Go value of type transfer.Record"},
+				{Row: 4, Detail: "due must be a date like 2024-01-31"},
+			}},
+		},
+		{
+			name:   "DryRun",
+			in:     `{"title":"Open"}`,
+			dryRun: true,
+			want:   Result{DryRun: true, Rows: 1, Created: 1, Errors: []*RowError{}},
+		},
+		{
+			name: "StoreError",
+			in:   `{"title":"Open"}`,
+			setup: func(tasks *repository.MockTaskRepository, imports *repository.MockImportRepository) {
+				tasks.On("CreateImported", mock.Anything, "").Return(entity.Task{}, dbErr)
+			},
+			want: Result{Rows: 1, Errors: []*RowError{}},
+			err:  dbErr,
+		},
+		{
+			name: "LookupError",
+			in:   `{"title":"Open","external_id":"a-1"}`,
+			setup: func(tasks *repository.MockTaskRepository, imports *repository.MockImportRepository) {
+				imports.On("Get", int64(1), "a-1").Return(entity.ImportedTask{}, dbErr)
+			},
+			want: Result{Rows: 1, Errors: []*RowError{}},
+			err:  dbErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks := new(repository.MockTaskRepository)
+			imports := new(repository.MockImportRepository)
+			if tt.setup != nil {
+				tt.setup(tasks, imports)
+			}
+			dec, err := NewDecoder(NDJSON, strings.NewReader(tt.in))
+			require.NoError(t, err)
+
+			result, err := Importer{Tasks: tasks, Imports: imports}.Import(1, dec, tt.dryRun)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, result)
+			tasks.AssertExpectations(t)
+			imports.AssertExpectations(t)
+		})
+	}
+}
+
+func TestImporterInputError(t *testing.T) {
+	readErr := errors.New("unexpected EOF")
+	dec, err := NewDecoder(NDJSON, &failingReader{data: `{"title":"Open"}` + "\n", err: readErr})
+	require.NoError(t, err)
+	tasks := new(repository.MockTaskRepository)
+	tasks.On("CreateImported", mock.Anything, "").Return(entity.Task{ID: 1}, nil)
+
+	result, err := Importer{Tasks: tasks, Imports: new(repository.MockImportRepository)}.Import(1, dec, false)
+	var inputErr *InputError
+	require.ErrorAs(t, err, &inputErr)
+	assert.ErrorIs(t, err, readErr)
+	assert.Equal(t, 1, result.Created)
+}
+
+// failingReader returns data and then err.
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+
+	return n, nil
+}
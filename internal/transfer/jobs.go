@@ -0,0 +1,184 @@
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nargesbyt/todo.go/internal/random"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+
+	jobKeyPrefix = "import:job:"
+	// A job that is not done is saved at least every jobHeartbeat while it
+	// runs, so one that was not saved for jobStaleAfter was interrupted,
+	// like by a restart.
+	jobHeartbeat  = 30 * time.Second
+	jobStaleAfter = 3 * jobHeartbeat
+)
+
+var (
+	ErrJobNotFound    = errors.New("import job not found")
+	errJobInterrupted = errors.New("the import was interrupted, retry it")
+)
+
+// Job is an import running in the background. Result is updated while it
+// runs; Total is set when the number of records is known up front.
+type Job struct {
+	ID        string    `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Source    string    `json:"source"`
+	Status    string    `json:"status"`
+	Total     int       `json:"total,omitempty"`
+	Result    Result    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Jobs runs imports in the background and keeps their state in Redis, so
+// any instance can report their progress.
+type Jobs struct {
+	RedisClient *redis.Client
+	TTL         time.Duration
+	Importer    Importer
+}
+
+// Start imports the file at path in the background and removes it when
+// done. open turns the file into records of the job's source.
+func (j *Jobs) Start(userId int64, source string, dryRun bool, path string, open func(io.Reader) (Decoder, error)) (Job, error) {
+	now := time.Now()
+	job := Job{
+		ID:        random.Token(24),
+		UserID:    userId,
+		Source:    source,
+		Status:    JobQueued,
+		Result:    Result{DryRun: dryRun, Errors: []*RowError{}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := j.save(job); err != nil {
+		return job, err
+	}
+
+	go j.run(job, path, open)
+
+	return job, nil
+}
+
+// Get returns a job. A job that stopped being saved while it was not done
+// yet is marked failed.
+func (j *Jobs) Get(id string) (Job, error) {
+	var job Job
+
+	value, err := j.RedisClient.Get(context.Background(), jobKeyPrefix+id).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return job, ErrJobNotFound
+		}
+		return job, err
+	}
+	if err := json.Unmarshal(value, &job); err != nil {
+		return job, err
+	}
+
+	if (job.Status == JobQueued || job.Status == JobRunning) && time.Since(job.UpdatedAt) > jobStaleAfter {
+		job.Status = JobFailed
+		job.Error = errJobInterrupted.Error()
+		j.update(job)
+	}
+
+	return job, nil
+}
+
+func (j *Jobs) run(job Job, path string, open func(io.Reader) (Decoder, error)) {
+	defer os.Remove(path)
+
+	// The heartbeat and progress updates both save the job.
+	var mu sync.Mutex
+	update := func(change func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		change()
+		j.update(job)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(jobHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				update(func() {})
+			}
+		}
+	}()
+
+	fail := func(err error) {
+		update(func() {
+			job.Status = JobFailed
+			job.Error = err.Error()
+		})
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer f.Close()
+
+	dec, err := open(f)
+	if err != nil {
+		fail(err)
+		return
+	}
+	update(func() {
+		if counted, ok := dec.(interface{ Len() int }); ok {
+			job.Total = counted.Len()
+		}
+		job.Status = JobRunning
+	})
+
+	importer := j.Importer
+	importer.Progress = func(result Result) {
+		update(func() { job.Result = result })
+	}
+	result, err := importer.Import(job.UserID, dec, job.Result.DryRun)
+	update(func() { job.Result = result })
+	if err != nil {
+		fail(err)
+		return
+	}
+	update(func() { job.Status = JobSucceeded })
+}
+
+func (j *Jobs) update(job Job) {
+	job.UpdatedAt = time.Now()
+	if err := j.save(job); err != nil {
+		log.Error().Stack().Err(err).Str("job", job.ID).Msg("unable to store import job")
+	}
+}
+
+func (j *Jobs) save(job Job) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return j.RedisClient.Set(context.Background(), jobKeyPrefix+job.ID, value, j.TTL).Err()
+}
@@ -0,0 +1,73 @@
+package transfer
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobs(t *testing.T) {
+	server := miniredis.RunT(t)
+	jobs := &Jobs{RedisClient: redis.NewClient(&redis.Options{Addr: server.Addr()}), TTL: time.Hour}
+
+	t.Run("Run", func(t *testing.T) {
+		tasks := new(repository.MockTaskRepository)
+		tasks.On("CreateImported", mock.Anything, mock.Anything).Return(entity.Task{ID: 1}, nil)
+		imports := new(repository.MockImportRepository)
+		imports.On("Get", int64(1), mock.Anything).Return(entity.ImportedTask{}, repository.ErrImportNotFound)
+		jobs.Importer = Importer{Tasks: tasks, Imports: imports}
+
+		f, err := os.CreateTemp("", "import-*")
+		require.NoError(t, err)
+		_, err = f.WriteString("Buy milk\nCall mom\n")
+		require.NoError(t, err)
+		f.Close()
+
+		job, err := jobs.Start(1, TodoTxt, false, f.Name(), func(r io.Reader) (Decoder, error) {
+			return NewTodoTxtDecoder(r), nil
+		})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			job, err = jobs.Get(job.ID)
+			return err == nil && job.Status == JobSucceeded
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, 2, job.Result.Created)
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(f.Name())
+			return os.IsNotExist(err)
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Interrupted", func(t *testing.T) {
+		updatedAt := time.Now().Add(-jobStaleAfter - time.Second)
+		require.NoError(t, jobs.save(Job{ID: "stale", UserID: 1, Status: JobRunning, UpdatedAt: updatedAt}))
+		require.NoError(t, jobs.save(Job{ID: "fresh", UserID: 1, Status: JobRunning, UpdatedAt: time.Now()}))
+
+		job, err := jobs.Get("stale")
+		require.NoError(t, err)
+		assert.Equal(t, JobFailed, job.Status)
+		assert.Equal(t, errJobInterrupted.Error(), job.Error)
+		job, err = jobs.Get("stale")
+		require.NoError(t, err)
+		assert.Equal(t, JobFailed, job.Status)
+
+		job, err = jobs.Get("fresh")
+		require.NoError(t, err)
+		assert.Equal(t, JobRunning, job.Status)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := jobs.Get("missing")
+		assert.Equal(t, ErrJobNotFound, err)
+	})
+}
@@ -0,0 +1,218 @@
+package transfer
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+)
+
+const MarkdownContentType = "text/markdown; charset=utf-8"
+
+var (
+	checklistItem = regexp.MustCompile(`^([ \t]*)[-*+] \[([ xX])\] (.*)$`)
+	lineBreaks    = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+)
+
+// ChecklistItem is a "- [ ] title" line of a Markdown document. Parent is
+// the row of the item it is nested under, or 0.
+type ChecklistItem struct {
+	Row     int
+	Title   string
+	Checked bool
+	Parent  int
+}
+
+// WriteChecklist writes tasks as a GitHub flavored Markdown checklist.
+// Subtasks are nested under their parent when it is part of the list. Line
+// breaks in titles are written as spaces, since an item is a single line.
+func WriteChecklist(w io.Writer, tasks []*entity.Task) error {
+	listed := map[int64]bool{}
+	for _, task := range tasks {
+		listed[task.ID] = true
+	}
+
+	children := map[int64][]*entity.Task{}
+	var roots []*entity.Task
+	for _, task := range tasks {
+		if task.ParentID.Valid && listed[task.ParentID.Int64] {
+			children[task.ParentID.Int64] = append(children[task.ParentID.Int64], task)
+		} else {
+			roots = append(roots, task)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	written := map[int64]bool{}
+	var write func(tasks []*entity.Task, depth int)
+	write = func(tasks []*entity.Task, depth int) {
+		for _, task := range tasks {
+			if written[task.ID] {
+				continue
+			}
+			written[task.ID] = true
+			mark := " "
+			if entity.Finished(task.Status) {
+				mark = "x"
+			}
+			fmt.Fprintf(bw, "%s- [%s] %s\n", strings.Repeat("  ", depth), mark, lineBreaks.Replace(task.Title))
+			write(children[task.ID], depth+1)
+		}
+	}
+	write(roots, 0)
+	// Tasks whose parents form a cycle are not below any root.
+	write(tasks, 0)
+
+	return bw.Flush()
+}
+
+// ParseChecklist reads the checklist items of a Markdown document, ignoring
+// any other content.
+func ParseChecklist(r io.Reader) ([]ChecklistItem, error) {
+	type level struct {
+		indent int
+		row    int
+	}
+
+	var (
+		items []ChecklistItem
+		stack []level
+		row   int
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		row++
+		line := scanner.Text()
+		m := checklistItem.FindStringSubmatch(line)
+		if m == nil {
+			// Text that is not indented ends the list.
+			if line != "" && line[0] != ' ' && line[0] != '\t' {
+				stack = nil
+			}
+			continue
+		}
+		indent := len(strings.ReplaceAll(m[1], "\t", "    "))
+		title := strings.TrimSpace(m[3])
+		if title == "" {
+			continue
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		item := ChecklistItem{Row: row, Title: title, Checked: m[2] != " "}
+		if len(stack) > 0 {
+			item.Parent = stack[len(stack)-1].row
+		}
+		stack = append(stack, level{indent: indent, row: row})
+
+		items = append(items, item)
+	}
+
+	return items, scanner.Err()
+}
+
+// ImportChecklist creates a task for every item whose title matches none
+// of the subtasks of its parent, or of the tasks without a parent for an
+// item that is not nested, and updates the status of those that do:
+// checked items are marked done and unchecked items reopen finished tasks.
+// Titles match regardless of whitespace, which Markdown does not keep; an
+// item repeating one created before in the same document is skipped.
+func (i Importer) ImportChecklist(userId int64, items []ChecklistItem, dryRun bool) (Result, error) {
+	result := Result{DryRun: dryRun, Errors: []*RowError{}}
+
+	type key struct {
+		parent int64
+		title  string
+	}
+
+	tasks, err := repository.FindAll(i.Tasks, "", "", userId)
+	if err != nil {
+		return result, err
+	}
+	byKey := map[key][]*entity.Task{}
+	for _, task := range tasks {
+		k := key{parent: task.ParentID.Int64, title: matchTitle(task.Title)}
+		byKey[k] = append(byKey[k], task)
+	}
+	created := map[key]int64{}
+	// rows maps the row of an item to the id of its task. Tasks a dry run
+	// would create are given the negated row, which matches no subtask.
+	rows := map[int]int64{}
+
+	for _, item := range items {
+		result.Rows++
+		record := Record{Title: item.Title, Status: DefaultStatus}
+		if item.Checked {
+			record.Status = "done"
+		}
+		if detail := validate(&record); detail != "" {
+			result.fail(&RowError{Row: item.Row, Detail: detail})
+			continue
+		}
+
+		var parentId int64
+		if item.Parent != 0 {
+			var ok bool
+			if parentId, ok = rows[item.Parent]; !ok {
+				result.fail(&RowError{Row: item.Row, Detail: "parent item was not imported"})
+				continue
+			}
+		}
+		k := key{parent: parentId, title: matchTitle(record.Title)}
+		if id, ok := created[k]; ok {
+			rows[item.Row] = id
+			result.Skipped++
+			continue
+		}
+		matches := byKey[k]
+		if len(matches) == 0 {
+			id := -int64(item.Row)
+			if !dryRun {
+				task := newTask(userId, record)
+				if parentId > 0 {
+					task.ParentID = sql.NullInt64{Int64: parentId, Valid: true}
+				}
+				task, err := i.Tasks.CreateImported(task, "")
+				if err != nil {
+					return result, err
+				}
+				id = task.ID
+			}
+			created[k] = id
+			rows[item.Row] = id
+			result.Created++
+			continue
+		}
+
+		rows[item.Row] = matches[0].ID
+		for _, task := range matches {
+			if entity.Finished(task.Status) == item.Checked {
+				result.Skipped++
+				continue
+			}
+			if !dryRun {
+				updated, err := i.Tasks.Update(task.ID, task.Title, record.Status, task.Version)
+				if err != nil {
+					return result, err
+				}
+				task.Version = updated.Version
+			}
+			// A later item with the same title sees the new status.
+			task.Status = record.Status
+			result.Updated++
+		}
+	}
+
+	return result, nil
+}
+
+// matchTitle returns title with its whitespace collapsed.
+func matchTitle(title string) string {
+	return strings.Join(strings.Fields(title), " ")
+}
@@ -0,0 +1,104 @@
+package transfer
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChecklist(t *testing.T) {
+	in := "# Trip\n" +
+		"- [ ] Pack\n" +
+		"  - [x] Socks\n" +
+		"  - [ ] Shoes\n" +
+		"\t* [X] Laces\n" +
+		"  + [ ]   \n" +
+		"- [ ] Book  hotel \n" +
+		"Notes\n" +
+		"  - [ ] Call\n" +
+		"- not a checklist item\n"
+
+	items, err := ParseChecklist(strings.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, []ChecklistItem{
+		{Row: 2, Title: "Pack"},
+		{Row: 3, Title: "Socks", Checked: true, Parent: 2},
+		{Row: 4, Title: "Shoes", Parent: 2},
+		{Row: 5, Title: "Laces", Checked: true, Parent: 4},
+		{Row: 7, Title: "Book  hotel"},
+		{Row: 9, Title: "Call"},
+	}, items)
+}
+
+func TestWriteChecklist(t *testing.T) {
+	tasks := []*entity.Task{
+		{ID: 1, Title: "Pack", Status: "pending"},
+		{ID: 2, Title: "Socks", Status: "done", ParentID: sql.NullInt64{Int64: 1, Valid: true}},
+		{ID: 3, Title: "Shoes", Status: "pending", ParentID: sql.NullInt64{Int64: 1, Valid: true}},
+		{ID: 4, Title: "Laces", Status: "Done", ParentID: sql.NullInt64{Int64: 3, Valid: true}},
+		{ID: 5, Title: "Book  hotel\nin Rome", Status: "pending"},
+		{ID: 6, Title: "Pack: Visa", Status: "pending"},
+		{ID: 7, Title: "Orphan", Status: "pending", ParentID: sql.NullInt64{Int64: 99, Valid: true}},
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, WriteChecklist(&b, tasks))
+	assert.Equal(t, "- [ ] Pack\n"+
+		"  - [x] Socks\n"+
+		"  - [ ] Shoes\n"+
+		"    - [x] Laces\n"+
+		"- [ ] Book  hotel in Rome\n"+
+		"- [ ] Pack: Visa\n"+
+		"- [ ] Orphan\n", b.String())
+}
+
+func TestImportChecklistRoundTrip(t *testing.T) {
+	existing := []*entity.Task{
+		{ID: 1, Title: "Pack", Status: "pending", Version: 1},
+		{ID: 2, Title: "Socks", Status: "pending", Version: 1, ParentID: sql.NullInt64{Int64: 1, Valid: true}},
+		{ID: 3, Title: " Book  hotel\nin Rome", Status: "pending", Version: 1},
+		{ID: 4, Title: "Shoes", Status: "pending", Version: 1},
+	}
+	tasks := new(repository.MockTaskRepository)
+	tasks.On("Find", "", "", int64(1), mock.Anything).Return(existing, repository.PageInfo{}, nil)
+
+	var b bytes.Buffer
+	require.NoError(t, WriteChecklist(&b, existing))
+	out := strings.Replace(b.String(), "[ ] Socks", "[x] Socks", 1) + "- [ ] New\n  - [ ] Shoes\n- [ ] New\n"
+	items, err := ParseChecklist(strings.NewReader(out))
+	require.NoError(t, err)
+
+	result, err := Importer{Tasks: tasks, Imports: new(repository.MockImportRepository)}.ImportChecklist(1, items, true)
+	require.NoError(t, err)
+	assert.Equal(t, Result{DryRun: true, Rows: 7, Created: 2, Updated: 1, Skipped: 4, Errors: []*RowError{}}, result)
+}
+
+func TestImportChecklistNestsSubtasks(t *testing.T) {
+	existing := []*entity.Task{
+		{ID: 1, Title: "Pack", Status: "pending", Version: 1},
+		{ID: 2, Title: "Socks", Status: "pending", Version: 1},
+	}
+	tasks := new(repository.MockTaskRepository)
+	tasks.On("Find", "", "", int64(1), mock.Anything).Return(existing, repository.PageInfo{}, nil)
+	tasks.On("CreateImported", entity.Task{Title: "Socks", Status: "pending", UserID: 1, ParentID: sql.NullInt64{Int64: 1, Valid: true}}, "").
+		Return(entity.Task{ID: 3}, nil).Once()
+	tasks.On("CreateImported", entity.Task{Title: "Trip", Status: "pending", UserID: 1}, "").
+		Return(entity.Task{ID: 4}, nil).Once()
+	tasks.On("CreateImported", entity.Task{Title: "Visa", Status: "done", UserID: 1, ParentID: sql.NullInt64{Int64: 4, Valid: true}}, "").
+		Return(entity.Task{ID: 5}, nil).Once()
+
+	items, err := ParseChecklist(strings.NewReader("- [ ] Pack\n  - [ ] Socks\n- [ ] Trip\n  - [x] Visa\n"))
+	require.NoError(t, err)
+
+	result, err := Importer{Tasks: tasks, Imports: new(repository.MockImportRepository)}.ImportChecklist(1, items, false)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Rows: 4, Created: 3, Skipped: 1, Errors: []*RowError{}}, result)
+	tasks.AssertExpectations(t)
+}
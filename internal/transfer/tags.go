@@ -0,0 +1,130 @@
+package transfer
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nargesbyt/todo.go/entity"
+)
+
+// Tags are the todo.txt style attributes of a task: +project and @context
+// words, pri: and due: tags. Imports store them in the fields of a task,
+// but users also type them into titles.
+type Tags struct {
+	Projects []string
+	Contexts []string
+	Priority string
+	Due      string
+}
+
+// Labels returns the projects and contexts as the labels of a task.
+func (t Tags) Labels() string {
+	var parts []string
+	for _, p := range t.Projects {
+		if p = tagWord(p); p != "" {
+			parts = append(parts, "+"+p)
+		}
+	}
+	for _, c := range t.Contexts {
+		if c = tagWord(c); c != "" {
+			parts = append(parts, "@"+c)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// tagWord turns a name into a single word usable as a tag.
+func tagWord(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+}
+
+// dueDate keeps the date part of an ISO 8601 date or date-time, or returns
+// an empty string for anything else, like the recurring due dates of
+// Todoist.
+func dueDate(value string) string {
+	if len(value) >= 10 && ValidDate(value[:10]) {
+		return value[:10]
+	}
+
+	return ""
+}
+
+// ValidDate reports whether date is a date like 2024-01-31.
+func ValidDate(date string) bool {
+	_, err := time.Parse("2006-01-02", date)
+
+	return err == nil
+}
+
+// TaskTags returns the tags of a task, from its title and fields. The due
+// date and priority fields win over tags in the title.
+func TaskTags(task entity.Task) Tags {
+	t := ParseTags(task.Title + " " + task.Labels)
+	if task.Due != "" {
+		t.Due = task.Due
+	}
+	if task.Priority != "" {
+		t.Priority = task.Priority
+	}
+
+	return t
+}
+
+// ProjectKey returns the name of a project as it is stored for shares: a
+// single word in lower case, without the + sign.
+func ProjectKey(name string) string {
+	return strings.ToLower(tagWord(strings.TrimPrefix(strings.TrimSpace(name), "+")))
+}
+
+// WithProject returns the tasks tagged with +project in their title or
+// labels, ignoring case.
+func WithProject(tasks []*entity.Task, project string) []*entity.Task {
+	return withTag(tasks, project, func(t Tags) []string { return t.Projects })
+}
+
+// WithContext returns the tasks tagged with @context in their title or
+// labels, ignoring case.
+func WithContext(tasks []*entity.Task, context string) []*entity.Task {
+	return withTag(tasks, context, func(t Tags) []string { return t.Contexts })
+}
+
+func withTag(tasks []*entity.Task, name string, tagsOf func(Tags) []string) []*entity.Task {
+	name = tagWord(name)
+	var matching []*entity.Task
+	for _, task := range tasks {
+		for _, tag := range tagsOf(TaskTags(*task)) {
+			if strings.EqualFold(tag, name) {
+				matching = append(matching, task)
+				break
+			}
+		}
+	}
+
+	return matching
+}
+
+// ParseTags reads the tags of a title or labels written like todo.txt.
+func ParseTags(title string) Tags {
+	var t Tags
+	for _, word := range strings.Fields(title) {
+		switch {
+		case len(word) > 1 && word[0] == '+':
+			t.Projects = append(t.Projects, word[1:])
+		case len(word) > 1 && word[0] == '@':
+			t.Contexts = append(t.Contexts, word[1:])
+		case strings.HasPrefix(word, "pri:") && len(word) > 4:
+			t.Priority = word[4:]
+		case strings.HasPrefix(word, "due:") && len(word) > 4:
+			t.Due = word[4:]
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,22 @@
+package transfer
+
+import (
+	"testing"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTag(t *testing.T) {
+	inTitle := &entity.Task{Title: "Paint +home"}
+	inLabels := &entity.Task{Title: "Call", Labels: "+Home @phone"}
+	other := &entity.Task{Title: "Read +homework", Labels: "@home"}
+	spaced := &entity.Task{Title: "Plan", Labels: "+Home_Office"}
+	tasks := []*entity.Task{inTitle, inLabels, other, spaced}
+
+	assert.Equal(t, []*entity.Task{inTitle, inLabels}, WithProject(tasks, "home"))
+	assert.Equal(t, []*entity.Task{spaced}, WithProject(tasks, "Home Office"))
+	assert.Empty(t, WithProject(tasks, "work"))
+	assert.Equal(t, []*entity.Task{inLabels}, WithContext(tasks, "Phone"))
+	assert.Equal(t, []*entity.Task{other}, WithContext(tasks, "home"))
+}
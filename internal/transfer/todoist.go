@@ -0,0 +1,266 @@
+package transfer
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const Todoist = "todoist"
+
+var ErrInvalidTodoist = errors.New("not a Todoist backup")
+
+type todoistDue struct {
+	Date string `json:"date"`
+}
+
+// todoistItem is an item of the sync API or a task of the REST API, which
+// name some fields differently.
+type todoistItem struct {
+	ID            json.Number `json:"id"`
+	Content       string      `json:"content"`
+	Checked       interface{} `json:"checked"`
+	IsCompleted   bool        `json:"is_completed"`
+	Priority      int         `json:"priority"`
+	Labels        []string    `json:"labels"`
+	ProjectID     json.Number `json:"project_id"`
+	ParentID      json.Number `json:"parent_id"`
+	Due           *todoistDue `json:"due"`
+	AddedAt       string      `json:"added_at"`
+	CreatedAt     string      `json:"created_at"`
+	CompletedAt   string      `json:"completed_at"`
+	DateCompleted string      `json:"date_completed"`
+}
+
+type todoistBackup struct {
+	Items    []todoistItem `json:"items"`
+	Projects []struct {
+		ID   json.Number `json:"id"`
+		Name string      `json:"name"`
+	} `json:"projects"`
+}
+
+// NewTodoistDecoder reads a Todoist backup: the JSON of the sync API with
+// items and projects, a JSON array of REST API tasks, or a project CSV
+// export.
+func NewTodoistDecoder(format string, r io.Reader) (Decoder, error) {
+	switch format {
+	case JSON:
+		return newTodoistJSONDecoder(r)
+	case CSV:
+		return newTodoistCSVDecoder(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+func newTodoistJSONDecoder(r io.Reader) (Decoder, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var backup todoistBackup
+	if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+		err = json.Unmarshal(body, &backup.Items)
+	} else {
+		err = json.Unmarshal(body, &backup)
+	}
+	if err != nil {
+		return nil, ErrInvalidTodoist
+	}
+
+	projects := map[string]string{}
+	for _, p := range backup.Projects {
+		projects[p.ID.String()] = p.Name
+	}
+
+	records := make([]Record, 0, len(backup.Items))
+	for _, item := range backup.Items {
+		tags := Tags{Contexts: item.Labels}
+		if name, ok := projects[item.ProjectID.String()]; ok {
+			tags.Projects = []string{name}
+		}
+		record := Record{
+			ExternalID: Todoist + ":" + item.ID.String(),
+			Title:      item.Content,
+			Status:     DefaultStatus,
+			Labels:     tags.Labels(),
+			CreatedAt:  todoistTime(item.AddedAt, item.CreatedAt),
+		}
+		// The API counts priorities up from 1 for normal to 4 for p1.
+		if item.Priority > 1 {
+			record.Priority = fmt.Sprintf("p%d", 5-item.Priority)
+		}
+		if item.Due != nil {
+			record.Due = dueDate(item.Due.Date)
+		}
+		if item.ParentID != "" {
+			record.Parent = Todoist + ":" + item.ParentID.String()
+		}
+		if item.IsCompleted || checked(item.Checked) {
+			record.Status = "done"
+			record.FinishedAt = todoistTime(item.CompletedAt, item.DateCompleted)
+		}
+		records = append(records, record)
+	}
+
+	return &sliceDecoder{records: records}, nil
+}
+
+// todoistTime parses the first of values that is set, or returns nil. Old
+// backups use another format, whose times are dropped.
+func todoistTime(values ...string) *time.Time {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil
+		}
+		return &t
+	}
+
+	return nil
+}
+
+// checked reads the checked flag, which older backups encode as 0 or 1.
+func checked(v interface{}) bool {
+	switch c := v.(type) {
+	case bool:
+		return c
+	case float64:
+		return c != 0
+	default:
+		return false
+	}
+}
+
+// todoistCSVDecoder reads the CSV export of a Todoist project, whose rows
+// have TYPE, CONTENT, PRIORITY, INDENT and DATE columns. Only task rows are
+// imported; an indented task is a checklist item of the task above it.
+type todoistCSVDecoder struct {
+	r     *csv.Reader
+	index map[string]int
+	row   int
+	// seen counts the rows with the same content, and parents are the
+	// external ids of the last task of each indent.
+	seen    map[string]int
+	parents []string
+}
+
+func newTodoistCSVDecoder(r io.Reader) (Decoder, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, ErrInvalidTodoist
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := index["CONTENT"]; !ok {
+		return nil, ErrInvalidTodoist
+	}
+
+	return &todoistCSVDecoder{r: reader, index: index, seen: map[string]int{}}, nil
+}
+
+func (d *todoistCSVDecoder) Next() (Record, error) {
+	for {
+		fields, err := d.r.Read()
+		if err == io.EOF {
+			return Record{}, io.EOF
+		}
+		d.row++
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				return Record{}, &RowError{Row: d.row, Detail: err.Error()}
+			}
+			return Record{}, err
+		}
+
+		field := func(name string) string {
+			i, ok := d.index[name]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(fields[i])
+		}
+		if t := field("TYPE"); t != "" && t != "task" {
+			continue
+		}
+
+		content := field("CONTENT")
+		record := Record{Title: content, Status: DefaultStatus, Due: dueDate(field("DATE"))}
+		// Exports count priorities down from 1 for p1.
+		if p, err := strconv.Atoi(field("PRIORITY")); err == nil && p < 4 {
+			record.Priority = fmt.Sprintf("p%d", p)
+		}
+		record.ExternalID = d.externalID(field("ID"), content)
+
+		indent, err := strconv.Atoi(field("INDENT"))
+		if err != nil || indent < 1 {
+			indent = 1
+		}
+		if indent > len(d.parents)+1 {
+			indent = len(d.parents) + 1
+		}
+		d.parents = append(d.parents[:indent-1], record.ExternalID)
+		if indent > 1 {
+			record.Parent = d.parents[indent-2]
+		}
+
+		return record, nil
+	}
+}
+
+// externalID returns the id of a row, or without one an id made from its
+// content, so importing the same export again skips the rows imported
+// before. Rows with the same content are told apart by their order.
+func (d *todoistCSVDecoder) externalID(id string, content string) string {
+	if id != "" {
+		return Todoist + ":" + id
+	}
+
+	sum := sha1.Sum([]byte(content))
+	d.seen[content]++
+	id = hex.EncodeToString(sum[:])
+	if n := d.seen[content]; n > 1 {
+		id += "-" + strconv.Itoa(n)
+	}
+
+	return Todoist + ":csv:" + id
+}
+
+// sliceDecoder returns records that were decoded up front, for sources
+// exported as a single document.
+type sliceDecoder struct {
+	records []Record
+	next    int
+}
+
+func (d *sliceDecoder) Next() (Record, error) {
+	if d.next == len(d.records) {
+		return Record{}, io.EOF
+	}
+	d.next++
+
+	return d.records[d.next-1], nil
+}
+
+// Len returns the number of records, so progress can be reported as a
+// fraction.
+func (d *sliceDecoder) Len() int {
+	return len(d.records)
+}
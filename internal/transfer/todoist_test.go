@@ -0,0 +1,126 @@
+package transfer
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTodoistDecoder(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		in      string
+		want    []Record
+		openErr error
+	}{
+		{
+			name:   "Sync",
+			format: JSON,
+			in: `{"projects":[{"id":"9","name":"Home Office"}],"items":[
+				{"id":"1","content":"Buy paper","priority":4,"labels":["errand"],"project_id":"9","due":{"date":"2024-01-03T10:00:00"},"added_at":"2024-01-01T09:00:00.000000Z"},
+				{"id":"2","content":"A4","parent_id":"1","checked":1,"completed_at":"2024-01-02T09:00:00Z"},
+				{"id":"3","content":"Old","checked":true,"date_completed":"Tue 02 Jan 2024"}]}`,
+			want: []Record{
+				{
+					ExternalID: "todoist:1",
+					Title:      "Buy paper",
+					Status:     DefaultStatus,
+					Labels:     "+Home_Office @errand",
+					Priority:   "p1",
+					Due:        "2024-01-03",
+					CreatedAt:  timeOf("2024-01-01T09:00:00Z"),
+				},
+				{
+					ExternalID: "todoist:2",
+					Title:      "A4",
+					Status:     "done",
+					Parent:     "todoist:1",
+					FinishedAt: timeOf("2024-01-02T09:00:00Z"),
+				},
+				{ExternalID: "todoist:3", Title: "Old", Status: "done"},
+			},
+		},
+		{
+			name:   "REST",
+			format: JSON,
+			in:     `[{"id":"5","content":"Read","is_completed":true,"priority":1,"due":{"date":"every day"}}]`,
+			want:   []Record{{ExternalID: "todoist:5", Title: "Read", Status: "done"}},
+		},
+		{
+			name:   "CSV",
+			format: CSV,
+			in: "\ufeffTYPE,CONTENT,PRIORITY,INDENT,DATE\n" +
+				"section,Errands,,,\n" +
+				"task,Shop,1,1,2024-01-03\n" +
+				"task,Milk,4,2,\n" +
+				"task,Whole,4,3,\n" +
+				"task,Shop,4,1,\n" +
+				"task,Deep,4,5,\n",
+			want: []Record{
+				{ExternalID: todoistCSVID("Shop", 1), Title: "Shop", Status: DefaultStatus, Priority: "p1", Due: "2024-01-03"},
+				{ExternalID: todoistCSVID("Milk", 1), Title: "Milk", Status: DefaultStatus, Parent: todoistCSVID("Shop", 1)},
+				{ExternalID: todoistCSVID("Whole", 1), Title: "Whole", Status: DefaultStatus, Parent: todoistCSVID("Milk", 1)},
+				{ExternalID: todoistCSVID("Shop", 2), Title: "Shop", Status: DefaultStatus},
+				{ExternalID: todoistCSVID("Deep", 1), Title: "Deep", Status: DefaultStatus, Parent: todoistCSVID("Shop", 2)},
+			},
+		},
+		{
+			name:   "CSVWithID",
+			format: CSV,
+			in:     "CONTENT,ID\nShop,42\n",
+			want:   []Record{{ExternalID: "todoist:42", Title: "Shop", Status: DefaultStatus}},
+		},
+		{
+			name:    "CSVWithoutContent",
+			format:  CSV,
+			in:      "TITLE\nShop\n",
+			openErr: ErrInvalidTodoist,
+		},
+		{
+			name:    "Invalid",
+			format:  JSON,
+			in:      `{"items":{}}`,
+			openErr: ErrInvalidTodoist,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec, err := NewTodoistDecoder(tt.format, strings.NewReader(tt.in))
+			if tt.openErr != nil {
+				assert.Equal(t, tt.openErr, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var records []Record
+			for {
+				record, err := dec.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				records = append(records, record)
+			}
+			assert.Equal(t, tt.want, records)
+		})
+	}
+}
+
+// todoistCSVID is the id of the nth row with content in an export without
+// ids.
+func todoistCSVID(content string, n int) string {
+	sum := sha1.Sum([]byte(content))
+	id := Todoist + ":csv:" + hex.EncodeToString(sum[:])
+	if n > 1 {
+		id += "-" + strconv.Itoa(n)
+	}
+
+	return id
+}
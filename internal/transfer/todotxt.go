@@ -0,0 +1,91 @@
+package transfer
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const TodoTxt = "todotxt"
+
+var (
+	todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\) `)
+	todoTxtDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} `)
+)
+
+// todoTxtDecoder reads the todo.txt format, one task per line. The
+// completion mark, priority and dates become fields of the task; the due:
+// tag is read into its field too. Projects, contexts and tags stay in the
+// title as they are, since they are part of the text in todo.txt.
+type todoTxtDecoder struct {
+	scanner *bufio.Scanner
+	row     int
+}
+
+func NewTodoTxtDecoder(r io.Reader) Decoder {
+	return &todoTxtDecoder{scanner: bufio.NewScanner(r)}
+}
+
+func (d *todoTxtDecoder) Next() (Record, error) {
+	for d.scanner.Scan() {
+		line := strings.TrimSpace(d.scanner.Text())
+		if line == "" {
+			continue
+		}
+		d.row++
+
+		return parseTodoTxt(line), nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+
+	return Record{}, io.EOF
+}
+
+func parseTodoTxt(line string) Record {
+	// The line identifies the task, since todo.txt has no ids.
+	sum := sha1.Sum([]byte(line))
+	record := Record{ExternalID: TodoTxt + ":" + hex.EncodeToString(sum[:]), Status: DefaultStatus}
+
+	text := line + " "
+	done := strings.HasPrefix(text, "x ")
+	if done {
+		record.Status = "done"
+		text = text[2:]
+	}
+
+	if m := todoTxtPriority.FindStringSubmatch(text); m != nil {
+		record.Priority = m[1]
+		text = text[len(m[0]):]
+	}
+	// A completed task has its completion date before the creation date.
+	var dates []time.Time
+	for len(dates) < 2 && todoTxtDate.MatchString(text) {
+		if date, err := time.Parse("2006-01-02", text[:10]); err == nil {
+			dates = append(dates, date)
+		}
+		text = text[11:]
+	}
+	if done && len(dates) > 0 {
+		record.FinishedAt = &dates[0]
+		dates = dates[1:]
+	}
+	if len(dates) > 0 {
+		record.CreatedAt = &dates[0]
+	}
+
+	text = strings.TrimSpace(text)
+	tags := ParseTags(text)
+	if record.Priority == "" {
+		record.Priority = tags.Priority
+	}
+	record.Due = dueDate(tags.Due)
+	record.Title = text
+
+	return record
+}
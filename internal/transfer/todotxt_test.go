@@ -0,0 +1,57 @@
+package transfer
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTodoTxtDecoder(t *testing.T) {
+	lines := []string{
+		"x 2024-01-05 2024-01-02 Call mom +family @phone",
+		"(A) 2024-01-03 Pay rent due:2024-02-01 pri:B",
+		"Water plants due:someday",
+	}
+	dec := NewTodoTxtDecoder(strings.NewReader(lines[0] + "\n\n  \n" + lines[1] + "\n" + lines[2]))
+
+	want := []Record{
+		{
+			ExternalID: todoTxtID(lines[0]),
+			Title:      "Call mom +family @phone",
+			Status:     "done",
+			CreatedAt:  timeOf("2024-01-02T00:00:00Z"),
+			FinishedAt: timeOf("2024-01-05T00:00:00Z"),
+		},
+		{
+			ExternalID: todoTxtID(lines[1]),
+			Title:      "Pay rent due:2024-02-01 pri:B",
+			Status:     DefaultStatus,
+			CreatedAt:  timeOf("2024-01-03T00:00:00Z"),
+			Due:        "2024-02-01",
+			Priority:   "A",
+		},
+		{
+			ExternalID: todoTxtID(lines[2]),
+			Title:      "Water plants due:someday",
+			Status:     DefaultStatus,
+		},
+	}
+	for _, w := range want {
+		record, err := dec.Next()
+		require.NoError(t, err)
+		assert.Equal(t, w, record)
+	}
+	_, err := dec.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func todoTxtID(line string) string {
+	sum := sha1.Sum([]byte(line))
+
+	return TodoTxt + ":" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,89 @@
+package transfer
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+)
+
+const (
+	CSV    = "csv"
+	JSON   = "json"
+	NDJSON = "ndjson"
+
+	// TodoGo prefixes the external ids of exported tasks that were not
+	// imported.
+	TodoGo = "todo.go"
+)
+
+var ErrUnknownFormat = errors.New("format must be one of csv, json or ndjson")
+
+// Record is a task as it is exported and imported. Parent is the external
+// id of the task a checklist item belongs to, which must come first.
+type Record struct {
+	ID         int64      `json:"id,omitempty"`
+	ExternalID string     `json:"external_id,omitempty"`
+	Title      string     `json:"title"`
+	Status     string     `json:"status,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Due        string     `json:"due,omitempty"`
+	Priority   string     `json:"priority,omitempty"`
+	Labels     string     `json:"labels,omitempty"`
+	Parent     string     `json:"parent,omitempty"`
+}
+
+// columns are the CSV header of an export. Imports accept them in any
+// order and ignore unknown ones.
+var columns = []string{"id", "external_id", "title", "status", "created_at", "finished_at", "due", "priority", "labels", "parent"}
+
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json"
+	}
+}
+
+// recordOf returns the record of an exported task, given the external ids
+// tasks were imported with by task id. Every task is exported with an
+// external id, so its subtasks can name it as their parent.
+func recordOf(task entity.Task, externalIds map[int64]string) Record {
+	r := Record{
+		ID:         task.ID,
+		ExternalID: externalID(task.ID, externalIds),
+		Title:      task.Title,
+		Status:     task.Status,
+		Due:        task.Due,
+		Priority:   task.Priority,
+		Labels:     task.Labels,
+	}
+	if !task.CreatedAt.IsZero() {
+		createdAt := task.CreatedAt
+		r.CreatedAt = &createdAt
+	}
+	if task.FinishedAt.Valid {
+		finishedAt := task.FinishedAt.Time
+		r.FinishedAt = &finishedAt
+	}
+	if task.ParentID.Valid {
+		r.Parent = externalID(task.ParentID.Int64, externalIds)
+	}
+
+	return r
+}
+
+// externalID returns the id a task was imported with, or one made of its
+// own id.
+func externalID(taskId int64, externalIds map[int64]string) string {
+	if id := externalIds[taskId]; id != "" {
+		return id
+	}
+
+	return TodoGo + ":" + strconv.FormatInt(taskId, 10)
+}
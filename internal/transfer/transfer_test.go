@@ -0,0 +1,233 @@
+package transfer
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoder(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	records := []Record{
+		{ID: 1, ExternalID: "a-1", Title: `Say "hi", then leave`, Status: "done", CreatedAt: &createdAt, FinishedAt: &createdAt, Due: "2024-01-03", Priority: "p1", Labels: "+work @desk"},
+		{ID: 2, Title: "Second", Status: "pending", Parent: "a-1"},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: CSV,
+			want: "id,external_id,title,status,created_at,finished_at,due,priority,labels,parent\n" +
+				`1,a-1,"Say ""hi"", then leave",done,2024-01-02T10:00:00Z,2024-01-02T10:00:00Z,2024-01-03,p1,+work @desk,` + "\n" +
+				"2,,Second,pending,,,,,,a-1\n",
+		},
+		{
+			format: JSON,
+			want: `[{"id":1,"external_id":"a-1","title":"Say \"hi\", then leave","status":"done","created_at":"2024-01-02T10:00:00Z","finished_at":"2024-01-02T10:00:00Z","due":"2024-01-03","priority":"p1","labels":"+work @desk"},` +
+				`{"id":2,"title":"Second","status":"pending","parent":"a-1"}]` + "\n",
+		},
+		{
+			format: NDJSON,
+			want: `{"id":1,"external_id":"a-1","title":"Say \"hi\", then leave","status":"done","created_at":"2024-01-02T10:00:00Z","finished_at":"2024-01-02T10:00:00Z","due":"2024-01-03","priority":"p1","labels":"+work @desk"}` + "\n" +
+				`{"id":2,"title":"Second","status":"pending","parent":"a-1"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b bytes.Buffer
+			enc, err := NewEncoder(tt.format, &b)
+			require.NoError(t, err)
+			require.NoError(t, enc.Begin())
+			for _, r := range records {
+				require.NoError(t, enc.Encode(r))
+			}
+			require.NoError(t, enc.End())
+
+			assert.Equal(t, tt.want, b.String())
+		})
+	}
+
+	_, err := NewEncoder("xml", io.Discard)
+	assert.Equal(t, ErrUnknownFormat, err)
+}
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		in      string
+		want    []Record
+		rowErrs []int
+		openErr error
+		readErr bool
+	}{
+		{
+			name:   "CSV",
+			format: CSV,
+			in:     "Status, TITLE ,extra,external_id\ndone,First,x,a-1\n,Second\n",
+			want:   []Record{{ExternalID: "a-1", Title: "First", Status: "done"}, {Title: "Second"}},
+		},
+		{
+			name:   "CSVFields",
+			format: CSV,
+			in:     "title,created_at,due,priority,labels\nFirst,2024-01-02T10:00:00Z,2024-01-03,p1,+work\nSecond,yesterday,,,\n",
+			want: []Record{{
+				Title:     "First",
+				CreatedAt: timeOf("2024-01-02T10:00:00Z"),
+				Due:       "2024-01-03",
+				Priority:  "p1",
+				Labels:    "+work",
+			}},
+			rowErrs: []int{2},
+		},
+		{
+			name:    "CSVRowError",
+			format:  CSV,
+			in:      "title\n\"broken\nGood\n",
+			rowErrs: []int{1},
+		},
+		{
+			name:    "CSVWithoutTitle",
+			format:  CSV,
+			in:      "id,status\n1,done\n",
+			openErr: ErrMissingTitleColumn,
+		},
+		{
+			name:    "CSVEmpty",
+			format:  CSV,
+			openErr: ErrMissingTitleColumn,
+		},
+		{
+			name:    "JSON",
+			format:  JSON,
+			in:      `[{"title":"First","status":"done","external_id":"a-1"}, {"title": 5}, {"title":"Third"}]`,
+			want:    []Record{{ExternalID: "a-1", Title: "First", Status: "done"}, {Title: "Third"}},
+			rowErrs: []int{2},
+		},
+		{
+			name:    "JSONTruncated",
+			format:  JSON,
+			in:      `[{"title":"First"}, {"title":`,
+			want:    []Record{{Title: "First"}},
+			readErr: true,
+		},
+		{
+			name:    "NDJSON",
+			format:  NDJSON,
+			in:      "{\"title\":\"First\"}\n\n  \nnot json\n{\"title\":\"Third\",\"status\":\"done\"}\n",
+			want:    []Record{{Title: "First"}, {Title: "Third", Status: "done"}},
+			rowErrs: []int{2},
+		},
+		{
+			name:    "Unknown",
+			format:  "xml",
+			openErr: ErrUnknownFormat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec, err := NewDecoder(tt.format, strings.NewReader(tt.in))
+			if tt.openErr != nil {
+				assert.Equal(t, tt.openErr, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var (
+				records []Record
+				rowErrs []int
+			)
+			for {
+				record, err := dec.Next()
+				if err == io.EOF {
+					break
+				}
+				if rowErr, ok := err.(*RowError); ok {
+					rowErrs = append(rowErrs, rowErr.Row)
+					continue
+				}
+				if err != nil {
+					assert.True(t, tt.readErr, "unexpected error %v", err)
+					break
+				}
+				records = append(records, record)
+			}
+
+			assert.Equal(t, tt.want, records)
+			assert.Equal(t, tt.rowErrs, rowErrs)
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{CSV, JSON, NDJSON} {
+		t.Run(format, func(t *testing.T) {
+			in := Record{
+				ExternalID: "a-1",
+				Title:      "Buy milk, eggs",
+				Status:     "done",
+				CreatedAt:  timeOf("2024-01-02T10:00:00Z"),
+				FinishedAt: timeOf("2024-01-03T10:00:00Z"),
+				Due:        "2024-01-03",
+				Priority:   "p1",
+				Labels:     "+work @desk",
+				Parent:     "a-0",
+			}
+
+			var b bytes.Buffer
+			enc, err := NewEncoder(format, &b)
+			require.NoError(t, err)
+			require.NoError(t, enc.Begin())
+			require.NoError(t, enc.Encode(in))
+			require.NoError(t, enc.End())
+
+			dec, err := NewDecoder(format, &b)
+			require.NoError(t, err)
+			out, err := dec.Next()
+			require.NoError(t, err)
+			assert.Equal(t, in, out)
+			_, err = dec.Next()
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	tasks := new(repository.MockTaskRepository)
+	tasks.On("Find", "", "", int64(1), mock.Anything).Return([]*entity.Task{
+		{ID: 1, Title: "Card", Status: "pending"},
+		{ID: 2, Title: "Item", Status: "pending", ParentID: sql.NullInt64{Int64: 1, Valid: true}},
+		{ID: 3, Title: "Step", Status: "pending", ParentID: sql.NullInt64{Int64: 2, Valid: true}},
+	}, repository.PageInfo{}, nil)
+	imports := new(repository.MockImportRepository)
+	imports.On("ExternalIDs", []int64{1, 2, 1, 3, 2}).Return(map[int64]string{1: "trello:c1"}, nil)
+
+	var b bytes.Buffer
+	enc, err := NewEncoder(NDJSON, &b)
+	require.NoError(t, err)
+	require.NoError(t, Export(tasks, imports, 1, enc, func() {}))
+
+	assert.Equal(t, `{"id":1,"external_id":"trello:c1","title":"Card","status":"pending"}`+"\n"+
+		`{"id":2,"external_id":"todo.go:2","title":"Item","status":"pending","parent":"trello:c1"}`+"\n"+
+		`{"id":3,"external_id":"todo.go:3","title":"Step","status":"pending","parent":"todo.go:2"}`+"\n", b.String())
+}
+
+func timeOf(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+
+	return &t
+}
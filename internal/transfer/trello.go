@@ -0,0 +1,125 @@
+package transfer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+const Trello = "trello"
+
+var ErrInvalidTrello = errors.New("not a Trello board export")
+
+type trelloBoard struct {
+	Name  string `json:"name"`
+	Lists []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"lists"`
+	Cards []struct {
+		ID          string  `json:"id"`
+		Name        string  `json:"name"`
+		Closed      bool    `json:"closed"`
+		IDList      string  `json:"idList"`
+		Due         *string `json:"due"`
+		DueComplete bool    `json:"dueComplete"`
+		Labels      []struct {
+			Name  string `json:"name"`
+			Color string `json:"color"`
+		} `json:"labels"`
+	} `json:"cards"`
+	Checklists []struct {
+		IDCard     string `json:"idCard"`
+		CheckItems []struct {
+			ID    string `json:"id"`
+			Name  string `json:"name"`
+			State string `json:"state"`
+		} `json:"checkItems"`
+	} `json:"checklists"`
+}
+
+// NewTrelloDecoder reads the JSON export of a Trello board. Every open
+// card becomes a task labeled with its board and list as projects and its
+// labels as contexts; checklist items become tasks of their own with the
+// card as their parent. Completed due dates and items are imported as
+// done.
+func NewTrelloDecoder(r io.Reader) (Decoder, error) {
+	var board trelloBoard
+	if err := json.NewDecoder(r).Decode(&board); err != nil || board.Cards == nil {
+		return nil, ErrInvalidTrello
+	}
+
+	lists := map[string]string{}
+	for _, l := range board.Lists {
+		lists[l.ID] = l.Name
+	}
+	items := map[string][]Record{}
+	for _, checklist := range board.Checklists {
+		for _, item := range checklist.CheckItems {
+			status := DefaultStatus
+			if item.State == "complete" {
+				status = "done"
+			}
+			items[checklist.IDCard] = append(items[checklist.IDCard], Record{
+				ExternalID: Trello + ":" + item.ID,
+				Title:      item.Name,
+				Status:     status,
+				Parent:     Trello + ":" + checklist.IDCard,
+				CreatedAt:  trelloTime(item.ID),
+			})
+		}
+	}
+
+	var records []Record
+	for _, card := range board.Cards {
+		if card.Closed {
+			continue
+		}
+
+		tags := Tags{Projects: []string{board.Name}}
+		if name, ok := lists[card.IDList]; ok {
+			tags.Projects = append(tags.Projects, name)
+		}
+		for _, label := range card.Labels {
+			name := label.Name
+			if name == "" {
+				name = label.Color
+			}
+			tags.Contexts = append(tags.Contexts, name)
+		}
+		record := Record{
+			ExternalID: Trello + ":" + card.ID,
+			Title:      card.Name,
+			Status:     DefaultStatus,
+			Labels:     tags.Labels(),
+			CreatedAt:  trelloTime(card.ID),
+		}
+		if card.Due != nil {
+			record.Due = dueDate(*card.Due)
+		}
+		if card.DueComplete {
+			record.Status = "done"
+		}
+		records = append(records, record)
+		records = append(records, items[card.ID]...)
+	}
+
+	return &sliceDecoder{records: records}, nil
+}
+
+// trelloTime returns when a card or item was created, which Trello encodes
+// in the first 8 hex digits of ids, or nil for other ids.
+func trelloTime(id string) *time.Time {
+	if len(id) < 8 {
+		return nil
+	}
+	seconds, err := strconv.ParseInt(id[:8], 16, 64)
+	if err != nil {
+		return nil
+	}
+	t := time.Unix(seconds, 0).UTC()
+
+	return &t
+}
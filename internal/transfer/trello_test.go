@@ -0,0 +1,52 @@
+package transfer
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrelloDecoder(t *testing.T) {
+	in := `{"name":"Home","lists":[{"id":"l1","name":"To Do"}],"cards":[
+		{"id":"5f1b2c3d0000000000000001","name":"Paint","idList":"l1","due":"2024-01-03T10:00:00.000Z","labels":[{"name":"Weekend"},{"name":"","color":"red"}]},
+		{"id":"5f1b2c3d0000000000000002","name":"Gone","closed":true},
+		{"id":"card","name":"Done","dueComplete":true}],
+		"checklists":[{"idCard":"5f1b2c3d0000000000000001","checkItems":[{"id":"5f1b2c3e0000000000000003","name":"Buy brushes","state":"complete"}]}]}`
+	dec, err := NewTrelloDecoder(strings.NewReader(in))
+	require.NoError(t, err)
+
+	createdAt := time.Unix(0x5f1b2c3d, 0).UTC()
+	itemCreatedAt := createdAt.Add(time.Second)
+	want := []Record{
+		{
+			ExternalID: "trello:5f1b2c3d0000000000000001",
+			Title:      "Paint",
+			Status:     DefaultStatus,
+			Labels:     "+Home +To_Do @Weekend @red",
+			Due:        "2024-01-03",
+			CreatedAt:  &createdAt,
+		},
+		{
+			ExternalID: "trello:5f1b2c3e0000000000000003",
+			Title:      "Buy brushes",
+			Status:     "done",
+			Parent:     "trello:5f1b2c3d0000000000000001",
+			CreatedAt:  &itemCreatedAt,
+		},
+		{ExternalID: "trello:card", Title: "Done", Status: "done", Labels: "+Home"},
+	}
+	for _, w := range want {
+		record, err := dec.Next()
+		require.NoError(t, err)
+		assert.Equal(t, w, record)
+	}
+	_, err = dec.Next()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = NewTrelloDecoder(strings.NewReader(`{"name":"Not a board"}`))
+	assert.Equal(t, ErrInvalidTrello, err)
+}
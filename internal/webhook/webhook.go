@@ -0,0 +1,252 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/event"
+	"github.com/nargesbyt/todo.go/repository"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	Ping = "ping"
+
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	batchSize = 50
+)
+
+// EventTypes are the event types a webhook can subscribe to, besides "*".
+var EventTypes = []string{event.TaskCreated, event.TaskUpdated, event.TaskDeleted}
+
+type Task struct {
+	ID         int64      `json:"id"`
+	Title      string     `json:"title"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Version    int64      `json:"version"`
+}
+
+// Payload is the JSON body posted to a webhook.
+type Payload struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	WebhookID  int64     `json:"webhook_id"`
+	UserID     int64     `json:"user_id"`
+	TaskID     int64     `json:"task_id,omitempty"`
+	Task       *Task     `json:"task,omitempty"`
+	Previous   *Task     `json:"previous,omitempty"`
+}
+
+// Dispatcher queues a delivery for every webhook subscribed to a published
+// event and posts due deliveries, retrying failed ones with exponential
+// backoff until MaxAttempts is reached.
+type Dispatcher struct {
+	Webhooks    repository.Webhooks
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// NewDispatcher returns a dispatcher posting with NewClient. allowPrivate
+// lets webhooks reach addresses inside our network, for development only.
+func NewDispatcher(webhooks repository.Webhooks, timeout time.Duration, allowPrivate bool, maxAttempts int, backoff time.Duration) *Dispatcher {
+	return &Dispatcher{
+		Webhooks:    webhooks,
+		Client:      NewClient(timeout, allowPrivate),
+		MaxAttempts: maxAttempts,
+		Backoff:     backoff,
+	}
+}
+
+// Publish enqueues e for the webhooks of its user.
+func (d *Dispatcher) Publish(e event.Event) error {
+	webhooks, err := d.Webhooks.Subscribed(e.UserID, e.Type)
+	if err != nil {
+		return err
+	}
+
+	occurredAt := e.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+	for _, webhook := range webhooks {
+		payload, err := json.Marshal(Payload{
+			Event:      e.Type,
+			OccurredAt: occurredAt,
+			WebhookID:  webhook.ID,
+			UserID:     e.UserID,
+			TaskID:     e.TaskID,
+			Task:       taskOf(e.Task),
+			Previous:   taskOf(e.Previous),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := d.Webhooks.Enqueue(webhook.ID, e.Type, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ping enqueues a test delivery for webhook.
+func (d *Dispatcher) Ping(webhook entity.Webhook) (entity.WebhookDelivery, error) {
+	payload, err := json.Marshal(Payload{
+		Event:      Ping,
+		OccurredAt: time.Now(),
+		WebhookID:  webhook.ID,
+		UserID:     webhook.UserID,
+	})
+	if err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+
+	return d.Webhooks.Enqueue(webhook.ID, Ping, payload)
+}
+
+// Redeliver enqueues a new delivery with the payload of an earlier one.
+func (d *Dispatcher) Redeliver(delivery entity.WebhookDelivery) (entity.WebhookDelivery, error) {
+	return d.Webhooks.Enqueue(delivery.WebhookID, delivery.Event, delivery.Payload)
+}
+
+// Run posts due deliveries every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.flush()
+		}
+	}
+}
+
+func (d *Dispatcher) flush() {
+	deliveries, err := d.Webhooks.Due(time.Now(), batchSize)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("unable to fetch due webhook deliveries")
+		return
+	}
+
+	for _, delivery := range deliveries {
+		// The claim outlasts the client timeout, so a crashed worker only
+		// delays the delivery.
+		claimed, err := d.Webhooks.Claim(*delivery, time.Now().Add(d.Client.Timeout+time.Minute))
+		if err != nil {
+			log.Error().Stack().Err(err).Int64("delivery", delivery.ID).Msg("unable to claim webhook delivery")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		d.deliver(*delivery)
+	}
+}
+
+func (d *Dispatcher) deliver(delivery entity.WebhookDelivery) {
+	attempt := entity.WebhookAttempt{Number: delivery.Attempts + 1, AttemptedAt: time.Now()}
+	delivery.Attempts = attempt.Number
+
+	if delivery.Webhook.ID == 0 || delivery.Webhook.Active == 0 {
+		attempt.Error = "webhook is deleted or inactive"
+	} else {
+		attempt.ResponseCode, attempt.Error = d.post(delivery)
+	}
+	attempt.Duration = time.Since(attempt.AttemptedAt)
+
+	delivery.ResponseCode = attempt.ResponseCode
+	delivery.LastError = attempt.Error
+	switch {
+	case attempt.Error == "":
+		delivery.Status = entity.DeliverySucceeded
+		delivery.DeliveredAt = sql.NullTime{Time: time.Now(), Valid: true}
+	case delivery.Attempts >= d.MaxAttempts || delivery.Webhook.ID == 0 || delivery.Webhook.Active == 0:
+		delivery.Status = entity.DeliveryFailed
+	default:
+		delivery.NextAttemptAt = time.Now().Add(d.Backoff << (delivery.Attempts - 1))
+	}
+
+	if err := d.Webhooks.RecordAttempt(delivery, attempt); err != nil {
+		log.Error().Stack().Err(err).Int64("delivery", delivery.ID).Msg("unable to record webhook attempt")
+	}
+}
+
+// post sends a delivery and returns the response status and, when the
+// attempt failed, its reason. The response body is never recorded, so a
+// webhook can not be used to read responses it was not meant to see.
+func (d *Dispatcher) post(delivery entity.WebhookDelivery) (int, string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, delivery.Webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(delivery.Webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, ""
+}
+
+// Sign returns the signature header of a payload: the hex encoded
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the webhook
+// secret. Receivers should reject old timestamps to prevent replays.
+func Sign(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func taskOf(task *entity.Task) *Task {
+	if task == nil {
+		return nil
+	}
+
+	t := &Task{
+		ID:        task.ID,
+		Title:     task.Title,
+		Status:    task.Status,
+		CreatedAt: task.CreatedAt,
+		Version:   task.Version,
+	}
+	if task.FinishedAt.Valid {
+		finishedAt := task.FinishedAt.Time
+		t.FinishedAt = &finishedAt
+	}
+
+	return t
+}
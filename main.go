@@ -4,22 +4,39 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
-	"errors"
-	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gin-gonic/gin"
 	"github.com/nargesbyt/todo.go/database"
 	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/handler"
+	"github.com/nargesbyt/todo.go/handler/caldav"
+	"github.com/nargesbyt/todo.go/handler/collab"
+	"github.com/nargesbyt/todo.go/handler/digest"
+	"github.com/nargesbyt/todo.go/handler/events"
+	"github.com/nargesbyt/todo.go/handler/feed"
+	"github.com/nargesbyt/todo.go/handler/idempotency"
+	"github.com/nargesbyt/todo.go/handler/identity"
 	"github.com/nargesbyt/todo.go/handler/oauth"
+	"github.com/nargesbyt/todo.go/handler/session"
+	"github.com/nargesbyt/todo.go/handler/share"
+	"github.com/nargesbyt/todo.go/handler/stats"
 	"github.com/nargesbyt/todo.go/handler/task"
 	"github.com/nargesbyt/todo.go/handler/token"
+	"github.com/nargesbyt/todo.go/handler/transfer"
 	"github.com/nargesbyt/todo.go/handler/user"
+	"github.com/nargesbyt/todo.go/handler/webhook"
+	digests "github.com/nargesbyt/todo.go/internal/digest"
+	"github.com/nargesbyt/todo.go/internal/event"
+	"github.com/nargesbyt/todo.go/internal/jwt"
+	sessions "github.com/nargesbyt/todo.go/internal/session"
+	"github.com/nargesbyt/todo.go/internal/sso"
+	internaltransfer "github.com/nargesbyt/todo.go/internal/transfer"
+	webhooks "github.com/nargesbyt/todo.go/internal/webhook"
 	"github.com/nargesbyt/todo.go/repository"
 	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/rs/zerolog/pkgerrors"
 	"github.com/spf13/viper"
-	"golang.org/x/oauth2"
 	"gorm.io/gorm"
 	"net/http"
 	"os"
@@ -27,35 +44,154 @@ import (
 	"time"
 )
 
+// abortUnauthorized rejects a request and tells the client, such as a
+// CalDAV app, how to authenticate.
+func abortUnauthorized(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="todo"`)
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+// acceptToken checks a personal access token found by the tokens
+// repository, records its use and sets its scopes on the request. It aborts
+// the request and returns false if the token can not be used.
+func acceptToken(c *gin.Context, tokensRepository repository.Tokens, token entity.Token, err error) bool {
+	if err != nil {
+		if err != repository.ErrInvalidToken {
+			log.Error().Stack().Err(err).Msg("unable to authenticate token")
+		}
+		abortUnauthorized(c)
+
+		return false
+	}
+	if !token.Usable(time.Now()) {
+		abortUnauthorized(c)
+
+		return false
+	}
+
+	if err := tokensRepository.Touch(token.ID, time.Now()); err != nil {
+		log.Error().Stack().Err(err).Msg("Unable to update the last_used column.")
+	}
+
+	if scopes := token.ScopeList(); scopes != nil {
+		c.Set("scopes", scopes)
+	}
+
+	return true
+}
+
+// sessionAuth authenticates a request by its session cookie. Browsers send
+// cookies along with requests made by other sites, so unsafe methods must
+// also carry the CSRF token of the session.
+func sessionAuth(c *gin.Context, usersRepository repository.Users, sessionStore *sessions.Store, cookie string) {
+	session, err := sessionStore.Authenticate(cookie)
+	if err != nil {
+		if err != sessions.ErrSessionNotFound {
+			log.Error().Stack().Err(err).Msg("unable to authenticate session")
+		}
+		abortUnauthorized(c)
+
+		return
+	}
+	if !sessions.SafeMethod(c.Request.Method) && !session.ValidCSRF(c.GetHeader(sessions.CSRFHeader)) {
+		c.AbortWithStatusJSON(http.StatusForbidden, handler.NewProblem(http.StatusForbidden, "missing or invalid CSRF token"))
+
+		return
+	}
+	userEntity, err := usersRepository.GetUserByID(session.UserID)
+	if err != nil {
+		abortUnauthorized(c)
+
+		return
+	}
+
+	c.Set("userId", userEntity.ID)
+	c.Set("role", userEntity.Role)
+	c.Set("sessionId", session.ID)
+	c.Next()
+}
+
 // BasicAuth authenticates users that want to send a request to server
-func BasicAuth(usersRepository repository.Users, tokensRepository repository.Tokens, oidcProvider *oidc.Provider) gin.HandlerFunc {
+func BasicAuth(usersRepository repository.Users, tokensRepository repository.Tokens, providers *sso.Providers, provisioner sso.Provisioner, sessionStore *sessions.Store, issuer *jwt.Issuer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authz := c.GetHeader("Authorization")
 		if authz == "" {
-			c.AbortWithStatus(http.StatusUnauthorized)
+			cookie, err := c.Cookie(sessions.CookieName)
+			if err != nil {
+				abortUnauthorized(c)
 
+				return
+			}
+			sessionAuth(c, usersRepository, sessionStore, cookie)
 			return
 		}
 
 		splits := strings.Split(authz, " ")
 		if len(splits) != 2 {
-			c.AbortWithStatus(http.StatusUnauthorized)
+			abortUnauthorized(c)
 
 			return
 		}
+		if splits[0] == "Bearer" && strings.HasPrefix(splits[1], entity.TokenPrefix) {
+			verifiedToken, err := tokensRepository.Lookup(splits[1])
+			if !acceptToken(c, tokensRepository, verifiedToken, err) {
+				return
+			}
+			userEntity, err := usersRepository.GetUserByID(verifiedToken.UserID)
+			if err != nil {
+				abortUnauthorized(c)
+
+				return
+			}
+
+			c.Set("userId", userEntity.ID)
+			c.Set("role", userEntity.Role)
+			c.Next()
+			return
+		}
 		if splits[0] == "Bearer" {
-			var verifier = oidcProvider.Verifier(&oidc.Config{ClientID: viper.GetString("oauth.client_id")})
-			_, err := verifier.Verify(context.Background(), splits[1])
+			claims, err := issuer.Verify(splits[1])
+			if err == nil {
+				c.Set("userId", claims.UserID)
+				c.Set("role", claims.Role)
+				if claims.Scopes != nil {
+					c.Set("scopes", claims.Scopes)
+				}
+				c.Next()
+				return
+			}
+			if err != jwt.ErrForeignToken {
+				abortUnauthorized(c)
+
+				return
+			}
+
+			provider, idToken, err := providers.Verify(context.Background(), splits[1])
 			if err != nil {
-				c.AbortWithStatus(http.StatusUnauthorized)
+				abortUnauthorized(c)
 
 				return
 			}
+			identity, err := provider.Identity(idToken)
+			if err != nil {
+				abortUnauthorized(c)
+
+				return
+			}
+			userEntity, err := provisioner.User(provider, identity)
+			if err != nil {
+				oauth.AbortWithProvisionError(c, err)
+
+				return
+			}
+
+			c.Set("userId", userEntity.ID)
+			c.Set("role", userEntity.Role)
 			c.Next()
 			return
 		}
 		if splits[0] != "Basic" {
-			c.AbortWithStatus(http.StatusUnauthorized)
+			abortUnauthorized(c)
 
 			return
 
@@ -63,7 +199,7 @@ func BasicAuth(usersRepository repository.Users, tokensRepository repository.Tok
 
 		userPass, err := base64.StdEncoding.DecodeString(splits[1])
 		if err != nil {
-			c.AbortWithStatus(http.StatusUnauthorized)
+			abortUnauthorized(c)
 
 			return
 		}
@@ -71,74 +207,69 @@ func BasicAuth(usersRepository repository.Users, tokensRepository repository.Tok
 		splitedUserPass := strings.Split(string(userPass), ":")
 		userEntity, err := usersRepository.GetUserByUsername(splitedUserPass[0])
 		if err != nil {
-			c.AbortWithStatus(http.StatusUnauthorized)
+			abortUnauthorized(c)
 
 			return
 		}
 
-		if strings.HasPrefix(splitedUserPass[1], "todo_pat_") {
-			tokens, err := tokensRepository.GetTokensByUserID(userEntity.ID)
-			if err != nil {
-				c.AbortWithStatus(http.StatusUnauthorized)
-
-				return
-			}
-
-			var verifiedToken *entity.Token
-			for _, t := range tokens {
-				err = t.VerifyToken(splitedUserPass[1])
-				if err != nil {
-					continue
-				}
-
-				if t.Active == 0 {
-					break
-				}
-				if t.ExpiredAt.Valid {
-					if t.ExpiredAt.Time.Before(time.Now()) {
-						break
-					}
-				}
-
-				verifiedToken = t
-				break
-			}
-
-			if verifiedToken == nil {
-				c.AbortWithStatus(http.StatusUnauthorized)
-				log.Fatal().Err(errors.New("token is expired")).Msg("token is expired")
-
+		if strings.HasPrefix(splitedUserPass[1], entity.TokenPrefix) {
+			verifiedToken, err := tokensRepository.Authenticate(userEntity.ID, splitedUserPass[1])
+			if !acceptToken(c, tokensRepository, verifiedToken, err) {
 				return
 			}
 
-			var ExpiredAt time.Time
-			if verifiedToken.ExpiredAt.Valid {
-				ExpiredAt = verifiedToken.ExpiredAt.Time
-			}
-
-			_, err = tokensRepository.Update(verifiedToken.ID, verifiedToken.Title, ExpiredAt, time.Now(), verifiedToken.Active)
-			if err != nil {
-				log.Fatal().Err(err).Msg("Unable to update the last_used column.")
-			}
-
 			c.Set("userId", userEntity.ID)
+			c.Set("role", userEntity.Role)
 			c.Next()
 			return
 		}
 
 		if err := userEntity.CheckPassword(splitedUserPass[1]); err != nil {
-			c.AbortWithStatus(http.StatusUnauthorized)
+			abortUnauthorized(c)
 
 			return
 		}
 
 		c.Set("userId", userEntity.ID)
+		c.Set("role", userEntity.Role)
 		c.Next()
 	}
 }
 
 func main() {
 	viper.SetConfigName("config")
+	viper.SetDefault("idempotency.ttl", 24*time.Hour)
+	viper.SetDefault("idempotency.lock_ttl", time.Minute)
+	viper.SetDefault("auth.admins", []string{})
+	viper.SetDefault("auth.role_cache_ttl", time.Minute)
+	viper.SetDefault("auth.token_key", "")
+	viper.SetDefault("auth.legacy_tokens", true)
+	viper.SetDefault("jwt.issuer", "http://localhost:8080")
+	viper.SetDefault("jwt.access_ttl", 15*time.Minute)
+	viper.SetDefault("jwt.refresh_ttl", 30*24*time.Hour)
+	viper.SetDefault("jwt.key_rotation", 7*24*time.Hour)
+	viper.SetDefault("oauth2.request_ttl", 10*time.Minute)
+	viper.SetDefault("sessions.idle_timeout", 2*time.Hour)
+	viper.SetDefault("sessions.absolute_timeout", 7*24*time.Hour)
+	viper.SetDefault("sessions.secure_cookies", true)
+	viper.SetDefault("oauth.redirect_url", "http://localhost:8080/oauth/google/callback")
+	viper.SetDefault("events.log_size", 1000)
+	viper.SetDefault("events.heartbeat", 15*time.Second)
+	viper.SetDefault("webhooks.timeout", 10*time.Second)
+	viper.SetDefault("webhooks.max_attempts", 8)
+	viper.SetDefault("webhooks.backoff", 30*time.Second)
+	viper.SetDefault("webhooks.interval", 5*time.Second)
+	viper.SetDefault("webhooks.allow_private_networks", false)
+	viper.SetDefault("caldav.change_retention", 30*24*time.Hour)
+	viper.SetDefault("feeds.base_url", "")
+	viper.SetDefault("imports.job_ttl", 24*time.Hour)
+	viper.SetDefault("stats.cache_ttl", 5*time.Minute)
+	viper.SetDefault("smtp.addr", "localhost:25")
+	viper.SetDefault("smtp.username", "")
+	viper.SetDefault("smtp.password", "")
+	viper.SetDefault("smtp.from", "todo@localhost")
+	viper.SetDefault("digest.base_url", "")
+	viper.SetDefault("digest.interval", time.Minute)
 	viper.AddConfigPath("./")
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -150,9 +281,23 @@ func main() {
 
 	}
 
-	provider, err := oidc.NewProvider(context.Background(), "https://accounts.google.com")
+	var providerConfigs []sso.Config
+	if err := viper.UnmarshalKey("oauth.providers", &providerConfigs); err != nil {
+		log.Fatal().Err(err).Msg("unable to read the OIDC providers")
+		return
+	}
+	if len(providerConfigs) == 0 && viper.GetString("oauth.client_id") != "" {
+		providerConfigs = append(providerConfigs, sso.Config{
+			Name:         "google",
+			Issuer:       "https://accounts.google.com",
+			ClientID:     viper.GetString("oauth.client_id"),
+			ClientSecret: viper.GetString("oauth.client_secret"),
+			RedirectURL:  viper.GetString("oauth.redirect_url"),
+		})
+	}
+	providers, err := sso.NewProviders(context.Background(), providerConfigs)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Unable to initialize an OIDC provider")
+		log.Fatal().Err(err).Msg("Unable to initialize the OIDC providers")
 		return
 	}
 	redisClient := redis.NewClient(&redis.Options{
@@ -161,19 +306,6 @@ func main() {
 		DB:       viper.GetInt("redis.db"),
 	})
 
-	// Configure an OpenID Connect aware OAuth2 client.
-	oauth2Config := oauth2.Config{
-		ClientID:     viper.GetString("oauth.client_id"),
-		ClientSecret: viper.GetString("oauth.client_secret"),
-		RedirectURL:  "http://localhost:8080/oauth/callback",
-
-		// Discovery returns the OAuth2 endpoints.
-		Endpoint: provider.Endpoint(),
-
-		// "openid" is a required scope for OpenID Connect flows.
-		Scopes: []string{oidc.ScopeOpenID, "profile", "email"},
-	}
-
 	logLevel, err := zerolog.ParseLevel(viper.GetString("log.level"))
 	if err != nil {
 		log.Fatal().
@@ -213,48 +345,274 @@ func main() {
 
 	}
 
+	if err := database.Migrate(db); err != nil {
+		log.Fatal().Err(err).Msg("Unable to migrate the database schema")
+	}
+
+	broker := event.NewBroker(redisClient, viper.GetInt64("events.log_size"))
+	go broker.Run(context.Background())
+
 	repo, err := repository.NewTasks(db)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Unable to initialize the tasks repository")
 	}
 
+	webhookRepository, err := repository.NewWebhooks(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the webhooks repository")
+	}
+	feedRepository, err := repository.NewFeeds(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the feeds repository")
+	}
+
+	calendarObjectRepository, err := repository.NewCalendarObjects(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the calendar objects repository")
+	}
+
+	calendarChangeRepository, err := repository.NewCalendarChanges(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the calendar changes repository")
+	}
+	syncLog := caldav.SyncLog{
+		ObjectsRepository: calendarObjectRepository,
+		ChangesRepository: calendarChangeRepository,
+		Retention:         viper.GetDuration("caldav.change_retention"),
+	}
+	go syncLog.Run(context.Background(), time.Hour)
+
+	shareRepository, err := repository.NewShares(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the shares repository")
+	}
+
+	importRepository, err := repository.NewImports(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the imports repository")
+	}
+
+	dispatcher := webhooks.NewDispatcher(webhookRepository, viper.GetDuration("webhooks.timeout"), viper.GetBool("webhooks.allow_private_networks"), viper.GetInt("webhooks.max_attempts"), viper.GetDuration("webhooks.backoff"))
+	go dispatcher.Run(context.Background(), viper.GetDuration("webhooks.interval"))
+
+	repo = repository.NewPublishingTasks(repo, event.Publishers{broker, dispatcher, syncLog})
+
 	userRepository, err := repository.NewUsers(db)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Unable to initialize the users repository")
 	}
 
-	tRepository, err := repository.NewTokens(db)
+	tokenKey := viper.GetString("auth.token_key")
+	if tokenKey == "" {
+		log.Fatal().Msg("auth.token_key must be set to hash personal access tokens")
+	}
+	tRepository, err := repository.NewTokens(db, []byte(tokenKey), viper.GetBool("auth.legacy_tokens"))
 	if err != nil {
 		log.Fatal().Err(err).Msg("Unable to initialize the tokens repository")
 	}
 
-	ah := oauth.OAuth{OAuth2Config: oauth2Config, RedisClient: redisClient}
+	roleRepository, err := repository.NewRoles(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the roles repository")
+	}
+	if err := roleRepository.Seed(entity.DefaultRoles()); err != nil {
+		log.Fatal().Err(err).Msg("Unable to seed the default roles")
+	}
+
+	// Admins are bootstrapped from the configuration; after that they can
+	// manage the roles of other users.
+	for _, username := range viper.GetStringSlice("auth.admins") {
+		admin, err := userRepository.GetUserByUsername(username)
+		if err != nil {
+			log.Warn().Err(err).Str("username", username).Msg("Unable to find the configured admin")
+			continue
+		}
+		if _, err := userRepository.SetRole(admin.ID, entity.RoleAdmin, 0); err != nil {
+			log.Fatal().Err(err).Str("username", username).Msg("Unable to grant the admin role")
+		}
+	}
+
+	identityRepository, err := repository.NewIdentities(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the identities repository")
+	}
+	provisioner := sso.Provisioner{Users: userRepository, Identities: identityRepository}
+
+	signingKeyRepository, err := repository.NewSigningKeys(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the signing keys repository")
+	}
+	refreshTokenRepository, err := repository.NewRefreshTokens(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the refresh tokens repository")
+	}
+	clientRepository, err := repository.NewClients(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the clients repository")
+	}
+	issuer := &jwt.Issuer{
+		Keys:      signingKeyRepository,
+		URL:       viper.GetString("jwt.issuer"),
+		AccessTTL: viper.GetDuration("jwt.access_ttl"),
+		Rotation:  viper.GetDuration("jwt.key_rotation"),
+	}
+
+	sessionStore := &sessions.Store{
+		RedisClient:     redisClient,
+		IdleTimeout:     viper.GetDuration("sessions.idle_timeout"),
+		AbsoluteTimeout: viper.GetDuration("sessions.absolute_timeout"),
+	}
+
+	digestRepository, err := repository.NewDigests(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to initialize the digests repository")
+	}
+	digestSender := &digests.Sender{
+		Digests: digestRepository,
+		Users:   userRepository,
+		Tasks:   repo,
+		Mailer: digests.Mailer{
+			Addr:     viper.GetString("smtp.addr"),
+			Username: viper.GetString("smtp.username"),
+			Password: viper.GetString("smtp.password"),
+			From:     viper.GetString("smtp.from"),
+		},
+		BaseURL: viper.GetString("digest.base_url"),
+	}
+	if digestSender.BaseURL == "" {
+		// Links in digests would be relative and could not be followed.
+		log.Error().Msg("digest.base_url is not set, digests are disabled")
+	} else {
+		go digestSender.Run(context.Background(), viper.GetDuration("digest.interval"))
+	}
+
+	ah := oauth.OAuth{Providers: providers, Provisioner: provisioner, RedisClient: redisClient}
+	eh := events.Events{Broker: broker, Heartbeat: viper.GetDuration("events.heartbeat")}
+	ch := collab.NewCollab(broker, redisClient, repo, shareRepository)
+	go ch.Run(context.Background())
+	ih := idempotency.Idempotency{RedisClient: redisClient, TTL: viper.GetDuration("idempotency.ttl"), LockTTL: viper.GetDuration("idempotency.lock_ttl")}
 
 	th := task.Task{TasksRepository: repo}
-	uh := user.User{UsersRepository: userRepository}
-	toh := token.Token{TokenRepository: tRepository}
-
-	r := gin.Default()
-	r.GET("/oauth", ah.Get)
-	r.GET("/oauth/callback", ah.Callback)
-
-	r.POST("/tasks", BasicAuth(userRepository, tRepository, provider), th.Create)
-	r.GET("/tasks", BasicAuth(userRepository, tRepository, provider), th.List)
-	r.GET("/tasks/:id", BasicAuth(userRepository, tRepository, provider), th.Get)
-	r.PATCH("/tasks/:id", BasicAuth(userRepository, tRepository, provider), th.Update)
-	r.DELETE("/tasks/:id", BasicAuth(userRepository, tRepository, provider), th.Delete)
-
-	r.POST("/users", uh.Create)
-	r.GET("/users", uh.List)
-	r.GET("/users/:id", uh.Get)
-	r.PATCH("/users/:id", uh.Update)
-	r.DELETE("/users/:id", uh.Delete)
-
-	r.POST("/tokens", BasicAuth(userRepository, tRepository, provider), toh.Create)
-	r.GET("/tokens", BasicAuth(userRepository, tRepository, provider), toh.List)
-	r.GET("/tokens/:id", BasicAuth(userRepository, tRepository, provider), toh.Get)
-	r.PATCH("/tokens/:id", BasicAuth(userRepository, tRepository, provider), toh.Update)
-	r.DELETE("/tokens/:id", BasicAuth(userRepository, tRepository, provider), toh.Delete)
+	authz := handler.NewAuthorizer(roleRepository, viper.GetDuration("auth.role_cache_ttl"))
+	uh := user.User{UsersRepository: userRepository, Authorizer: authz}
+	ath := oauth.Token{
+		UsersRepository:         userRepository,
+		TokensRepository:        tRepository,
+		RefreshTokensRepository: refreshTokenRepository,
+		ClientsRepository:       clientRepository,
+		RedisClient:             redisClient,
+		Providers:               providers,
+		Provisioner:             provisioner,
+		Issuer:                  issuer,
+		RefreshTTL:              viper.GetDuration("jwt.refresh_ttl"),
+	}
+	azh := oauth.Authorization{ClientsRepository: clientRepository, RedisClient: redisClient, RequestTTL: viper.GetDuration("oauth2.request_ttl")}
+	clh := oauth.Client{ClientsRepository: clientRepository, RefreshTokensRepository: refreshTokenRepository}
+	seh := session.Session{UsersRepository: userRepository, Store: sessionStore, Secure: viper.GetBool("sessions.secure_cookies")}
+	idh := identity.Identity{IdentitiesRepository: identityRepository, Providers: providers, Provisioner: provisioner}
+	toh := token.Token{TokenRepository: tRepository, Authorizer: authz}
+	cdh := caldav.CalDAV{TasksRepository: repo, ObjectsRepository: calendarObjectRepository, ChangesRepository: calendarChangeRepository}
+	dh := digest.Digest{DigestsRepository: digestRepository, UsersRepository: userRepository, Sender: digestSender}
+	sh := stats.Stats{TasksRepository: repo, RedisClient: redisClient, TTL: viper.GetDuration("stats.cache_ttl")}
+	importJobs := &internaltransfer.Jobs{
+		RedisClient: redisClient,
+		TTL:         viper.GetDuration("imports.job_ttl"),
+		Importer:    internaltransfer.Importer{Tasks: repo, Imports: importRepository},
+	}
+	trh := transfer.Transfer{TasksRepository: repo, ImportsRepository: importRepository, Jobs: importJobs}
+	shh := share.Share{SharesRepository: shareRepository, UsersRepository: userRepository}
+	fh := feed.Feed{FeedsRepository: feedRepository, TasksRepository: repo, BaseURL: viper.GetString("feeds.base_url")}
+	wh := webhook.Webhook{WebhooksRepository: webhookRepository, Dispatcher: dispatcher, Authorizer: authz}
+
+	// Like gin.Default, but the access log leaves out secrets in URLs.
+	r := gin.New()
+	r.Use(handler.Logger(), gin.Recovery())
+	r.GET("/oauth/:provider", ah.Get)
+	r.GET("/oauth/:provider/callback", ah.Callback)
+
+	r.POST("/tasks", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksWrite), ih.Handle, th.Create)
+	r.GET("/tasks", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), th.List)
+	r.GET("/tasks/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), th.Get)
+	r.PATCH("/tasks/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksWrite), th.Update)
+	r.DELETE("/tasks/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksWrite), th.Delete)
+
+	r.GET("/events", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), eh.Stream)
+	r.GET("/collab", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), ch.Connect)
+	r.GET("/shares", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), shh.SharedWith)
+	r.GET("/projects/:project/shares", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), shh.List)
+	r.POST("/projects/:project/shares", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksWrite), shh.Create)
+	r.DELETE("/projects/:project/shares/:username", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksWrite), shh.Delete)
+
+	r.POST("/users", ih.Handle, uh.Create)
+	r.GET("/users", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionUsersAdmin), uh.List)
+	r.GET("/users/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.RequireSelf("id", entity.PermissionUsersAdmin), uh.Get)
+	r.PATCH("/users/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.RequireSelf("id", entity.PermissionUsersAdmin), uh.Update)
+	r.DELETE("/users/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.RequireSelf("id", entity.PermissionUsersAdmin), uh.Delete)
+	r.GET("/roles", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionUsersAdmin), uh.Roles)
+	r.GET("/me/permissions", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), uh.Permissions)
+	r.POST("/auth/token", ath.Create)
+	r.GET("/.well-known/jwks.json", ath.JWKS)
+	r.GET("/.well-known/oauth-authorization-server", ath.Metadata)
+	r.POST("/oauth2/revoke", ath.Revoke)
+	r.POST("/oauth2/introspect", ath.Introspect)
+	r.GET("/oauth2/authorize", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), azh.Authorize)
+	r.POST("/oauth2/authorize/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), azh.Consent)
+	r.POST("/oauth2/clients", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTokensManage), ih.HandleSecret, clh.Create)
+	r.GET("/oauth2/clients", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTokensManage), clh.List)
+	r.DELETE("/oauth2/clients/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTokensManage), clh.Delete)
+	r.POST("/login", seh.Login)
+	r.POST("/logout", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), handler.RequireUnscoped, seh.Logout)
+	r.GET("/me/sessions", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), handler.RequireUnscoped, seh.List)
+	r.DELETE("/me/sessions/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), handler.RequireUnscoped, seh.Delete)
+	r.GET("/me/identities", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), handler.RequireUnscoped, idh.List)
+	r.POST("/me/identities", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), handler.RequireUnscoped, idh.Link)
+	r.DELETE("/me/identities/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), handler.RequireUnscoped, idh.Delete)
+	r.PUT("/users/:id/role", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionUsersAdmin), uh.SetRole)
+
+	r.POST("/tokens", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTokensManage), ih.HandleSecret, toh.Create)
+	r.GET("/tokens", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTokensManage), toh.List)
+	r.GET("/tokens/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTokensManage), toh.Get)
+	r.PATCH("/tokens/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTokensManage), toh.Update)
+	r.DELETE("/tokens/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTokensManage), toh.Delete)
+
+	r.GET("/digest", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), dh.Get)
+	r.PATCH("/digest", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksWrite), dh.Update)
+	r.GET("/digest/preview", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), dh.Preview)
+	r.GET("/digest/unsubscribe", dh.UnsubscribeForm)
+	r.POST("/digest/unsubscribe", dh.Unsubscribe)
+	r.GET("/digest/confirm", dh.ConfirmForm)
+	r.POST("/digest/confirm", dh.Confirm)
+	r.GET("/stats", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), sh.Get)
+	r.GET("/export", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), trh.Export)
+	r.POST("/import", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksWrite), trh.Import)
+	r.GET("/export/markdown", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), trh.ExportMarkdown)
+	r.POST("/import/markdown", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksWrite), trh.ImportMarkdown)
+	r.POST("/import/jobs", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksWrite), ih.Handle, trh.StartJob)
+	r.GET("/import/jobs/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), trh.Job)
+
+	r.GET("/feed", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksRead), fh.Get)
+	r.POST("/feed/rotate", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionTasksWrite), fh.Rotate)
+	r.GET("/feeds/:secret/tasks.ics", fh.Tasks)
+
+	r.GET("/.well-known/caldav", cdh.WellKnown)
+	r.Handle("PROPFIND", "/.well-known/caldav", cdh.WellKnown)
+	dav := r.Group(caldav.Prefix, BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer))
+	for _, method := range []string{http.MethodOptions, "PROPFIND", "REPORT", http.MethodGet, http.MethodHead} {
+		dav.Handle(method, "/*path", authz.Require(entity.PermissionTasksRead), cdh.Serve)
+	}
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		dav.Handle(method, "/*path", authz.Require(entity.PermissionTasksWrite), cdh.Serve)
+	}
+
+	r.POST("/webhooks", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionWebhooksManage), ih.HandleSecret, wh.Create)
+	r.GET("/webhooks", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionWebhooksManage), wh.List)
+	r.GET("/webhooks/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionWebhooksManage), wh.Get)
+	r.PATCH("/webhooks/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionWebhooksManage), wh.Update)
+	r.DELETE("/webhooks/:id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionWebhooksManage), wh.Delete)
+	r.POST("/webhooks/:id/ping", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionWebhooksManage), wh.Ping)
+	r.GET("/webhooks/:id/deliveries", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionWebhooksManage), wh.Deliveries)
+	r.GET("/webhooks/:id/deliveries/:delivery_id", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionWebhooksManage), wh.Delivery)
+	r.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", BasicAuth(userRepository, tRepository, providers, provisioner, sessionStore, issuer), authz.Require(entity.PermissionWebhooksManage), wh.Redeliver)
 
 	err = r.Run(viper.GetString("port"))
 	if err != nil {
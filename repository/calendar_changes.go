@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"gorm.io/gorm"
+)
+
+// ErrSyncTokenExpired is returned for a sync token older than the retained
+// changes; the client has to sync from scratch.
+var ErrSyncTokenExpired = errors.New("sync token expired")
+
+// CalendarChanges is the log of task changes that CalDAV sync tokens point
+// into. A token is the id of the last change a client has seen.
+type CalendarChanges interface {
+	Record(change entity.CalendarChange) (entity.CalendarChange, error)
+	Since(userId int64, since int64) ([]*entity.CalendarChange, error)
+	Latest(userId int64) (int64, error)
+	Prune(before time.Time) error
+}
+
+type calendarChanges struct {
+	db *gorm.DB
+}
+
+func NewCalendarChanges(db *gorm.DB) (CalendarChanges, error) {
+	return &calendarChanges{db: db}, nil
+}
+
+func (c *calendarChanges) Record(change entity.CalendarChange) (entity.CalendarChange, error) {
+	tx := c.db.Create(&change)
+	if tx.Error != nil {
+		return entity.CalendarChange{}, tx.Error
+	}
+
+	return change, nil
+}
+
+// Since returns the changes of a user after the change since, oldest first.
+// It returns ErrSyncTokenExpired when some of them may have been pruned.
+func (c *calendarChanges) Since(userId int64, since int64) ([]*entity.CalendarChange, error) {
+	oldest, err := c.oldest()
+	if err != nil {
+		return nil, err
+	}
+	if oldest > 0 && since < oldest-1 {
+		return nil, ErrSyncTokenExpired
+	}
+
+	var changes []*entity.CalendarChange
+	tx := c.db.Where("user_id = ? AND id > ?", userId, since).Order("id").Find(&changes)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return changes, nil
+}
+
+// Latest returns the sync token of the tasks of a user: the id of their
+// last change, but not older than the retained changes.
+func (c *calendarChanges) Latest(userId int64) (int64, error) {
+	var latest int64
+	tx := c.db.Model(&entity.CalendarChange{}).Where("user_id = ?", userId).Select("COALESCE(MAX(id), 0)").Scan(&latest)
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	oldest, err := c.oldest()
+	if err != nil {
+		return 0, err
+	}
+	if oldest-1 > latest {
+		latest = oldest - 1
+	}
+
+	return latest, nil
+}
+
+// Prune removes the changes made before a time. The newest change is kept,
+// so it still tells which tokens have expired.
+func (c *calendarChanges) Prune(before time.Time) error {
+	var newest int64
+	tx := c.db.Model(&entity.CalendarChange{}).Select("COALESCE(MAX(id), 0)").Scan(&newest)
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	return c.db.Where("created_at < ? AND id < ?", before, newest).Delete(&entity.CalendarChange{}).Error
+}
+
+func (c *calendarChanges) oldest() (int64, error) {
+	var oldest int64
+	tx := c.db.Model(&entity.CalendarChange{}).Select("COALESCE(MIN(id), 0)").Scan(&oldest)
+
+	return oldest, tx.Error
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"gorm.io/gorm"
+)
+
+var ErrCalendarObjectNotFound = errors.New("calendar object not found")
+
+type CalendarObjects interface {
+	Create(userId int64, name string, taskId int64, uid string) (entity.CalendarObject, error)
+	GetByName(userId int64, name string) (entity.CalendarObject, error)
+	GetByTask(taskId int64) (entity.CalendarObject, error)
+	List(userId int64) ([]*entity.CalendarObject, error)
+	DeleteByTask(taskId int64) error
+}
+
+type calendarObjects struct {
+	db *gorm.DB
+}
+
+func NewCalendarObjects(db *gorm.DB) (CalendarObjects, error) {
+	return &calendarObjects{db: db}, nil
+}
+
+// Create maps a resource name to a task, replacing a stale mapping of the
+// name or the task, such as one left behind by a task deleted elsewhere.
+func (o *calendarObjects) Create(userId int64, name string, taskId int64, uid string) (entity.CalendarObject, error) {
+	object := entity.CalendarObject{UserID: userId, Name: name, TaskID: taskId, UID: uid}
+
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("(user_id = ? AND name = ?) OR task_id = ?", userId, name, taskId).Delete(&entity.CalendarObject{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&object).Error
+	})
+	if err != nil {
+		return entity.CalendarObject{}, err
+	}
+
+	return object, nil
+}
+
+func (o *calendarObjects) GetByName(userId int64, name string) (entity.CalendarObject, error) {
+	var object entity.CalendarObject
+
+	tx := o.db.Where(&entity.CalendarObject{UserID: userId, Name: name}).First(&object)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return object, ErrCalendarObjectNotFound
+		}
+
+		return object, tx.Error
+	}
+
+	return object, nil
+}
+
+func (o *calendarObjects) GetByTask(taskId int64) (entity.CalendarObject, error) {
+	var object entity.CalendarObject
+
+	tx := o.db.Where(&entity.CalendarObject{TaskID: taskId}).First(&object)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return object, ErrCalendarObjectNotFound
+		}
+
+		return object, tx.Error
+	}
+
+	return object, nil
+}
+
+func (o *calendarObjects) List(userId int64) ([]*entity.CalendarObject, error) {
+	var objects []*entity.CalendarObject
+
+	tx := o.db.Where(&entity.CalendarObject{UserID: userId}).Find(&objects)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return objects, nil
+}
+
+func (o *calendarObjects) DeleteByTask(taskId int64) error {
+	return o.db.Where(&entity.CalendarObject{TaskID: taskId}).Delete(&entity.CalendarObject{}).Error
+}
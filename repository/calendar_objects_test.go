@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nargesbyt/todo.go/database"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type CalendarObjectSuite struct {
+	suite.Suite
+	DB      *gorm.DB
+	mock    sqlmock.Sqlmock
+	objects CalendarObjects
+	changes CalendarChanges
+}
+
+func (s *CalendarObjectSuite) SetupSuite() {
+	var (
+		db  *sql.DB
+		err error
+	)
+	db, s.mock, err = sqlmock.New()
+	s.Require().NoError(err)
+
+	s.DB, err = database.NewPostgres(db)
+	s.Require().NoError(err)
+
+	s.objects, err = NewCalendarObjects(s.DB)
+	s.Require().NoError(err)
+	s.changes, err = NewCalendarChanges(s.DB)
+	s.Require().NoError(err)
+}
+
+func (s *CalendarObjectSuite) TestCreateReplacesStaleMapping() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "calendar_objects" WHERE (user_id = $1 AND name = $2) OR task_id = $3`)).
+		WithArgs(1, "abc.ics", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "calendar_objects" ("user_id","name","task_id","uid") VALUES ($1,$2,$3,$4) RETURNING "id"`)).
+		WithArgs(1, "abc.ics", 7, "abc").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	s.mock.ExpectCommit()
+
+	object, err := s.objects.Create(1, "abc.ics", 7, "abc")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(3), object.ID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *CalendarObjectSuite) TestGetByTaskNotFound() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "calendar_objects" WHERE "calendar_objects"."task_id" = $1 ORDER BY "calendar_objects"."id" LIMIT 1`)).
+		WithArgs(7).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	_, err := s.objects.GetByTask(7)
+	s.Assert().Equal(ErrCalendarObjectNotFound, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *CalendarObjectSuite) TestRecordChange() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "calendar_changes" ("user_id","task_id","name","deleted","created_at") VALUES ($1,$2,$3,$4,$5) RETURNING "id"`)).
+		WithArgs(1, 7, "abc.ics", 1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
+	s.mock.ExpectCommit()
+
+	change, err := s.changes.Record(entity.CalendarChange{UserID: 1, TaskID: 7, Name: "abc.ics", Deleted: 1})
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(12), change.ID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *CalendarObjectSuite) TestSince() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(MIN(id), 0) FROM "calendar_changes"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(5))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "calendar_changes" WHERE user_id = $1 AND id > $2 ORDER BY id`)).
+		WithArgs(1, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "task_id", "deleted"}).AddRow(5, 1, 7, 0).AddRow(9, 1, 8, 1))
+
+	changes, err := s.changes.Since(1, 4)
+	s.Require().NoError(err)
+	s.Require().Len(changes, 2)
+	s.Assert().Equal(int64(9), changes[1].ID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *CalendarObjectSuite) TestSinceExpired() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(MIN(id), 0) FROM "calendar_changes"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(5))
+
+	_, err := s.changes.Since(1, 3)
+	s.Assert().Equal(ErrSyncTokenExpired, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *CalendarObjectSuite) TestLatestNotBeforeOldest() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(MAX(id), 0) FROM "calendar_changes" WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(0))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(MIN(id), 0) FROM "calendar_changes"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(20))
+
+	latest, err := s.changes.Latest(1)
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(19), latest)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *CalendarObjectSuite) TestPruneKeepsNewest() {
+	before := time.Now()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(MAX(id), 0) FROM "calendar_changes"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(30))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "calendar_changes" WHERE created_at < $1 AND id < $2`)).
+		WithArgs(before, 30).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	s.mock.ExpectCommit()
+
+	s.Require().NoError(s.changes.Prune(before))
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func TestCalendarObjectSuite(t *testing.T) {
+	suite.Run(t, new(CalendarObjectSuite))
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/random"
+	"gorm.io/gorm"
+)
+
+var ErrClientNotFound = errors.New("client not found")
+
+const (
+	clientIDLength     = 24
+	clientSecretLength = 43
+)
+
+type Clients interface {
+	Add(userId int64, name string, redirectURIs []string, scopes []string, confidential bool) (entity.Client, string, error)
+	Get(clientID string) (entity.Client, error)
+	List(userId int64) ([]entity.Client, error)
+	Delete(id int64, userId int64) (entity.Client, error)
+}
+
+type clients struct {
+	db *gorm.DB
+}
+
+func NewClients(db *gorm.DB) (Clients, error) {
+	return &clients{db: db}, nil
+}
+
+// Add registers a client. Confidential clients get a secret, which is
+// returned raw once and only stored hashed.
+func (c *clients) Add(userId int64, name string, redirectURIs []string, scopes []string, confidential bool) (entity.Client, string, error) {
+	client := entity.Client{
+		UserID:       userId,
+		ClientID:     random.Token(clientIDLength),
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, ","),
+		Scopes:       strings.Join(scopes, ","),
+		Version:      1,
+	}
+	var secret string
+	if confidential {
+		secret = random.Token(clientSecretLength)
+		client.HashSecret(secret)
+	}
+	if err := c.db.Create(&client).Error; err != nil {
+		return entity.Client{}, "", err
+	}
+
+	return client, secret, nil
+}
+
+func (c *clients) Get(clientID string) (entity.Client, error) {
+	var client entity.Client
+
+	tx := c.db.Where(&entity.Client{ClientID: clientID}).First(&client)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return client, ErrClientNotFound
+		}
+
+		return client, tx.Error
+	}
+
+	return client, nil
+}
+
+func (c *clients) List(userId int64) ([]entity.Client, error) {
+	var list []entity.Client
+
+	tx := c.db.Where(&entity.Client{UserID: userId}).Order("id").Find(&list)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return list, nil
+}
+
+// Delete removes a client of a user and returns it.
+func (c *clients) Delete(id int64, userId int64) (entity.Client, error) {
+	var client entity.Client
+
+	tx := c.db.Where(&entity.Client{UserID: userId}).First(&client, id)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return client, ErrClientNotFound
+		}
+
+		return client, tx.Error
+	}
+	if err := c.db.Delete(&client).Error; err != nil {
+		return client, err
+	}
+
+	return client, nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nargesbyt/todo.go/database"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type ClientSuite struct {
+	suite.Suite
+	DB      *gorm.DB
+	mock    sqlmock.Sqlmock
+	clients Clients
+}
+
+func (s *ClientSuite) SetupTest() {
+	var (
+		db  *sql.DB
+		err error
+	)
+	db, s.mock, err = sqlmock.New()
+	s.Require().NoError(err)
+
+	s.DB, err = database.NewPostgres(db)
+	s.Require().NoError(err)
+
+	s.clients, err = NewClients(s.DB)
+	s.Require().NoError(err)
+}
+
+func (s *ClientSuite) TestAddConfidential() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "clients" ("user_id","client_id","secret_hash","name","redirect_uris","scopes","created_at","version") VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING "id"`)).
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "app", "https://app.example/callback", "tasks:read", sqlmock.AnyArg(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	client, secret, err := s.clients.Add(1, "app", []string{"https://app.example/callback"}, []string{"tasks:read"}, true)
+	s.Require().NoError(err)
+	s.Assert().True(client.VerifySecret(secret))
+	s.Assert().False(client.VerifySecret("guess"))
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestAddPublic() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "clients"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	client, secret, err := s.clients.Add(1, "app", []string{"app://callback"}, []string{"tasks:read"}, false)
+	s.Require().NoError(err)
+	s.Assert().Empty(secret)
+	s.Assert().False(client.Confidential())
+	s.Assert().False(client.VerifySecret(""))
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestGet() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "clients" WHERE "clients"."client_id" = $1 ORDER BY "clients"."id" LIMIT 1`)).
+		WithArgs("abc").
+		WillReturnRows(s.mock.NewRows([]string{"id", "client_id", "redirect_uris"}).AddRow(1, "abc", "https://a.example/cb,https://b.example/cb"))
+
+	client, err := s.clients.Get("abc")
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"https://a.example/cb", "https://b.example/cb"}, client.RedirectURIList())
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestDeleteNotFound() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "clients" WHERE "clients"."user_id" = $1 AND "clients"."id" = $2 ORDER BY "clients"."id" LIMIT 1`)).
+		WithArgs(2, 1).
+		WillReturnRows(s.mock.NewRows([]string{"id"}))
+
+	_, err := s.clients.Delete(1, 2)
+	s.Assert().Equal(ErrClientNotFound, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func TestClientSuite(t *testing.T) {
+	suite.Run(t, new(ClientSuite))
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/random"
+	"gorm.io/gorm"
+)
+
+var ErrDigestNotFound = errors.New("digest not found")
+
+type Digests interface {
+	Get(userId int64) (entity.Digest, error)
+	Save(userId int64, enabled int, sendAt string, timeZone string, version int64) (entity.Digest, error)
+	Enabled() ([]entity.Digest, error)
+	Claim(id int64, day string) (bool, error)
+	Unsubscribe(token string) error
+	RequestConfirmation(id int64, email string) (string, error)
+	Confirm(token string) error
+}
+
+type digests struct {
+	db *gorm.DB
+}
+
+func NewDigests(db *gorm.DB) (Digests, error) {
+	return &digests{db: db}, nil
+}
+
+func (d *digests) Get(userId int64) (entity.Digest, error) {
+	var digest entity.Digest
+
+	tx := d.db.Where(&entity.Digest{UserID: userId}).First(&digest)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return digest, ErrDigestNotFound
+		}
+
+		return digest, tx.Error
+	}
+
+	return digest, nil
+}
+
+// Save creates the digest settings of a user on first use and updates them
+// afterwards. A non-zero version must match the stored one, otherwise
+// ErrVersionConflict is returned.
+func (d *digests) Save(userId int64, enabled int, sendAt string, timeZone string, version int64) (entity.Digest, error) {
+	digest, err := d.Get(userId)
+	if err == ErrDigestNotFound {
+		digest = entity.Digest{
+			UserID:           userId,
+			Enabled:          enabled,
+			SendAt:           sendAt,
+			TimeZone:         timeZone,
+			UnsubscribeToken: random.Token(32),
+			Version:          1,
+		}
+		if err := d.db.Create(&digest).Error; err != nil {
+			return entity.Digest{}, err
+		}
+
+		return digest, nil
+	}
+	if err != nil {
+		return digest, err
+	}
+	if version != 0 && digest.Version != version {
+		return digest, ErrVersionConflict
+	}
+
+	tx := d.db.Model(&digest).Where("version = ?", digest.Version).Updates(map[string]interface{}{
+		"enabled":   enabled,
+		"send_at":   sendAt,
+		"time_zone": timeZone,
+		"version":   digest.Version + 1,
+	})
+	if tx.Error != nil {
+		return digest, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return digest, ErrVersionConflict
+	}
+
+	digest.Enabled = enabled
+	digest.SendAt = sendAt
+	digest.TimeZone = timeZone
+	digest.Version++
+
+	return digest, nil
+}
+
+func (d *digests) Enabled() ([]entity.Digest, error) {
+	var enabled []entity.Digest
+
+	tx := d.db.Where("enabled = ? AND confirmed_email <> ?", 1, "").Order("id").Find(&enabled)
+
+	return enabled, tx.Error
+}
+
+// Claim records that the digest of the given local day is being sent. It
+// reports false when it was already claimed, so only one instance sends.
+func (d *digests) Claim(id int64, day string) (bool, error) {
+	tx := d.db.Model(&entity.Digest{}).
+		Where("id = ? AND (last_sent_on IS NULL OR last_sent_on <> ?)", id, day).
+		Update("last_sent_on", day)
+
+	return tx.RowsAffected == 1, tx.Error
+}
+
+// Unsubscribe disables the digest with the given unsubscribe token.
+func (d *digests) Unsubscribe(token string) error {
+	tx := d.db.Model(&entity.Digest{}).
+		Where("unsubscribe_token = ?", token).
+		Updates(map[string]interface{}{"enabled": 0, "version": gorm.Expr("version + 1")})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrDigestNotFound
+	}
+
+	return nil
+}
+
+// RequestConfirmation starts the confirmation of email as the address the
+// digest is sent to and returns the token of the confirmation link. It
+// replaces any confirmation still pending.
+func (d *digests) RequestConfirmation(id int64, email string) (string, error) {
+	token := random.Token(32)
+	tx := d.db.Model(&entity.Digest{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"pending_email": email, "confirm_token": token})
+	if tx.Error != nil {
+		return "", tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return "", ErrDigestNotFound
+	}
+
+	return token, nil
+}
+
+// Confirm makes the pending email of the digest with the given confirmation
+// token the address digests are sent to.
+func (d *digests) Confirm(token string) error {
+	if token == "" {
+		return ErrDigestNotFound
+	}
+	tx := d.db.Model(&entity.Digest{}).
+		Where("confirm_token = ?", token).
+		Updates(map[string]interface{}{
+			"confirmed_email": gorm.Expr("pending_email"),
+			"confirm_token":   "",
+			"version":         gorm.Expr("version + 1"),
+		})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrDigestNotFound
+	}
+
+	return nil
+}
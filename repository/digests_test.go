@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nargesbyt/todo.go/database"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type DigestSuite struct {
+	suite.Suite
+	DB      *gorm.DB
+	mock    sqlmock.Sqlmock
+	digests Digests
+}
+
+func (s *DigestSuite) SetupTest() {
+	var (
+		db  *sql.DB
+		err error
+	)
+	db, s.mock, err = sqlmock.New()
+	s.Require().NoError(err)
+
+	s.DB, err = database.NewPostgres(db)
+	s.Require().NoError(err)
+
+	s.digests, err = NewDigests(s.DB)
+	s.Require().NoError(err)
+}
+
+func (s *DigestSuite) TestSaveVersionConflict() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "digests" WHERE "digests"."user_id" = $1 ORDER BY "digests"."id" LIMIT 1`)).
+		WithArgs(2).
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "enabled", "send_at", "time_zone", "version"}).
+			AddRow(1, 2, 1, "08:00", "UTC", 3))
+
+	_, err := s.digests.Save(2, 0, "08:00", "UTC", 2)
+	s.Assert().ErrorIs(err, ErrVersionConflict)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *DigestSuite) TestClaim() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "digests" SET "last_sent_on"=$1,"updated_at"=$2 WHERE id = $3 AND (last_sent_on IS NULL OR last_sent_on <> $4)`)).
+		WithArgs("2024-03-05", sqlmock.AnyArg(), 1, "2024-03-05").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	claimed, err := s.digests.Claim(1, "2024-03-05")
+	s.Require().NoError(err)
+	s.Assert().True(claimed)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *DigestSuite) TestClaimAlreadySent() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "digests" SET "last_sent_on"=$1,"updated_at"=$2 WHERE id = $3 AND (last_sent_on IS NULL OR last_sent_on <> $4)`)).
+		WithArgs("2024-03-05", sqlmock.AnyArg(), 1, "2024-03-05").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	claimed, err := s.digests.Claim(1, "2024-03-05")
+	s.Require().NoError(err)
+	s.Assert().False(claimed)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *DigestSuite) TestUnsubscribeUnknownToken() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "digests" SET "enabled"=$1,"version"=version + 1,"updated_at"=$2 WHERE unsubscribe_token = $3`)).
+		WithArgs(0, sqlmock.AnyArg(), "unknown").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	err := s.digests.Unsubscribe("unknown")
+	s.Assert().Equal(ErrDigestNotFound, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *DigestSuite) TestConfirm() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "digests" SET "confirm_token"=$1,"confirmed_email"=pending_email,"version"=version + 1,"updated_at"=$2 WHERE confirm_token = $3`)).
+		WithArgs("", sqlmock.AnyArg(), "token").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	s.Assert().NoError(s.digests.Confirm("token"))
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *DigestSuite) TestConfirmEmptyToken() {
+	s.Assert().Equal(ErrDigestNotFound, s.digests.Confirm(""))
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func TestDigestSuite(t *testing.T) {
+	suite.Run(t, new(DigestSuite))
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/random"
+	"gorm.io/gorm"
+)
+
+var ErrFeedNotFound = errors.New("feed not found")
+
+type Feeds interface {
+	Get(userId int64) (entity.Feed, error)
+	GetBySecret(secret string) (entity.Feed, error)
+	Rotate(userId int64) (entity.Feed, string, error)
+}
+
+type feeds struct {
+	db *gorm.DB
+}
+
+func NewFeeds(db *gorm.DB) (Feeds, error) {
+	return &feeds{db: db}, nil
+}
+
+func (f *feeds) Get(userId int64) (entity.Feed, error) {
+	var feed entity.Feed
+
+	tx := f.db.Where(&entity.Feed{UserID: userId}).First(&feed)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return feed, ErrFeedNotFound
+		}
+
+		return feed, tx.Error
+	}
+
+	return feed, nil
+}
+
+func (f *feeds) GetBySecret(secret string) (entity.Feed, error) {
+	var feed entity.Feed
+
+	tx := f.db.Where(&entity.Feed{SecretHash: entity.HashFeedSecret(secret)}).First(&feed)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return feed, ErrFeedNotFound
+		}
+
+		return feed, tx.Error
+	}
+
+	return feed, nil
+}
+
+// Rotate replaces the secret of the feed of a user, creating the feed on
+// first use, and returns the new secret. URLs with the old secret stop
+// working.
+func (f *feeds) Rotate(userId int64) (entity.Feed, string, error) {
+	secret := random.Token(32)
+
+	feed, err := f.Get(userId)
+	if err != nil && err != ErrFeedNotFound {
+		return feed, "", err
+	}
+
+	feed.UserID = userId
+	feed.SecretHash = entity.HashFeedSecret(secret)
+	feed.RotatedAt = time.Now()
+	if err := f.db.Save(&feed).Error; err != nil {
+		return entity.Feed{}, "", err
+	}
+
+	return feed, secret, nil
+}
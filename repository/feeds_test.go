@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nargesbyt/todo.go/database"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type FeedSuite struct {
+	suite.Suite
+	DB    *gorm.DB
+	mock  sqlmock.Sqlmock
+	feeds Feeds
+}
+
+func (s *FeedSuite) SetupSuite() {
+	var (
+		db  *sql.DB
+		err error
+	)
+	db, s.mock, err = sqlmock.New()
+	s.Require().NoError(err)
+
+	s.DB, err = database.NewPostgres(db)
+	s.Require().NoError(err)
+
+	s.feeds, err = NewFeeds(s.DB)
+	s.Require().NoError(err)
+}
+
+func (s *FeedSuite) TestGetBySecret() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "feeds" WHERE "feeds"."secret_hash" = $1 ORDER BY "feeds"."id" LIMIT 1`)).
+		WithArgs(entity.HashFeedSecret("secret")).
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "secret_hash"}).AddRow(1, 2, entity.HashFeedSecret("secret")))
+
+	feed, err := s.feeds.GetBySecret("secret")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(2), feed.UserID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *FeedSuite) TestGetBySecretNotFound() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "feeds" WHERE "feeds"."secret_hash" = $1 ORDER BY "feeds"."id" LIMIT 1`)).
+		WithArgs(entity.HashFeedSecret("unknown")).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	_, err := s.feeds.GetBySecret("unknown")
+	s.Assert().Equal(ErrFeedNotFound, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func TestFeedSuite(t *testing.T) {
+	suite.Run(t, new(FeedSuite))
+}
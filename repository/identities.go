@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrIdentityExists   = errors.New("identity is already linked")
+)
+
+type Identities interface {
+	Get(issuer string, subject string) (entity.Identity, error)
+	List(userId int64) ([]entity.Identity, error)
+	Add(userId int64, issuer string, subject string, email string) (entity.Identity, error)
+	Touch(id int64) error
+	Delete(id int64, userId int64) error
+}
+
+type identities struct {
+	db *gorm.DB
+}
+
+func NewIdentities(db *gorm.DB) (Identities, error) {
+	return &identities{db: db}, nil
+}
+
+func (i *identities) Get(issuer string, subject string) (entity.Identity, error) {
+	var identity entity.Identity
+
+	tx := i.db.Where(&entity.Identity{Issuer: issuer, Subject: subject}).First(&identity)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return identity, ErrIdentityNotFound
+		}
+
+		return identity, tx.Error
+	}
+
+	return identity, nil
+}
+
+func (i *identities) List(userId int64) ([]entity.Identity, error) {
+	var identities []entity.Identity
+
+	tx := i.db.Where(&entity.Identity{UserID: userId}).Order("id").Find(&identities)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return identities, nil
+}
+
+// Add links the subject of issuer to a user. It returns ErrIdentityExists
+// if the subject is linked already, to this or another user.
+func (i *identities) Add(userId int64, issuer string, subject string, email string) (entity.Identity, error) {
+	if _, err := i.Get(issuer, subject); err != ErrIdentityNotFound {
+		if err == nil {
+			return entity.Identity{}, ErrIdentityExists
+		}
+
+		return entity.Identity{}, err
+	}
+
+	identity := entity.Identity{
+		UserID:      userId,
+		Issuer:      issuer,
+		Subject:     subject,
+		Email:       email,
+		LastLoginAt: time.Now(),
+	}
+	if err := i.db.Create(&identity).Error; err != nil {
+		return entity.Identity{}, err
+	}
+
+	return identity, nil
+}
+
+// Touch records a login with an identity.
+func (i *identities) Touch(id int64) error {
+	return i.db.Model(&entity.Identity{ID: id}).Update("last_login_at", time.Now()).Error
+}
+
+func (i *identities) Delete(id int64, userId int64) error {
+	tx := i.db.Where(&entity.Identity{UserID: userId}).Delete(&entity.Identity{}, id)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrIdentityNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nargesbyt/todo.go/database"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type IdentitySuite struct {
+	suite.Suite
+	DB         *gorm.DB
+	mock       sqlmock.Sqlmock
+	identities Identities
+}
+
+func (s *IdentitySuite) SetupTest() {
+	var (
+		db  *sql.DB
+		err error
+	)
+	db, s.mock, err = sqlmock.New()
+	s.Require().NoError(err)
+
+	s.DB, err = database.NewPostgres(db)
+	s.Require().NoError(err)
+
+	s.identities, err = NewIdentities(s.DB)
+	s.Require().NoError(err)
+}
+
+func (s *IdentitySuite) TestGet() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "identities" WHERE "identities"."issuer" = $1 AND "identities"."subject" = $2 ORDER BY "identities"."id" LIMIT 1`)).
+		WithArgs("https://accounts.google.com", "42").
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "issuer", "subject"}).AddRow(1, 2, "https://accounts.google.com", "42"))
+
+	identity, err := s.identities.Get("https://accounts.google.com", "42")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(2), identity.UserID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *IdentitySuite) TestAdd() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "identities" WHERE "identities"."issuer" = $1 AND "identities"."subject" = $2 ORDER BY "identities"."id" LIMIT 1`)).
+		WithArgs("https://accounts.google.com", "42").
+		WillReturnRows(s.mock.NewRows([]string{"id"}))
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "identities" ("user_id","issuer","subject","email","created_at","last_login_at") VALUES ($1,$2,$3,$4,$5,$6) RETURNING "id"`)).
+		WithArgs(2, "https://accounts.google.com", "42", "ali@gmail.com", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	identity, err := s.identities.Add(2, "https://accounts.google.com", "42", "ali@gmail.com")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(1), identity.ID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *IdentitySuite) TestAddLinked() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "identities" WHERE "identities"."issuer" = $1 AND "identities"."subject" = $2 ORDER BY "identities"."id" LIMIT 1`)).
+		WithArgs("https://accounts.google.com", "42").
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id"}).AddRow(1, 3))
+
+	_, err := s.identities.Add(2, "https://accounts.google.com", "42", "ali@gmail.com")
+	s.Assert().Equal(ErrIdentityExists, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *IdentitySuite) TestDeleteNotFound() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "identities" WHERE "identities"."user_id" = $1 AND "identities"."id" = $2`)).
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	err := s.identities.Delete(1, 2)
+	s.Assert().Equal(ErrIdentityNotFound, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func TestIdentitySuite(t *testing.T) {
+	suite.Run(t, new(IdentitySuite))
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"gorm.io/gorm"
+)
+
+var ErrImportNotFound = errors.New("imported task not found")
+
+type Imports interface {
+	Create(userId int64, externalId string, taskId int64) (entity.ImportedTask, error)
+	Get(userId int64, externalId string) (entity.ImportedTask, error)
+	// ExternalIDs returns the external ids of the given tasks by task id.
+	ExternalIDs(taskIds []int64) (map[int64]string, error)
+}
+
+type imports struct {
+	db *gorm.DB
+}
+
+func NewImports(db *gorm.DB) (Imports, error) {
+	return &imports{db: db}, nil
+}
+
+func (i *imports) Create(userId int64, externalId string, taskId int64) (entity.ImportedTask, error) {
+	imported := entity.ImportedTask{UserID: userId, ExternalID: externalId, TaskID: taskId}
+
+	tx := i.db.Create(&imported)
+	if tx.Error != nil {
+		return entity.ImportedTask{}, tx.Error
+	}
+
+	return imported, nil
+}
+
+func (i *imports) Get(userId int64, externalId string) (entity.ImportedTask, error) {
+	var imported entity.ImportedTask
+
+	tx := i.db.Where(&entity.ImportedTask{UserID: userId, ExternalID: externalId}).First(&imported)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return imported, ErrImportNotFound
+		}
+
+		return imported, tx.Error
+	}
+
+	return imported, nil
+}
+
+func (i *imports) ExternalIDs(taskIds []int64) (map[int64]string, error) {
+	ids := map[int64]string{}
+	if len(taskIds) == 0 {
+		return ids, nil
+	}
+
+	var imported []*entity.ImportedTask
+	tx := i.db.Where("task_id IN ?", taskIds).Find(&imported)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	for _, it := range imported {
+		ids[it.TaskID] = it.ExternalID
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockImportRepository struct {
+	mock.Mock
+}
+
+func (m *MockImportRepository) Create(userId int64, externalId string, taskId int64) (entity.ImportedTask, error) {
+	args := m.Called(userId, externalId, taskId)
+	return args.Get(0).(entity.ImportedTask), args.Error(1)
+}
+
+func (m *MockImportRepository) Get(userId int64, externalId string) (entity.ImportedTask, error) {
+	args := m.Called(userId, externalId)
+	return args.Get(0).(entity.ImportedTask), args.Error(1)
+}
+
+func (m *MockImportRepository) ExternalIDs(taskIds []int64) (map[int64]string, error) {
+	args := m.Called(taskIds)
+	return args.Get(0).(map[int64]string), args.Error(1)
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPageLimit is used when a client does not ask for a page size.
+	DefaultPageLimit = 20
+	// MaxPageLimit is the largest page a client may request.
+	MaxPageLimit = 100
+)
+
+var ErrInvalidPage = errors.New("invalid page")
+
+// Page is a keyset pagination window over the primary key. At most one of
+// After and Before is set; both are exclusive bounds.
+type Page struct {
+	After  int64
+	Before int64
+	Limit  int
+}
+
+// PageInfo describes the fetched page and the filtered set around it.
+type PageInfo struct {
+	Total   int64
+	MaxID   int64
+	StartID int64
+	EndID   int64
+	HasPrev bool
+	HasNext bool
+}
+
+func (p Page) validate() error {
+	if p.Limit < 1 || p.Limit > MaxPageLimit {
+		return ErrInvalidPage
+	}
+	if p.After < 0 || p.Before < 0 || (p.After > 0 && p.Before > 0) {
+		return ErrInvalidPage
+	}
+
+	return nil
+}
+
+// paginate runs query, which must already carry its model and filters, for
+// the given page ordered by id and reports the surrounding PageInfo.
+func paginate[T any](query *gorm.DB, page Page, idOf func(*T) int64) ([]*T, PageInfo, error) {
+	var info PageInfo
+	if err := page.validate(); err != nil {
+		return nil, info, err
+	}
+
+	var stats struct {
+		Total int64
+		MaxID sql.NullInt64
+	}
+	tx := query.Session(&gorm.Session{}).Select("COUNT(*) AS total, MAX(id) AS max_id").Scan(&stats)
+	if tx.Error != nil {
+		return nil, info, tx.Error
+	}
+	info.Total = stats.Total
+	info.MaxID = stats.MaxID.Int64
+
+	q := query.Session(&gorm.Session{})
+	switch {
+	case page.Before > 0:
+		q = q.Where("id < ?", page.Before).Order("id DESC")
+	case page.After > 0:
+		q = q.Where("id > ?", page.After).Order("id")
+	default:
+		q = q.Order("id")
+	}
+
+	var items []*T
+	tx = q.Limit(page.Limit + 1).Find(&items)
+	if tx.Error != nil {
+		return nil, info, tx.Error
+	}
+
+	more := len(items) > page.Limit
+	if more {
+		items = items[:page.Limit]
+	}
+
+	if page.Before > 0 {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+		info.HasPrev = more
+		info.HasNext = page.Before <= info.MaxID
+	} else {
+		info.HasPrev = page.After > 0
+		info.HasNext = more
+	}
+
+	if len(items) > 0 {
+		info.StartID = idOf(items[0])
+		info.EndID = idOf(items[len(items)-1])
+	}
+
+	return items, info, nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/random"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid")
+	ErrRefreshTokenReused  = errors.New("refresh token was used before")
+)
+
+const refreshTokenLength = 43
+
+type RefreshTokens interface {
+	Add(userId int64, clientID string, familyID string, scopes []string, expiresAt time.Time) (entity.RefreshToken, string, error)
+	Find(raw string) (entity.RefreshToken, error)
+	Use(raw string) (entity.RefreshToken, error)
+	RevokeFamily(familyID string) error
+	RevokeClient(clientID string) error
+}
+
+type refreshTokens struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokens(db *gorm.DB) (RefreshTokens, error) {
+	return &refreshTokens{db: db}, nil
+}
+
+// Add creates a refresh token in a family, a new one if familyID is empty.
+// clientID is the third-party client it is issued to, if any. It returns
+// the raw token, which is not stored.
+func (r *refreshTokens) Add(userId int64, clientID string, familyID string, scopes []string, expiresAt time.Time) (entity.RefreshToken, string, error) {
+	if familyID == "" {
+		familyID = random.Token(16)
+	}
+	raw := entity.RefreshTokenPrefix + random.Token(refreshTokenLength)
+
+	token := entity.RefreshToken{
+		UserID:    userId,
+		ClientID:  clientID,
+		FamilyID:  familyID,
+		TokenHash: entity.HashRefreshToken(raw),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := r.db.Create(&token).Error; err != nil {
+		return entity.RefreshToken{}, "", err
+	}
+
+	return token, raw, nil
+}
+
+// Find returns the live refresh token matching raw without using it.
+func (r *refreshTokens) Find(raw string) (entity.RefreshToken, error) {
+	var token entity.RefreshToken
+
+	tx := r.db.Where("token_hash = ?", entity.HashRefreshToken(raw)).First(&token)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return token, ErrInvalidRefreshToken
+		}
+
+		return token, tx.Error
+	}
+	if token.RevokedAt.Valid || token.UsedAt.Valid || token.ExpiresAt.Before(time.Now()) {
+		return entity.RefreshToken{}, ErrInvalidRefreshToken
+	}
+
+	return token, nil
+}
+
+// Use marks a refresh token as used and returns it. A token used before
+// returns ErrRefreshTokenReused and revokes its family, since either the
+// client or whoever stole the token holds a newer one.
+func (r *refreshTokens) Use(raw string) (entity.RefreshToken, error) {
+	var token entity.RefreshToken
+
+	tx := r.db.Where("token_hash = ?", entity.HashRefreshToken(raw)).First(&token)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return token, ErrInvalidRefreshToken
+		}
+
+		return token, tx.Error
+	}
+	if token.RevokedAt.Valid || token.ExpiresAt.Before(time.Now()) {
+		return entity.RefreshToken{}, ErrInvalidRefreshToken
+	}
+	if token.UsedAt.Valid {
+		return entity.RefreshToken{}, r.reused(token.FamilyID)
+	}
+
+	tx = r.db.Model(&token).Where("used_at IS NULL").Update("used_at", time.Now())
+	if tx.Error != nil {
+		return entity.RefreshToken{}, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return entity.RefreshToken{}, r.reused(token.FamilyID)
+	}
+
+	return token, nil
+}
+
+func (r *refreshTokens) reused(familyID string) error {
+	if err := r.RevokeFamily(familyID); err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// RevokeFamily revokes every refresh token of a family.
+func (r *refreshTokens) RevokeFamily(familyID string) error {
+	return r.db.Model(&entity.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeClient revokes every refresh token issued to a client.
+func (r *refreshTokens) RevokeClient(clientID string) error {
+	return r.db.Model(&entity.RefreshToken{}).
+		Where("client_id = ? AND revoked_at IS NULL", clientID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nargesbyt/todo.go/database"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type RefreshTokenSuite struct {
+	suite.Suite
+	DB            *gorm.DB
+	mock          sqlmock.Sqlmock
+	refreshTokens RefreshTokens
+}
+
+func (s *RefreshTokenSuite) SetupTest() {
+	var (
+		db  *sql.DB
+		err error
+	)
+	db, s.mock, err = sqlmock.New()
+	s.Require().NoError(err)
+
+	s.DB, err = database.NewPostgres(db)
+	s.Require().NoError(err)
+
+	s.refreshTokens, err = NewRefreshTokens(s.DB)
+	s.Require().NoError(err)
+}
+
+func (s *RefreshTokenSuite) TestAdd() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "refresh_tokens" ("user_id","client_id","family_id","token_hash","scopes","created_at","expires_at","used_at","revoked_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "id"`)).
+		WithArgs(1, "", "family", sqlmock.AnyArg(), "tasks:read", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	token, raw, err := s.refreshTokens.Add(1, "", "family", []string{"tasks:read"}, time.Now().Add(time.Hour))
+	s.Require().NoError(err)
+	s.Assert().Equal(entity.HashRefreshToken(raw), token.TokenHash)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *RefreshTokenSuite) TestUse() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "refresh_tokens" WHERE token_hash = $1 ORDER BY "refresh_tokens"."id" LIMIT 1`)).
+		WithArgs(entity.HashRefreshToken("todo_rt_abc")).
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "family_id", "expires_at"}).AddRow(1, 2, "family", time.Now().Add(time.Hour)))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "used_at"=$1 WHERE used_at IS NULL AND "id" = $2`)).
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	token, err := s.refreshTokens.Use("todo_rt_abc")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(2), token.UserID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *RefreshTokenSuite) TestUseReused() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "refresh_tokens" WHERE token_hash = $1 ORDER BY "refresh_tokens"."id" LIMIT 1`)).
+		WithArgs(entity.HashRefreshToken("todo_rt_abc")).
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "family_id", "expires_at", "used_at"}).AddRow(1, 2, "family", time.Now().Add(time.Hour), time.Now()))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "revoked_at"=$1 WHERE family_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), "family").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.mock.ExpectCommit()
+
+	_, err := s.refreshTokens.Use("todo_rt_abc")
+	s.Assert().Equal(ErrRefreshTokenReused, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *RefreshTokenSuite) TestUseExpired() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "refresh_tokens" WHERE token_hash = $1 ORDER BY "refresh_tokens"."id" LIMIT 1`)).
+		WithArgs(entity.HashRefreshToken("todo_rt_abc")).
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "family_id", "expires_at"}).AddRow(1, 2, "family", time.Now().Add(-time.Hour)))
+
+	_, err := s.refreshTokens.Use("todo_rt_abc")
+	s.Assert().Equal(ErrInvalidRefreshToken, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokenSuite(t *testing.T) {
+	suite.Run(t, new(RefreshTokenSuite))
+}
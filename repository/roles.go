@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"gorm.io/gorm"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+type Roles interface {
+	Get(name string) (entity.Role, error)
+	List() ([]entity.Role, error)
+	Seed(roles []entity.Role) error
+}
+
+type roles struct {
+	db *gorm.DB
+}
+
+func NewRoles(db *gorm.DB) (Roles, error) {
+	return &roles{db: db}, nil
+}
+
+func (r *roles) Get(name string) (entity.Role, error) {
+	var role entity.Role
+
+	tx := r.db.Where(&entity.Role{Name: name}).First(&role)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return role, ErrRoleNotFound
+		}
+
+		return role, tx.Error
+	}
+
+	return role, nil
+}
+
+func (r *roles) List() ([]entity.Role, error) {
+	var list []entity.Role
+
+	tx := r.db.Order("name").Find(&list)
+
+	return list, tx.Error
+}
+
+// Seed creates the roles that do not exist yet.
+func (r *roles) Seed(roles []entity.Role) error {
+	for _, role := range roles {
+		tx := r.db.Where(&entity.Role{Name: role.Name}).FirstOrCreate(&role)
+		if tx.Error != nil {
+			return tx.Error
+		}
+	}
+
+	return nil
+}
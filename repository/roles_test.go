@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nargesbyt/todo.go/database"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type RoleSuite struct {
+	suite.Suite
+	DB    *gorm.DB
+	mock  sqlmock.Sqlmock
+	roles Roles
+}
+
+func (s *RoleSuite) SetupTest() {
+	var (
+		db  *sql.DB
+		err error
+	)
+	db, s.mock, err = sqlmock.New()
+	s.Require().NoError(err)
+
+	s.DB, err = database.NewPostgres(db)
+	s.Require().NoError(err)
+
+	s.roles, err = NewRoles(s.DB)
+	s.Require().NoError(err)
+}
+
+func (s *RoleSuite) TestGet() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE "roles"."name" = $1 ORDER BY "roles"."id" LIMIT 1`)).
+		WithArgs("viewer").
+		WillReturnRows(s.mock.NewRows([]string{"id", "name", "permissions"}).AddRow(3, "viewer", "tasks:read"))
+
+	role, err := s.roles.Get("viewer")
+	s.Require().NoError(err)
+	s.Assert().True(role.Grants(entity.PermissionTasksRead))
+	s.Assert().False(role.Grants(entity.PermissionTasksWrite))
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *RoleSuite) TestGetNotFound() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE "roles"."name" = $1 ORDER BY "roles"."id" LIMIT 1`)).
+		WithArgs("unknown").
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	_, err := s.roles.Get("unknown")
+	s.Assert().Equal(ErrRoleNotFound, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *RoleSuite) TestSeedKeepsExistingRoles() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "roles" WHERE "roles"."name" = $1 ORDER BY "roles"."id" LIMIT 1`)).
+		WithArgs("admin").
+		WillReturnRows(s.mock.NewRows([]string{"id", "name", "permissions"}).AddRow(1, "admin", "*"))
+
+	err := s.roles.Seed([]entity.Role{{Name: "admin", Permissions: "tasks:read"}})
+	s.Require().NoError(err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func TestRoleSuite(t *testing.T) {
+	suite.Run(t, new(RoleSuite))
+}
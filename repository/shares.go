@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"gorm.io/gorm"
+)
+
+var ErrShareNotFound = errors.New("share not found")
+
+type Shares interface {
+	// Create shares a project with a user, or returns the existing share.
+	Create(ownerId int64, project string, userId int64) (entity.Share, error)
+	// List returns the shares of a project, or of every project of the
+	// owner when project is empty.
+	List(ownerId int64, project string) ([]*entity.Share, error)
+	// SharedWith returns the projects other users shared with userId.
+	SharedWith(userId int64) ([]*entity.Share, error)
+	Get(ownerId int64, project string, userId int64) (entity.Share, error)
+	Delete(ownerId int64, project string, userId int64) error
+}
+
+type shares struct {
+	db *gorm.DB
+}
+
+func NewShares(db *gorm.DB) (Shares, error) {
+	return &shares{db: db}, nil
+}
+
+func (s *shares) Create(ownerId int64, project string, userId int64) (entity.Share, error) {
+	share := entity.Share{OwnerID: ownerId, Project: project, UserID: userId}
+
+	// Conditions are spelled out, as a struct condition would drop an
+	// empty project.
+	tx := s.db.Where("owner_id = ? AND project = ? AND user_id = ?", ownerId, project, userId).FirstOrCreate(&share)
+	if tx.Error != nil {
+		return entity.Share{}, tx.Error
+	}
+
+	return s.Get(ownerId, project, userId)
+}
+
+func (s *shares) List(ownerId int64, project string) ([]*entity.Share, error) {
+	var list []*entity.Share
+
+	tx := s.db.Preload("Owner").Preload("User").Where("owner_id = ?", ownerId)
+	if project != "" {
+		tx = tx.Where("project = ?", project)
+	}
+	tx = tx.Order("id").Find(&list)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return list, nil
+}
+
+func (s *shares) SharedWith(userId int64) ([]*entity.Share, error) {
+	var list []*entity.Share
+
+	tx := s.db.Preload("Owner").Preload("User").Where(&entity.Share{UserID: userId}).Order("id").Find(&list)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return list, nil
+}
+
+func (s *shares) Get(ownerId int64, project string, userId int64) (entity.Share, error) {
+	var share entity.Share
+
+	tx := s.db.Preload("Owner").Preload("User").Where("owner_id = ? AND project = ? AND user_id = ?", ownerId, project, userId).First(&share)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return share, ErrShareNotFound
+		}
+
+		return share, tx.Error
+	}
+
+	return share, nil
+}
+
+func (s *shares) Delete(ownerId int64, project string, userId int64) error {
+	tx := s.db.Where("owner_id = ? AND project = ? AND user_id = ?", ownerId, project, userId).Delete(&entity.Share{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrShareNotFound
+	}
+
+	return nil
+}
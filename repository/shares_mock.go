@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockShareRepository struct {
+	mock.Mock
+}
+
+func (m *MockShareRepository) Create(ownerId int64, project string, userId int64) (entity.Share, error) {
+	args := m.Called(ownerId, project, userId)
+	return args.Get(0).(entity.Share), args.Error(1)
+}
+
+func (m *MockShareRepository) List(ownerId int64, project string) ([]*entity.Share, error) {
+	args := m.Called(ownerId, project)
+	return args.Get(0).([]*entity.Share), args.Error(1)
+}
+
+func (m *MockShareRepository) SharedWith(userId int64) ([]*entity.Share, error) {
+	args := m.Called(userId)
+	return args.Get(0).([]*entity.Share), args.Error(1)
+}
+
+func (m *MockShareRepository) Get(ownerId int64, project string, userId int64) (entity.Share, error) {
+	args := m.Called(ownerId, project, userId)
+	return args.Get(0).(entity.Share), args.Error(1)
+}
+
+func (m *MockShareRepository) Delete(ownerId int64, project string, userId int64) error {
+	args := m.Called(ownerId, project, userId)
+	return args.Error(0)
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nargesbyt/todo.go/database"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type ShareSuite struct {
+	suite.Suite
+	DB     *gorm.DB
+	mock   sqlmock.Sqlmock
+	shares Shares
+}
+
+func (s *ShareSuite) SetupSuite() {
+	var (
+		db  *sql.DB
+		err error
+	)
+	db, s.mock, err = sqlmock.New()
+	s.Require().NoError(err)
+
+	s.DB, err = database.NewPostgres(db)
+	s.Require().NoError(err)
+
+	s.shares, err = NewShares(s.DB)
+	s.Require().NoError(err)
+}
+
+func (s *ShareSuite) TestGetNotFound() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "shares" WHERE owner_id = $1 AND project = $2 AND user_id = $3 ORDER BY "shares"."id" LIMIT 1`)).
+		WithArgs(1, "home", 2).
+		WillReturnError(gorm.ErrRecordNotFound)
+
+	_, err := s.shares.Get(1, "home", 2)
+	s.Assert().Equal(ErrShareNotFound, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *ShareSuite) TestDelete() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "shares" WHERE owner_id = $1 AND project = $2 AND user_id = $3`)).
+		WithArgs(1, "home", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	s.Assert().NoError(s.shares.Delete(1, "home", 2))
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *ShareSuite) TestDeleteNotFound() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "shares" WHERE owner_id = $1 AND project = $2 AND user_id = $3`)).
+		WithArgs(1, "home", 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	s.Assert().Equal(ErrShareNotFound, s.shares.Delete(1, "home", 3))
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *ShareSuite) TestDeleteEmptyProject() {
+	// An empty project is a condition, not a wildcard.
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "shares" WHERE owner_id = $1 AND project = $2 AND user_id = $3`)).
+		WithArgs(1, "", 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	s.Assert().Equal(ErrShareNotFound, s.shares.Delete(1, "", 2))
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *ShareSuite) TestCreate() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "shares" WHERE owner_id = $1 AND project = $2 AND user_id = $3 ORDER BY "shares"."id" LIMIT 1`)).
+		WithArgs(1, "home", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "shares" ("owner_id","project","user_id","created_at") VALUES ($1,$2,$3,$4) RETURNING "id"`)).
+		WithArgs(1, "home", 2, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	s.mock.ExpectCommit()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "shares" WHERE owner_id = $1 AND project = $2 AND user_id = $3 ORDER BY "shares"."id" LIMIT 1`)).
+		WithArgs(1, "home", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "project", "user_id"}).AddRow(5, 1, "home", 2))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(1, "ali"))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(2, "sara"))
+
+	share, err := s.shares.Create(1, "home", 2)
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(5), share.ID)
+	s.Assert().Equal("sara", share.User.Username)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func TestShareSuite(t *testing.T) {
+	suite.Run(t, new(ShareSuite))
+}
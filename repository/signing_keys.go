@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"gorm.io/gorm"
+)
+
+type SigningKeys interface {
+	List() ([]entity.SigningKey, error)
+	Add(keyID string, algorithm string, privateKey string) (entity.SigningKey, error)
+	DeleteBefore(createdAt time.Time) error
+}
+
+type signingKeys struct {
+	db *gorm.DB
+}
+
+func NewSigningKeys(db *gorm.DB) (SigningKeys, error) {
+	return &signingKeys{db: db}, nil
+}
+
+// List returns all keys, newest first.
+func (k *signingKeys) List() ([]entity.SigningKey, error) {
+	var keys []entity.SigningKey
+
+	tx := k.db.Order("created_at DESC, id DESC").Find(&keys)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return keys, nil
+}
+
+func (k *signingKeys) Add(keyID string, algorithm string, privateKey string) (entity.SigningKey, error) {
+	key := entity.SigningKey{
+		KeyID:      keyID,
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+	}
+	if err := k.db.Create(&key).Error; err != nil {
+		return entity.SigningKey{}, err
+	}
+
+	return key, nil
+}
+
+// DeleteBefore removes the keys created before createdAt.
+func (k *signingKeys) DeleteBefore(createdAt time.Time) error {
+	return k.db.Where("created_at < ?", createdAt).Delete(&entity.SigningKey{}).Error
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"gorm.io/gorm"
+)
+
+// DayCount is the number of tasks for a day, formatted YYYY-MM-DD in UTC.
+type DayCount struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+// TagCount is the number of tasks, and of finished ones, with a tag.
+type TagCount struct {
+	Tag      string
+	Total    int64
+	Finished int64
+}
+
+// TaskStats are aggregates over the tasks of a user. The per day counts
+// cover the days since the given time, the other fields all tasks.
+type TaskStats struct {
+	Total     int64
+	Finished  int64
+	Created   []DayCount
+	Completed []DayCount
+	// AverageCycleTime is the mean time between creating and finishing a
+	// task, zero when no task was finished.
+	AverageCycleTime time.Duration
+	// CompletionDays lists every day a task was finished, latest first.
+	CompletionDays []string
+	// Projects and Contexts count tasks per +project and @context tag of
+	// their titles and labels, and Overdue the open tasks due before the
+	// day of now.
+	Projects []TagCount
+	Contexts []TagCount
+	Overdue  int64
+}
+
+// Stats computes the statistics of a user's tasks with aggregate queries,
+// using the date and string functions of the database in use.
+func (t *tasks) Stats(userId int64, since time.Time, now time.Time) (TaskStats, error) {
+	var stats TaskStats
+	dialect := t.db.Dialector.Name()
+	userTasks := func() *gorm.DB { return t.db.Model(&entity.Task{}).Where("user_id = ?", userId) }
+
+	var totals struct {
+		Total    int64
+		Finished int64
+	}
+	tx := userTasks().
+		Select("COUNT(*) AS total, SUM("+finishedCase+") AS finished", entity.FinishedStatuses).
+		Scan(&totals)
+	if tx.Error != nil {
+		return stats, tx.Error
+	}
+	stats.Total, stats.Finished = totals.Total, totals.Finished
+
+	for _, series := range []struct {
+		column string
+		counts *[]DayCount
+	}{{"created_at", &stats.Created}, {"finished_at", &stats.Completed}} {
+		day := dayOf(dialect, series.column)
+		tx = userTasks().
+			Select(day+" AS day, COUNT(*) AS count").
+			Where(series.column+" >= ?", since).
+			Group(day).
+			Order("day").
+			Scan(series.counts)
+		if tx.Error != nil {
+			return stats, tx.Error
+		}
+	}
+
+	var cycle struct{ Seconds *float64 }
+	tx = userTasks().
+		Select(secondsBetween(dialect, "created_at", "finished_at") + " AS seconds").
+		Where("finished_at IS NOT NULL").
+		Scan(&cycle)
+	if tx.Error != nil {
+		return stats, tx.Error
+	}
+	if cycle.Seconds != nil {
+		stats.AverageCycleTime = time.Duration(*cycle.Seconds * float64(time.Second))
+	}
+
+	day := dayOf(dialect, "finished_at")
+	tx = userTasks().
+		Where("finished_at IS NOT NULL").
+		Distinct(day).
+		Order(day+" DESC").
+		Pluck(day, &stats.CompletionDays)
+	if tx.Error != nil {
+		return stats, tx.Error
+	}
+
+	words := taskWords(dialect)
+	var tags []struct {
+		Kind     string
+		Tag      string
+		Total    int64
+		Finished int64
+	}
+	// A tag in both the title and the labels of a task counts once.
+	tx = t.db.Raw(words+` SELECT substr(word, 1, 1) AS kind, substr(word, 2) AS tag,
+		COUNT(DISTINCT id) AS total, COUNT(DISTINCT CASE WHEN finished = 1 THEN id END) AS finished FROM words
+		WHERE word LIKE '+_%' OR word LIKE '@_%' GROUP BY substr(word, 1, 1), substr(word, 2) ORDER BY tag`,
+		entity.FinishedStatuses, userId).
+		Scan(&tags)
+	if tx.Error != nil {
+		return stats, tx.Error
+	}
+	for _, tag := range tags {
+		count := TagCount{Tag: tag.Tag, Total: tag.Total, Finished: tag.Finished}
+		if tag.Kind == "+" {
+			stats.Projects = append(stats.Projects, count)
+		} else {
+			stats.Contexts = append(stats.Contexts, count)
+		}
+	}
+
+	today := now.UTC().Format("2006-01-02")
+	tx = t.db.Raw(words+` SELECT COUNT(*) FROM tasks WHERE user_id = ? AND `+finishedCase+` = 0
+		AND ((due <> '' AND due < ?) OR id IN (SELECT id FROM words WHERE word LIKE 'due:_%' AND substr(word, 5) < ?))`,
+		entity.FinishedStatuses, userId, userId, entity.FinishedStatuses, today, today).
+		Scan(&stats.Overdue)
+	if tx.Error != nil {
+		return stats, tx.Error
+	}
+
+	return stats, nil
+}
+
+// finishedCase is the SQL expression that is 1 for a task with one of the
+// statuses of the argument, in any case, and 0 otherwise, like
+// entity.Finished.
+const finishedCase = "CASE WHEN lower(trim(status)) IN ? THEN 1 ELSE 0 END"
+
+// taskWords returns the common table expression words, with a row of the
+// id, finished case and word of every whitespace separated word of the
+// titles and labels of a user's tasks. Its arguments are the finished statuses and
+// the user id.
+func taskWords(dialect string) string {
+	if dialect == "postgres" {
+		return `WITH words AS (SELECT id, ` + finishedCase + ` AS finished, regexp_split_to_table(title || ' ' || labels, '\s+') AS word FROM tasks WHERE user_id = ?)`
+	}
+
+	// SQLite cannot split a string into rows, so the words are cut off the
+	// rest of the title one by one. The same query works on MySQL 8.
+	spaced := "replace(replace(replace(title || ' ' || labels, char(9), ' '), char(10), ' '), char(13), ' ') || ' '"
+	if dialect == "mysql" {
+		spaced = "CONCAT(REGEXP_REPLACE(CONCAT(title, ' ', labels), '[[:space:]]', ' '), ' ')"
+	}
+
+	return `WITH RECURSIVE rests(id, finished, rest) AS (
+		SELECT id, ` + finishedCase + `, ` + spaced + ` FROM tasks WHERE user_id = ?
+		UNION ALL
+		SELECT id, finished, substr(rest, instr(rest, ' ') + 1) FROM rests WHERE rest <> ''
+	), words AS (SELECT id, finished, substr(rest, 1, instr(rest, ' ') - 1) AS word FROM rests)`
+}
+
+// dayOf returns the SQL expression formatting a time column as YYYY-MM-DD
+// in UTC.
+func dayOf(dialect string, column string) string {
+	switch dialect {
+	case "postgres":
+		// to_char formats a timestamptz in the time zone of the session.
+		return "to_char(" + column + " AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+	case "mysql":
+		return "DATE_FORMAT(" + column + ", '%Y-%m-%d')"
+	default:
+		return "strftime('%Y-%m-%d', " + column + ")"
+	}
+}
+
+// secondsBetween returns the SQL expression averaging the seconds between
+// two time columns.
+func secondsBetween(dialect string, from string, to string) string {
+	switch dialect {
+	case "postgres":
+		return "AVG(EXTRACT(EPOCH FROM (" + to + " - " + from + ")))"
+	case "mysql":
+		return "AVG(TIMESTAMPDIFF(SECOND, " + from + ", " + to + "))"
+	default:
+		return "AVG((julianday(" + to + ") - julianday(" + from + ")) * 86400)"
+	}
+}
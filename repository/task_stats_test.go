@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/nargesbyt/todo.go/database"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStatsSqlite runs the statistics queries on SQLite, whose recursive
+// word splitting can not be checked against a mocked database.
+func TestStatsSqlite(t *testing.T) {
+	db, err := database.NewSqlite("file::memory:")
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// Every connection would open a database of its own.
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.Close()
+	require.NoError(t, database.Migrate(db))
+
+	at := func(day int, hour int) time.Time { return time.Date(2024, 1, day, hour, 0, 0, 0, time.UTC) }
+	finishedAt := func(t time.Time) sql.NullTime { return sql.NullTime{Time: t, Valid: true} }
+	for _, task := range []entity.Task{
+		{Title: "Paint the fence +home", Status: "done", CreatedAt: at(2, 10), FinishedAt: finishedAt(at(3, 10)), Labels: "+home @outside", UserID: 1},
+		{Title: "Write report\t+work", Status: " Done", CreatedAt: at(2, 12), FinishedAt: finishedAt(at(4, 12)), UserID: 1},
+		{Title: "Call mom @phone due:2024-01-04", Status: "pending", CreatedAt: at(3, 9), UserID: 1},
+		{Title: "Pay rent", Status: "pending", CreatedAt: at(4, 9), Due: "2024-01-01", Labels: "+home", UserID: 1},
+		{Title: "Plan trip due:2024-01-10", Status: "pending", CreatedAt: at(4, 18), Due: "2024-01-02", UserID: 1},
+		{Title: "Book flights", Status: "pending", CreatedAt: at(4, 19), Due: "2024-01-09", UserID: 1},
+		{Title: "File taxes", Status: "finished", CreatedAt: time.Date(2023, 11, 30, 8, 0, 0, 0, time.UTC),
+			FinishedAt: finishedAt(time.Date(2023, 12, 1, 8, 0, 0, 0, time.UTC)), Due: "2023-12-01", UserID: 1},
+		{Title: "Someone else's +home due:2020-01-01", Status: "pending", CreatedAt: at(2, 10), UserID: 2},
+	} {
+		require.NoError(t, db.Create(&task).Error)
+	}
+
+	tasks, err := NewTasks(db)
+	require.NoError(t, err)
+	stats, err := tasks.Stats(1, at(1, 0), at(5, 12))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(7), stats.Total)
+	assert.Equal(t, int64(3), stats.Finished)
+	assert.Equal(t, []DayCount{{Day: "2024-01-02", Count: 2}, {Day: "2024-01-03", Count: 1}, {Day: "2024-01-04", Count: 3}}, stats.Created)
+	assert.Equal(t, []DayCount{{Day: "2024-01-03", Count: 1}, {Day: "2024-01-04", Count: 1}}, stats.Completed)
+	assert.Equal(t, 32*time.Hour, stats.AverageCycleTime.Round(time.Second))
+	assert.Equal(t, []string{"2024-01-04", "2024-01-03", "2023-12-01"}, stats.CompletionDays)
+	assert.Equal(t, []TagCount{{Tag: "home", Total: 2, Finished: 1}, {Tag: "work", Total: 1, Finished: 1}}, stats.Projects)
+	assert.Equal(t, []TagCount{{Tag: "outside", Total: 1, Finished: 1}, {Tag: "phone", Total: 1}}, stats.Contexts)
+	// Call mom is overdue by its title, Pay rent and Plan trip by their
+	// due dates.
+	assert.Equal(t, int64(3), stats.Overdue)
+}
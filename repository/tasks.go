@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"database/sql"
 	"errors"
 	"github.com/nargesbyt/todo.go/entity"
 	"gorm.io/gorm"
@@ -9,13 +10,18 @@ import (
 
 var ErrTaskNotFound = errors.New("task not found")
 var ErrUnauthorized = errors.New("permission is denied")
+var ErrVersionConflict = errors.New("resource has been modified")
 
 type Tasks interface {
 	Create(title string, userId int64) (entity.Task, error)
+	CreateImported(task entity.Task, externalId string) (entity.Task, error)
+	CreateFromCalendar(task entity.Task, name string, uid string) (entity.Task, error)
 	Get(id int64) (entity.Task, error)
-	Find(title string, status string, userId int64, page int, limit int) ([]*entity.Task, error)
-	Update(id int64, title string, status string) (entity.Task, error)
-	Delete(id int64) error
+	Find(title string, status string, userId int64, page Page) ([]*entity.Task, PageInfo, error)
+	Update(id int64, title string, status string, version int64) (entity.Task, error)
+	UpdateFields(task entity.Task, version int64) (entity.Task, error)
+	Delete(id int64, version int64) error
+	Stats(userId int64, since time.Time, now time.Time) (TaskStats, error)
 }
 
 type tasks struct {
@@ -38,6 +44,7 @@ func (t *tasks) Create(title string, userId int64) (entity.Task, error) {
 		Status:    "pending",
 		CreatedAt: time.Now(),
 		UserID:    userId,
+		Version:   1,
 		//User:      user,
 	}
 	tx := t.db.Create(&task).Preload("User")
@@ -48,6 +55,69 @@ func (t *tasks) Create(title string, userId int64) (entity.Task, error) {
 
 }
 
+// CreateImported creates a task with the fields it was imported with,
+// created now unless the source knew when. A non-empty externalId is recorded as the id of the task
+// in its source in the same transaction, so a failed import can be
+// retried without duplicating tasks.
+func (t *tasks) CreateImported(task entity.Task, externalId string) (entity.Task, error) {
+	task.ID = 0
+	if task.CreatedAt.IsZero() {
+		task.CreatedAt = time.Now()
+	}
+	task.Version = 1
+	if task.Status == "" {
+		task.Status = "pending"
+	}
+
+	err := t.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&task).Error; err != nil {
+			return err
+		}
+		if externalId == "" {
+			return nil
+		}
+
+		return tx.Create(&entity.ImportedTask{UserID: task.UserID, ExternalID: externalId, TaskID: task.ID}).Error
+	})
+	if err != nil {
+		return entity.Task{}, err
+	}
+
+	return task, nil
+}
+
+// CreateFromCalendar creates a task a CalDAV client sent and maps it to
+// the resource name and UID the client chose in the same transaction, so
+// a failed write leaves neither behind. A stale mapping of the name is
+// replaced.
+func (t *tasks) CreateFromCalendar(task entity.Task, name string, uid string) (entity.Task, error) {
+	task.ID = 0
+	task.CreatedAt = time.Now()
+	task.Version = 1
+	if task.Status == "" {
+		task.Status = "pending"
+	}
+	if entity.Finished(task.Status) && !task.FinishedAt.Valid {
+		task.FinishedAt = sql.NullTime{Time: task.CreatedAt, Valid: true}
+	}
+
+	err := t.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&task).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND name = ?", task.UserID, name).Delete(&entity.CalendarObject{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&entity.CalendarObject{UserID: task.UserID, Name: name, TaskID: task.ID, UID: uid}).Error
+	})
+	if err != nil {
+		return entity.Task{}, err
+	}
+
+	return task, nil
+}
+
 func (t *tasks) Get(id int64) (entity.Task, error) {
 	var task entity.Task
 	tx := t.db.Preload("User").First(&task, id)
@@ -60,33 +130,134 @@ func (t *tasks) Get(id int64) (entity.Task, error) {
 	return task, nil
 }
 
-func (t *tasks) Find(title string, status string, userId int64, page int, limit int) ([]*entity.Task, error) {
-	var tasks []*entity.Task
-	tx := t.db.Preload("User").Where(&entity.Task{Title: title, Status: status, UserID: userId}).Offset((page - 1) * limit).Limit(limit).Find(&tasks)
-	if tx.Error != nil {
-		return tasks, tx.Error
+func (t *tasks) Find(title string, status string, userId int64, page Page) ([]*entity.Task, PageInfo, error) {
+	query := t.db.Model(&entity.Task{}).Preload("User").Where(&entity.Task{Title: title, Status: status, UserID: userId})
 
-	}
-	return tasks, nil
+	return paginate(query, page, func(task *entity.Task) int64 { return task.ID })
 }
 
-func (t *tasks) Update(id int64, title string, status string) (entity.Task, error) {
+// Update changes the title and status of a task. A non-zero version must
+// match the stored one, otherwise ErrVersionConflict is returned. The
+// finish time is set when the status changes to a finished one and
+// cleared when the task is reopened.
+func (t *tasks) Update(id int64, title string, status string, version int64) (entity.Task, error) {
 	task := entity.Task{}
-	t.db.First(&task, id)
+	tx := t.db.First(&task, id)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return task, ErrTaskNotFound
+		}
+		return task, tx.Error
+	}
+	if version != 0 && task.Version != version {
+		return task, ErrVersionConflict
+	}
 
-	tx := t.db.Model(&task).Updates(entity.Task{Title: title, Status: status})
+	tx = t.db.Model(&task).Where("version = ?", task.Version)
+	values := entity.Task{Title: title, Status: status, Version: task.Version + 1}
+	if status != "" && entity.Finished(status) != entity.Finished(task.Status) {
+		if entity.Finished(status) {
+			values.FinishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+		// Selected columns are written even when they hold zero values,
+		// which clears the finish time.
+		columns := []string{"status", "version", "finished_at"}
+		if title != "" {
+			columns = append(columns, "title")
+		}
+		tx = tx.Select(columns)
+	}
+	tx = tx.Updates(values)
 	if tx.Error != nil {
 		return task, tx.Error
 	}
+	if tx.RowsAffected == 0 {
+		return task, ErrVersionConflict
+	}
 
 	return task, nil
 }
 
-func (t *tasks) Delete(id int64) error {
-	tx := t.db.Delete(&entity.Task{}, id)
+// UpdateFields writes the title, status, due date, priority and labels of
+// a task, including empty ones. A non-zero version must match the stored
+// one, otherwise ErrVersionConflict is returned. The finish time changes
+// like in Update.
+func (t *tasks) UpdateFields(task entity.Task, version int64) (entity.Task, error) {
+	current := entity.Task{}
+	tx := t.db.First(&current, task.ID)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return current, ErrTaskNotFound
+		}
+		return current, tx.Error
+	}
+	if version != 0 && current.Version != version {
+		return current, ErrVersionConflict
+	}
+
+	values := entity.Task{
+		Title:      task.Title,
+		Status:     task.Status,
+		Due:        task.Due,
+		Priority:   task.Priority,
+		Labels:     task.Labels,
+		FinishedAt: current.FinishedAt,
+		Version:    current.Version + 1,
+	}
+	if entity.Finished(task.Status) != entity.Finished(current.Status) {
+		values.FinishedAt = sql.NullTime{}
+		if entity.Finished(task.Status) {
+			values.FinishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	tx = t.db.Model(&current).Where("version = ?", current.Version).
+		Select("title", "status", "due", "priority", "labels", "finished_at", "version").
+		Updates(values)
 	if tx.Error != nil {
-		return tx.Error
+		return current, tx.Error
 	}
+	if tx.RowsAffected == 0 {
+		return current, ErrVersionConflict
+	}
+
+	return current, nil
+}
+
+// Delete removes a task and the record of its import, so importing it
+// again creates it anew. A non-zero version must match the stored one,
+// otherwise ErrVersionConflict is returned.
+func (t *tasks) Delete(id int64, version int64) error {
+	return t.db.Transaction(func(tx *gorm.DB) error {
+		query := tx
+		if version != 0 {
+			query = query.Where("version = ?", version)
+		}
+		query = query.Delete(&entity.Task{}, id)
+		if query.Error != nil {
+			return query.Error
+		}
+		if version != 0 && query.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		return tx.Where("task_id = ?", id).Delete(&entity.ImportedTask{}).Error
+	})
+}
 
-	return nil
+// FindAll returns every task matching the filters, walking all pages of
+// Find.
+func FindAll(tasks Tasks, title string, status string, userId int64) ([]*entity.Task, error) {
+	var all []*entity.Task
+	page := Page{Limit: MaxPageLimit}
+	for {
+		batch, info, err := tasks.Find(title, status, userId, page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, batch...)
+		if !info.HasNext {
+			return all, nil
+		}
+		page.After = info.EndID
+	}
 }
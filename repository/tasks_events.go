@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/event"
+	"github.com/rs/zerolog/log"
+)
+
+// publishingTasks notifies a publisher after every successful write to the
+// wrapped tasks repository.
+type publishingTasks struct {
+	Tasks
+	publisher event.Publisher
+}
+
+// NewPublishingTasks wraps tasks so created, updated and deleted tasks are
+// published as events.
+func NewPublishingTasks(tasks Tasks, publisher event.Publisher) Tasks {
+	return &publishingTasks{Tasks: tasks, publisher: publisher}
+}
+
+func (p *publishingTasks) Create(title string, userId int64) (entity.Task, error) {
+	task, err := p.Tasks.Create(title, userId)
+	if err != nil {
+		return task, err
+	}
+	p.publish(event.TaskCreated, task, nil)
+
+	return task, nil
+}
+
+func (p *publishingTasks) CreateImported(task entity.Task, externalId string) (entity.Task, error) {
+	task, err := p.Tasks.CreateImported(task, externalId)
+	if err != nil {
+		return task, err
+	}
+	p.publish(event.TaskCreated, task, nil)
+
+	return task, nil
+}
+
+func (p *publishingTasks) CreateFromCalendar(task entity.Task, name string, uid string) (entity.Task, error) {
+	task, err := p.Tasks.CreateFromCalendar(task, name, uid)
+	if err != nil {
+		return task, err
+	}
+	p.publish(event.TaskCreated, task, nil)
+
+	return task, nil
+}
+
+func (p *publishingTasks) Update(id int64, title string, status string, version int64) (entity.Task, error) {
+	previous, err := p.Tasks.Get(id)
+	if err != nil {
+		return previous, err
+	}
+	task, err := p.Tasks.Update(id, title, status, version)
+	if err != nil {
+		return task, err
+	}
+	p.publish(event.TaskUpdated, task, &previous)
+
+	return task, nil
+}
+
+func (p *publishingTasks) UpdateFields(task entity.Task, version int64) (entity.Task, error) {
+	previous, err := p.Tasks.Get(task.ID)
+	if err != nil {
+		return previous, err
+	}
+	task, err = p.Tasks.UpdateFields(task, version)
+	if err != nil {
+		return task, err
+	}
+	p.publish(event.TaskUpdated, task, &previous)
+
+	return task, nil
+}
+
+func (p *publishingTasks) Delete(id int64, version int64) error {
+	task, err := p.Tasks.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := p.Tasks.Delete(id, version); err != nil {
+		return err
+	}
+	p.publish(event.TaskDeleted, task, nil)
+
+	return nil
+}
+
+func (p *publishingTasks) publish(eventType string, task entity.Task, previous *entity.Task) {
+	task.User = entity.User{}
+	if previous != nil {
+		previous.User = entity.User{}
+	}
+	e := event.Event{
+		Type:     eventType,
+		UserID:   task.UserID,
+		TaskID:   task.ID,
+		Task:     &task,
+		Previous: previous,
+	}
+	if err := p.publisher.Publish(e); err != nil {
+		log.Error().Stack().Err(err).Str("event", eventType).Msg("unable to publish event")
+	}
+}
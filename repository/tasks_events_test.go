@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/nargesbyt/todo.go/internal/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingPublisher struct {
+	events []event.Event
+}
+
+func (r *recordingPublisher) Publish(e event.Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestPublishingTasks(t *testing.T) {
+	t.Run("Create", func(t *testing.T) {
+		inner := new(MockTaskRepository)
+		inner.On("Create", "New task", int64(1)).Return(entity.Task{ID: 3, Title: "New task", UserID: 1, User: entity.User{ID: 1, Password: "hash"}}, nil)
+		publisher := &recordingPublisher{}
+
+		_, err := NewPublishingTasks(inner, publisher).Create("New task", 1)
+		require.NoError(t, err)
+		require.Len(t, publisher.events, 1)
+		assert.Equal(t, event.TaskCreated, publisher.events[0].Type)
+		assert.Equal(t, int64(1), publisher.events[0].UserID)
+		assert.Empty(t, publisher.events[0].Task.User.Password)
+	})
+
+	t.Run("UpdateConflict", func(t *testing.T) {
+		inner := new(MockTaskRepository)
+		inner.On("Get", int64(3)).Return(entity.Task{ID: 3, UserID: 7, Version: 3}, nil)
+		inner.On("Update", int64(3), "", "finished", int64(2)).Return(entity.Task{}, ErrVersionConflict)
+		publisher := &recordingPublisher{}
+
+		_, err := NewPublishingTasks(inner, publisher).Update(3, "", "finished", 2)
+		assert.ErrorIs(t, err, ErrVersionConflict)
+		assert.Empty(t, publisher.events)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		inner := new(MockTaskRepository)
+		inner.On("Get", int64(3)).Return(entity.Task{ID: 3, UserID: 7, Status: "pending"}, nil)
+		inner.On("Update", int64(3), "", "finished", int64(0)).Return(entity.Task{ID: 3, UserID: 7, Status: "finished"}, nil)
+		publisher := &recordingPublisher{}
+
+		_, err := NewPublishingTasks(inner, publisher).Update(3, "", "finished", 0)
+		require.NoError(t, err)
+		require.Len(t, publisher.events, 1)
+		assert.Equal(t, event.TaskUpdated, publisher.events[0].Type)
+		assert.Equal(t, "pending", publisher.events[0].Previous.Status)
+		assert.Equal(t, "finished", publisher.events[0].Task.Status)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		inner := new(MockTaskRepository)
+		inner.On("Get", int64(3)).Return(entity.Task{ID: 3, UserID: 7}, nil)
+		inner.On("Delete", int64(3), int64(0)).Return(nil)
+		publisher := &recordingPublisher{}
+
+		err := NewPublishingTasks(inner, publisher).Delete(3, 0)
+		require.NoError(t, err)
+		require.Len(t, publisher.events, 1)
+		assert.Equal(t, event.TaskDeleted, publisher.events[0].Type)
+		assert.Equal(t, int64(7), publisher.events[0].UserID)
+		assert.Equal(t, int64(3), publisher.events[0].TaskID)
+	})
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/nargesbyt/todo.go/entity"
 	"github.com/stretchr/testify/mock"
 )
@@ -14,22 +16,42 @@ func (m *MockTaskRepository) Create(title string, userId int64) (entity.Task, er
 	return args.Get(0).(entity.Task), args.Error(1)
 }
 
+func (m *MockTaskRepository) CreateImported(task entity.Task, externalId string) (entity.Task, error) {
+	args := m.Called(task, externalId)
+	return args.Get(0).(entity.Task), args.Error(1)
+}
+
+func (m *MockTaskRepository) CreateFromCalendar(task entity.Task, name string, uid string) (entity.Task, error) {
+	args := m.Called(task, name, uid)
+	return args.Get(0).(entity.Task), args.Error(1)
+}
+
 func (m *MockTaskRepository) Get(id int64) (entity.Task, error) {
 	args := m.Called(id)
 	return args.Get(0).(entity.Task), args.Error(1)
 }
 
-func (m *MockTaskRepository) Find(title string, status string, userId int64, page int, limit int) ([]*entity.Task, error) {
-	args := m.Called(title, status, userId, page, limit)
-	return args.Get(0).([]*entity.Task), args.Error(1)
+func (m *MockTaskRepository) Find(title string, status string, userId int64, page Page) ([]*entity.Task, PageInfo, error) {
+	args := m.Called(title, status, userId, page)
+	return args.Get(0).([]*entity.Task), args.Get(1).(PageInfo), args.Error(2)
 }
 
-func (m *MockTaskRepository) Update(id int64, title string, status string) (entity.Task, error) {
-	args := m.Called(id, title, status)
+func (m *MockTaskRepository) Update(id int64, title string, status string, version int64) (entity.Task, error) {
+	args := m.Called(id, title, status, version)
 	return args.Get(0).(entity.Task), args.Error(1)
 }
 
-func (m *MockTaskRepository) Delete(id int64) error {
-	args := m.Called(id)
+func (m *MockTaskRepository) UpdateFields(task entity.Task, version int64) (entity.Task, error) {
+	args := m.Called(task, version)
+	return args.Get(0).(entity.Task), args.Error(1)
+}
+
+func (m *MockTaskRepository) Delete(id int64, version int64) error {
+	args := m.Called(id, version)
 	return args.Error(0)
 }
+
+func (m *MockTaskRepository) Stats(userId int64, since time.Time, now time.Time) (TaskStats, error) {
+	args := m.Called(userId, since, now)
+	return args.Get(0).(TaskStats), args.Error(1)
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"regexp"
 	"testing"
 	"time"
@@ -68,8 +69,8 @@ func (s *TaskSuite) TestCreate() {
 		UserID: 1,
 	}
 	s.mock.ExpectBegin()
-	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tasks" ("title","status","created_at","finished_at","user_id") VALUES ($1,$2,$3,$4,$5) RETURNING "id"`)).
-		WithArgs(expectedTask.Title, expectedTask.Status, sqlmock.AnyArg(), sqlmock.AnyArg(), expectedTask.UserID).
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tasks" ("title","status","created_at","finished_at","due","priority","labels","parent_id","user_id","version") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id"`)).
+		WithArgs(expectedTask.Title, expectedTask.Status, sqlmock.AnyArg(), sqlmock.AnyArg(), "", "", "", nil, expectedTask.UserID, 1).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
 	s.mock.ExpectCommit()
 
@@ -78,17 +79,131 @@ func (s *TaskSuite) TestCreate() {
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
 }
 
+func (s *TaskSuite) TestCreateImported() {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	finishedAt := sql.NullTime{Time: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Valid: true}
+	parentId := sql.NullInt64{Int64: 6, Valid: true}
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tasks" ("title","status","created_at","finished_at","due","priority","labels","parent_id","user_id","version") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id"`)).
+		WithArgs("Imported", "done", createdAt, finishedAt, "2024-01-03", "p1", "+work", parentId, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "imported_tasks" ("user_id","external_id","task_id") VALUES ($1,$2,$3) RETURNING "id"`)).
+		WithArgs(1, "ext-1", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	task, err := s.tasks.CreateImported(entity.Task{
+		Title:      "Imported",
+		Status:     "done",
+		CreatedAt:  createdAt,
+		FinishedAt: finishedAt,
+		Due:        "2024-01-03",
+		Priority:   "p1",
+		Labels:     "+work",
+		ParentID:   parentId,
+		UserID:     1,
+	}, "ext-1")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(7), task.ID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestCreateImportedRollsBack() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tasks"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "imported_tasks"`)).
+		WillReturnError(errors.New("duplicate key"))
+	s.mock.ExpectRollback()
+
+	_, err := s.tasks.CreateImported(entity.Task{Title: "Imported", UserID: 1}, "ext-1")
+	s.Assert().Error(err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestCreateFromCalendar() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tasks" ("title","status","created_at","finished_at","due","priority","labels","parent_id","user_id","version") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id"`)).
+		WithArgs("Pay rent", "done", sqlmock.AnyArg(), sqlmock.AnyArg(), "2024-01-31", "A", "+home", nil, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "calendar_objects" WHERE user_id = $1 AND name = $2`)).
+		WithArgs(1, "abc.ics").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "calendar_objects" ("user_id","name","task_id","uid") VALUES ($1,$2,$3,$4) RETURNING "id"`)).
+		WithArgs(1, "abc.ics", 7, "abc").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	task, err := s.tasks.CreateFromCalendar(entity.Task{Title: "Pay rent", Status: "done", Due: "2024-01-31", Priority: "A", Labels: "+home", UserID: 1}, "abc.ics", "abc")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(7), task.ID)
+	s.Assert().True(task.FinishedAt.Valid)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestCreateFromCalendarRollsBack() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tasks"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "calendar_objects"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "calendar_objects"`)).
+		WillReturnError(errors.New("duplicate key"))
+	s.mock.ExpectRollback()
+
+	_, err := s.tasks.CreateFromCalendar(entity.Task{Title: "Pay rent", UserID: 1}, "abc.ics", "abc")
+	s.Assert().Error(err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
 func (s *TaskSuite) TestFind() {
-	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tasks" WHERE "tasks"."title" = $1 AND "tasks"."status" = $2 AND "tasks"."user_id" = $3 LIMIT 1 OFFSET 2`)).
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) AS total, MAX(id) AS max_id FROM "tasks" WHERE "tasks"."title" = $1 AND "tasks"."status" = $2 AND "tasks"."user_id" = $3`)).
 		WithArgs("New task", "pending", 1).
-		WillReturnRows(sqlmock.NewRows([]string{"title", "status", "created_at", "finished_at", "user_Id"}).
-			AddRow("New task", "pending", nil, nil, 1))
+		WillReturnRows(sqlmock.NewRows([]string{"total", "max_id"}).AddRow(3, 4))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tasks" WHERE "tasks"."title" = $1 AND "tasks"."status" = $2 AND "tasks"."user_id" = $3 AND id > $4 ORDER BY id LIMIT 2`)).
+		WithArgs("New task", "pending", 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "created_at", "finished_at", "user_id"}).
+			AddRow(3, "New task", "pending", nil, nil, 1).
+			AddRow(4, "New task", "pending", nil, nil, 1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}).
+			AddRow(1, "ali", "ali@yahoo.com"))
 
-	_, err := s.tasks.Find("New task", "pending", 1, 3, 1)
+	tasks, info, err := s.tasks.Find("New task", "pending", 1, Page{After: 2, Limit: 1})
 	s.Require().NoError(err)
+	s.Require().Len(tasks, 1)
+	s.Assert().Equal(PageInfo{Total: 3, MaxID: 4, StartID: 3, EndID: 3, HasPrev: true, HasNext: true}, info)
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
 }
 
+func (s *TaskSuite) TestFindBefore() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) AS total, MAX(id) AS max_id FROM "tasks" WHERE "tasks"."user_id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "max_id"}).AddRow(3, 3))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tasks" WHERE "tasks"."user_id" = $1 AND id < $2 ORDER BY id DESC LIMIT 3`)).
+		WithArgs(1, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "created_at", "finished_at", "user_id"}).
+			AddRow(3, "third", "pending", nil, nil, 1).
+			AddRow(2, "second", "pending", nil, nil, 1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}).
+			AddRow(1, "ali", "ali@yahoo.com"))
+
+	tasks, info, err := s.tasks.Find("", "", 1, Page{Before: 4, Limit: 2})
+	s.Require().NoError(err)
+	s.Require().Len(tasks, 2)
+	s.Assert().Equal(int64(2), tasks[0].ID)
+	s.Assert().Equal(PageInfo{Total: 3, MaxID: 3, StartID: 2, EndID: 3, HasPrev: false, HasNext: false}, info)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestFindInvalidPage() {
+	_, _, err := s.tasks.Find("", "", 1, Page{After: 1, Before: 3, Limit: 10})
+	s.Assert().ErrorIs(err, ErrInvalidPage)
+}
+
 func (s *TaskSuite) TestUpdate() {
 	expectedTask := entity.Task{
 		ID:        1,
@@ -98,17 +213,152 @@ func (s *TaskSuite) TestUpdate() {
 	}
 	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tasks" WHERE "tasks"."id" = $1`)).
 		WithArgs(expectedTask.ID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "created_at", "finished_at"}).
-			AddRow(expectedTask.ID, expectedTask.Title, expectedTask.Status, expectedTask.CreatedAt, nil))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "created_at", "finished_at", "version"}).
+			AddRow(expectedTask.ID, expectedTask.Title, expectedTask.Status, expectedTask.CreatedAt, nil, 2))
 	s.mock.ExpectBegin()
-	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tasks" SET "title"=$1,"status"=$2 WHERE "id" = $3`)).
-		WithArgs("updated task", "in progress", expectedTask.ID).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tasks" SET "title"=$1,"status"=$2,"version"=$3 WHERE version = $4 AND "id" = $5`)).
+		WithArgs("updated task", "in progress", 3, 2, expectedTask.ID).WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectCommit()
 
-	task, err := s.tasks.Update(expectedTask.ID, "updated task", "in progress")
+	task, err := s.tasks.Update(expectedTask.ID, "updated task", "in progress", 2)
 	s.Require().NoError(err)
 	s.Assert().Equal("updated task", task.Title)
 	s.Assert().Equal("in progress", task.Status)
+	s.Assert().Equal(int64(3), task.Version)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestUpdateFinished() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tasks" WHERE "tasks"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "finished_at", "version"}).
+			AddRow(1, "New task", "pending", nil, 2))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tasks" SET "title"=$1,"status"=$2,"finished_at"=$3,"version"=$4 WHERE version = $5 AND "id" = $6`)).
+		WithArgs("New task", "done", sqlmock.AnyArg(), 3, 2, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit()
+
+	task, err := s.tasks.Update(1, "New task", "done", 2)
+	s.Require().NoError(err)
+	s.Assert().True(task.FinishedAt.Valid)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestUpdateReopened() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tasks" WHERE "tasks"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "finished_at", "version"}).
+			AddRow(1, "New task", "done", time.Now(), 2))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tasks" SET "title"=$1,"status"=$2,"finished_at"=$3,"version"=$4 WHERE version = $5 AND "id" = $6`)).
+		WithArgs("New task", "pending", nil, 3, 2, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit()
+
+	task, err := s.tasks.Update(1, "New task", "pending", 2)
+	s.Require().NoError(err)
+	s.Assert().False(task.FinishedAt.Valid)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestUpdateVersionConflict() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tasks" WHERE "tasks"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "version"}).
+			AddRow(1, "New task", "pending", 4))
+
+	_, err := s.tasks.Update(1, "updated task", "in progress", 3)
+	s.Assert().ErrorIs(err, ErrVersionConflict)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestUpdateConcurrentWrite() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tasks" WHERE "tasks"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "version"}).
+			AddRow(1, "New task", "pending", 4))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tasks" SET "title"=$1,"status"=$2,"version"=$3 WHERE version = $4 AND "id" = $5`)).
+		WithArgs("updated task", "in progress", 5, 4, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	_, err := s.tasks.Update(1, "updated task", "in progress", 0)
+	s.Assert().ErrorIs(err, ErrVersionConflict)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestUpdateFields() {
+	finishedAt := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tasks" WHERE "tasks"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "finished_at", "due", "priority", "labels", "version"}).
+			AddRow(1, "Pay rent", "done", finishedAt, "2024-01-31", "A", "+home", 2))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tasks" SET "title"=$1,"status"=$2,"finished_at"=$3,"due"=$4,"priority"=$5,"labels"=$6,"version"=$7 WHERE version = $8 AND "id" = $9`)).
+		WithArgs("Pay rent", "finished", finishedAt, "", "", "", 3, 2, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit()
+
+	task, err := s.tasks.UpdateFields(entity.Task{ID: 1, Title: "Pay rent", Status: "finished"}, 2)
+	s.Require().NoError(err)
+	s.Assert().Equal("", task.Due)
+	s.Assert().Equal("", task.Labels)
+	s.Assert().Equal(finishedAt, task.FinishedAt.Time)
+	s.Assert().Equal(int64(3), task.Version)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestUpdateFieldsVersionConflict() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tasks" WHERE "tasks"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "version"}).
+			AddRow(1, "Pay rent", "pending", 4))
+
+	_, err := s.tasks.UpdateFields(entity.Task{ID: 1, Title: "Pay rent"}, 3)
+	s.Assert().ErrorIs(err, ErrVersionConflict)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TaskSuite) TestStats() {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)
+	words := regexp.QuoteMeta(`WITH words AS (SELECT id, CASE WHEN lower(trim(status)) IN ($1,$2,$3) THEN 1 ELSE 0 END AS finished, regexp_split_to_table(title || ' ' || labels, '\s+') AS word FROM tasks WHERE user_id = $4)`)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) AS total, SUM(CASE WHEN lower(trim(status)) IN ($1,$2,$3) THEN 1 ELSE 0 END) AS finished FROM "tasks" WHERE user_id = $4`)).
+		WithArgs("done", "completed", "finished", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "finished"}).AddRow(3, 2))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, COUNT(*) AS count FROM "tasks" WHERE user_id = $1 AND created_at >= $2 GROUP BY to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') ORDER BY day`)).
+		WithArgs(1, since).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "count"}).AddRow("2024-01-02", 3))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_char(finished_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, COUNT(*) AS count FROM "tasks" WHERE user_id = $1 AND finished_at >= $2 GROUP BY to_char(finished_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') ORDER BY day`)).
+		WithArgs(1, since).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "count"}).AddRow("2024-01-03", 2))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT AVG(EXTRACT(EPOCH FROM (finished_at - created_at))) AS seconds FROM "tasks" WHERE user_id = $1 AND finished_at IS NOT NULL`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"seconds"}).AddRow(90.0))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT to_char(finished_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') FROM "tasks" WHERE user_id = $1 AND finished_at IS NOT NULL ORDER BY to_char(finished_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') DESC`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"day"}).AddRow("2024-01-03"))
+	s.mock.ExpectQuery(words+regexp.QuoteMeta(` SELECT substr(word, 1, 1) AS kind, substr(word, 2) AS tag,`)+`\s+`+
+		regexp.QuoteMeta(`COUNT(DISTINCT id) AS total, COUNT(DISTINCT CASE WHEN finished = 1 THEN id END) AS finished FROM words`)+`\s+`+
+		regexp.QuoteMeta(`WHERE word LIKE '+_%' OR word LIKE '@_%' GROUP BY substr(word, 1, 1), substr(word, 2) ORDER BY tag`)).
+		WithArgs("done", "completed", "finished", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "tag", "total", "finished"}).
+			AddRow("@", "home", 1, 0).
+			AddRow("+", "work", 2, 1))
+	s.mock.ExpectQuery(words+regexp.QuoteMeta(` SELECT COUNT(*) FROM tasks WHERE user_id = $5 AND CASE WHEN lower(trim(status)) IN ($6,$7,$8) THEN 1 ELSE 0 END = 0`)+`\s+`+
+		regexp.QuoteMeta(`AND ((due <> '' AND due < $9) OR id IN (SELECT id FROM words WHERE word LIKE 'due:_%' AND substr(word, 5) < $10))`)).
+		WithArgs("done", "completed", "finished", 1, 1, "done", "completed", "finished", "2024-01-05", "2024-01-05").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	stats, err := s.tasks.Stats(1, since, now)
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(3), stats.Total)
+	s.Assert().Equal(int64(2), stats.Finished)
+	s.Assert().Equal([]DayCount{{Day: "2024-01-02", Count: 3}}, stats.Created)
+	s.Assert().Equal([]DayCount{{Day: "2024-01-03", Count: 2}}, stats.Completed)
+	s.Assert().Equal(90*time.Second, stats.AverageCycleTime)
+	s.Assert().Equal([]string{"2024-01-03"}, stats.CompletionDays)
+	s.Assert().Equal([]TagCount{{Tag: "work", Total: 2, Finished: 1}}, stats.Projects)
+	s.Assert().Equal([]TagCount{{Tag: "home", Total: 1}}, stats.Contexts)
+	s.Assert().Equal(int64(1), stats.Overdue)
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
 }
 
@@ -116,13 +366,26 @@ func (s *TaskSuite) TestDelete() {
 	s.mock.ExpectBegin()
 	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "tasks" WHERE "tasks"."id" = $1`)).
 		WithArgs(6).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "imported_tasks" WHERE task_id = $1`)).
+		WithArgs(6).WillReturnResult(sqlmock.NewResult(0, 1))
 	s.mock.ExpectCommit()
 
-	err := s.tasks.Delete(6)
+	err := s.tasks.Delete(6, 0)
 	s.Require().NoError(err)
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
 }
 
+func (s *TaskSuite) TestDeleteVersionConflict() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "tasks" WHERE version = $1 AND "tasks"."id" = $2`)).
+		WithArgs(2, 6).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectRollback()
+
+	err := s.tasks.Delete(6, 2)
+	s.Assert().ErrorIs(err, ErrVersionConflict)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
 func TestTaskSuite(t *testing.T) {
 	suite.Run(t, new(TaskSuite))
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/nargesbyt/todo.go/database"
+	"github.com/nargesbyt/todo.go/entity"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/gorm"
 	"regexp"
@@ -30,18 +31,79 @@ func (s *TokenSuite) SetupSuite() {
 	s.DB, err = database.NewPostgres(db)
 	s.Require().NoError(err)
 
-	s.tokens, err = NewTokens(s.DB)
+	s.tokens, err = NewTokens(s.DB, []byte("key"), true)
 	s.Require().NoError(err)
 }
 
 func (s *TokenSuite) TestAdd() {
 	s.mock.ExpectBegin()
-	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tokens" ("user_id","title","token","issued_at","active","last_used","expired_at") VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING "id"`)).
-		WithArgs(1, "token1", sqlmock.AnyArg(), sqlmock.AnyArg(), 1, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tokens" ("user_id","title","token","lookup_id","issued_at","active","last_used","expired_at","scopes","version") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING "id"`)).
+		WithArgs(1, "token1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 1, sqlmock.AnyArg(), sqlmock.AnyArg(), "tasks:read,tasks:write", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
 	s.mock.ExpectCommit()
 
-	_, err := s.tokens.Add("token1", time.Now(), 1)
+	token, err := s.tokens.Add("token1", time.Now(), []string{"tasks:read", "tasks:write"}, 1)
 	s.Require().NoError(err)
+	s.Assert().Equal([]string{"tasks:read", "tasks:write"}, token.ScopeList())
+	lookupID, secret, ok := entity.ParseToken(token.Token)
+	s.Require().True(ok)
+	s.Assert().Equal(token.LookupID.String, lookupID)
+	s.Assert().NotEmpty(secret)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TokenSuite) TestAuthenticate() {
+	token := entity.Token{}
+	token.HashSecret([]byte("key"), "secret")
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tokens" WHERE lookup_id = $1 ORDER BY "tokens"."id" LIMIT 1`)).
+		WithArgs("abc").
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "token", "lookup_id", "active"}).AddRow(1, 2, token.Token, "abc", 1))
+
+	authenticated, err := s.tokens.Authenticate(2, "todo_pat_abc_secret")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(1), authenticated.ID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TokenSuite) TestAuthenticateWrongSecret() {
+	token := entity.Token{}
+	token.HashSecret([]byte("key"), "secret")
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tokens" WHERE lookup_id = $1 ORDER BY "tokens"."id" LIMIT 1`)).
+		WithArgs("abc").
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "token", "lookup_id", "active"}).AddRow(1, 2, token.Token, "abc", 1))
+
+	_, err := s.tokens.Authenticate(2, "todo_pat_abc_guess")
+	s.Assert().Equal(ErrInvalidToken, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TokenSuite) TestAuthenticateOtherUser() {
+	token := entity.Token{}
+	token.HashSecret([]byte("key"), "secret")
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tokens" WHERE lookup_id = $1 ORDER BY "tokens"."id" LIMIT 1`)).
+		WithArgs("abc").
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "token", "lookup_id", "active"}).AddRow(1, 2, token.Token, "abc", 1))
+
+	_, err := s.tokens.Authenticate(3, "todo_pat_abc_secret")
+	s.Assert().Equal(ErrInvalidToken, err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TokenSuite) TestLookup() {
+	token := entity.Token{}
+	token.HashSecret([]byte("key"), "secret")
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tokens" WHERE lookup_id = $1 ORDER BY "tokens"."id" LIMIT 1`)).
+		WithArgs("abc").
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "token", "lookup_id", "active"}).AddRow(1, 2, token.Token, "abc", 1))
+
+	found, err := s.tokens.Lookup("todo_pat_abc_secret")
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(2), found.UserID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TokenSuite) TestLookupLegacy() {
+	_, err := s.tokens.Lookup("todo_pat_legacy")
+	s.Assert().Equal(ErrInvalidToken, err)
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
 }
 
@@ -51,6 +113,10 @@ func (s *TokenSuite) TestGet() {
 		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "title", "token", "issued_at", "active", "last_used", "expired_at"}).
 			AddRow(1, 1, "token1", "todo_pat_abc", nil, 1, nil, nil))
 
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(s.mock.NewRows([]string{"id", "username", "email"}).AddRow(1, "ali", "ali@gmail.com"))
+
 	_, err := s.tokens.Get(1)
 	s.Require().NoError(err)
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
@@ -68,12 +134,19 @@ func (s *TokenSuite) TestGetTokensByUserID() {
 }
 
 func (s *TokenSuite) TestList() {
-	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tokens" WHERE "tokens"."user_id" = $1 AND "tokens"."title" = $2`)).
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) AS total, MAX(id) AS max_id FROM "tokens" WHERE "tokens"."user_id" = $1 AND "tokens"."title" = $2`)).
+		WithArgs(1, "token1").
+		WillReturnRows(s.mock.NewRows([]string{"total", "max_id"}).AddRow(1, 1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tokens" WHERE "tokens"."user_id" = $1 AND "tokens"."title" = $2 ORDER BY id LIMIT 21`)).
 		WithArgs(1, "token1").
 		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "title", "token", "issued_at", "active", "last_used", "expired_at"}).
 			AddRow(1, 1, "token1", "todo_pat_abc", nil, 1, nil, nil))
 
-	_, err := s.tokens.List("token1", 1)
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(s.mock.NewRows([]string{"id", "username", "email"}).AddRow(1, "ali", "ali@gmail.com"))
+
+	_, _, err := s.tokens.List("token1", 1, Page{Limit: DefaultPageLimit})
 	s.Require().NoError(err)
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
 }
@@ -81,16 +154,28 @@ func (s *TokenSuite) TestList() {
 func (s *TokenSuite) TestUpdate() {
 	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tokens" WHERE "tokens"."id" = $1`)).
 		WithArgs(1).
-		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "title", "token", "issued_at", "active", "last_used", "expired_at"}).
-			AddRow(1, 1, "token1", "todo_pat_abc", nil, 1, nil, nil))
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "title", "token", "issued_at", "active", "last_used", "expired_at", "version"}).
+			AddRow(1, 1, "token1", "todo_pat_abc", nil, 1, nil, nil, 1))
 
 	s.mock.ExpectBegin()
-	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tokens" SET "title"=$1,"active"=$2,"last_used"=$3,"expired_at"=$4 WHERE "id" = $5`)).
-		WithArgs("updated token", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tokens" SET "title"=$1,"active"=$2,"last_used"=$3,"expired_at"=$4,"version"=$5 WHERE version = $6 AND "id" = $7`)).
+		WithArgs("updated token", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), 2, 1, 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectCommit()
 
-	_, err := s.tokens.Update(1, "updated token", time.Now(), time.Now(), 1)
+	_, err := s.tokens.Update(1, "updated token", time.Now(), time.Now(), 1, 0)
+	s.Require().NoError(err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *TokenSuite) TestTouch() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tokens" SET "last_used"=$1 WHERE id = $2`)).
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	err := s.tokens.Touch(1, time.Now())
 	s.Require().NoError(err)
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
 }
@@ -101,7 +186,7 @@ func (s *TokenSuite) TestDelete() {
 		WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectCommit()
 
-	err := s.tokens.Delete(1)
+	err := s.tokens.Delete(1, 0)
 	s.Require().NoError(err)
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
 }
@@ -6,33 +6,51 @@ import (
 	"github.com/nargesbyt/todo.go/entity"
 	"github.com/nargesbyt/todo.go/internal/random"
 	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
 var ErrTokenNotFound = errors.New("token not found")
+var ErrInvalidToken = errors.New("token is invalid")
+
+const (
+	tokenLookupIDLength = 12
+	tokenSecretLength   = 32
+)
 
 type Tokens interface {
-	Add(title string, expiredAt time.Time, userId int64) (entity.Token, error)
+	Add(title string, expiredAt time.Time, scopes []string, userId int64) (entity.Token, error)
 	Get(id int64) (entity.Token, error)
-	List(title string, userId int64) ([]*entity.Token, error)
+	List(title string, userId int64, page Page) ([]*entity.Token, PageInfo, error)
 	GetTokensByUserID(userId int64) ([]*entity.Token, error)
-	Update(id int64, title string, expiresAt time.Time, lastUsed time.Time, active int) (entity.Token, error)
-	Delete(id int64) error
+	Authenticate(userId int64, raw string) (entity.Token, error)
+	Lookup(raw string) (entity.Token, error)
+	Update(id int64, title string, expiresAt time.Time, lastUsed time.Time, active int, version int64) (entity.Token, error)
+	Touch(id int64, lastUsed time.Time) error
+	Delete(id int64, version int64) error
 }
 
 type tokens struct {
 	db *gorm.DB
+	// key is the HMAC key of token secrets.
+	key []byte
+	// legacy enables tokens without a lookup id, which need a bcrypt
+	// comparison against every token of the user.
+	legacy bool
 }
 
-func NewTokens(db *gorm.DB) (Tokens, error) {
-	token := &tokens{db: db}
-	
+func NewTokens(db *gorm.DB, key []byte, legacy bool) (Tokens, error) {
+	token := &tokens{db: db, key: key, legacy: legacy}
+
 	return token, nil
 }
 
-func (t *tokens) Add(title string, expiredAt time.Time, userId int64) (entity.Token, error) {
-	randomToken := "todo_pat_"
-	randomToken += random.Token(32)
+// Add creates a token of the todo_pat_<id>_<secret> format. The returned
+// token holds the raw token, which is not stored.
+func (t *tokens) Add(title string, expiredAt time.Time, scopes []string, userId int64) (entity.Token, error) {
+	lookupID := random.Token(tokenLookupIDLength)
+	secret := random.Token(tokenSecretLength)
+	randomToken := entity.TokenPrefix + lookupID + "_" + secret
 
 	expireTime := sql.NullTime{}
 	err := expireTime.Scan(expiredAt)
@@ -43,16 +61,15 @@ func (t *tokens) Add(title string, expiredAt time.Time, userId int64) (entity.To
 	token := entity.Token{
 		Title:     title,
 		ExpiredAt: expireTime,
-		Token:     randomToken,
+		LookupID:  sql.NullString{String: lookupID, Valid: true},
 		UserID:    userId,
 		Active:    1,
+		Scopes:    strings.Join(scopes, ","),
+		Version:   1,
 		//LastUsed:  expireTime,
 	}
 
-	err = token.HashToken()
-	if err != nil {
-		return entity.Token{}, err
-	}
+	token.HashSecret(t.key, secret)
 
 	tx := t.db.Create(&token)
 	if tx.Error != nil {
@@ -67,7 +84,7 @@ func (t *tokens) Add(title string, expiredAt time.Time, userId int64) (entity.To
 func (t *tokens) Get(id int64) (entity.Token, error) {
 	var token entity.Token
 
-	tx := t.db.First(&token, id)
+	tx := t.db.Preload("User").First(&token, id)
 	if tx.Error != nil {
 		if tx.Error == gorm.ErrRecordNotFound {
 			return token, ErrTokenNotFound
@@ -79,46 +96,101 @@ func (t *tokens) Get(id int64) (entity.Token, error) {
 	return token, nil
 }
 
-func (t *tokens) List(title string, userId int64) ([]*entity.Token, error) {
+func (t *tokens) List(title string, userId int64, page Page) ([]*entity.Token, PageInfo, error) {
+	query := t.db.Model(&entity.Token{}).Preload("User").Where(&entity.Token{Title: title, UserID: userId})
+
+	return paginate(query, page, func(token *entity.Token) int64 { return token.ID })
+}
+
+func (t *tokens) GetTokensByUserID(userId int64) ([]*entity.Token, error) {
 	var tokensList []*entity.Token
-	//var totalRows int64
-	/*tx := t.db.Model(&entity.Task{Title: title, UserID: userId}).Count(&totalRows)
+
+	tx := t.db.Where(&entity.Token{UserID: userId}).Find(&tokensList)
 	if tx.Error != nil {
 		return nil, tx.Error
-	}*/
-	tx := t.db.Where(&entity.Token{Title: title, UserID: userId}).Find(&tokensList)
+	}
+
+	return tokensList, nil
+}
+
+// Authenticate returns the token of a user matching raw. Tokens with a
+// lookup id are found by it and verified with one HMAC; legacy tokens are
+// compared against every token of the user, when enabled.
+func (t *tokens) Authenticate(userId int64, raw string) (entity.Token, error) {
+	if _, _, ok := entity.ParseToken(raw); !ok {
+		return t.authenticateLegacy(userId, raw)
+	}
+
+	token, err := t.Lookup(raw)
+	if err != nil {
+		return token, err
+	}
+	if token.UserID != userId {
+		return entity.Token{}, ErrInvalidToken
+	}
+
+	return token, nil
+}
+
+// Lookup returns the token matching raw without knowing its user, which
+// only works for tokens with a lookup id.
+func (t *tokens) Lookup(raw string) (entity.Token, error) {
+	lookupID, secret, ok := entity.ParseToken(raw)
+	if !ok {
+		return entity.Token{}, ErrInvalidToken
+	}
+
+	var token entity.Token
+	tx := t.db.Where("lookup_id = ?", lookupID).First(&token)
 	if tx.Error != nil {
 		if tx.Error == gorm.ErrRecordNotFound {
-			return nil, ErrTokenNotFound
+			return token, ErrInvalidToken
 		}
-		return nil, tx.Error
+		return token, tx.Error
+	}
+	if !token.VerifySecret(t.key, secret) {
+		return entity.Token{}, ErrInvalidToken
 	}
-	return tokensList, nil
 
+	return token, nil
 }
 
-func (t *tokens) GetTokensByUserID(userId int64) ([]*entity.Token, error) {
-	var tokensList []*entity.Token
+func (t *tokens) authenticateLegacy(userId int64, raw string) (entity.Token, error) {
+	if !t.legacy || !strings.HasPrefix(raw, entity.TokenPrefix) {
+		return entity.Token{}, ErrInvalidToken
+	}
 
-	tx := t.db.Where(&entity.Token{UserID: userId}).Find(&tokensList)
+	var legacy []*entity.Token
+	tx := t.db.Where("user_id = ? AND lookup_id IS NULL", userId).Find(&legacy)
 	if tx.Error != nil {
-		return nil, tx.Error
+		return entity.Token{}, tx.Error
+	}
+	for _, token := range legacy {
+		if token.VerifyToken(raw) == nil {
+			return *token, nil
+		}
 	}
 
-	return tokensList, nil
+	return entity.Token{}, ErrInvalidToken
 }
 
-func (t *tokens) Update(id int64, title string, expiresAt time.Time, lastUsed time.Time, active int) (entity.Token, error) {
-	token, err := t.Get(id)
-	if err != nil {
-		if err == ErrTokenNotFound {
-			return token, err
+// Update changes a token. A non-zero version must match the stored one,
+// otherwise ErrVersionConflict is returned.
+func (t *tokens) Update(id int64, title string, expiresAt time.Time, lastUsed time.Time, active int, version int64) (entity.Token, error) {
+	var token entity.Token
+	tx := t.db.First(&token, id)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return token, ErrTokenNotFound
 		}
-		return token, err
+		return token, tx.Error
+	}
+	if version != 0 && token.Version != version {
+		return token, ErrVersionConflict
 	}
 
 	expireTime := sql.NullTime{}
-	err = expireTime.Scan(expiresAt)
+	err := expireTime.Scan(expiresAt)
 	if err != nil {
 		return token, err
 	}
@@ -134,19 +206,35 @@ func (t *tokens) Update(id int64, title string, expiresAt time.Time, lastUsed ti
 	token.LastUsed = lastUsedTime
 	token.Active = active
 	tx := t.db.Save(&token)*/
-	tx := t.db.Model(&token).Updates(entity.Token{Title: title,ExpiredAt: expireTime,LastUsed: lastUsedTime,Active: active})
+	tx = t.db.Model(&token).Where("version = ?", token.Version).Updates(entity.Token{Title: title, ExpiredAt: expireTime, LastUsed: lastUsedTime, Active: active, Version: token.Version + 1})
 	if tx.Error != nil {
 		return token, tx.Error
 	}
+	if tx.RowsAffected == 0 {
+		return token, ErrVersionConflict
+	}
 
 	return token, nil
 }
 
-func (t *tokens) Delete(id int64) error {
-	tx := t.db.Delete(&entity.Token{}, id)
+// Touch records when a token was last used. It leaves the version alone,
+// so using a token does not change its ETag.
+func (t *tokens) Touch(id int64, lastUsed time.Time) error {
+	return t.db.Model(&entity.Token{}).Where("id = ?", id).Update("last_used", lastUsed).Error
+}
+
+func (t *tokens) Delete(id int64, version int64) error {
+	tx := t.db
+	if version != 0 {
+		tx = tx.Where("version = ?", version)
+	}
+	tx = tx.Delete(&entity.Token{}, id)
 	if tx.Error != nil {
 		return tx.Error
 	}
+	if version != 0 && tx.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
 
 	return nil
 }
@@ -11,12 +11,13 @@ var ErrUserNotFound = errors.New("user not found")
 
 type Users interface {
 	Create(email string, password string, username string) (entity.User, error)
-	GetUsers(email string, username string) ([]*entity.User, error)
+	GetUsers(email string, username string, page Page) ([]*entity.User, PageInfo, error)
 	GetUserByID(userID int64) (entity.User, error)
 	GetUserByUsername(username string) (entity.User, error)
 	GetUserByEmail(email string)(entity.User, error)
-	UpdateUsers(id int64, username string, email string, password string) (entity.User, error)
-	DeleteUsers(id int64) error
+	UpdateUsers(id int64, username string, email string, password string, version int64) (entity.User, error)
+	DeleteUsers(id int64, version int64) error
+	SetRole(id int64, role string, version int64) (entity.User, error)
 	//UpdatePassword( userID string, password string, tokenHash string) error
 }
 
@@ -33,7 +34,9 @@ func (u *users) Create(email string, password string, username string) (entity.U
 		Email:     email,
 		Password:  password,
 		Username:  username,
+		Role:      entity.RoleUser,
 		CreatedAt: time.Now(),
+		Version:   1,
 	}
 	err := user.HashPassword()
 	if err != nil {
@@ -45,17 +48,10 @@ func (u *users) Create(email string, password string, username string) (entity.U
 	}
 	return user, nil
 }
-func (u *users) GetUsers(email string, username string) ([]*entity.User, error) {
-	var user []*entity.User
-	tx := u.db.Preload("Tasks").Where(&entity.User{Email: email, Username: username}).Find(&user)
-	if tx.Error != nil {
-		if tx.Error == gorm.ErrRecordNotFound {
-			return user, ErrUserNotFound
-		}
-		return user, tx.Error
-	}
-	return user, nil
+func (u *users) GetUsers(email string, username string, page Page) ([]*entity.User, PageInfo, error) {
+	query := u.db.Model(&entity.User{}).Preload("Tasks").Where(&entity.User{Email: email, Username: username})
 
+	return paginate(query, page, func(user *entity.User) int64 { return user.ID })
 }
 
 func (u *users) GetUserByID(userID int64) (entity.User, error) {
@@ -91,25 +87,83 @@ func (u *users) GetUserByEmail(email string) (entity.User, error) {
 	}
 	return user, nil
 }
-func (u *users) UpdateUsers(id int64, username string, email string, password string) (entity.User, error) {
+// UpdateUsers changes a user, hashing a new password. A non-zero version
+// must match the stored one, otherwise ErrVersionConflict is returned.
+func (u *users) UpdateUsers(id int64, username string, email string, password string, version int64) (entity.User, error) {
 	user := entity.User{}
-	u.db.First(&user, id)
+	tx := u.db.First(&user, id)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return user, ErrUserNotFound
+		}
+		return user, tx.Error
+	}
+	if version != 0 && user.Version != version {
+		return user, ErrVersionConflict
+	}
 	/*user.Password = password
 	user.Username = username
 	user.Email = email
 	tx := u.db.Save(&user)*/
-	tx := u.db.Model(&user).Updates(entity.User{Username: username, Email: email, Password: password})
+	values := entity.User{Username: username, Email: email, Password: password, Version: user.Version + 1}
+	// Passwords are stored hashed, like in Create; an empty one is left
+	// unchanged.
+	if password != "" {
+		if err := values.HashPassword(); err != nil {
+			return user, err
+		}
+	}
+	tx = u.db.Model(&user).Where("version = ?", user.Version).Updates(values)
 	if tx.Error != nil {
 		return user, tx.Error
 	}
+	if tx.RowsAffected == 0 {
+		return user, ErrVersionConflict
+	}
 	return user, nil
 }
 
-func (u *users) DeleteUsers(id int64) error {
-	tx := u.db.Delete(&entity.User{}, id)
+func (u *users) DeleteUsers(id int64, version int64) error {
+	tx := u.db
+	if version != 0 {
+		tx = tx.Where("version = ?", version)
+	}
+	tx = tx.Delete(&entity.User{}, id)
 	if tx.Error != nil {
 		return tx.Error
 	}
+	if version != 0 && tx.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
 
 	return nil
 }
+
+// SetRole changes the role of a user. A non-zero version must match the
+// stored one, otherwise ErrVersionConflict is returned.
+func (u *users) SetRole(id int64, role string, version int64) (entity.User, error) {
+	user := entity.User{}
+	tx := u.db.First(&user, id)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return user, ErrUserNotFound
+		}
+		return user, tx.Error
+	}
+	if version != 0 && user.Version != version {
+		return user, ErrVersionConflict
+	}
+	if user.Role == role {
+		return user, nil
+	}
+
+	tx = u.db.Model(&user).Where("version = ?", user.Version).Updates(entity.User{Role: role, Version: user.Version + 1})
+	if tx.Error != nil {
+		return user, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return user, ErrVersionConflict
+	}
+
+	return user, nil
+}
@@ -2,12 +2,14 @@ package repository
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/nargesbyt/todo.go/database"
 	"github.com/nargesbyt/todo.go/entity"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"regexp"
 	"testing"
@@ -74,7 +76,10 @@ func (s *UserSuite) TestGetUserByID() {
 }
 
 func (s *UserSuite) TestGetUsers() {
-	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."email" = $1 AND "users"."username" = $2`)).
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) AS total, MAX(id) AS max_id FROM "users" WHERE "users"."email" = $1 AND "users"."username" = $2`)).
+		WithArgs("ali@gmail.com", "ali").
+		WillReturnRows(s.mock.NewRows([]string{"total", "max_id"}).AddRow(1, 1))
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."email" = $1 AND "users"."username" = $2 ORDER BY id LIMIT 21`)).
 		WithArgs("ali@gmail.com", "ali").
 		WillReturnRows(s.mock.NewRows([]string{"id", "username", "email", "created_at", "updated_at"}).
 			AddRow(1, "ali", "ali@gmail.com", time.Now(), nil))
@@ -83,7 +88,7 @@ func (s *UserSuite) TestGetUsers() {
 		WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "created_at", "finished_at", "user_id"}).
 		AddRow(1, "task1", "pending", time.Now(), nil, 1))
 
-	_, err := s.users.GetUsers("ali@gmail.com", "ali")
+	_, _, err := s.users.GetUsers("ali@gmail.com", "ali", Page{Limit: DefaultPageLimit})
 	s.Require().NoError(err)
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
 }
@@ -113,16 +118,59 @@ func (s *UserSuite) TestUpdateUsers() {
 	}
 	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
 		WithArgs(expectedUser.ID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "email", "created_at", "updated_at"}).
-			AddRow(expectedUser.ID, expectedUser.Username, expectedUser.Password, expectedUser.Email, expectedUser.CreatedAt, nil))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "email", "created_at", "updated_at", "version"}).
+			AddRow(expectedUser.ID, expectedUser.Username, expectedUser.Password, expectedUser.Email, expectedUser.CreatedAt, nil, 1))
 
 	s.mock.ExpectBegin()
 	s.mock.ExpectExec(`UPDATE "users" SET .+ WHERE .+`).
-		WithArgs("john@yahoo.com", "abc", "john", sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		WithArgs("john@yahoo.com", passwordHash("abc"), "john", sqlmock.AnyArg(), 2, 1, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit()
+
+	user, err := s.users.UpdateUsers(1, "john", "john@yahoo.com", "abc", 1)
+	s.Require().NoError(err)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+	// The user logs in with the new password.
+	s.Assert().NoError(user.CheckPassword("abc"))
+	s.Assert().Error(user.CheckPassword("123"))
+}
+
+func (s *UserSuite) TestUpdateUsersKeepsPassword() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "email", "version"}).
+			AddRow(1, "ali", "hash", "ali@gmail.com", 1))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "username"=$1,"updated_at"=$2,"version"=$3 WHERE version = $4 AND "id" = $5`)).
+		WithArgs("john", sqlmock.AnyArg(), 2, 1, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit()
+
+	user, err := s.users.UpdateUsers(1, "john", "", "", 1)
+	s.Require().NoError(err)
+	s.Assert().Equal("hash", user.Password)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+// passwordHash matches a bcrypt hash of a password.
+type passwordHash string
+
+func (p passwordHash) Match(v driver.Value) bool {
+	hash, ok := v.(string)
+
+	return ok && bcrypt.CompareHashAndPassword([]byte(hash), []byte(p)) == nil
+}
+
+func (s *UserSuite) TestSetRole() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "version"}).AddRow(1, "ali", "user", 2))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "updated_at"=$1,"role"=$2,"version"=$3 WHERE version = $4 AND "id" = $5`)).
+		WithArgs(sqlmock.AnyArg(), "admin", 3, 2, 1).WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectCommit()
 
-	_, err := s.users.UpdateUsers(1, "john", "john@yahoo.com", "abc")
+	user, err := s.users.SetRole(1, "admin", 2)
 	s.Require().NoError(err)
+	s.Assert().Equal("admin", user.Role)
 	s.Assert().NoError(s.mock.ExpectationsWereMet())
 }
 
@@ -132,7 +180,7 @@ func (s *UserSuite) TestDeleteUsers() {
 		WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectCommit()
 
-	err := s.users.DeleteUsers(1)
+	err := s.users.DeleteUsers(1, 0)
 	s.Require().NoError(err)
 }
 
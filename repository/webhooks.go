@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nargesbyt/todo.go/entity"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+type Webhooks interface {
+	Create(userId int64, url string, events []string, secret string, global int) (entity.Webhook, error)
+	Get(id int64) (entity.Webhook, error)
+	List(userId int64, page Page) ([]*entity.Webhook, PageInfo, error)
+	Update(id int64, url string, events []string, active int, version int64) (entity.Webhook, error)
+	Delete(id int64, version int64) error
+	Subscribed(userId int64, eventType string) ([]*entity.Webhook, error)
+
+	Enqueue(webhookId int64, eventType string, payload []byte) (entity.WebhookDelivery, error)
+	GetDelivery(id int64) (entity.WebhookDelivery, error)
+	Deliveries(webhookId int64, page Page) ([]*entity.WebhookDelivery, PageInfo, error)
+	Due(now time.Time, limit int) ([]*entity.WebhookDelivery, error)
+	Claim(delivery entity.WebhookDelivery, until time.Time) (bool, error)
+	RecordAttempt(delivery entity.WebhookDelivery, attempt entity.WebhookAttempt) error
+}
+
+type webhooks struct {
+	db *gorm.DB
+}
+
+func NewWebhooks(db *gorm.DB) (Webhooks, error) {
+	return &webhooks{db: db}, nil
+}
+
+func (w *webhooks) Create(userId int64, url string, events []string, secret string, global int) (entity.Webhook, error) {
+	webhook := entity.Webhook{
+		UserID:  userId,
+		URL:     url,
+		Events:  strings.Join(events, ","),
+		Secret:  secret,
+		Active:  1,
+		Global:  global,
+		Version: 1,
+	}
+
+	tx := w.db.Create(&webhook)
+	if tx.Error != nil {
+		return entity.Webhook{}, tx.Error
+	}
+
+	return webhook, nil
+}
+
+func (w *webhooks) Get(id int64) (entity.Webhook, error) {
+	var webhook entity.Webhook
+
+	tx := w.db.First(&webhook, id)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return webhook, ErrWebhookNotFound
+		}
+
+		return webhook, tx.Error
+	}
+
+	return webhook, nil
+}
+
+func (w *webhooks) List(userId int64, page Page) ([]*entity.Webhook, PageInfo, error) {
+	query := w.db.Model(&entity.Webhook{}).Where(&entity.Webhook{UserID: userId})
+
+	return paginate(query, page, func(webhook *entity.Webhook) int64 { return webhook.ID })
+}
+
+// Update changes a webhook. A non-zero version must match the stored one,
+// otherwise ErrVersionConflict is returned.
+func (w *webhooks) Update(id int64, url string, events []string, active int, version int64) (entity.Webhook, error) {
+	webhook, err := w.Get(id)
+	if err != nil {
+		return webhook, err
+	}
+	if version != 0 && webhook.Version != version {
+		return webhook, ErrVersionConflict
+	}
+
+	tx := w.db.Model(&webhook).Where("version = ?", webhook.Version).Updates(map[string]interface{}{
+		"url":     url,
+		"events":  strings.Join(events, ","),
+		"active":  active,
+		"version": webhook.Version + 1,
+	})
+	if tx.Error != nil {
+		return webhook, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return webhook, ErrVersionConflict
+	}
+
+	webhook.URL = url
+	webhook.Events = strings.Join(events, ",")
+	webhook.Active = active
+	webhook.Version++
+
+	return webhook, nil
+}
+
+func (w *webhooks) Delete(id int64, version int64) error {
+	tx := w.db
+	if version != 0 {
+		tx = tx.Where("version = ?", version)
+	}
+	tx = tx.Delete(&entity.Webhook{}, id)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if version != 0 && tx.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// Subscribed returns the active webhooks of a user, and the global ones,
+// that receive events of eventType.
+func (w *webhooks) Subscribed(userId int64, eventType string) ([]*entity.Webhook, error) {
+	var all []*entity.Webhook
+
+	tx := w.db.Where("active = ? AND (user_id = ? OR global = ?)", 1, userId, 1).Find(&all)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var subscribed []*entity.Webhook
+	for _, webhook := range all {
+		if webhook.Subscribed(eventType) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+
+	return subscribed, nil
+}
+
+// Enqueue stores a delivery that is due immediately.
+func (w *webhooks) Enqueue(webhookId int64, eventType string, payload []byte) (entity.WebhookDelivery, error) {
+	delivery := entity.WebhookDelivery{
+		WebhookID:     webhookId,
+		Event:         eventType,
+		Payload:       payload,
+		Status:        entity.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+
+	tx := w.db.Omit("Webhook").Create(&delivery)
+	if tx.Error != nil {
+		return entity.WebhookDelivery{}, tx.Error
+	}
+
+	return delivery, nil
+}
+
+func (w *webhooks) GetDelivery(id int64) (entity.WebhookDelivery, error) {
+	var delivery entity.WebhookDelivery
+
+	tx := w.db.Preload("AttemptLog").First(&delivery, id)
+	if tx.Error != nil {
+		if tx.Error == gorm.ErrRecordNotFound {
+			return delivery, ErrDeliveryNotFound
+		}
+
+		return delivery, tx.Error
+	}
+
+	return delivery, nil
+}
+
+func (w *webhooks) Deliveries(webhookId int64, page Page) ([]*entity.WebhookDelivery, PageInfo, error) {
+	query := w.db.Model(&entity.WebhookDelivery{}).Where(&entity.WebhookDelivery{WebhookID: webhookId})
+
+	return paginate(query, page, func(delivery *entity.WebhookDelivery) int64 { return delivery.ID })
+}
+
+// Due returns pending deliveries whose next attempt is not after now,
+// oldest first.
+func (w *webhooks) Due(now time.Time, limit int) ([]*entity.WebhookDelivery, error) {
+	var deliveries []*entity.WebhookDelivery
+
+	tx := w.db.Preload("Webhook").
+		Where("status = ? AND next_attempt_at <= ?", entity.DeliveryPending, now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&deliveries)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return deliveries, nil
+}
+
+// Claim postpones the next attempt of a due delivery to until, so no other
+// worker picks it up meanwhile. It reports false when another worker
+// claimed it first.
+func (w *webhooks) Claim(delivery entity.WebhookDelivery, until time.Time) (bool, error) {
+	tx := w.db.Model(&entity.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, entity.DeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", until)
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
+
+// RecordAttempt stores an attempt and the resulting state of its delivery.
+func (w *webhooks) RecordAttempt(delivery entity.WebhookDelivery, attempt entity.WebhookAttempt) error {
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		attempt.DeliveryID = delivery.ID
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&entity.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+			"status":          delivery.Status,
+			"attempts":        delivery.Attempts,
+			"response_code":   delivery.ResponseCode,
+			"last_error":      delivery.LastError,
+			"next_attempt_at": delivery.NextAttemptAt,
+			"delivered_at":    delivery.DeliveredAt,
+		}).Error
+	})
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nargesbyt/todo.go/database"
+	"github.com/nargesbyt/todo.go/entity"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type WebhookSuite struct {
+	suite.Suite
+	DB       *gorm.DB
+	mock     sqlmock.Sqlmock
+	webhooks Webhooks
+}
+
+func (s *WebhookSuite) SetupSuite() {
+	var (
+		db  *sql.DB
+		err error
+	)
+	db, s.mock, err = sqlmock.New()
+	s.Require().NoError(err)
+
+	s.DB, err = database.NewPostgres(db)
+	s.Require().NoError(err)
+
+	s.webhooks, err = NewWebhooks(s.DB)
+	s.Require().NoError(err)
+}
+
+func (s *WebhookSuite) TestCreate() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "webhooks" ("user_id","url","events","secret","active","global","created_at","version") VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING "id"`)).
+		WithArgs(1, "https://example.com/hook", "task.created,task.deleted", "secret", 1, 0, sqlmock.AnyArg(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	s.mock.ExpectCommit()
+
+	webhook, err := s.webhooks.Create(1, "https://example.com/hook", []string{"task.created", "task.deleted"}, "secret", 0)
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(1), webhook.ID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *WebhookSuite) TestSubscribed() {
+	s.mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "webhooks" WHERE active = $1 AND (user_id = $2 OR global = $3)`)).
+		WithArgs(1, 1, 1).
+		WillReturnRows(s.mock.NewRows([]string{"id", "user_id", "url", "events", "active", "global"}).
+			AddRow(1, 1, "https://example.com/a", "task.created", 1, 0).
+			AddRow(2, 2, "https://example.com/b", "*", 1, 1).
+			AddRow(3, 1, "https://example.com/c", "task.deleted", 1, 0))
+
+	webhooks, err := s.webhooks.Subscribed(1, "task.created")
+	s.Require().NoError(err)
+	s.Require().Len(webhooks, 2)
+	s.Assert().Equal(int64(1), webhooks[0].ID)
+	s.Assert().Equal(int64(2), webhooks[1].ID)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *WebhookSuite) TestClaim() {
+	due := time.Now()
+	until := due.Add(time.Minute)
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(regexp.QuoteMeta(`UPDATE "webhook_deliveries" SET "next_attempt_at"=$1 WHERE id = $2 AND status = $3 AND next_attempt_at = $4`)).
+		WithArgs(until, 1, entity.DeliveryPending, due).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	claimed, err := s.webhooks.Claim(entity.WebhookDelivery{ID: 1, NextAttemptAt: due}, until)
+	s.Require().NoError(err)
+	s.Assert().False(claimed)
+	s.Assert().NoError(s.mock.ExpectationsWereMet())
+}
+
+func TestWebhookSuite(t *testing.T) {
+	suite.Run(t, new(WebhookSuite))
+}